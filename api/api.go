@@ -1,29 +1,48 @@
 package main
 
 import (
+	"context"
 	"encoding/json"
 	"flag"
 	"fmt"
+	"net"
 	"net/http"
 	"os"
 	"runtime/pprof"
+	"strings"
+	"time"
 
 	"github.com/ngaut/log"
 
 	"strconv"
 
-	"github.com/gogo/protobuf/proto"
+	"github.com/kabergstrom/site/apiclient"
 	"github.com/kabergstrom/site/db"
+	"github.com/kabergstrom/site/lifecycle"
+	"github.com/kabergstrom/site/monitor"
 	"github.com/kabergstrom/site/protocol"
+	"github.com/kabergstrom/site/search"
 	"github.com/labstack/echo"
 	mw "github.com/labstack/echo/middleware"
+	"github.com/nats-io/go-nats-streaming"
 	"github.com/pkg/errors"
-	"github.com/rainycape/memcache"
+	"golang.org/x/net/websocket"
+	"google.golang.org/grpc"
 )
 
 type apiCtx struct {
-	mcObj     *memcache.Client
-	mcListing *memcache.Client
+	objects     db.ObjectStore
+	listings    db.ListingStore
+	history     db.HistoryStore
+	versions    db.VersionStore
+	search      *search.Index
+	stream      *streamHub
+	users       sourceIDLookup
+	submissions db.SubmissionStore
+	authorCache *authorCache
+	cacheMaxAge time.Duration
+	// siteBaseURL base URL of links in feeds. Taken from the request when empty
+	siteBaseURL string
 }
 
 type author struct {
@@ -40,6 +59,12 @@ type object struct {
 	UnixTime int32  `json:"created"`
 }
 
+type revision struct {
+	Version  int         `json:"version"`
+	Replaced int64       `json:"replaced"`
+	Object   interface{} `json:"object"`
+}
+
 type user struct {
 	object
 	Name  string `json:"name"`
@@ -89,6 +114,21 @@ func apiObjectType(t protocol.ObjectType) (string, error) {
 	}
 }
 
+// parseObjectType parse an object type name as returned by apiObjectType
+func parseObjectType(name string) (protocol.ObjectType, error) {
+	for t := protocol.LinkPost; t <= protocol.User; t++ {
+		if typeStr, err := apiObjectType(t); err == nil && typeStr == name {
+			return t, nil
+		}
+	}
+	return 0, fmt.Errorf("Unknown type %s", name)
+}
+
+var sourceIDs = map[string]protocol.SourceID{
+	"site":       protocol.Site,
+	"hackernews": protocol.HackerNews,
+}
+
 func getAuthor(obj db.Object) int64 {
 	switch obj.Type {
 	case protocol.LinkPost:
@@ -165,45 +205,152 @@ func dbObjectToAPIObject(obj db.Object, userMap map[int64]author) (retVal interf
 }
 
 func (api *apiCtx) hydrateAuthors(authors map[int64]author) error {
-	authorsToGet := make([]string, len(authors))
-	i := 0
-	for val := range authors {
-		authorsToGet[i] = strconv.FormatInt(val, 10)
-		i++
+	authorsToGet := make([]int64, 0, len(authors))
+	for id := range authors {
+		if cached, ok := api.authorCache.get(id); ok {
+			authors[id] = cached
+			continue
+		}
+		authorsToGet = append(authorsToGet, id)
+	}
+	if len(authorsToGet) == 0 {
+		return nil
 	}
-	/*items, err := api.mcObj.GetMulti(authorsToGet)
+	objects, err := api.objects.GetObjects(authorsToGet)
 	if err != nil {
 		return errors.Wrapf(err, "Failed to get authors")
-	}*/
-	items := make(map[string]*memcache.Item, len(authors))
-	for id := range authors {
-		key := strconv.FormatInt(id, 10)
-		item, err := api.mcObj.Get(key)
-		if err != nil {
-			if err.Error() == "memcache: cache miss" {
-				log.Infof("Author with id %s not in db", key)
-				continue
-			}
-			return errors.Wrapf(err, "Failed to get item %s", key)
-		}
-		items[key] = item
 	}
-	for key, item := range items {
-		obj, err := db.ParseMemCacheObj(item.Value)
-		if err != nil {
-			return errors.Wrapf(err, "Failed to parse object for id %s"+key)
+	for _, id := range authorsToGet {
+		obj, ok := objects[id]
+		if !ok {
+			log.Infof("Author with id %d not in db", id)
+			continue
 		}
 		user := obj.Data.(*db.User)
-		authors[obj.ID] = author{Name: user.Name, ID: strconv.FormatInt(obj.ID, 10)}
+		a := author{Name: user.Name, ID: strconv.FormatInt(obj.ID, 10)}
+		authors[obj.ID] = a
+		api.authorCache.add(obj.ID, a)
 	}
 	return nil
 }
 
+// objectAuthors get the authors of objects, keyed by author object ID
+func (api *apiCtx) objectAuthors(objects []db.Object) (map[int64]author, error) {
+	authors := make(map[int64]author, len(objects))
+	for _, obj := range objects {
+		if objAuthor := getAuthor(obj); objAuthor != 0 {
+			authors[objAuthor] = author{}
+		}
+	}
+	if err := api.hydrateAuthors(authors); err != nil {
+		return nil, err
+	}
+	return authors, nil
+}
+
+// missingObjectError an object of a listing that could not be found
+type missingObjectError int64
+
+func (e missingObjectError) Error() string {
+	return fmt.Sprintf("Could not find %d", int64(e))
+}
+
+// listingPage the IDs of the objects from start to end of a listing
+func listingPage(listing db.Listing, start int, end int) []int64 {
+	if len(listing.Objects) < start {
+		start = len(listing.Objects)
+	}
+	if len(listing.Objects) < end {
+		end = len(listing.Objects)
+	}
+	if end < start {
+		end = start
+	}
+	return listing.Objects[start:end]
+}
+
+// getPage get the objects of a listing page in order
+func (a *apiCtx) getPage(ids []int64) ([]db.Object, error) {
+	dbObjects := make([]db.Object, len(ids))
+	items, err := a.objects.GetObjects(ids)
+	if err != nil {
+		return nil, err
+	}
+	for i, val := range ids {
+		obj, ok := items[val]
+		if !ok {
+			return nil, missingObjectError(val)
+		}
+		dbObjects[i] = obj
+	}
+	return dbObjects, nil
+}
+
+// listingHandler serve a page of a listing as JSON, or as a feed if format or the Accept header asks for one
+func (a *apiCtx) listingHandler(listingID int, name string, format feedFormat) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		start := 0
+		str := c.QueryParam("start")
+		if str != "" {
+			var err error
+			start, err = strconv.Atoi(str)
+			if err != nil || start < 0 {
+				return c.String(http.StatusBadRequest, "Could not parse start parameter")
+			}
+		}
+		end := start + 30
+		str = c.QueryParam("count")
+		if str != "" {
+			count, err := strconv.Atoi(str)
+			if err != nil || count < 0 {
+				return c.String(http.StatusBadRequest, "Could not parse count parameter")
+			}
+			if count > 100 {
+				return c.String(http.StatusBadRequest, "Max 100 items per request")
+			}
+			end = start + count
+		}
+		format := negotiate(c, format)
+		// versions are read before the data they belong to, so a concurrent write can only make the ETag older than the response
+		listingVersion := 0
+		if a.versions != nil {
+			var err error
+			if listingVersion, err = a.versions.GetListingVersion(listingID); err != nil && err != db.ErrNotFound {
+				log.Error(err)
+				return c.String(http.StatusInternalServerError, "Internal server error")
+			}
+		}
+		listing, err := a.listings.GetListing(listingID)
+		if err != nil {
+			log.Error(err)
+			return c.String(http.StatusInternalServerError, "Internal server error")
+		}
+		ids := listingPage(listing, start, end)
+		etag, err := a.listingETag(listingID, listingVersion, ids, format)
+		if err != nil {
+			log.Error(err)
+			return c.String(http.StatusInternalServerError, "Internal server error")
+		}
+		if a.notModified(c, etag) {
+			return c.NoContent(http.StatusNotModified)
+		}
+
+		dbObjects, err := a.getPage(ids)
+		if missing, ok := err.(missingObjectError); ok {
+			return c.String(http.StatusNotFound, missing.Error())
+		}
+		if err != nil {
+			log.Error(err)
+			return c.String(http.StatusInternalServerError, "Internal server error")
+		}
+		return a.serveObjects(c, format, feedInfo{title: "site: " + name, path: "/" + name}, dbObjects)
+	}
+}
+
+// maxBulkIDs max number of IDs of a POST /object/bulk request
+const maxBulkIDs = 100
+
 func addEndpoints(e *echo.Echo, a *apiCtx) {
-	e.GET("/exit", func(c echo.Context) error {
-		e.Close()
-		return nil
-	})
 	e.POST("/object/bulk", func(c echo.Context) error {
 		type bulkObjectRequest struct {
 			IDs []string `json:"ids"`
@@ -216,12 +363,18 @@ func addEndpoints(e *echo.Echo, a *apiCtx) {
 		if len(req.IDs) == 0 {
 			return c.String(http.StatusBadRequest, "No ids supplied")
 		}
-		for _, id := range req.IDs {
-			if _, err := strconv.ParseInt(id, 10, 64); err != nil {
+		if len(req.IDs) > maxBulkIDs {
+			return c.String(http.StatusBadRequest, fmt.Sprintf("Max %d ids per request", maxBulkIDs))
+		}
+		ids := make([]int64, len(req.IDs))
+		for i, id := range req.IDs {
+			parsed, err := strconv.ParseInt(id, 10, 64)
+			if err != nil {
 				return c.String(http.StatusBadRequest, fmt.Sprintf("Invalid id %s", id))
 			}
+			ids[i] = parsed
 		}
-		items, err := a.mcObj.GetMulti(req.IDs)
+		items, err := a.objects.GetObjects(ids)
 		if err != nil {
 			log.Error(err)
 			return c.String(http.StatusInternalServerError, fmt.Sprintf("Error getting ids %+v", req))
@@ -230,12 +383,7 @@ func addEndpoints(e *echo.Echo, a *apiCtx) {
 		authors := make(map[int64]author, len(items))
 		{
 			i := 0
-			for key, item := range items {
-				obj, err := db.ParseMemCacheObj(item.Value)
-				if err != nil {
-					log.Error(err)
-					return c.String(http.StatusInternalServerError, fmt.Sprintf("Error parsing object for id %s", key))
-				}
+			for _, obj := range items {
 				objAuthor := getAuthor(obj)
 				if objAuthor != 0 {
 					authors[objAuthor] = author{}
@@ -264,136 +412,249 @@ func addEndpoints(e *echo.Echo, a *apiCtx) {
 			log.Error(err)
 			return c.String(http.StatusInternalServerError, fmt.Sprintf("Error marshalling items for ids %+v", req))
 		}
-		return c.String(http.StatusOK, string(json))
+		return c.JSONBlob(http.StatusOK, json)
 	})
-	e.GET("/hot", func(c echo.Context) error {
-		start := 0
-		str := c.QueryParam("start")
-		if str != "" {
-			var err error
-			start, err = strconv.Atoi(str)
+	e.GET("/openapi.json", func(c echo.Context) error {
+		spec, err := apiclient.GetSwagger()
+		if err != nil {
+			log.Error(err)
+			return c.String(http.StatusInternalServerError, "Internal server error")
+		}
+		return c.JSON(http.StatusOK, spec)
+	})
+	e.GET("/hot", a.listingHandler(db.ListingHot, "hot", formatJSON))
+	e.GET("/hot.rss", a.listingHandler(db.ListingHot, "hot", formatRSS))
+	e.GET("/hot.atom", a.listingHandler(db.ListingHot, "hot", formatAtom))
+	e.GET("/new", a.listingHandler(db.ListingNew, "new", formatJSON))
+	e.GET("/new.rss", a.listingHandler(db.ListingNew, "new", formatRSS))
+	e.GET("/new.atom", a.listingHandler(db.ListingNew, "new", formatAtom))
+	e.GET("/user/:name/submissions", a.submissionsHandler(formatJSON))
+	e.GET("/user/:name/submissions.rss", a.submissionsHandler(formatRSS))
+	e.GET("/user/:name/submissions.atom", a.submissionsHandler(formatAtom))
+	e.GET("/object/:id/comments", a.commentsHandler(formatJSON))
+	e.GET("/object/:id/comments.rss", a.commentsHandler(formatRSS))
+	e.GET("/object/:id/comments.atom", a.commentsHandler(formatAtom))
+	e.GET("/object/:id", func(c echo.Context) error {
+		str := c.Param("id")
+		id, err := strconv.ParseInt(str, 10, 64)
+		if err != nil {
+			return c.String(http.StatusBadRequest, "Invalid id")
+		}
+		etag := ""
+		if a.versions != nil {
+			versions, err := a.versions.GetObjectVersions([]int64{id})
 			if err != nil {
+				log.Error(err)
+				return c.String(http.StatusInternalServerError, fmt.Sprintf("Error getting id %s", str))
+			}
+			if version, ok := versions[id]; ok {
+				etag = objectETag(id, version)
+			}
+		}
+		if a.notModified(c, etag) {
+			return c.NoContent(http.StatusNotModified)
+		}
+		obj, err := a.objects.GetObject(id)
+		if err == db.ErrNotFound {
+			return c.String(http.StatusNotFound, fmt.Sprintf("Could not find %s", str))
+		}
+		if err != nil {
+			log.Error(err)
+			return c.String(http.StatusInternalServerError, fmt.Sprintf("Error getting id %s", str))
+		}
+		authors := make(map[int64]author, 1)
+		objAuthor := getAuthor(obj)
+		if objAuthor != 0 {
+			authors[objAuthor] = author{}
+		}
+		if err = a.hydrateAuthors(authors); err != nil {
+			log.Error(err)
+			return c.String(http.StatusInternalServerError, fmt.Sprintf("Internal server error"))
+		}
+		apiObj, err := dbObjectToAPIObject(obj, authors)
+		if err != nil {
+			log.Error(err)
+			return c.String(http.StatusInternalServerError, fmt.Sprintf("Error converting object for id %s", str))
+		}
+		a.setCacheControl(c)
+		if c.QueryParam("pretty") != "" {
+			return c.JSONPretty(200, apiObj, "  ")
+		}
+		return c.JSON(200, apiObj)
+	})
+	e.GET("/stream/hot", func(c echo.Context) error {
+		if a.stream == nil {
+			return c.String(http.StatusNotImplemented, "Live updates are not available")
+		}
+		return a.stream.serveSSE(c, streamFilter{hot: true})
+	})
+	e.GET("/stream/thread/:id", func(c echo.Context) error {
+		if a.stream == nil {
+			return c.String(http.StatusNotImplemented, "Live updates are not available")
+		}
+		f, err := parseStreamFilter("", c.Param("id"), "")
+		if err != nil {
+			return c.String(http.StatusBadRequest, "Invalid id")
+		}
+		return a.stream.serveSSE(c, f)
+	})
+	e.GET("/stream/user/:id", func(c echo.Context) error {
+		if a.stream == nil {
+			return c.String(http.StatusNotImplemented, "Live updates are not available")
+		}
+		f, err := parseStreamFilter("", "", c.Param("id"))
+		if err != nil {
+			return c.String(http.StatusBadRequest, "Invalid id")
+		}
+		return a.stream.serveSSE(c, f)
+	})
+	e.GET("/stream/ws", func(c echo.Context) error {
+		if a.stream == nil {
+			return c.String(http.StatusNotImplemented, "Live updates are not available")
+		}
+		server := websocket.Server{Handler: a.stream.serveWebSocket, Handshake: checkWebSocketOrigin(a.siteBaseURL)}
+		server.ServeHTTP(c.Response(), c.Request())
+		return nil
+	})
+	e.GET("/search", func(c echo.Context) error {
+		if a.search == nil {
+			return c.String(http.StatusNotImplemented, "Search is not available")
+		}
+		q := search.Query{Text: c.QueryParam("q"), Size: 30}
+		if q.Text == "" {
+			return c.String(http.StatusBadRequest, "No query supplied")
+		}
+		var err error
+		if str := c.QueryParam("type"); str != "" {
+			if q.Type, err = parseObjectType(str); err != nil || !search.Indexed(q.Type) {
+				return c.String(http.StatusBadRequest, "Could not parse type parameter")
+			}
+		}
+		if str := c.QueryParam("source"); str != "" {
+			source, ok := sourceIDs[str]
+			if !ok {
+				return c.String(http.StatusBadRequest, "Could not parse source parameter")
+			}
+			q.Source = source
+		}
+		if q.Sort, err = search.ParseSort(c.QueryParam("sort")); err != nil {
+			return c.String(http.StatusBadRequest, "Could not parse sort parameter")
+		}
+		if str := c.QueryParam("start"); str != "" {
+			if q.From, err = strconv.Atoi(str); err != nil || q.From < 0 {
 				return c.String(http.StatusBadRequest, "Could not parse start parameter")
 			}
 		}
-		end := start + 30
-		str = c.QueryParam("count")
-		if str != "" {
-			count, err := strconv.Atoi(str)
-			if err != nil {
+		if str := c.QueryParam("count"); str != "" {
+			if q.Size, err = strconv.Atoi(str); err != nil || q.Size < 0 {
 				return c.String(http.StatusBadRequest, "Could not parse count parameter")
 			}
-			if count > 100 {
+			if q.Size > 100 {
 				return c.String(http.StatusBadRequest, "Max 100 items per request")
 			}
-			end = start + count
 		}
 
-		listingItem, err := a.mcListing.Get(strconv.Itoa(db.ListingHot))
+		result, err := a.search.Search(q)
 		if err != nil {
 			log.Error(err)
 			return c.String(http.StatusInternalServerError, "Internal server error")
 		}
-		var listing db.Listing
-		if err := proto.Unmarshal(listingItem.Value, &listing); err != nil {
+		items, err := a.objects.GetObjects(result.IDs)
+		if err != nil {
 			log.Error(err)
 			return c.String(http.StatusInternalServerError, "Internal server error")
 		}
-		if len(listing.Objects) < start {
-			end = start
-		} else if len(listing.Objects) < end {
-			end = len(listing.Objects) - 1
-		}
-		authors := make(map[int64]author, end-start)
-		dbObjects := make([]db.Object, end-start)
-		for i, val := range listing.Objects[start:end] {
-			item, err := a.mcObj.Get(strconv.FormatInt(val, 10))
-			if err != nil {
-				log.Error(err)
-				return c.String(http.StatusNotFound, fmt.Sprintf("Could not find %d", val))
-			}
-			obj, err := db.ParseMemCacheObj(item.Value)
-			if err != nil {
-				log.Error(err)
-				return c.String(http.StatusInternalServerError, fmt.Sprintf("Error parsing object with id %d", val))
-			}
+		authors := make(map[int64]author, len(items))
+		for _, obj := range items {
 			objAuthor := getAuthor(obj)
 			if objAuthor != 0 {
 				authors[objAuthor] = author{}
 			}
-
-			dbObjects[i] = obj
 		}
 		if err = a.hydrateAuthors(authors); err != nil {
 			log.Error(err)
 			return c.String(http.StatusInternalServerError, "Internal server error")
 		}
 
-		var values []interface{}
-		for _, obj := range dbObjects {
+		type searchResult struct {
+			Total   uint64        `json:"total"`
+			Objects []interface{} `json:"objects"`
+		}
+		values := searchResult{Total: result.Total, Objects: []interface{}{}}
+		for _, id := range result.IDs {
+			// the index can be ahead of a memcache read
+			obj, ok := items[id]
+			if !ok {
+				continue
+			}
 			apiObj, err := dbObjectToAPIObject(obj, authors)
 			if err != nil {
-				log.Error(err)
-				return c.String(http.StatusInternalServerError, fmt.Sprintf("Error converting object for id %d", obj.ID))
+				// indexed before the index was limited to the types the api serves
+				log.Warnf("Skipping search hit %d: %s", obj.ID, err)
+				continue
 			}
-			values = append(values, apiObj)
+			values.Objects = append(values.Objects, apiObj)
 		}
-
 		if c.QueryParam("pretty") != "" {
 			return c.JSONPretty(200, values, "  ")
 		}
 		return c.JSON(200, values)
 	})
-	e.GET("/object/:id", func(c echo.Context) error {
+	e.GET("/object/:id/history", func(c echo.Context) error {
+		if a.history == nil {
+			return c.String(http.StatusNotImplemented, "Object history is not available")
+		}
 		str := c.Param("id")
-		_, err := strconv.ParseInt(str, 10, 64)
+		id, err := strconv.ParseInt(str, 10, 64)
 		if err != nil {
 			return c.String(http.StatusBadRequest, "Invalid id")
 		}
-		item, err := a.mcObj.Get(str)
+		obj, err := a.objects.GetObject(id)
+		if err == db.ErrNotFound {
+			return c.String(http.StatusNotFound, fmt.Sprintf("Could not find %s", str))
+		}
 		if err != nil {
 			log.Error(err)
-			return c.String(http.StatusNotFound, fmt.Sprintf("Could not find %s", str))
+			return c.String(http.StatusInternalServerError, fmt.Sprintf("Error getting id %s", str))
 		}
-		obj, err := db.ParseMemCacheObj(item.Value)
+		revisions, err := a.history.GetObjectHistory(id)
 		if err != nil {
 			log.Error(err)
-			return c.String(http.StatusInternalServerError, fmt.Sprintf("Error parsing id %s", str))
+			return c.String(http.StatusInternalServerError, fmt.Sprintf("Error getting history of id %s", str))
 		}
-		authors := make(map[int64]author, 1)
-		objAuthor := getAuthor(obj)
-		if objAuthor != 0 {
-			authors[objAuthor] = author{}
+		// revisions are rendered as the current object with the data it had at the time
+		dbObjects := make([]db.Object, len(revisions))
+		authors := make(map[int64]author)
+		for i, r := range revisions {
+			dbObjects[i] = obj
+			dbObjects[i].Data = r.Data
+			objAuthor := getAuthor(dbObjects[i])
+			if objAuthor != 0 {
+				authors[objAuthor] = author{}
+			}
 		}
 		if err = a.hydrateAuthors(authors); err != nil {
 			log.Error(err)
-			return c.String(http.StatusInternalServerError, fmt.Sprintf("Internal server error"))
+			return c.String(http.StatusInternalServerError, "Internal server error")
 		}
-		apiObj, err := dbObjectToAPIObject(obj, authors)
-		if err != nil {
-			log.Error(err)
-			return c.String(http.StatusInternalServerError, fmt.Sprintf("Error converting object for id %s", str))
+		values := make([]revision, len(revisions))
+		for i, r := range revisions {
+			apiObj, err := dbObjectToAPIObject(dbObjects[i], authors)
+			if err != nil {
+				log.Error(err)
+				return c.String(http.StatusInternalServerError, fmt.Sprintf("Error converting revision %d of id %s", r.Version, str))
+			}
+			values[i] = revision{Version: r.Version, Replaced: r.ReplacedAt, Object: apiObj}
 		}
 		if c.QueryParam("pretty") != "" {
-			return c.JSONPretty(200, apiObj, "  ")
+			return c.JSONPretty(200, values, "  ")
 		}
-		return c.JSON(200, apiObj)
+		return c.JSON(200, values)
 	})
 }
 
 var cpuprofile = flag.String("cpuprofile", "", "write cpu profile to file")
 
-func openMemcachedView(url string, viewName string) (*memcache.Client, error) {
-	mc, err := memcache.New(url)
-	if err != nil {
-		return nil, err
-	}
-	if _, err := mc.Get("@@" + viewName); err != nil {
-		return nil, err
-	}
-	return mc, err
-}
-
 func main() {
 	flag.Parse()
 	if *cpuprofile != "" {
@@ -408,27 +669,264 @@ func main() {
 		defer pprof.StopCPUProfile()
 	}
 	log.SetFlags(log.LstdFlags | log.Lshortfile)
-	memcacheAddr := os.Getenv("API_MEMCACHE_ADDRESS")
-	mcObj, err := openMemcachedView(memcacheAddr, "object_data")
+	backend := os.Getenv("API_STORE_BACKEND")
+	storeAddr := os.Getenv("API_MEMCACHE_ADDRESS")
+	if backend == db.BackendSQL {
+		storeAddr = os.Getenv("API_MYSQL_DATA_SOURCE_NAME")
+	}
+	store, err := db.OpenStore(backend, storeAddr)
 	if err != nil {
-		log.Fatalf("Failed to connect to MySQL memcache plugin on %s : %s", memcacheAddr, err)
+		log.Fatalf("Failed to open %s store: %s", backend, err)
 	}
-	mcListing, err := openMemcachedView(memcacheAddr, "listing_data")
+	mon := monitor.NewServer()
+	if p, ok := store.(db.Pinger); ok {
+		mon.AddCheck("store", p.Ping)
+	}
+	if mc, ok := store.(*db.MemcacheStore); ok {
+		if multiGetSize, err := strconv.Atoi(os.Getenv("API_MEMCACHE_MULTIGET_SIZE")); err == nil {
+			mc.MultiGetSize = multiGetSize
+		}
+	}
+
+	authorCacheSize, err := strconv.Atoi(os.Getenv("API_AUTHOR_CACHE_SIZE"))
 	if err != nil {
-		log.Fatalf("Failed to connect to MySQL memcache plugin on %s : %s", memcacheAddr, err)
+		authorCacheSize = 10000
+	}
+	authorCacheTTL, err := time.ParseDuration(os.Getenv("API_AUTHOR_CACHE_TTL"))
+	if err != nil {
+		authorCacheTTL = time.Second * 30
+	}
+
+	cacheMaxAge, err := time.ParseDuration(os.Getenv("API_CACHE_MAX_AGE"))
+	if err != nil {
+		cacheMaxAge = time.Second * 10
+	}
+	versions, _ := store.(db.VersionStore)
+	if mc, ok := store.(*db.MemcacheStore); ok && !mc.HasVersions() {
+		// responses are sent without ETags until dbtool migrate up adds the version containers
+		versions = nil
+	}
+
+	history, _ := store.(db.HistoryStore)
+	users, _ := store.(sourceIDLookup)
+	submissions, _ := store.(db.SubmissionStore)
+	keys, _ := store.(db.APIKeyStore)
+	var sqlStore *db.Database
+	if dsn := os.Getenv("API_MYSQL_DATA_SOURCE_NAME"); history == nil && dsn != "" {
+		// the memcache views do not serve object_history, source ID mappings, submissions and api keys
+		sqlStore, err = db.OpenSQL(dsn)
+		if err != nil {
+			log.Fatalf("Failed to open sql store: %s", err)
+		}
+		history, users, submissions, keys = sqlStore, sqlStore, sqlStore, sqlStore
+		mon.AddCheck("mysql", sqlStore.Ping)
+	}
+
+	lc := lifecycle.New()
+	var nc stan.Conn
+	clientID := os.Getenv("API_NATS_CLIENT_ID")
+	if clientID == "" {
+		clientID = "api"
+	}
+	if clusterID := os.Getenv("NATS_CLUSTER_ID"); clusterID != "" {
+		nc = connectNATS(clusterID, clientID)
+		mon.AddCheck("nats", monitor.NATSConnected(nc.NatsConn()))
+	}
+
+	var index *search.Index
+	if indexPath := os.Getenv("API_SEARCH_INDEX_PATH"); indexPath != "" {
+		if nc == nil {
+			log.Fatal("API_SEARCH_INDEX_PATH requires NATS_CLUSTER_ID")
+		}
+		index, err = search.Open(indexPath)
+		if err != nil {
+			log.Fatal(err)
+		}
+		lc.Go("Search indexer", func(ctx context.Context) error {
+			// every api instance has its own index, so the durable name is the NATS client ID
+			return search.NewIndexer(nc, store, index).Run(ctx, clientID)
+		})
 	}
 
 	api := apiCtx{
-		mcObj:     mcObj,
-		mcListing: mcListing,
+		objects:     store,
+		listings:    store,
+		history:     history,
+		versions:    versions,
+		search:      index,
+		users:       users,
+		submissions: submissions,
+		siteBaseURL: strings.TrimSuffix(os.Getenv("API_SITE_URL"), "/"),
+		authorCache: newAuthorCache(authorCacheSize, authorCacheTTL),
+		cacheMaxAge: cacheMaxAge,
+	}
+	if nc != nil {
+		api.stream = newStreamHub(&api)
+		lc.Go("Stream hub", func(ctx context.Context) error {
+			return api.stream.Run(ctx, nc)
+		})
+	}
+
+	costs, err := parseRateLimitCosts(os.Getenv("API_RATE_LIMIT_COSTS"))
+	if err != nil {
+		log.Fatalf("Invalid API_RATE_LIMIT_COSTS: %s", err)
+	}
+	proxies, err := parseTrustedProxies(os.Getenv("API_TRUSTED_PROXIES"))
+	if err != nil {
+		log.Fatalf("Invalid API_TRUSTED_PROXIES: %s", err)
+	}
+	keyCacheTTL, err := time.ParseDuration(os.Getenv("API_KEY_CACHE_TTL"))
+	if err != nil {
+		keyCacheTTL = time.Minute
+	}
+
+	graphQLMaxDepth, err := strconv.Atoi(os.Getenv("API_GRAPHQL_MAX_DEPTH"))
+	if err != nil {
+		graphQLMaxDepth = DefaultGraphQLMaxDepth
+	}
+	graphQLMaxComplexity, err := strconv.Atoi(os.Getenv("API_GRAPHQL_MAX_COMPLEXITY"))
+	if err != nil {
+		graphQLMaxComplexity = DefaultGraphQLMaxComplexity
+	}
+	schema, err := newGraphQLSchema(&api)
+	if err != nil {
+		log.Fatalf("Error creating GraphQL schema: %s", err)
+	}
+
+	limiter := newRateLimiter(
+		rateLimit{rate: envFloat("API_RATE_LIMIT_IP_RATE", 10), burst: envFloat("API_RATE_LIMIT_IP_BURST", 100)},
+		rateLimit{rate: envFloat("API_RATE_LIMIT_KEY_RATE", 50), burst: envFloat("API_RATE_LIMIT_KEY_BURST", 500)},
+		costs, keys, keyCacheTTL)
+	limiter.proxies = proxies
+	if syncInterval, err := time.ParseDuration(os.Getenv("API_RATE_LIMIT_SYNC_INTERVAL")); err == nil {
+		if nc == nil {
+			log.Fatal("API_RATE_LIMIT_SYNC_INTERVAL requires NATS_CLUSTER_ID")
+		}
+		lc.Go("Rate limit sharing", func(ctx context.Context) error {
+			return limiter.share(ctx, nc.NatsConn(), clientID, syncInterval)
+		})
 	}
 
 	e := echo.New()
 
 	e.Use(mw.Logger())
+	e.Use(instrument())
 	e.Use(mw.Recover())
+	e.Use(limiter.middleware())
+	e.Use(compress())
 	addEndpoints(e, &api)
+	e.POST("/graphql", api.graphQLHandler(schema, graphQLMaxDepth, graphQLMaxComplexity))
 	serverHost := os.Getenv("API_SERVER_HOST")
 	serverPort := os.Getenv("API_SERVER_PORT")
-	e.Logger.Fatal(e.Start(fmt.Sprintf("%s:%s", serverHost, serverPort)))
+	lc.Go("Monitoring", func(ctx context.Context) error {
+		return mon.Serve(ctx, monitor.Addr(serverHost, "API_MONITOR_PORT", monitor.APIPort))
+	})
+	var grpcServer *grpc.Server
+	if grpcPort := os.Getenv("API_GRPC_PORT"); grpcPort != "" {
+		lis, err := net.Listen("tcp", fmt.Sprintf("%s:%s", serverHost, grpcPort))
+		if err != nil {
+			log.Fatalf("Failed to listen for gRPC: %s", err)
+		}
+		grpcServer = newGRPCServer(&api, limiter)
+		go func() {
+			if err := grpcServer.Serve(lis); err != nil {
+				lc.Fail(errors.Wrap(err, "Error serving gRPC"))
+			}
+		}()
+	}
+	go func() {
+		if err := e.Start(fmt.Sprintf("%s:%s", serverHost, serverPort)); err != http.ErrServerClosed {
+			lc.Fail(errors.Wrap(err, "Error serving HTTP"))
+		}
+	}()
+
+	<-lc.Done()
+	// the stream hub drops its clients when it stops, so the streams do not hold up the shutdown
+	ctx, cancel := context.WithTimeout(context.Background(), lifecycle.DefaultTimeout)
+	defer cancel()
+	if err := e.Shutdown(ctx); err != nil {
+		log.Errorf("Error shutting down HTTP server: %s", err)
+	}
+	if grpcServer != nil {
+		stopped := make(chan struct{})
+		go func() {
+			grpcServer.GracefulStop()
+			close(stopped)
+		}()
+		select {
+		case <-stopped:
+		case <-ctx.Done():
+			grpcServer.Stop()
+		}
+	}
+	lc.Wait(lifecycle.DefaultTimeout)
+	if index != nil {
+		if err := index.Close(); err != nil {
+			log.Errorf("Error closing search index: %s", err)
+		}
+	}
+	if nc != nil {
+		if err := nc.Close(); err != nil {
+			log.Errorf("Error closing nats-streaming connection: %s", err)
+		}
+	}
+	if err := db.Close(store); err != nil {
+		log.Errorf("Error closing store: %s", err)
+	}
+	if sqlStore != nil {
+		if err := sqlStore.Close(); err != nil {
+			log.Errorf("Error closing sql store: %s", err)
+		}
+	}
+	if *cpuprofile != "" {
+		pprof.StopCPUProfile()
+	}
+	lc.Exit()
+}
+
+// instrument record the latency of every request by route in the http_request_duration_seconds histogram
+func instrument() echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			start := time.Now()
+			err := next(c)
+			status := c.Response().Status
+			if he, ok := err.(*echo.HTTPError); ok {
+				status = he.Code
+			} else if err != nil {
+				status = http.StatusInternalServerError
+			}
+			route := c.Path()
+			if route == "" {
+				// requests that matched no route are counted together
+				route = "unmatched"
+			}
+			monitor.HTTPRequest(c.Request().Method, route, status, start)
+			return err
+		}
+	}
+}
+
+// envFloat the number in environment variable name, or def if it is not set or invalid
+func envFloat(name string, def float64) float64 {
+	value, err := strconv.ParseFloat(os.Getenv(name), 64)
+	if err != nil {
+		return def
+	}
+	return value
+}
+
+// connectNATS connect to the NATS Streaming cluster used for search and live updates
+func connectNATS(clusterID string, clientID string) stan.Conn {
+	natsURL := os.Getenv("NATS_URL")
+	if natsURL == "" {
+		natsURL = stan.DefaultNatsURL
+	}
+	log.Infof("Connecting to nats server %s", natsURL)
+	nc, err := stan.Connect(clusterID, clientID, stan.NatsURL(natsURL))
+	if err != nil {
+		log.Fatalf("Error connecting to nats-streaming server: %s", err)
+	}
+	log.Infof("Connected to nats-streaming. url = %s id = %s ", nc.NatsConn().ConnectedUrl(), nc.NatsConn().ConnectedServerId())
+	return nc
 }
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"container/list"
+	"sync"
+	"time"
+)
+
+// authorCache is a size-bounded LRU of hydrated authors shared by all requests.
+// Entries expire after ttl so renamed users are picked up reasonably quickly.
+type authorCache struct {
+	mu      sync.Mutex
+	size    int
+	ttl     time.Duration
+	ll      *list.List
+	entries map[int64]*list.Element
+}
+
+type authorCacheEntry struct {
+	id      int64
+	author  author
+	expires time.Time
+}
+
+func newAuthorCache(size int, ttl time.Duration) *authorCache {
+	if size < 0 {
+		size = 0
+	}
+	return &authorCache{
+		size:    size,
+		ttl:     ttl,
+		ll:      list.New(),
+		entries: make(map[int64]*list.Element, size),
+	}
+}
+
+func (c *authorCache) get(id int64) (author, bool) {
+	if c.size <= 0 {
+		return author{}, false
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	el, ok := c.entries[id]
+	if !ok {
+		return author{}, false
+	}
+	entry := el.Value.(*authorCacheEntry)
+	if time.Now().After(entry.expires) {
+		c.ll.Remove(el)
+		delete(c.entries, id)
+		return author{}, false
+	}
+	c.ll.MoveToFront(el)
+	return entry.author, true
+}
+
+func (c *authorCache) add(id int64, a author) {
+	if c.size <= 0 {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	expires := time.Now().Add(c.ttl)
+	if el, ok := c.entries[id]; ok {
+		entry := el.Value.(*authorCacheEntry)
+		entry.author = a
+		entry.expires = expires
+		c.ll.MoveToFront(el)
+		return
+	}
+	c.entries[id] = c.ll.PushFront(&authorCacheEntry{id: id, author: a, expires: expires})
+	for c.ll.Len() > c.size {
+		oldest := c.ll.Back()
+		c.ll.Remove(oldest)
+		delete(c.entries, oldest.Value.(*authorCacheEntry).id)
+	}
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestAuthorCache(t *testing.T) {
+	c := newAuthorCache(2, time.Minute)
+	c.add(1, author{ID: "1", Name: "alice"})
+	c.add(2, author{ID: "2", Name: "bob"})
+	// a get makes 1 the most recently used, so 2 is evicted by 3
+	if a, ok := c.get(1); !ok || a.Name != "alice" {
+		t.Errorf("Got %+v, %t", a, ok)
+	}
+	c.add(3, author{ID: "3", Name: "carol"})
+	if _, ok := c.get(2); ok {
+		t.Error("Least recently used author was not evicted")
+	}
+	for _, id := range []int64{1, 3} {
+		if _, ok := c.get(id); !ok {
+			t.Errorf("Author %d was evicted", id)
+		}
+	}
+	c.add(3, author{ID: "3", Name: "dave"})
+	if a, _ := c.get(3); a.Name != "dave" {
+		t.Errorf("Updated author is %+v", a)
+	}
+	if len(c.entries) != 2 || c.ll.Len() != 2 {
+		t.Errorf("Cache holds %d entries in a list of %d", len(c.entries), c.ll.Len())
+	}
+}
+
+func TestAuthorCacheExpiry(t *testing.T) {
+	c := newAuthorCache(2, -time.Second)
+	c.add(1, author{ID: "1", Name: "alice"})
+	if _, ok := c.get(1); ok {
+		t.Error("Got an expired author")
+	}
+	if len(c.entries) != 0 || c.ll.Len() != 0 {
+		t.Error("Expired author was not removed")
+	}
+}
+
+func TestAuthorCacheDisabled(t *testing.T) {
+	for _, size := range []int{0, -1} {
+		c := newAuthorCache(size, time.Minute)
+		c.add(1, author{ID: "1", Name: "alice"})
+		if _, ok := c.get(1); ok {
+			t.Errorf("Cache of size %d returned an author", size)
+		}
+	}
+}
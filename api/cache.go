@@ -0,0 +1,187 @@
+package main
+
+import (
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/andybalholm/brotli"
+	"github.com/labstack/echo"
+	"github.com/ngaut/log"
+)
+
+// objectETag weak ETag of an object version
+func objectETag(objID int64, version int) string {
+	return fmt.Sprintf(`W/"%d-%d"`, objID, version)
+}
+
+// listingETag weak ETag of a listing page in format, derived from the listing version and the
+// versions of the objects on the page. Empty if the store has no versions
+func (a *apiCtx) listingETag(listingID int, listingVersion int, ids []int64, format feedFormat) (string, error) {
+	if a.versions == nil {
+		return "", nil
+	}
+	versions, err := a.versions.GetObjectVersions(ids)
+	if err != nil {
+		return "", err
+	}
+	h := sha256.New()
+	fmt.Fprintf(h, "%d-%d-%d", listingID, listingVersion, format)
+	for _, id := range ids {
+		fmt.Fprintf(h, ",%d-%d", id, versions[id])
+	}
+	return `W/"` + hex.EncodeToString(h.Sum(nil)[:16]) + `"`, nil
+}
+
+// etagMatches weak comparison of etag with the ETags of an If-None-Match header
+func etagMatches(ifNoneMatch string, etag string) bool {
+	if ifNoneMatch == "" || etag == "" {
+		return false
+	}
+	etag = strings.TrimPrefix(etag, "W/")
+	for _, tag := range strings.Split(ifNoneMatch, ",") {
+		tag = strings.TrimSpace(tag)
+		if tag == "*" || strings.TrimPrefix(tag, "W/") == etag {
+			return true
+		}
+	}
+	return false
+}
+
+// setCacheControl allow clients and proxies to cache a response for cacheMaxAge
+func (a *apiCtx) setCacheControl(c echo.Context) {
+	c.Response().Header().Set("Cache-Control", fmt.Sprintf("public, max-age=%d", int(a.cacheMaxAge.Seconds())))
+}
+
+// notModified set the ETag header of a response, if etag is not empty, and whether the request
+// has an If-None-Match header matching it. The caller then responds with 304 Not Modified
+func (a *apiCtx) notModified(c echo.Context, etag string) bool {
+	if etag == "" {
+		return false
+	}
+	c.Response().Header().Set("ETag", etag)
+	if !etagMatches(c.Request().Header.Get("If-None-Match"), etag) {
+		return false
+	}
+	a.setCacheControl(c)
+	return true
+}
+
+// encoder a compressing writer that can be reused
+type encoder interface {
+	io.WriteCloser
+	Flush() error
+	Reset(w io.Writer)
+}
+
+var encoders = map[string]*sync.Pool{
+	"br":   {New: func() interface{} { return brotli.NewWriter(ioutil.Discard) }},
+	"gzip": {New: func() interface{} { return gzip.NewWriter(ioutil.Discard) }},
+}
+
+// negotiateEncoding the content coding an Accept-Encoding header prefers, br or gzip. brotli wins
+// ties. Empty if neither is acceptable
+func negotiateEncoding(acceptEncoding string) string {
+	best, bestQ := "", 0.0
+	for _, coding := range strings.Split(acceptEncoding, ",") {
+		name, params, err := mime.ParseMediaType(strings.TrimSpace(coding))
+		if err != nil {
+			continue
+		}
+		if _, ok := encoders[name]; !ok {
+			continue
+		}
+		q := 1.0
+		if str, ok := params["q"]; ok {
+			if q, err = strconv.ParseFloat(str, 64); err != nil {
+				continue
+			}
+		}
+		if q > bestQ || (q > 0 && q == bestQ && name == "br") {
+			best, bestQ = name, q
+		}
+	}
+	return best
+}
+
+// compressWriter compresses the body of a response. Responses without a body or with a
+// Content-Encoding of their own are passed through
+type compressWriter struct {
+	http.ResponseWriter
+	encoding string
+	encoder  encoder
+}
+
+func (w *compressWriter) WriteHeader(code int) {
+	header := w.Header()
+	if code != http.StatusNoContent && code != http.StatusNotModified && header.Get(echo.HeaderContentEncoding) == "" {
+		header.Set(echo.HeaderContentEncoding, w.encoding)
+		header.Del(echo.HeaderContentLength)
+		w.encoder = encoders[w.encoding].Get().(encoder)
+		w.encoder.Reset(w.ResponseWriter)
+	}
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *compressWriter) Write(b []byte) (int, error) {
+	if w.encoder == nil {
+		return w.ResponseWriter.Write(b)
+	}
+	return w.encoder.Write(b)
+}
+
+func (w *compressWriter) Flush() {
+	if w.encoder != nil {
+		w.encoder.Flush()
+	}
+	if flusher, ok := w.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+// Close write the end of the compressed body
+func (w *compressWriter) Close() error {
+	if w.encoder == nil {
+		return nil
+	}
+	err := w.encoder.Close()
+	w.encoder.Reset(ioutil.Discard)
+	encoders[w.encoding].Put(w.encoder)
+	w.encoder = nil
+	return err
+}
+
+// compress compress responses with brotli or gzip, whichever the Accept-Encoding header prefers.
+// Live updates are not compressed so every event reaches the client as soon as it is written
+func compress() echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			if strings.HasPrefix(c.Request().URL.Path, "/stream/") {
+				return next(c)
+			}
+			res := c.Response()
+			res.Header().Add(echo.HeaderVary, echo.HeaderAcceptEncoding)
+			encoding := negotiateEncoding(c.Request().Header.Get(echo.HeaderAcceptEncoding))
+			if encoding == "" {
+				return next(c)
+			}
+			w := &compressWriter{ResponseWriter: res.Writer, encoding: encoding}
+			res.Writer = w
+			defer func() {
+				if err := w.Close(); err != nil {
+					log.Error(err)
+				}
+				res.Writer = w.ResponseWriter
+			}()
+			return next(c)
+		}
+	}
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"compress/gzip"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/kabergstrom/site/db"
+	"github.com/kabergstrom/site/protocol"
+	"github.com/labstack/echo"
+)
+
+func TestNegotiateEncoding(t *testing.T) {
+	for acceptEncoding, expected := range map[string]string{
+		"":                         "",
+		"identity":                 "",
+		"gzip, deflate":            "gzip",
+		"gzip, deflate, br":        "br",
+		"br;q=0.5, gzip":           "gzip",
+		"gzip;q=0, br;q=0":         "",
+		"deflate, gzip;q=0.1, br ": "br",
+	} {
+		if encoding := negotiateEncoding(acceptEncoding); encoding != expected {
+			t.Errorf("Accept-Encoding %q negotiated %q, expected %q", acceptEncoding, encoding, expected)
+		}
+	}
+}
+
+func TestConditionalRequests(t *testing.T) {
+	store := db.NewMemoryStore()
+	post := db.Object{ID: 2, Source: protocol.HackerNews, Type: protocol.TextPost, Compression: db.None, Encoding: db.Protobuf, Data: &db.Post{Title: "First story"}}
+	if err := store.InsertObject(post); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.SetListing(db.ListingHot, db.Listing{Objects: []int64{2}}); err != nil {
+		t.Fatal(err)
+	}
+	e := echo.New()
+	e.Use(compress())
+	addEndpoints(e, &apiCtx{
+		objects:     store,
+		listings:    store,
+		versions:    store,
+		authorCache: newAuthorCache(100, time.Minute),
+		cacheMaxAge: time.Minute,
+	})
+	get := func(path string, etag string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		req.Header.Set("If-None-Match", etag)
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		return rec
+	}
+
+	for _, path := range []string{"/object/2", "/hot"} {
+		rec := get(path, "")
+		etag := rec.Header().Get("ETag")
+		if rec.Code != http.StatusOK || etag == "" {
+			t.Fatalf("%s returned %d with ETag %q", path, rec.Code, etag)
+		}
+		if cc := rec.Header().Get("Cache-Control"); cc != "public, max-age=60" {
+			t.Errorf("%s returned Cache-Control %q", path, cc)
+		}
+		if rec = get(path, `"other", `+etag); rec.Code != http.StatusNotModified || rec.Body.Len() != 0 {
+			t.Errorf("Unchanged %s returned %d", path, rec.Code)
+		}
+
+		_, version, err := store.GetObjectVersion(2)
+		if err != nil {
+			t.Fatal(err)
+		}
+		post.Data = &db.Post{Title: "Edited " + path}
+		if err := store.UpdateSourceObject(post, version); err != nil {
+			t.Fatal(err)
+		}
+		if rec = get(path, etag); rec.Code != http.StatusOK || rec.Header().Get("ETag") == etag {
+			t.Errorf("Modified %s returned %d with ETag %q", path, rec.Code, rec.Header().Get("ETag"))
+		}
+	}
+}
+
+func TestCompression(t *testing.T) {
+	store := db.NewMemoryStore()
+	obj := db.Object{ID: 1, Source: protocol.HackerNews, Type: protocol.User, Compression: db.None, Encoding: db.Protobuf, Data: &db.User{Name: "alice"}}
+	if err := store.InsertObject(obj); err != nil {
+		t.Fatal(err)
+	}
+	e := echo.New()
+	e.Use(compress())
+	addEndpoints(e, &apiCtx{objects: store, listings: store, authorCache: newAuthorCache(100, time.Minute)})
+
+	req := httptest.NewRequest(http.MethodGet, "/object/1", nil)
+	req.Header.Set(echo.HeaderAcceptEncoding, "gzip")
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK || rec.Header().Get(echo.HeaderContentEncoding) != "gzip" {
+		t.Fatalf("/object/1 returned %d with Content-Encoding %q", rec.Code, rec.Header().Get(echo.HeaderContentEncoding))
+	}
+	r, err := gzip.NewReader(rec.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var u user
+	if err := json.NewDecoder(r).Decode(&u); err != nil {
+		t.Fatal(err)
+	}
+	if u.Name != "alice" {
+		t.Errorf("Unexpected user %+v", u)
+	}
+}
@@ -0,0 +1,181 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/bwmarrin/snowflake"
+	"github.com/gogo/protobuf/proto"
+	"github.com/kabergstrom/site/harness"
+	"github.com/kabergstrom/site/nats2db/processor"
+	"github.com/kabergstrom/site/protocol"
+	"github.com/kabergstrom/site/protocol/subjects"
+	"github.com/kabergstrom/site/ranking/ranker"
+	"github.com/labstack/echo"
+	nats "github.com/nats-io/go-nats"
+	"github.com/nats-io/go-nats-streaming"
+)
+
+var fixtureUsers = map[string]protocol.HnUser{
+	"alice": {Id: "alice", Created: 1400000000, Karma: 120, About: "first"},
+	"bob":   {Id: "bob", Created: 1400000001, Karma: 30},
+}
+
+var fixturePosts = map[int64]protocol.HnPost{
+	100: {Id: 100, Type: "story", Author: "alice", Time: 1500000000, Title: "First story", Text: "hello", Kids: []int64{102}, Score: 50, Source: int32(protocol.HackerNews)},
+	101: {Id: 101, Type: "story", Author: "bob", Time: 1500000100, Title: "Second story", Score: 80, Source: int32(protocol.HackerNews)},
+	102: {Id: 102, Type: "comment", Author: "bob", Time: 1500000200, Text: "Nice", Parent: 100, Source: int32(protocol.HackerNews)},
+}
+
+// serveHackerNews answers hacker-news.get-object requests from the fixtures. Like hackernews,
+// requests without a reply subject are answered on the posts stream
+func serveHackerNews(t *testing.T, sc stan.Conn) {
+	nc := sc.NatsConn()
+	_, err := nc.Subscribe(subjects.HackerNewsGetObject, func(m *nats.Msg) {
+		var request protocol.HnObjectRequest
+		if err := proto.Unmarshal(m.Data, &request); err != nil {
+			t.Error(err)
+			return
+		}
+		var reply proto.Message
+		switch request.Type {
+		case protocol.HnObjectRequest_USER:
+			u := fixtureUsers[request.Username]
+			reply = &u
+		case protocol.HnObjectRequest_POST:
+			p := fixturePosts[request.Id]
+			reply = &p
+		}
+		payload, err := proto.Marshal(reply)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		if m.Reply == "" {
+			if err := sc.Publish(subjects.HackerNewsPosts, payload); err != nil {
+				t.Error(err)
+			}
+			return
+		}
+		nc.Publish(m.Reply, payload)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func get(e *echo.Echo, path string, v interface{}) int {
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+	if rec.Code == http.StatusOK {
+		if err := json.Unmarshal(rec.Body.Bytes(), v); err != nil {
+			return http.StatusInternalServerError
+		}
+	}
+	return rec.Code
+}
+
+func TestEndToEnd(t *testing.T) {
+	h := harness.Start(t)
+	defer h.Close()
+
+	serveHackerNews(t, h.Connect("hacker-news-producer"))
+
+	node, err := snowflake.NewNode(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	proc := processor.New(h.Store, node, h.Connect("nats2db"))
+	if _, err := proc.Subscribe("nats2db", 1, time.Second*30); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	r := ranker.New(h.Connect("ranking"), h.Store, h.Store)
+	r.Window = time.Millisecond * 100
+	go func() {
+		if err := r.Run(ctx, "ranking"); err != nil {
+			t.Error(err)
+		}
+	}()
+
+	publisher := h.Connect("hacker-news-fixtures")
+	for _, id := range []int64{100, 101} {
+		p := fixturePosts[id]
+		payload, err := proto.Marshal(&p)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := publisher.Publish(subjects.HackerNewsPosts, payload); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	e := echo.New()
+	addEndpoints(e, &apiCtx{
+		objects:     h.Store,
+		listings:    h.Store,
+		authorCache: newAuthorCache(100, time.Minute),
+	})
+
+	var hot []textPost
+	deadline := time.Now().Add(time.Second * 10)
+	for {
+		hot = nil
+		if get(e, "/hot", &hot) == http.StatusOK && len(hot) == 2 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("/hot did not list both stories in time, got %+v", hot)
+		}
+		time.Sleep(time.Millisecond * 50)
+	}
+
+	if hot[0].Title != "Second story" || hot[1].Title != "First story" {
+		t.Fatalf("/hot not sorted by score: %+v", hot)
+	}
+	if hot[0].Type != "story" || hot[0].Score != 80 || hot[0].Author.Name != "bob" || hot[0].NumKids != 0 {
+		t.Errorf("Unexpected first /hot entry %+v", hot[0])
+	}
+	if hot[1].Score != 50 || hot[1].Author.Name != "alice" || hot[1].Text != "hello" || hot[1].NumKids != 1 {
+		t.Errorf("Unexpected second /hot entry %+v", hot[1])
+	}
+
+	commentID, err := h.Store.GetObjectIDFromSourceID(protocol.HackerNews, []byte("p102"))
+	if err != nil {
+		t.Fatalf("Comment fetched through hacker-news.get-object was not stored: %s", err)
+	}
+	// the comment is fetched after the story that refers to it
+	var c comment
+	for {
+		code := get(e, "/object/"+strconv.FormatInt(commentID, 10), &c)
+		if code == http.StatusOK {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("/object/%d returned %d", commentID, code)
+		}
+		time.Sleep(time.Millisecond * 50)
+	}
+	if c.Type != "comment" || c.Text != "Nice" || c.Author.Name != "bob" || c.Parent != hot[1].ID {
+		t.Errorf("Unexpected comment %+v, parent should be %s", c, hot[1].ID)
+	}
+
+	var story textPost
+	if code := get(e, "/object/"+hot[1].ID, &story); code != http.StatusOK {
+		t.Fatalf("/object/%s returned %d", hot[1].ID, code)
+	}
+	if story != hot[1] {
+		t.Errorf("/object/%s returned %+v, /hot returned %+v", hot[1].ID, story, hot[1])
+	}
+
+	if code := get(e, "/object/1", &story); code != http.StatusNotFound {
+		t.Errorf("/object/1 returned %d, expected %d", code, http.StatusNotFound)
+	}
+}
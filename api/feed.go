@@ -0,0 +1,410 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"mime"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/kabergstrom/site/db"
+	"github.com/kabergstrom/site/protocol"
+	"github.com/labstack/echo"
+	"github.com/ngaut/log"
+)
+
+type feedFormat int
+
+const (
+	formatJSON feedFormat = iota
+	formatRSS
+	formatAtom
+)
+
+// feedSize max number of entries in user and thread feeds
+const feedSize = 30
+
+// feedMaxAge how long clients and proxies may cache a feed
+const feedMaxAge = 60
+
+var acceptFormats = map[string]feedFormat{
+	"application/json":     formatJSON,
+	"application/rss+xml":  formatRSS,
+	"application/atom+xml": formatAtom,
+	"application/xml":      formatRSS,
+	"text/xml":             formatRSS,
+}
+
+// negotiateFormat the format an Accept header prefers. JSON unless a feed is preferred
+func negotiateFormat(accept string) feedFormat {
+	best, bestQ := formatJSON, -1.0
+	for _, mediaRange := range strings.Split(accept, ",") {
+		mediaType, params, err := mime.ParseMediaType(strings.TrimSpace(mediaRange))
+		if err != nil {
+			continue
+		}
+		format, ok := acceptFormats[mediaType]
+		if !ok {
+			continue
+		}
+		q := 1.0
+		if str, ok := params["q"]; ok {
+			if q, err = strconv.ParseFloat(str, 64); err != nil {
+				continue
+			}
+		}
+		if q > bestQ && q > 0 {
+			best, bestQ = format, q
+		}
+	}
+	return best
+}
+
+// feedInfo the feed of an endpoint
+type feedInfo struct {
+	title string
+	// path of the JSON endpoint the feed is generated from
+	path string
+}
+
+type rssFeed struct {
+	XMLName xml.Name   `xml:"rss"`
+	Version string     `xml:"version,attr"`
+	DC      string     `xml:"xmlns:dc,attr"`
+	Channel rssChannel `xml:"channel"`
+}
+
+type rssChannel struct {
+	Title         string    `xml:"title"`
+	Link          string    `xml:"link"`
+	Description   string    `xml:"description"`
+	LastBuildDate string    `xml:"lastBuildDate"`
+	TTL           int       `xml:"ttl"`
+	Items         []rssItem `xml:"item"`
+}
+
+type rssItem struct {
+	Title       string  `xml:"title"`
+	Link        string  `xml:"link"`
+	Description string  `xml:"description,omitempty"`
+	Creator     string  `xml:"dc:creator,omitempty"`
+	GUID        rssGUID `xml:"guid"`
+	PubDate     string  `xml:"pubDate"`
+}
+
+type rssGUID struct {
+	IsPermaLink bool   `xml:"isPermaLink,attr"`
+	Value       string `xml:",chardata"`
+}
+
+type atomFeed struct {
+	XMLName xml.Name    `xml:"http://www.w3.org/2005/Atom feed"`
+	Title   string      `xml:"title"`
+	ID      string      `xml:"id"`
+	Updated string      `xml:"updated"`
+	Links   []atomLink  `xml:"link"`
+	Entries []atomEntry `xml:"entry"`
+}
+
+type atomLink struct {
+	Href string `xml:"href,attr"`
+	Rel  string `xml:"rel,attr,omitempty"`
+}
+
+type atomEntry struct {
+	Title     string       `xml:"title"`
+	ID        string       `xml:"id"`
+	Updated   string       `xml:"updated"`
+	Published string       `xml:"published"`
+	Links     []atomLink   `xml:"link"`
+	Author    *atomPerson  `xml:"author,omitempty"`
+	Content   *atomContent `xml:"content,omitempty"`
+}
+
+type atomPerson struct {
+	Name string `xml:"name"`
+}
+
+type atomContent struct {
+	Type string `xml:"type,attr"`
+	Body string `xml:",chardata"`
+}
+
+// siteURL the base URL of links in feeds. API_SITE_URL, or the URL the request was made to
+func (a *apiCtx) siteURL(c echo.Context) string {
+	if a.siteBaseURL != "" {
+		return a.siteBaseURL
+	}
+	return c.Scheme() + "://" + c.Request().Host
+}
+
+// objectGUID the GUID of an object in feeds. It only depends on the site host and object ID,
+// so readers recognize entries across feeds and formats
+func objectGUID(site string, objID int64) string {
+	host := site
+	if u, err := url.Parse(site); err == nil && u.Host != "" {
+		host = u.Host
+	}
+	return fmt.Sprintf("tag:%s,2017:object/%d", host, objID)
+}
+
+func feedEntryTitle(obj db.Object, authors map[int64]author) string {
+	post, ok := obj.Data.(*db.Post)
+	if !ok {
+		return ""
+	}
+	if post.Title != "" {
+		return post.Title
+	}
+	return "Comment by " + authors[post.Author].Name
+}
+
+// serveFeed serve objects as an RSS or Atom feed with caching headers
+func (a *apiCtx) serveFeed(c echo.Context, format feedFormat, info feedInfo, objects []db.Object, authors map[int64]author) error {
+	site := a.siteURL(c)
+	updated := time.Unix(0, 0)
+	for _, obj := range objects {
+		if created := time.Unix(int64(obj.UnixTime), 0); created.After(updated) {
+			updated = created
+		}
+	}
+	var feed interface{}
+	contentType := "application/rss+xml; charset=utf-8"
+	if format == formatAtom {
+		contentType = "application/atom+xml; charset=utf-8"
+		atom := atomFeed{
+			Title:   info.title,
+			ID:      site + info.path,
+			Updated: updated.UTC().Format(time.RFC3339),
+			Links: []atomLink{
+				{Href: site + info.path + ".atom", Rel: "self"},
+				{Href: site + info.path, Rel: "alternate"},
+			},
+		}
+		for _, obj := range objects {
+			post, ok := obj.Data.(*db.Post)
+			if !ok {
+				continue
+			}
+			created := time.Unix(int64(obj.UnixTime), 0).UTC().Format(time.RFC3339)
+			entry := atomEntry{
+				Title:     feedEntryTitle(obj, authors),
+				ID:        objectGUID(site, obj.ID),
+				Updated:   created,
+				Published: created,
+				Links:     []atomLink{{Href: site + "/object/" + strconv.FormatInt(obj.ID, 10), Rel: "alternate"}},
+			}
+			if post.Url != "" {
+				entry.Links = append(entry.Links, atomLink{Href: post.Url, Rel: "related"})
+			}
+			if name := authors[post.Author].Name; name != "" {
+				entry.Author = &atomPerson{Name: name}
+			}
+			if post.Text != "" {
+				entry.Content = &atomContent{Type: "html", Body: post.Text}
+			}
+			atom.Entries = append(atom.Entries, entry)
+		}
+		feed = atom
+	} else {
+		rss := rssFeed{
+			Version: "2.0",
+			DC:      "http://purl.org/dc/elements/1.1/",
+			Channel: rssChannel{
+				Title:         info.title,
+				Link:          site + info.path,
+				Description:   info.title,
+				LastBuildDate: updated.UTC().Format(time.RFC1123Z),
+				TTL:           feedMaxAge / 60,
+			},
+		}
+		for _, obj := range objects {
+			post, ok := obj.Data.(*db.Post)
+			if !ok {
+				continue
+			}
+			link := site + "/object/" + strconv.FormatInt(obj.ID, 10)
+			if post.Url != "" {
+				link = post.Url
+			}
+			rss.Channel.Items = append(rss.Channel.Items, rssItem{
+				Title:       feedEntryTitle(obj, authors),
+				Link:        link,
+				Description: post.Text,
+				Creator:     authors[post.Author].Name,
+				GUID:        rssGUID{Value: objectGUID(site, obj.ID)},
+				PubDate:     time.Unix(int64(obj.UnixTime), 0).UTC().Format(time.RFC1123Z),
+			})
+		}
+		feed = rss
+	}
+	body, err := xml.Marshal(feed)
+	if err != nil {
+		log.Error(err)
+		return c.String(http.StatusInternalServerError, "Error generating feed")
+	}
+	body = append([]byte(xml.Header), body...)
+
+	header := c.Response().Header()
+	etag := header.Get("ETag")
+	if etag == "" {
+		// feeds without versions are identified by their content
+		sum := sha256.Sum256(body)
+		etag = `W/"` + hex.EncodeToString(sum[:16]) + `"`
+		header.Set("ETag", etag)
+	}
+	header.Set("Cache-Control", fmt.Sprintf("public, max-age=%d", feedMaxAge))
+	header.Set("Last-Modified", updated.UTC().Format(http.TimeFormat))
+	if etagMatches(c.Request().Header.Get("If-None-Match"), etag) {
+		return c.NoContent(http.StatusNotModified)
+	}
+	return c.Blob(http.StatusOK, contentType, body)
+}
+
+// sourceIDLookup resolves content source IDs. Implemented by the sql and memory backends
+type sourceIDLookup interface {
+	GetObjectIDFromSourceID(source protocol.SourceID, sourceID []byte) (int64, error)
+}
+
+// hnUserSourceID the source ID of a HN user, as nats2db maps it
+func hnUserSourceID(name string) []byte {
+	return []byte("u" + name)
+}
+
+// sortNewest order objects by descending creation time
+func sortNewest(objects []db.Object) {
+	sort.Slice(objects, func(i, j int) bool { return objects[i].UnixTime > objects[j].UnixTime })
+}
+
+// negotiate the format of a response. formatJSON is resolved to the format the Accept header prefers
+func negotiate(c echo.Context, format feedFormat) feedFormat {
+	if format != formatJSON {
+		return format
+	}
+	c.Response().Header().Add("Vary", echo.HeaderAccept)
+	return negotiateFormat(c.Request().Header.Get(echo.HeaderAccept))
+}
+
+// serveObjects serve objects in a format resolved by negotiate
+func (a *apiCtx) serveObjects(c echo.Context, format feedFormat, info feedInfo, objects []db.Object) error {
+	authors, err := a.objectAuthors(objects)
+	if err != nil {
+		log.Error(err)
+		return c.String(http.StatusInternalServerError, "Internal server error")
+	}
+	if format != formatJSON {
+		return a.serveFeed(c, format, info, objects, authors)
+	}
+	values := make([]interface{}, 0, len(objects))
+	for _, obj := range objects {
+		apiObj, err := dbObjectToAPIObject(obj, authors)
+		if err != nil {
+			log.Error(err)
+			return c.String(http.StatusInternalServerError, fmt.Sprintf("Error converting object for id %d", obj.ID))
+		}
+		values = append(values, apiObj)
+	}
+	a.setCacheControl(c)
+	if c.QueryParam("pretty") != "" {
+		return c.JSONPretty(200, values, "  ")
+	}
+	return c.JSON(200, values)
+}
+
+// submissionsHandler serve the newest submissions of a user
+func (a *apiCtx) submissionsHandler(format feedFormat) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		if a.users == nil || a.submissions == nil {
+			return c.String(http.StatusNotImplemented, "User lookup is not available")
+		}
+		name := c.Param("name")
+		userID, err := a.users.GetObjectIDFromSourceID(protocol.HackerNews, hnUserSourceID(name))
+		if err == db.ErrNotFound {
+			return c.String(http.StatusNotFound, fmt.Sprintf("Could not find user %s", name))
+		}
+		if err != nil {
+			log.Error(err)
+			return c.String(http.StatusInternalServerError, "Internal server error")
+		}
+		submitted, err := a.submissions.GetSubmissions(userID, feedSize)
+		if err != nil {
+			log.Error(err)
+			return c.String(http.StatusInternalServerError, "Internal server error")
+		}
+		items, err := a.objects.GetObjects(submitted)
+		if err != nil {
+			log.Error(err)
+			return c.String(http.StatusInternalServerError, "Internal server error")
+		}
+		objects := make([]db.Object, 0, len(items))
+		for _, obj := range items {
+			if !obj.Deleted {
+				objects = append(objects, obj)
+			}
+		}
+		sortNewest(objects)
+		return a.serveObjects(c, negotiate(c, format), feedInfo{
+			title: "site: submissions by " + name,
+			path:  "/user/" + url.PathEscape(name) + "/submissions",
+		}, objects)
+	}
+}
+
+// commentsHandler serve the newest comments below a post
+func (a *apiCtx) commentsHandler(format feedFormat) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		str := c.Param("id")
+		id, err := strconv.ParseInt(str, 10, 64)
+		if err != nil {
+			return c.String(http.StatusBadRequest, "Invalid id")
+		}
+		root, err := a.objects.GetObject(id)
+		if err == db.ErrNotFound {
+			return c.String(http.StatusNotFound, fmt.Sprintf("Could not find %s", str))
+		}
+		if err != nil {
+			log.Error(err)
+			return c.String(http.StatusInternalServerError, fmt.Sprintf("Error getting id %s", str))
+		}
+		// read the thread a level at a time, up to a bounded number of comments
+		var comments []db.Object
+		level := root.Kids.Kids
+		for len(level) > 0 && len(comments) < maxThreadComments {
+			items, err := a.objects.GetObjects(level)
+			if err != nil {
+				log.Error(err)
+				return c.String(http.StatusInternalServerError, "Internal server error")
+			}
+			var next []int64
+			for _, kidID := range level {
+				kid, ok := items[kidID]
+				if !ok {
+					continue
+				}
+				if !kid.Deleted {
+					comments = append(comments, kid)
+				}
+				next = append(next, kid.Kids.Kids...)
+			}
+			level = next
+		}
+		sortNewest(comments)
+		if len(comments) > feedSize {
+			comments = comments[:feedSize]
+		}
+		title := feedEntryTitle(root, nil)
+		return a.serveObjects(c, negotiate(c, format), feedInfo{
+			title: "site: comments on " + title,
+			path:  "/object/" + str + "/comments",
+		}, comments)
+	}
+}
+
+// maxThreadComments max number of comments read for a thread feed
+const maxThreadComments = 1000
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"encoding/xml"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/kabergstrom/site/db"
+	"github.com/kabergstrom/site/protocol"
+	"github.com/labstack/echo"
+)
+
+func TestNegotiateFormat(t *testing.T) {
+	for accept, expected := range map[string]feedFormat{
+		"": formatJSON,
+		"text/html,application/xhtml+xml,*/*;q=0.8":       formatJSON,
+		"application/rss+xml":                             formatRSS,
+		"application/atom+xml, application/rss+xml;q=0.9": formatAtom,
+		"application/json;q=0.5, application/atom+xml":    formatAtom,
+		"application/rss+xml;q=0, application/json":       formatJSON,
+	} {
+		if format := negotiateFormat(accept); format != expected {
+			t.Errorf("Accept %q negotiated %d, expected %d", accept, format, expected)
+		}
+	}
+}
+
+func TestHotFeed(t *testing.T) {
+	store := db.NewMemoryStore()
+	objects := []db.Object{
+		{ID: 1, Source: protocol.HackerNews, Type: protocol.User, Compression: db.None, Encoding: db.Protobuf, Data: &db.User{Name: "alice"}},
+		{ID: 2, Source: protocol.HackerNews, Type: protocol.TextPost, UnixTime: 1500000000, Compression: db.None, Encoding: db.Protobuf, Data: &db.Post{Author: 1, Title: "First story"}},
+	}
+	for _, obj := range objects {
+		if err := store.InsertObject(obj); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := store.SetListing(db.ListingHot, db.Listing{Objects: []int64{2}}); err != nil {
+		t.Fatal(err)
+	}
+	e := echo.New()
+	addEndpoints(e, &apiCtx{
+		objects:     store,
+		listings:    store,
+		authorCache: newAuthorCache(100, time.Minute),
+		siteBaseURL: "https://example.com",
+	})
+
+	req := httptest.NewRequest(http.MethodGet, "/hot", nil)
+	req.Header.Set(echo.HeaderAccept, "application/rss+xml")
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("/hot returned %d", rec.Code)
+	}
+	var feed rssFeed
+	if err := xml.Unmarshal(rec.Body.Bytes(), &feed); err != nil {
+		t.Fatal(err)
+	}
+	if len(feed.Channel.Items) != 1 {
+		t.Fatalf("Unexpected feed %+v", feed)
+	}
+	item := feed.Channel.Items[0]
+	if item.Title != "First story" || item.GUID.Value != "tag:example.com,2017:object/2" || item.GUID.IsPermaLink {
+		t.Errorf("Unexpected item %+v", item)
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "/hot.atom", nil)
+	req.Header.Set("If-None-Match", rec.Header().Get("ETag"))
+	rec = httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Errorf("ETag of the RSS feed matched the Atom feed")
+	}
+	req = httptest.NewRequest(http.MethodGet, "/hot.atom", nil)
+	req.Header.Set("If-None-Match", rec.Header().Get("ETag"))
+	rec = httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+	if rec.Code != http.StatusNotModified {
+		t.Errorf("Unchanged feed returned %d", rec.Code)
+	}
+}
@@ -0,0 +1,494 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync"
+
+	"github.com/graphql-go/graphql"
+	"github.com/graphql-go/graphql/gqlerrors"
+	"github.com/graphql-go/graphql/language/ast"
+	"github.com/graphql-go/graphql/language/parser"
+	"github.com/kabergstrom/site/db"
+	"github.com/kabergstrom/site/protocol"
+	"github.com/labstack/echo"
+	"github.com/ngaut/log"
+	"github.com/pkg/errors"
+)
+
+const (
+	// DefaultGraphQLMaxDepth max nesting of fields in a GraphQL query
+	DefaultGraphQLMaxDepth = 10
+	// DefaultGraphQLMaxComplexity max number of fields a GraphQL query can resolve, counting the
+	// fields below a list once for every requested entry
+	DefaultGraphQLMaxComplexity = 10000
+
+	// graphQLListSize default size of list fields
+	graphQLListSize = 30
+	// graphQLMaxListSize max size of list fields
+	graphQLMaxListSize = 100
+)
+
+// objectLoader batches the object reads of a GraphQL query. Resolvers queue the IDs they need and
+// return thunks, which are called breadth-first once every field of a level has been resolved, so
+// the first thunk of a level reads the objects of the whole level in one GetObjects
+type objectLoader struct {
+	objects db.ObjectStore
+
+	mu     sync.Mutex
+	queued map[int64]bool
+	loaded map[int64]db.Object
+	// reads number of GetObjects calls
+	reads int
+}
+
+func newObjectLoader(objects db.ObjectStore) *objectLoader {
+	return &objectLoader{
+		objects: objects,
+		queued:  make(map[int64]bool),
+		loaded:  make(map[int64]db.Object),
+	}
+}
+
+func (l *objectLoader) queue(ids []int64) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for _, id := range ids {
+		if _, ok := l.loaded[id]; !ok {
+			l.queued[id] = true
+		}
+	}
+}
+
+// get the objects of ids that exist, in order, reading everything queued so far if any of them is not loaded yet
+func (l *objectLoader) get(ids []int64) ([]db.Object, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for _, id := range ids {
+		if _, ok := l.loaded[id]; !ok {
+			l.queued[id] = true
+		}
+	}
+	if len(l.queued) > 0 {
+		queued := make([]int64, 0, len(l.queued))
+		for id := range l.queued {
+			queued = append(queued, id)
+		}
+		l.queued = make(map[int64]bool)
+		l.reads++
+		objects, err := l.objects.GetObjects(queued)
+		if err != nil {
+			return nil, errors.Wrap(err, "Error getting objects")
+		}
+		for _, id := range queued {
+			// missing objects are remembered so they are not read again
+			l.loaded[id] = objects[id]
+		}
+	}
+	result := make([]db.Object, 0, len(ids))
+	for _, id := range ids {
+		if obj := l.loaded[id]; obj.ID != 0 {
+			result = append(result, obj)
+		}
+	}
+	return result, nil
+}
+
+type loaderKey struct{}
+
+func loaderFrom(ctx context.Context) *objectLoader {
+	return ctx.Value(loaderKey{}).(*objectLoader)
+}
+
+// loadObject resolve to the object id if it exists and has one of types
+func loadObject(p graphql.ResolveParams, id int64, types ...protocol.ObjectType) (interface{}, error) {
+	if id == 0 {
+		return nil, nil
+	}
+	l := loaderFrom(p.Context)
+	l.queue([]int64{id})
+	return func() (interface{}, error) {
+		objects, err := l.get([]int64{id})
+		if err != nil || len(objects) == 0 {
+			return nil, err
+		}
+		for _, t := range types {
+			if objects[0].Type == t {
+				return objects[0], nil
+			}
+		}
+		return nil, nil
+	}, nil
+}
+
+// loadKids resolve to the first count kids of the source object of type t
+func loadKids(p graphql.ResolveParams, t protocol.ObjectType) (interface{}, error) {
+	count, err := listSize(p.Args["count"])
+	if err != nil {
+		return nil, err
+	}
+	kids := p.Source.(db.Object).Kids.Kids
+	if len(kids) > count {
+		kids = kids[:count]
+	}
+	l := loaderFrom(p.Context)
+	l.queue(kids)
+	return func() (interface{}, error) {
+		objects, err := l.get(kids)
+		if err != nil {
+			return nil, err
+		}
+		result := make([]db.Object, 0, len(objects))
+		for _, obj := range objects {
+			if obj.Type == t {
+				result = append(result, obj)
+			}
+		}
+		return result, nil
+	}, nil
+}
+
+func listSize(arg interface{}) (int, error) {
+	count, ok := arg.(int)
+	if !ok {
+		return graphQLListSize, nil
+	}
+	if count < 0 || count > graphQLMaxListSize {
+		return 0, fmt.Errorf("count must be between 0 and %d", graphQLMaxListSize)
+	}
+	return count, nil
+}
+
+func idArg(p graphql.ResolveParams) (int64, error) {
+	str, _ := p.Args["id"].(string)
+	id, err := strconv.ParseInt(str, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("Invalid id %s", str)
+	}
+	return id, nil
+}
+
+// graphListing a page of a listing
+type graphListing struct {
+	name   string
+	length int
+	ids    []int64
+}
+
+func sourceObject(p graphql.ResolveParams) db.Object {
+	return p.Source.(db.Object)
+}
+
+func sourcePost(p graphql.ResolveParams) *db.Post {
+	return p.Source.(db.Object).Data.(*db.Post)
+}
+
+func objectFields() graphql.Fields {
+	return graphql.Fields{
+		"id": &graphql.Field{Type: graphql.NewNonNull(graphql.ID), Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+			return strconv.FormatInt(sourceObject(p).ID, 10), nil
+		}},
+		"score": &graphql.Field{Type: graphql.Int, Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+			obj := sourceObject(p)
+			return int(obj.Score + obj.SourceScore), nil
+		}},
+		"created": &graphql.Field{Type: graphql.Int, Description: "Unix time", Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+			return int(sourceObject(p).UnixTime), nil
+		}},
+		"deleted": &graphql.Field{Type: graphql.Boolean, Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+			return sourceObject(p).Deleted, nil
+		}},
+	}
+}
+
+// postFields the fields of posts and comments
+func postFields(userType *graphql.Object) graphql.Fields {
+	fields := objectFields()
+	fields["text"] = &graphql.Field{Type: graphql.String, Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+		return sourcePost(p).Text, nil
+	}}
+	fields["dead"] = &graphql.Field{Type: graphql.Boolean, Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+		return sourcePost(p).Dead, nil
+	}}
+	fields["author"] = &graphql.Field{Type: userType, Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+		return loadObject(p, sourcePost(p).Author, protocol.User)
+	}}
+	return fields
+}
+
+func countArgs() graphql.FieldConfigArgument {
+	return graphql.FieldConfigArgument{
+		"count": &graphql.ArgumentConfig{Type: graphql.Int, DefaultValue: graphQLListSize},
+	}
+}
+
+func newGraphQLSchema(api *apiCtx) (graphql.Schema, error) {
+	userType := graphql.NewObject(graphql.ObjectConfig{
+		Name: "User",
+		Fields: graphql.FieldsThunk(func() graphql.Fields {
+			fields := objectFields()
+			fields["name"] = &graphql.Field{Type: graphql.String, Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				return sourceObject(p).Data.(*db.User).Name, nil
+			}}
+			fields["about"] = &graphql.Field{Type: graphql.String, Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				return sourceObject(p).Data.(*db.User).About, nil
+			}}
+			return fields
+		}),
+	})
+	var commentType *graphql.Object
+	commentType = graphql.NewObject(graphql.ObjectConfig{
+		Name: "Comment",
+		Fields: graphql.FieldsThunk(func() graphql.Fields {
+			fields := postFields(userType)
+			fields["parent"] = &graphql.Field{Type: graphql.ID, Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				return strconv.FormatInt(sourcePost(p).Parent, 10), nil
+			}}
+			fields["numReplies"] = &graphql.Field{Type: graphql.Int, Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				return len(sourceObject(p).Kids.Kids), nil
+			}}
+			fields["replies"] = &graphql.Field{
+				Type: graphql.NewNonNull(graphql.NewList(graphql.NewNonNull(commentType))),
+				Args: countArgs(),
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					return loadKids(p, protocol.Comment)
+				},
+			}
+			return fields
+		}),
+	})
+	postType := graphql.NewObject(graphql.ObjectConfig{
+		Name: "Post",
+		Fields: graphql.FieldsThunk(func() graphql.Fields {
+			fields := postFields(userType)
+			fields["type"] = &graphql.Field{Type: graphql.String, Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				return apiObjectType(sourceObject(p).Type)
+			}}
+			fields["title"] = &graphql.Field{Type: graphql.String, Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				return sourcePost(p).Title, nil
+			}}
+			fields["url"] = &graphql.Field{Type: graphql.String, Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				return sourcePost(p).Url, nil
+			}}
+			fields["numComments"] = &graphql.Field{Type: graphql.Int, Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				return len(sourceObject(p).Kids.Kids), nil
+			}}
+			fields["comments"] = &graphql.Field{
+				Type:        graphql.NewNonNull(graphql.NewList(graphql.NewNonNull(commentType))),
+				Description: "The direct replies to the post",
+				Args:        countArgs(),
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					return loadKids(p, protocol.Comment)
+				},
+			}
+			return fields
+		}),
+	})
+	postTypes := []protocol.ObjectType{protocol.LinkPost, protocol.TextPost, protocol.Job, protocol.Poll, protocol.PollOpt}
+	listingType := graphql.NewObject(graphql.ObjectConfig{
+		Name: "Listing",
+		Fields: graphql.Fields{
+			"name": &graphql.Field{Type: graphql.String, Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				return p.Source.(graphListing).name, nil
+			}},
+			"length": &graphql.Field{Type: graphql.Int, Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				return p.Source.(graphListing).length, nil
+			}},
+			"posts": &graphql.Field{
+				Type: graphql.NewNonNull(graphql.NewList(graphql.NewNonNull(postType))),
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					ids := p.Source.(graphListing).ids
+					l := loaderFrom(p.Context)
+					l.queue(ids)
+					return func() (interface{}, error) {
+						return l.get(ids)
+					}, nil
+				},
+			},
+		},
+	})
+	listingIDs := map[string]int{"hot": db.ListingHot, "new": db.ListingNew}
+	idArgs := graphql.FieldConfigArgument{"id": &graphql.ArgumentConfig{Type: graphql.NewNonNull(graphql.ID)}}
+	queryType := graphql.NewObject(graphql.ObjectConfig{
+		Name: "Query",
+		Fields: graphql.Fields{
+			"listing": &graphql.Field{
+				Type:        listingType,
+				Description: "A page of the hot or new listing",
+				Args: graphql.FieldConfigArgument{
+					"name":  &graphql.ArgumentConfig{Type: graphql.NewNonNull(graphql.String)},
+					"start": &graphql.ArgumentConfig{Type: graphql.Int, DefaultValue: 0},
+					"count": &graphql.ArgumentConfig{Type: graphql.Int, DefaultValue: graphQLListSize},
+				},
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					name, _ := p.Args["name"].(string)
+					listingID, ok := listingIDs[name]
+					if !ok {
+						return nil, fmt.Errorf("Unknown listing %s", name)
+					}
+					start, _ := p.Args["start"].(int)
+					count, err := listSize(p.Args["count"])
+					if err != nil {
+						return nil, err
+					}
+					if start < 0 {
+						return nil, fmt.Errorf("start must not be negative")
+					}
+					listing, err := api.listings.GetListing(listingID)
+					if err == db.ErrNotFound {
+						return nil, nil
+					} else if err != nil {
+						return nil, errors.Wrapf(err, "Error getting listing %s", name)
+					}
+					return graphListing{name: name, length: len(listing.Objects), ids: listingPage(listing, start, start+count)}, nil
+				},
+			},
+			"post": &graphql.Field{Type: postType, Args: idArgs, Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				id, err := idArg(p)
+				if err != nil {
+					return nil, err
+				}
+				return loadObject(p, id, postTypes...)
+			}},
+			"comment": &graphql.Field{Type: commentType, Args: idArgs, Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				id, err := idArg(p)
+				if err != nil {
+					return nil, err
+				}
+				return loadObject(p, id, protocol.Comment)
+			}},
+			"user": &graphql.Field{Type: userType, Args: idArgs, Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				id, err := idArg(p)
+				if err != nil {
+					return nil, err
+				}
+				return loadObject(p, id, protocol.User)
+			}},
+		},
+	})
+	return graphql.NewSchema(graphql.SchemaConfig{Query: queryType})
+}
+
+// queryLimits the depth and complexity of the operations in a query. The complexity counts the
+// fields below a list field once for every entry its count argument asks for
+type queryLimits struct {
+	fragments map[string]*ast.FragmentDefinition
+	variables map[string]interface{}
+}
+
+// listSize the count argument of a list field. Counts outside 0 to graphQLMaxListSize fail in the
+// resolver, but are measured as graphQLMaxListSize since the sibling fields still run
+func (q *queryLimits) listSize(field *ast.Field) int {
+	for _, arg := range field.Arguments {
+		if arg.Name.Value != "count" {
+			continue
+		}
+		switch value := arg.Value.(type) {
+		case *ast.IntValue:
+			if n, err := strconv.Atoi(value.Value); err == nil && n >= 0 && n <= graphQLMaxListSize {
+				return n
+			}
+		case *ast.Variable:
+			if n, ok := q.variables[value.Name.Value].(float64); ok && n >= 0 && n <= graphQLMaxListSize {
+				return int(n)
+			}
+		}
+		return graphQLMaxListSize
+	}
+	return graphQLListSize
+}
+
+// measure the depth and complexity of a selection set whose fields are resolved multiplier times
+func (q *queryLimits) measure(set *ast.SelectionSet, multiplier int) (depth int, complexity int) {
+	if set == nil {
+		return 0, 0
+	}
+	for _, selection := range set.Selections {
+		var d, c int
+		switch s := selection.(type) {
+		case *ast.Field:
+			childMultiplier := multiplier
+			if s.SelectionSet != nil {
+				switch s.Name.Value {
+				case "listing", "comments", "replies":
+					childMultiplier *= q.listSize(s)
+				}
+			}
+			d, c = q.measure(s.SelectionSet, childMultiplier)
+			d, c = d+1, c+multiplier
+		case *ast.InlineFragment:
+			d, c = q.measure(s.SelectionSet, multiplier)
+		case *ast.FragmentSpread:
+			if fragment, ok := q.fragments[s.Name.Value]; ok {
+				d, c = q.measure(fragment.SelectionSet, multiplier)
+			}
+		}
+		if d > depth {
+			depth = d
+		}
+		complexity += c
+	}
+	return depth, complexity
+}
+
+// graphQLRequest the body of POST /graphql
+type graphQLRequest struct {
+	Query         string                 `json:"query"`
+	OperationName string                 `json:"operationName"`
+	Variables     map[string]interface{} `json:"variables"`
+}
+
+// graphQLHandler execute queries against schema after checking they are valid and within the limits
+func (a *apiCtx) graphQLHandler(schema graphql.Schema, maxDepth int, maxComplexity int) echo.HandlerFunc {
+	fail := func(c echo.Context, errs ...gqlerrors.FormattedError) error {
+		return c.JSON(http.StatusBadRequest, &graphql.Result{Errors: errs})
+	}
+	return func(c echo.Context) error {
+		var req graphQLRequest
+		if err := json.NewDecoder(c.Request().Body).Decode(&req); err != nil {
+			return fail(c, gqlerrors.NewFormattedError("Invalid json"))
+		}
+		doc, err := parser.Parse(parser.ParseParams{Source: req.Query})
+		if err != nil {
+			return fail(c, gqlerrors.FormatError(err))
+		}
+		if validation := graphql.ValidateDocument(&schema, doc, graphql.SpecifiedRules); !validation.IsValid {
+			return fail(c, validation.Errors...)
+		}
+		limits := queryLimits{fragments: make(map[string]*ast.FragmentDefinition), variables: req.Variables}
+		for _, def := range doc.Definitions {
+			if fragment, ok := def.(*ast.FragmentDefinition); ok {
+				limits.fragments[fragment.Name.Value] = fragment
+			}
+		}
+		for _, def := range doc.Definitions {
+			op, ok := def.(*ast.OperationDefinition)
+			if !ok {
+				continue
+			}
+			depth, complexity := limits.measure(op.SelectionSet, 1)
+			if depth > maxDepth {
+				return fail(c, gqlerrors.NewFormattedError(fmt.Sprintf("Query depth %d exceeds the max depth %d", depth, maxDepth)))
+			}
+			if complexity > maxComplexity {
+				return fail(c, gqlerrors.NewFormattedError(fmt.Sprintf("Query complexity %d exceeds the max complexity %d", complexity, maxComplexity)))
+			}
+		}
+
+		loader := newObjectLoader(a.objects)
+		result := graphql.Execute(graphql.ExecuteParams{
+			Schema:        schema,
+			AST:           doc,
+			OperationName: req.OperationName,
+			Args:          req.Variables,
+			Context:       context.WithValue(c.Request().Context(), loaderKey{}, loader),
+		})
+		for _, err := range result.Errors {
+			log.Infof("GraphQL error: %s", err.Message)
+		}
+		return c.JSON(http.StatusOK, result)
+	}
+}
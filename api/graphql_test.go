@@ -0,0 +1,102 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/kabergstrom/site/db"
+	"github.com/kabergstrom/site/protocol"
+	"github.com/labstack/echo"
+)
+
+// countingStore counts the GetObjects calls made to a MemoryStore
+type countingStore struct {
+	*db.MemoryStore
+	reads int
+}
+
+func (s *countingStore) GetObjects(objIDs []int64) (map[int64]db.Object, error) {
+	s.reads++
+	return s.MemoryStore.GetObjects(objIDs)
+}
+
+func TestGraphQL(t *testing.T) {
+	store := &countingStore{MemoryStore: db.NewMemoryStore()}
+	objects := []db.Object{
+		{ID: 1, Source: protocol.HackerNews, Type: protocol.User, Data: &db.User{Name: "alice"}},
+		{ID: 2, Source: protocol.HackerNews, Type: protocol.User, Data: &db.User{Name: "bob"}},
+		{ID: 3, Source: protocol.HackerNews, Type: protocol.TextPost, Data: &db.Post{Author: 1, Title: "First story"}, Kids: db.Kids{Kids: []int64{5}}},
+		{ID: 4, Source: protocol.HackerNews, Type: protocol.LinkPost, Data: &db.Post{Author: 2, Title: "Second story", Url: "https://example.com"}},
+		{ID: 5, Source: protocol.HackerNews, Type: protocol.Comment, Data: &db.Post{Author: 6, Parent: 3, Text: "A comment"}},
+		{ID: 6, Source: protocol.HackerNews, Type: protocol.User, Data: &db.User{Name: "carol"}},
+	}
+	for _, obj := range objects {
+		obj.Compression, obj.Encoding = db.None, db.Protobuf
+		if err := store.InsertObject(obj); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := store.SetListing(db.ListingHot, db.Listing{Objects: []int64{3, 4}}); err != nil {
+		t.Fatal(err)
+	}
+	api := &apiCtx{objects: store, listings: store, authorCache: newAuthorCache(100, time.Minute)}
+	schema, err := newGraphQLSchema(api)
+	if err != nil {
+		t.Fatal(err)
+	}
+	e := echo.New()
+	e.POST("/graphql", api.graphQLHandler(schema, 5, 5000))
+	query := func(q string, variables ...map[string]interface{}) (*httptest.ResponseRecorder, map[string]interface{}) {
+		r := graphQLRequest{Query: q}
+		if len(variables) > 0 {
+			r.Variables = variables[0]
+		}
+		body, _ := json.Marshal(r)
+		req := httptest.NewRequest(http.MethodPost, "/graphql", strings.NewReader(string(body)))
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		var result map[string]interface{}
+		if err := json.Unmarshal(rec.Body.Bytes(), &result); err != nil {
+			t.Fatal(err)
+		}
+		return rec, result
+	}
+
+	rec, result := query(`{ listing(name: "hot") { length posts { title author { name } comments { text author { name } } } } }`)
+	if rec.Code != http.StatusOK || result["errors"] != nil {
+		t.Fatalf("Query returned %d: %s", rec.Code, rec.Body.String())
+	}
+	var expected map[string]interface{}
+	json.Unmarshal([]byte(`{"listing": {"length": 2, "posts": [
+		{"title": "First story", "author": {"name": "alice"}, "comments": [{"text": "A comment", "author": {"name": "carol"}}]},
+		{"title": "Second story", "author": {"name": "bob"}, "comments": []}
+	]}}`), &expected)
+	got, _ := json.Marshal(result["data"])
+	want, _ := json.Marshal(expected)
+	if string(got) != string(want) {
+		t.Errorf("Got %s, expected %s", got, want)
+	}
+	// posts, then authors and comments, then comment authors
+	if store.reads != 3 {
+		t.Errorf("Query read objects %d times, expected 3", store.reads)
+	}
+
+	if rec, _ := query(`{ post(id: "3") { comments { replies { replies { replies { replies { text } } } } } } }`); rec.Code != http.StatusBadRequest {
+		t.Errorf("Too deep query returned %d", rec.Code)
+	}
+	if rec, _ := query(`{ listing(name: "hot", count: 100) { posts { comments(count: 100) { text } } } }`); rec.Code != http.StatusBadRequest {
+		t.Errorf("Too complex query returned %d", rec.Code)
+	}
+	// a negative count must not cancel out the complexity of its siblings
+	if rec, _ := query(`{ a: listing(name: "hot", count: -1000000) { posts { id } } b: listing(name: "hot", count: 100) { posts { comments(count: 100) { text } } } }`); rec.Code != http.StatusBadRequest {
+		t.Errorf("Too complex query with a negative count returned %d", rec.Code)
+	}
+	q := `query($count: Int) { a: listing(name: "hot", count: $count) { posts { id } } b: listing(name: "hot", count: 100) { posts { comments(count: 100) { text } } } }`
+	if rec, _ := query(q, map[string]interface{}{"count": -1000000}); rec.Code != http.StatusBadRequest {
+		t.Errorf("Too complex query with a negative count variable returned %d", rec.Code)
+	}
+}
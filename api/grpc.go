@@ -0,0 +1,283 @@
+package main
+
+import (
+	"context"
+	"runtime/debug"
+	"strconv"
+
+	"github.com/kabergstrom/site/db"
+	"github.com/kabergstrom/site/rpc"
+	"github.com/ngaut/log"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+// metadataAPIKey metadata with the API key of a gRPC client, like the X-API-Key header
+const metadataAPIKey = "x-api-key"
+
+// rpcServer serves the rpc.Site gRPC service from the stores of the REST API
+type rpcServer struct {
+	api *apiCtx
+}
+
+// newGRPCServer create the gRPC server. Calls are limited by limiter like HTTP requests unless it is nil
+func newGRPCServer(api *apiCtx, limiter *rateLimiter) *grpc.Server {
+	unary := []grpc.UnaryServerInterceptor{recoverUnary}
+	stream := []grpc.StreamServerInterceptor{recoverStream}
+	if limiter != nil {
+		unary = append(unary, limiter.unaryInterceptor)
+		stream = append(stream, limiter.streamInterceptor)
+	}
+	s := grpc.NewServer(grpc.ChainUnaryInterceptor(unary...), grpc.ChainStreamInterceptor(stream...))
+	rpc.RegisterSiteServer(s, &rpcServer{api: api})
+	return s
+}
+
+// recoverUnary turn a panic in a unary call into an Internal error, like the Recover middleware of echo
+func recoverUnary(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (resp interface{}, err error) {
+	defer func() {
+		if p := recover(); p != nil {
+			log.Errorf("Panic in %s: %v\n%s", info.FullMethod, p, debug.Stack())
+			err = status.Error(codes.Internal, "Internal server error")
+		}
+	}()
+	return handler(ctx, req)
+}
+
+// recoverStream turn a panic in a stream into an Internal error
+func recoverStream(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) (err error) {
+	defer func() {
+		if p := recover(); p != nil {
+			log.Errorf("Panic in %s: %v\n%s", info.FullMethod, p, debug.Stack())
+			err = status.Error(codes.Internal, "Internal server error")
+		}
+	}()
+	return handler(srv, ss)
+}
+
+// rpcClientIP the IP of the client of a call, from the x-forwarded-for metadata of trusted proxies like
+// the X-Forwarded-For header of HTTP requests
+func (l *rateLimiter) rpcClientIP(ctx context.Context) string {
+	var remoteAddr string
+	if p, ok := peer.FromContext(ctx); ok {
+		remoteAddr = p.Addr.String()
+	}
+	md, _ := metadata.FromIncomingContext(ctx)
+	return l.clientIP(remoteAddr, md["x-forwarded-for"])
+}
+
+// limitCall take the tokens of a call to method, like middleware takes those of an HTTP request
+func (l *rateLimiter) limitCall(ctx context.Context, method string) error {
+	var key string
+	md, _ := metadata.FromIncomingContext(ctx)
+	if keys := md[metadataAPIKey]; len(keys) > 0 {
+		key = keys[0]
+	}
+	r, err := l.allow(l.rpcClientIP(ctx), key, method)
+	if !r.ok {
+		return status.Errorf(codes.ResourceExhausted, "Rate limit exceeded, retry after %d seconds", r.retryAfter())
+	}
+	if err == errInvalidAPIKey {
+		return status.Error(codes.Unauthenticated, "Invalid API key")
+	}
+	if err != nil {
+		log.Error(err)
+		return status.Error(codes.Internal, "Internal server error")
+	}
+	return nil
+}
+
+// unaryInterceptor limit unary calls
+func (l *rateLimiter) unaryInterceptor(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	if err := l.limitCall(ctx, info.FullMethod); err != nil {
+		return nil, err
+	}
+	return handler(ctx, req)
+}
+
+// streamInterceptor limit streams when they are opened
+func (l *rateLimiter) streamInterceptor(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	if err := l.limitCall(ss.Context(), info.FullMethod); err != nil {
+		return err
+	}
+	return handler(srv, ss)
+}
+
+// rpcObject convert obj to its gRPC representation, like dbObjectToAPIObject
+func rpcObject(obj db.Object, authors map[int64]author) *rpc.Object {
+	o := &rpc.Object{
+		Id:      obj.ID,
+		Source:  uint32(obj.Source),
+		Type:    uint32(obj.Type),
+		Score:   obj.Score + obj.SourceScore,
+		Deleted: obj.Deleted,
+		Created: obj.UnixTime,
+		NumKids: int32(len(obj.Kids.Kids)),
+	}
+	switch data := obj.Data.(type) {
+	case *db.Post:
+		o.Data = &rpc.Object_Post{Post: data}
+		if a, ok := authors[data.Author]; ok {
+			o.Author = &rpc.Author{Id: data.Author, Name: a.Name}
+		}
+	case *db.User:
+		o.Data = &rpc.Object_User{User: data}
+	}
+	return o
+}
+
+// rpcObjects convert objects and get their authors
+func (s *rpcServer) rpcObjects(objects []db.Object) ([]*rpc.Object, error) {
+	authors, err := s.api.objectAuthors(objects)
+	if err != nil {
+		log.Error(err)
+		return nil, status.Error(codes.Internal, "Internal server error")
+	}
+	values := make([]*rpc.Object, len(objects))
+	for i, obj := range objects {
+		values[i] = rpcObject(obj, authors)
+	}
+	return values, nil
+}
+
+// GetObject get a single object
+func (s *rpcServer) GetObject(ctx context.Context, req *rpc.GetObjectRequest) (*rpc.Object, error) {
+	obj, err := s.api.objects.GetObject(req.Id)
+	if err == db.ErrNotFound {
+		return nil, status.Errorf(codes.NotFound, "Could not find %d", req.Id)
+	}
+	if err != nil {
+		log.Error(err)
+		return nil, status.Errorf(codes.Internal, "Error getting id %d", req.Id)
+	}
+	values, err := s.rpcObjects([]db.Object{obj})
+	if err != nil {
+		return nil, err
+	}
+	return values[0], nil
+}
+
+// GetObjects get multiple objects. IDs that do not exist are left out
+func (s *rpcServer) GetObjects(ctx context.Context, req *rpc.GetObjectsRequest) (*rpc.GetObjectsResponse, error) {
+	if len(req.Ids) == 0 {
+		return nil, status.Error(codes.InvalidArgument, "No ids supplied")
+	}
+	if len(req.Ids) > maxBulkIDs {
+		return nil, status.Errorf(codes.InvalidArgument, "Max %d ids per request", maxBulkIDs)
+	}
+	items, err := s.api.objects.GetObjects(req.Ids)
+	if err != nil {
+		log.Error(err)
+		return nil, status.Error(codes.Internal, "Error getting ids")
+	}
+	objects := make([]db.Object, 0, len(items))
+	for _, obj := range items {
+		objects = append(objects, obj)
+	}
+	values, err := s.rpcObjects(objects)
+	if err != nil {
+		return nil, err
+	}
+	return &rpc.GetObjectsResponse{Objects: values}, nil
+}
+
+// rpcListingID the listing ID of a gRPC listing
+func rpcListingID(listing rpc.ListingId) (int, error) {
+	switch listing {
+	case rpc.ListingId_HOT:
+		return db.ListingHot, nil
+	case rpc.ListingId_NEW:
+		return db.ListingNew, nil
+	default:
+		return 0, status.Errorf(codes.InvalidArgument, "Unknown listing %s", listing)
+	}
+}
+
+// GetListing get a page of a listing
+func (s *rpcServer) GetListing(ctx context.Context, req *rpc.GetListingRequest) (*rpc.GetListingResponse, error) {
+	listingID, err := rpcListingID(req.Listing)
+	if err != nil {
+		return nil, err
+	}
+	count := req.Count
+	if count == 0 {
+		count = 30
+	}
+	if req.Start < 0 || count < 0 {
+		return nil, status.Error(codes.InvalidArgument, "Negative start or count")
+	}
+	if count > 100 {
+		return nil, status.Error(codes.InvalidArgument, "Max 100 items per request")
+	}
+	listing, err := s.api.listings.GetListing(listingID)
+	if err == db.ErrNotFound {
+		return nil, status.Errorf(codes.NotFound, "Could not find listing %s", req.Listing)
+	}
+	if err != nil {
+		log.Error(err)
+		return nil, status.Error(codes.Internal, "Internal server error")
+	}
+	objects, err := s.api.getPage(listingPage(listing, int(req.Start), int(req.Start)+int(count)))
+	if missing, ok := err.(missingObjectError); ok {
+		return nil, status.Error(codes.NotFound, missing.Error())
+	}
+	if err != nil {
+		log.Error(err)
+		return nil, status.Error(codes.Internal, "Internal server error")
+	}
+	values, err := s.rpcObjects(objects)
+	if err != nil {
+		return nil, err
+	}
+	return &rpc.GetListingResponse{Objects: values}, nil
+}
+
+// StreamListing stream the hot listing from the stream hub, like GET /stream/hot
+func (s *rpcServer) StreamListing(req *rpc.StreamListingRequest, stream rpc.Site_StreamListingServer) error {
+	if s.api.stream == nil {
+		return status.Error(codes.Unimplemented, "Live updates are not available")
+	}
+	if req.Listing != rpc.ListingId_HOT {
+		return status.Errorf(codes.InvalidArgument, "Listing %s is not streamed", req.Listing)
+	}
+	client := newStreamClient()
+	s.api.stream.add(client)
+	defer s.api.stream.remove(client)
+	s.api.stream.subscribe(client, streamFilter{hot: true})
+
+	// object events do not change the listing, they are sent with the length of the last listing event
+	length := int32(0)
+	for {
+		select {
+		case <-stream.Context().Done():
+			return nil
+		case <-client.dropped:
+			return status.Error(codes.ResourceExhausted, "Client fell behind, stream the listing again")
+		case e := <-client.events:
+			update := &rpc.ListingUpdate{Length: length}
+			switch e.Event {
+			case "listing":
+				diff := e.Data.(listingDiff)
+				length = int32(diff.Length)
+				update.Length = length
+				for _, change := range diff.Changes {
+					id, err := strconv.ParseInt(change.ID, 10, 64)
+					if err != nil {
+						return status.Error(codes.Internal, "Internal server error")
+					}
+					update.Changes = append(update.Changes, &rpc.ListingChange{Index: int32(change.Index), Id: id})
+				}
+			case "object":
+				update.Objects = []*rpc.Object{rpcObject(e.object, e.authors)}
+			default:
+				continue
+			}
+			if err := stream.Send(update); err != nil {
+				return err
+			}
+		}
+	}
+}
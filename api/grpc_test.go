@@ -0,0 +1,141 @@
+package main
+
+import (
+	"context"
+	"math"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/kabergstrom/site/db"
+	"github.com/kabergstrom/site/protocol"
+	"github.com/kabergstrom/site/rpc"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+// startGRPC serve api on an in memory listener. The server and connection are stopped by the returned func
+func startGRPC(t *testing.T, api *apiCtx, limiter *rateLimiter) (rpc.SiteClient, func()) {
+	lis := bufconn.Listen(1 << 20)
+	s := newGRPCServer(api, limiter)
+	go s.Serve(lis)
+	conn, err := grpc.Dial("bufnet", grpc.WithInsecure(), grpc.WithContextDialer(func(ctx context.Context, addr string) (net.Conn, error) {
+		return lis.Dial()
+	}))
+	if err != nil {
+		s.Stop()
+		t.Fatal(err)
+	}
+	return rpc.NewSiteClient(conn), func() {
+		conn.Close()
+		s.Stop()
+	}
+}
+
+func TestGRPC(t *testing.T) {
+	store := db.NewMemoryStore()
+	objects := []db.Object{
+		{ID: 1, Source: protocol.HackerNews, Type: protocol.User, Compression: db.None, Encoding: db.Protobuf, Data: &db.User{Name: "alice"}},
+		{ID: 2, Source: protocol.HackerNews, Type: protocol.TextPost, Compression: db.None, Encoding: db.Protobuf, Data: &db.Post{Author: 1, Title: "First story"}},
+	}
+	for _, obj := range objects {
+		if err := store.InsertObject(obj); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := store.SetListing(db.ListingHot, db.Listing{Objects: []int64{2}}); err != nil {
+		t.Fatal(err)
+	}
+	client, stop := startGRPC(t, &apiCtx{objects: store, listings: store, authorCache: newAuthorCache(100, time.Minute)}, nil)
+	defer stop()
+	ctx := context.Background()
+
+	listing, err := client.GetListing(ctx, &rpc.GetListingRequest{Listing: rpc.ListingId_HOT})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(listing.Objects) != 1 {
+		t.Fatalf("Unexpected listing %+v", listing)
+	}
+	post := listing.Objects[0]
+	if post.Id != 2 || post.GetPost().GetTitle() != "First story" || post.GetAuthor().GetName() != "alice" {
+		t.Errorf("Unexpected post %+v", post)
+	}
+	if _, err := client.GetObject(ctx, &rpc.GetObjectRequest{Id: 3}); status.Code(err) != codes.NotFound {
+		t.Errorf("Missing object returned %s", err)
+	}
+	if _, err := client.GetListing(ctx, &rpc.GetListingRequest{Listing: rpc.ListingId_NEW}); status.Code(err) != codes.NotFound {
+		t.Errorf("Missing listing returned %s", err)
+	}
+	// a start beyond the listing is an empty page, also where start plus count overflows an int32
+	if listing, err := client.GetListing(ctx, &rpc.GetListingRequest{Listing: rpc.ListingId_HOT, Start: math.MaxInt32, Count: 100}); err != nil || len(listing.Objects) != 0 {
+		t.Errorf("Page beyond the listing returned %+v, %s", listing, err)
+	}
+	stream, err := client.StreamListing(ctx, &rpc.StreamListingRequest{Listing: rpc.ListingId_HOT})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := stream.Recv(); status.Code(err) != codes.Unimplemented {
+		t.Errorf("Stream without NATS returned %s", err)
+	}
+}
+
+func TestGRPCRateLimit(t *testing.T) {
+	store := db.NewMemoryStore()
+	key, _, err := store.CreateAPIKey("test", 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := store.InsertObject(db.Object{ID: 1, Source: protocol.HackerNews, Type: protocol.User, Compression: db.None, Encoding: db.Protobuf, Data: &db.User{Name: "alice"}}); err != nil {
+		t.Fatal(err)
+	}
+	now := time.Unix(1500000000, 0)
+	limiter := newRateLimiter(rateLimit{rate: 1, burst: 10}, rateLimit{rate: 1, burst: 20}, defaultRateLimitCosts, store, time.Minute)
+	limiter.now = func() time.Time { return now }
+	client, stop := startGRPC(t, &apiCtx{objects: store, listings: store, authorCache: newAuthorCache(100, time.Minute)}, limiter)
+	defer stop()
+	ctx := context.Background()
+	withKey := func(key string) context.Context {
+		return metadata.AppendToOutgoingContext(ctx, metadataAPIKey, key)
+	}
+
+	if _, err := client.GetObject(withKey("site_unknown"), &rpc.GetObjectRequest{Id: 1}); status.Code(err) != codes.Unauthenticated {
+		t.Errorf("Unknown key returned %s", err)
+	}
+	ids := make([]int64, maxBulkIDs+1)
+	for i := range ids {
+		ids[i] = int64(i + 1)
+	}
+	if _, err := client.GetObjects(withKey(key), &rpc.GetObjectsRequest{Ids: ids}); status.Code(err) != codes.InvalidArgument {
+		t.Errorf("Request for %d ids returned %s", len(ids), err)
+	}
+	if _, err := client.GetObjects(withKey(key), &rpc.GetObjectsRequest{Ids: ids[:maxBulkIDs]}); err != nil {
+		t.Errorf("Request with a key returned %s", err)
+	}
+	// the two key lookups took 2 of the 10 IP tokens, and GetObjects costs 10
+	if _, err := client.GetObjects(ctx, &rpc.GetObjectsRequest{Ids: []int64{1}}); status.Code(err) != codes.ResourceExhausted {
+		t.Errorf("Request over the IP limit returned %s", err)
+	}
+	if _, err := client.GetObject(ctx, &rpc.GetObjectRequest{Id: 1}); err != nil {
+		t.Errorf("Request within the IP limit returned %s", err)
+	}
+}
+
+func TestGRPCRecover(t *testing.T) {
+	info := &grpc.UnaryServerInfo{FullMethod: "/rpc.Site/GetObject"}
+	_, err := recoverUnary(context.Background(), nil, info, func(ctx context.Context, req interface{}) (interface{}, error) {
+		panic("failed")
+	})
+	if status.Code(err) != codes.Internal {
+		t.Errorf("Panicking call returned %s", err)
+	}
+	err = recoverStream(nil, nil, &grpc.StreamServerInfo{FullMethod: "/rpc.Site/StreamListing"}, func(srv interface{}, ss grpc.ServerStream) error {
+		panic("failed")
+	})
+	if status.Code(err) != codes.Internal {
+		t.Errorf("Panicking stream returned %s", err)
+	}
+}
@@ -0,0 +1,201 @@
+package main
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/getkin/kin-openapi/openapi3filter"
+	"github.com/getkin/kin-openapi/routers/legacy"
+	"github.com/kabergstrom/site/apiclient"
+	"github.com/kabergstrom/site/db"
+	"github.com/kabergstrom/site/protocol"
+	"github.com/labstack/echo"
+)
+
+// undocumentedRoute routes left out of the spec: feeds are the same endpoints with a suffix instead of an Accept header
+var undocumentedRoute = regexp.MustCompile(`^/stream/ws$|\.(rss|atom)$`)
+
+func TestOpenAPIContract(t *testing.T) {
+	spec, err := apiclient.GetSwagger()
+	if err != nil {
+		t.Fatal(err)
+	}
+	router, err := legacy.NewRouter(spec)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// feeds are validated as strings, like text/plain
+	openapi3filter.RegisterBodyDecoder("application/rss+xml", openapi3filter.RegisteredBodyDecoder("text/plain"))
+	openapi3filter.RegisterBodyDecoder("application/atom+xml", openapi3filter.RegisteredBodyDecoder("text/plain"))
+
+	store := db.NewMemoryStore()
+	objects := []db.Object{
+		{ID: 1, Source: protocol.HackerNews, Type: protocol.User, Data: &db.User{Name: "alice", About: "About alice"}},
+		{ID: 2, Source: protocol.HackerNews, Type: protocol.TextPost, UnixTime: 1500000000, Data: &db.Post{Author: 1, Title: "First story", Text: "Text"}, Kids: db.Kids{Kids: []int64{4}}},
+		{ID: 3, Source: protocol.HackerNews, Type: protocol.LinkPost, UnixTime: 1500000001, Data: &db.Post{Author: 1, Title: "Second story", Url: "https://example.com"}},
+		{ID: 4, Source: protocol.HackerNews, Type: protocol.Comment, UnixTime: 1500000002, Data: &db.Post{Author: 1, Parent: 2, Text: "A comment"}},
+	}
+	for _, obj := range objects {
+		obj.Compression, obj.Encoding = db.None, db.Protobuf
+		if err := store.InsertObject(obj); err != nil {
+			t.Fatal(err)
+		}
+		if post, ok := obj.Data.(*db.Post); ok {
+			if err := store.InsertSubmission(post.Author, obj.ID, obj.UnixTime); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	if err := store.InsertSourceIDToObjectID(1, protocol.HackerNews, hnUserSourceID("alice")); err != nil {
+		t.Fatal(err)
+	}
+	post, version, err := store.GetObjectVersion(2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	post.Data = &db.Post{Author: 1, Title: "First story, edited"}
+	if err := store.UpdateSourceObject(post, version); err != nil {
+		t.Fatal(err)
+	}
+	for _, listingID := range []int{db.ListingHot, db.ListingNew} {
+		if err := store.SetListing(listingID, db.Listing{Objects: []int64{2, 3}}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	api := &apiCtx{
+		objects:     store,
+		listings:    store,
+		history:     store,
+		versions:    store,
+		users:       store,
+		submissions: store,
+		authorCache: newAuthorCache(100, time.Minute),
+		cacheMaxAge: time.Minute,
+	}
+	schema, err := newGraphQLSchema(api)
+	if err != nil {
+		t.Fatal(err)
+	}
+	e := echo.New()
+	addEndpoints(e, api)
+	e.POST("/graphql", api.graphQLHandler(schema, DefaultGraphQLMaxDepth, DefaultGraphQLMaxComplexity))
+
+	for _, route := range e.Routes() {
+		if undocumentedRoute.MatchString(route.Path) {
+			continue
+		}
+		path := regexp.MustCompile(`:(\w+)`).ReplaceAllString(route.Path, "{$1}")
+		if item := spec.Paths.Find(path); item == nil || item.GetOperation(route.Method) == nil {
+			t.Errorf("%s %s is not in the spec", route.Method, path)
+		}
+	}
+
+	for _, test := range []struct {
+		method string
+		path   string
+		accept string
+		body   string
+		status int
+	}{
+		{http.MethodPost, "/object/bulk", "", `{"ids": ["1", "2", "3", "4", "5"]}`, http.StatusOK},
+		{http.MethodPost, "/object/bulk", "", `{"ids": ["99999999999999999999"]}`, http.StatusBadRequest},
+		{http.MethodPost, "/graphql", "", `{"query": "{ post(id: \"2\") { title author { name } comments { text } } }"}`, http.StatusOK},
+		{http.MethodPost, "/graphql", "", `{"query": "{ post }"}`, http.StatusBadRequest},
+		{http.MethodGet, "/hot", "", "", http.StatusOK},
+		{http.MethodGet, "/hot?start=1&count=10&pretty=1", "", "", http.StatusOK},
+		{http.MethodGet, "/new", "application/atom+xml", "", http.StatusOK},
+		{http.MethodGet, "/user/alice/submissions", "", "", http.StatusOK},
+		{http.MethodGet, "/user/bob/submissions", "", "", http.StatusNotFound},
+		{http.MethodGet, "/object/2/comments", "application/rss+xml", "", http.StatusOK},
+		{http.MethodGet, "/object/2/comments", "", "", http.StatusOK},
+		{http.MethodGet, "/object/1", "", "", http.StatusOK},
+		{http.MethodGet, "/object/2", "", "", http.StatusOK},
+		{http.MethodGet, "/object/3", "", "", http.StatusOK},
+		{http.MethodGet, "/object/4", "", "", http.StatusOK},
+		{http.MethodGet, "/object/5", "", "", http.StatusNotFound},
+		{http.MethodGet, "/object/2/history", "", "", http.StatusOK},
+		{http.MethodGet, "/search?q=story", "", "", http.StatusNotImplemented},
+		{http.MethodGet, "/stream/hot", "", "", http.StatusNotImplemented},
+		{http.MethodGet, "/openapi.json", "", "", http.StatusOK},
+	} {
+		req := httptest.NewRequest(test.method, test.path, strings.NewReader(test.body))
+		if test.body != "" {
+			req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		}
+		if test.accept != "" {
+			req.Header.Set(echo.HeaderAccept, test.accept)
+		}
+		route, pathParams, err := router.FindRoute(req)
+		if err != nil {
+			t.Fatalf("%s %s: %s", test.method, test.path, err)
+		}
+		input := &openapi3filter.RequestValidationInput{Request: req, PathParams: pathParams, Route: route,
+			Options: &openapi3filter.Options{AuthenticationFunc: openapi3filter.NoopAuthenticationFunc}}
+		if err := openapi3filter.ValidateRequest(context.Background(), input); err != nil {
+			t.Fatalf("%s %s: invalid request: %s", test.method, test.path, err)
+		}
+		req.Body = ioutil.NopCloser(strings.NewReader(test.body))
+
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		if rec.Code != test.status {
+			t.Errorf("%s %s returned %d, expected %d: %s", test.method, test.path, rec.Code, test.status, rec.Body.String())
+			continue
+		}
+		err = openapi3filter.ValidateResponse(context.Background(), &openapi3filter.ResponseValidationInput{
+			RequestValidationInput: input,
+			Status:                 rec.Code,
+			Header:                 rec.Header(),
+			Body:                   ioutil.NopCloser(rec.Body),
+			Options:                &openapi3filter.Options{IncludeResponseStatus: true},
+		})
+		if err != nil {
+			t.Errorf("%s %s: response does not match the spec: %s", test.method, test.path, err)
+		}
+	}
+}
+
+func TestOpenAPIClient(t *testing.T) {
+	store := db.NewMemoryStore()
+	objects := []db.Object{
+		{ID: 1, Source: protocol.HackerNews, Type: protocol.User, Compression: db.None, Encoding: db.Protobuf, Data: &db.User{Name: "alice"}},
+		{ID: 2, Source: protocol.HackerNews, Type: protocol.TextPost, Compression: db.None, Encoding: db.Protobuf, Data: &db.Post{Author: 1, Title: "First story"}},
+	}
+	for _, obj := range objects {
+		if err := store.InsertObject(obj); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := store.SetListing(db.ListingHot, db.Listing{Objects: []int64{2}}); err != nil {
+		t.Fatal(err)
+	}
+	e := echo.New()
+	addEndpoints(e, &apiCtx{objects: store, listings: store, authorCache: newAuthorCache(100, time.Minute)})
+	server := httptest.NewServer(e)
+	defer server.Close()
+
+	client, err := apiclient.NewClientWithResponses(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := client.GetHotWithResponse(context.Background(), &apiclient.GetHotParams{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.JSON200 == nil || len(*resp.JSON200) != 1 {
+		t.Fatalf("Unexpected response %d: %s", resp.StatusCode(), resp.Body)
+	}
+	value, err := (*resp.JSON200)[0].ValueByDiscriminator()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if post, ok := value.(apiclient.TextPost); !ok || post.Title != "First story" || post.Author.Name != "alice" {
+		t.Errorf("Unexpected object %+v", value)
+	}
+}
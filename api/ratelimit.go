@@ -0,0 +1,435 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/kabergstrom/site/db"
+	"github.com/kabergstrom/site/protocol"
+	"github.com/kabergstrom/site/protocol/subjects"
+	"github.com/labstack/echo"
+	"github.com/nats-io/go-nats"
+	"github.com/ngaut/log"
+	"github.com/pkg/errors"
+)
+
+// headerAPIKey request header with the API key of a client
+const headerAPIKey = "X-API-Key"
+
+// maxCachedKeys max number of looked up keys kept by a rateLimiter before its key cache is cleared
+const maxCachedKeys = 10000
+
+// idleBucketAge how long a bucket only known from other instances is kept without being used
+const idleBucketAge = time.Minute
+
+// defaultRateLimitCosts tokens a request to a route takes, for routes that do more work than
+// reading one object. Other routes take 1 token. Feeds cost the same as their JSON route. gRPC calls
+// are routed by their full method name
+var defaultRateLimitCosts = map[string]float64{
+	"/object/bulk":            10,
+	"/rpc.Site/GetObjects":    10,
+	"/graphql":                10,
+	"/search":                 5,
+	"/object/:id/comments":    2,
+	"/user/:name/submissions": 2,
+}
+
+// rateLimit a token bucket size and refill rate. A zero rate is not limited
+type rateLimit struct {
+	rate  float64
+	burst float64
+}
+
+// tokenBucket the tokens left of a client
+type tokenBucket struct {
+	tokens float64
+	last   time.Time
+	limit  rateLimit
+	// relative the bucket was created from the usage of other instances before its limit was
+	// known, and tokens are relative to a full bucket
+	relative bool
+}
+
+// refill add the tokens accumulated since the last refill
+func (b *tokenBucket) refill(now time.Time, limit rateLimit) {
+	if b.relative {
+		b.tokens += limit.burst
+		b.relative = false
+	}
+	b.tokens = math.Max(-limit.burst, math.Min(limit.burst, b.tokens+now.Sub(b.last).Seconds()*limit.rate))
+	b.last, b.limit = now, limit
+}
+
+type apiKeyCacheEntry struct {
+	apiKey  db.APIKey
+	err     error
+	expires time.Time
+}
+
+// rateLimiter limits requests with a token bucket per API key, or per client IP for requests
+// without a key. Buckets are kept in memory and optionally shared with other instances over NATS
+type rateLimiter struct {
+	ip    rateLimit
+	key   rateLimit
+	costs map[string]float64
+	// keys nil if API keys are not available, then keys are ignored and all requests are limited by IP
+	keys   db.APIKeyStore
+	keyTTL time.Duration
+	// proxies the addresses X-Forwarded-For is trusted from. Without them requests are limited by the
+	// address they come from
+	proxies []*net.IPNet
+	now     func() time.Time
+
+	mu        sync.Mutex
+	buckets   map[string]*tokenBucket
+	keyCache  map[string]apiKeyCacheEntry
+	lastSweep time.Time
+	// taken tokens taken from each bucket since they were last published. nil unless shared
+	taken map[string]float64
+}
+
+func newRateLimiter(ip rateLimit, key rateLimit, costs map[string]float64, keys db.APIKeyStore, keyTTL time.Duration) *rateLimiter {
+	return &rateLimiter{
+		ip:       ip,
+		key:      key,
+		costs:    costs,
+		keys:     keys,
+		keyTTL:   keyTTL,
+		now:      time.Now,
+		buckets:  make(map[string]*tokenBucket),
+		keyCache: make(map[string]apiKeyCacheEntry),
+	}
+}
+
+// parseRateLimitCosts parse a comma separated list of route=cost pairs, like /graphql=20,/search=5,
+// into defaultRateLimitCosts
+func parseRateLimitCosts(str string) (map[string]float64, error) {
+	costs := make(map[string]float64, len(defaultRateLimitCosts))
+	for route, cost := range defaultRateLimitCosts {
+		costs[route] = cost
+	}
+	for _, pair := range strings.Split(str, ",") {
+		if pair = strings.TrimSpace(pair); pair == "" {
+			continue
+		}
+		idx := strings.LastIndex(pair, "=")
+		if idx < 0 {
+			return nil, fmt.Errorf("Invalid route cost %s", pair)
+		}
+		cost, err := strconv.ParseFloat(pair[idx+1:], 64)
+		if err != nil || cost < 0 {
+			return nil, fmt.Errorf("Invalid cost of route %s", pair[:idx])
+		}
+		costs[pair[:idx]] = cost
+	}
+	return costs, nil
+}
+
+// parseTrustedProxies parse a comma separated list of IPs and CIDR ranges, like 10.0.0.0/8,192.168.1.10
+func parseTrustedProxies(str string) ([]*net.IPNet, error) {
+	var proxies []*net.IPNet
+	for _, entry := range strings.Split(str, ",") {
+		if entry = strings.TrimSpace(entry); entry == "" {
+			continue
+		}
+		if !strings.Contains(entry, "/") {
+			if ip := net.ParseIP(entry); ip != nil && ip.To4() != nil {
+				entry += "/32"
+			} else {
+				entry += "/128"
+			}
+		}
+		_, ipNet, err := net.ParseCIDR(entry)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid trusted proxy %s", entry)
+		}
+		proxies = append(proxies, ipNet)
+	}
+	return proxies, nil
+}
+
+// trusted whether ip is one of the trusted proxies
+func (l *rateLimiter) trusted(ip string) bool {
+	parsed := net.ParseIP(ip)
+	if parsed == nil {
+		return false
+	}
+	for _, proxy := range l.proxies {
+		if proxy.Contains(parsed) {
+			return true
+		}
+	}
+	return false
+}
+
+// clientIP the IP of a client connected from remoteAddr. The X-Forwarded-For values are only used when
+// remoteAddr is a trusted proxy, and then the client is the right-most entry that is not a trusted proxy,
+// since a client can put anything in the header before the first proxy appends to it
+func (l *rateLimiter) clientIP(remoteAddr string, forwardedFor []string) string {
+	ip := remoteAddr
+	if host, _, err := net.SplitHostPort(remoteAddr); err == nil {
+		ip = host
+	}
+	if !l.trusted(ip) {
+		return ip
+	}
+	var hops []string
+	for _, value := range forwardedFor {
+		hops = append(hops, strings.Split(value, ",")...)
+	}
+	for i := len(hops) - 1; i >= 0; i-- {
+		hop := strings.TrimSpace(hops[i])
+		if hop == "" {
+			continue
+		}
+		if !l.trusted(hop) {
+			return hop
+		}
+		ip = hop
+	}
+	return ip
+}
+
+// cost tokens a request to route takes
+func (l *rateLimiter) cost(route string) float64 {
+	route = strings.TrimSuffix(strings.TrimSuffix(route, ".rss"), ".atom")
+	if cost, ok := l.costs[route]; ok {
+		return cost
+	}
+	return 1
+}
+
+// take cost tokens from a bucket if it has them. Returns the bucket after the request
+func (l *rateLimiter) take(name string, limit rateLimit, cost float64) (tokenBucket, bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	now := l.now()
+	if now.Sub(l.lastSweep) > idleBucketAge {
+		l.sweep(now)
+	}
+	b, ok := l.buckets[name]
+	if !ok {
+		b = &tokenBucket{tokens: limit.burst, last: now}
+		l.buckets[name] = b
+	}
+	b.refill(now, limit)
+	// a request that costs more than the bucket holds would never be allowed
+	cost = math.Min(cost, limit.burst)
+	if b.tokens < cost {
+		return *b, false
+	}
+	b.tokens -= cost
+	if l.taken != nil {
+		l.taken[name] += cost
+	}
+	return *b, true
+}
+
+// sweep remove the buckets that have refilled, which are the same as a new bucket
+func (l *rateLimiter) sweep(now time.Time) {
+	for name, b := range l.buckets {
+		if b.relative && now.Sub(b.last) > idleBucketAge {
+			delete(l.buckets, name)
+		} else if !b.relative && b.tokens+now.Sub(b.last).Seconds()*b.limit.rate >= b.limit.burst {
+			delete(l.buckets, name)
+		}
+	}
+	l.lastSweep = now
+}
+
+// apiKey get a key from the cache or the store. Returns db.ErrNotFound for unknown and revoked keys
+func (l *rateLimiter) apiKey(key string) (db.APIKey, bool, error) {
+	l.mu.Lock()
+	entry, ok := l.keyCache[key]
+	l.mu.Unlock()
+	if ok && l.now().Before(entry.expires) {
+		return entry.apiKey, true, entry.err
+	}
+	apiKey, err := l.keys.GetAPIKey(key)
+	if err == nil && apiKey.RevokedAt != 0 {
+		err = db.ErrNotFound
+	}
+	if err != nil && err != db.ErrNotFound {
+		return db.APIKey{}, false, errors.Wrapf(err, "Failed to look up API key")
+	}
+	l.mu.Lock()
+	if len(l.keyCache) >= maxCachedKeys {
+		l.keyCache = make(map[string]apiKeyCacheEntry)
+	}
+	l.keyCache[key] = apiKeyCacheEntry{apiKey: apiKey, err: err, expires: l.now().Add(l.keyTTL)}
+	l.mu.Unlock()
+	return apiKey, false, err
+}
+
+// setRateLimitHeaders describe bucket b of limit in the X-RateLimit headers
+func setRateLimitHeaders(c echo.Context, b tokenBucket, limit rateLimit) {
+	h := c.Response().Header()
+	h.Set("X-RateLimit-Limit", strconv.Itoa(int(limit.burst)))
+	h.Set("X-RateLimit-Remaining", strconv.Itoa(int(math.Max(0, math.Floor(b.tokens)))))
+	// seconds until the bucket is full again
+	h.Set("X-RateLimit-Reset", strconv.Itoa(int(math.Ceil((limit.burst-b.tokens)/limit.rate))))
+}
+
+// errInvalidAPIKey the API key of a request is unknown or revoked
+var errInvalidAPIKey = errors.New("Invalid API key")
+
+// rateLimitResult the bucket a request took its tokens from
+type rateLimitResult struct {
+	bucket tokenBucket
+	limit  rateLimit
+	cost   float64
+	ok     bool
+}
+
+// limited whether the request was limited at all, requests to a bucket with a zero rate are not
+func (r rateLimitResult) limited() bool {
+	return r.limit.rate > 0
+}
+
+// retryAfter seconds until the bucket has the tokens of the request
+func (r rateLimitResult) retryAfter() int {
+	return int(math.Ceil((math.Min(r.cost, r.limit.burst) - r.bucket.tokens) / r.limit.rate))
+}
+
+// check take cost tokens from a bucket if it has them
+func (l *rateLimiter) check(name string, limit rateLimit, cost float64) rateLimitResult {
+	if limit.rate <= 0 {
+		return rateLimitResult{ok: true}
+	}
+	b, ok := l.take(name, limit, cost)
+	return rateLimitResult{bucket: b, limit: limit, cost: cost, ok: ok}
+}
+
+// allow take the tokens of a request to route from the bucket of key, or of ip if key is empty.
+// Returns errInvalidAPIKey for unknown and revoked keys
+func (l *rateLimiter) allow(ip string, key string, route string) (rateLimitResult, error) {
+	ipBucket := "ip:" + ip
+	if key == "" || l.keys == nil {
+		return l.check(ipBucket, l.ip, l.cost(route)), nil
+	}
+	apiKey, cached, err := l.apiKey(key)
+	r := rateLimitResult{ok: true}
+	if !cached || err == db.ErrNotFound {
+		// lookups and invalid keys take a token from the IP bucket, so clients can not flood the store
+		// with made up keys or bypass the IP limit with a key they know is invalid
+		if r = l.check(ipBucket, l.ip, 1); !r.ok {
+			return r, nil
+		}
+	}
+	if err == db.ErrNotFound {
+		return r, errInvalidAPIKey
+	}
+	if err != nil {
+		return r, err
+	}
+	limit := l.key
+	if apiKey.Rate > 0 {
+		limit.rate = float64(apiKey.Rate)
+	}
+	if apiKey.Burst > 0 {
+		limit.burst = float64(apiKey.Burst)
+	}
+	return l.check("key:"+strconv.FormatInt(apiKey.ID, 10), limit, l.cost(route)), nil
+}
+
+// middleware limit requests by their API key, or by client IP if they have none
+func (l *rateLimiter) middleware() echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			req := c.Request()
+			r, err := l.allow(l.clientIP(req.RemoteAddr, req.Header["X-Forwarded-For"]), req.Header.Get(headerAPIKey), c.Path())
+			if r.limited() {
+				setRateLimitHeaders(c, r.bucket, r.limit)
+			}
+			if !r.ok {
+				c.Response().Header().Set("Retry-After", strconv.Itoa(r.retryAfter()))
+				return c.String(http.StatusTooManyRequests, "Rate limit exceeded")
+			}
+			if err == errInvalidAPIKey {
+				return c.String(http.StatusUnauthorized, "Invalid API key")
+			}
+			if err != nil {
+				log.Error(err)
+				return c.String(http.StatusInternalServerError, "Internal server error")
+			}
+			return next(c)
+		}
+	}
+}
+
+// flush the tokens taken since the last flush
+func (l *rateLimiter) flush() []*protocol.RateLimitTaken {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	taken := make([]*protocol.RateLimitTaken, 0, len(l.taken))
+	for name, tokens := range l.taken {
+		taken = append(taken, &protocol.RateLimitTaken{Bucket: name, Tokens: tokens})
+	}
+	l.taken = make(map[string]float64)
+	return taken
+}
+
+// apply take the tokens other instances took from the buckets. Buckets can go negative, so a client
+// that used up its tokens on every instance waits until its total usage is within the limit
+func (l *rateLimiter) apply(taken []*protocol.RateLimitTaken) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	now := l.now()
+	for _, t := range taken {
+		b, ok := l.buckets[t.Bucket]
+		if !ok {
+			b = &tokenBucket{last: now, relative: true}
+			l.buckets[t.Bucket] = b
+		}
+		b.tokens -= t.Tokens
+	}
+}
+
+// share publish the tokens taken on this instance every interval and apply those taken on other
+// instances until ctx is done. instance must be unique for each instance
+func (l *rateLimiter) share(ctx context.Context, nc *nats.Conn, instance string, interval time.Duration) error {
+	l.mu.Lock()
+	l.taken = make(map[string]float64)
+	l.mu.Unlock()
+	sub, err := nc.Subscribe(subjects.RateLimitUsage, func(m *nats.Msg) {
+		var usage protocol.RateLimitUsage
+		if err := usage.Unmarshal(m.Data); err != nil {
+			log.Errorf("Failed to decode rate limit usage: %s", err)
+			return
+		}
+		if usage.Instance != instance {
+			l.apply(usage.Taken)
+		}
+	})
+	if err != nil {
+		return errors.Wrapf(err, "Failed to subscribe to %s", subjects.RateLimitUsage)
+	}
+	defer sub.Unsubscribe()
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+		usage := protocol.RateLimitUsage{Instance: instance, Taken: l.flush()}
+		if len(usage.Taken) == 0 {
+			continue
+		}
+		data, err := usage.Marshal()
+		if err != nil {
+			return errors.Wrapf(err, "Failed to encode rate limit usage")
+		}
+		if err := nc.Publish(subjects.RateLimitUsage, data); err != nil {
+			log.Errorf("Failed to publish rate limit usage: %s", err)
+		}
+	}
+}
@@ -0,0 +1,143 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/kabergstrom/site/db"
+	"github.com/labstack/echo"
+)
+
+func TestRateLimit(t *testing.T) {
+	store := db.NewMemoryStore()
+	key, _, err := store.CreateAPIKey("test", 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	costs, err := parseRateLimitCosts("/object/bulk=3")
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Unix(1500000000, 0)
+	limiter := newRateLimiter(rateLimit{rate: 1, burst: 3}, rateLimit{rate: 1, burst: 5}, costs, store, time.Minute)
+	limiter.now = func() time.Time { return now }
+	e := echo.New()
+	e.Use(limiter.middleware())
+	ok := func(c echo.Context) error { return c.NoContent(http.StatusNoContent) }
+	e.GET("/object/:id", ok)
+	e.POST("/object/bulk", ok)
+	request := func(method string, path string, key string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, nil)
+		if key != "" {
+			req.Header.Set(headerAPIKey, key)
+		}
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		return rec
+	}
+
+	for i, remaining := range []string{"2", "1", "0"} {
+		rec := request(http.MethodGet, "/object/1", "")
+		if rec.Code != http.StatusNoContent || rec.Header().Get("X-RateLimit-Remaining") != remaining || rec.Header().Get("X-RateLimit-Limit") != "3" {
+			t.Fatalf("Request %d returned %d with headers %v", i, rec.Code, rec.Header())
+		}
+	}
+	rec := request(http.MethodGet, "/object/1", "")
+	if rec.Code != http.StatusTooManyRequests || rec.Header().Get("Retry-After") != "1" || rec.Header().Get("X-RateLimit-Reset") != "3" {
+		t.Fatalf("Request over the limit returned %d with headers %v", rec.Code, rec.Header())
+	}
+	now = now.Add(time.Second)
+	if rec := request(http.MethodGet, "/object/1", ""); rec.Code != http.StatusNoContent {
+		t.Errorf("Request after a refill returned %d", rec.Code)
+	}
+
+	// keys have their own bucket
+	if rec := request(http.MethodGet, "/object/1", "site_unknown"); rec.Code != http.StatusTooManyRequests {
+		t.Errorf("Lookup of an unknown key without IP tokens returned %d", rec.Code)
+	}
+	now = now.Add(3 * time.Second)
+	if rec := request(http.MethodGet, "/object/1", "site_unknown"); rec.Code != http.StatusUnauthorized {
+		t.Errorf("Unknown key returned %d", rec.Code)
+	}
+	// the unknown key is cached, it still takes IP tokens so it can not be used to bypass the IP limit
+	for i := 0; i < 2; i++ {
+		if rec := request(http.MethodGet, "/object/1", "site_unknown"); rec.Code != http.StatusUnauthorized {
+			t.Errorf("Cached unknown key returned %d", rec.Code)
+		}
+	}
+	if rec := request(http.MethodGet, "/object/1", "site_unknown"); rec.Code != http.StatusTooManyRequests {
+		t.Errorf("Cached unknown key without IP tokens returned %d", rec.Code)
+	}
+	now = now.Add(3 * time.Second)
+	rec = request(http.MethodPost, "/object/bulk", key)
+	if rec.Code != http.StatusNoContent || rec.Header().Get("X-RateLimit-Limit") != "5" || rec.Header().Get("X-RateLimit-Remaining") != "2" {
+		t.Errorf("Request with a key returned %d with headers %v", rec.Code, rec.Header())
+	}
+	if rec := request(http.MethodPost, "/object/bulk", key); rec.Code != http.StatusTooManyRequests {
+		t.Errorf("Request over the cost of the key returned %d", rec.Code)
+	}
+	if err := store.RevokeAPIKey(1); err != nil {
+		t.Fatal(err)
+	}
+	now = now.Add(time.Minute)
+	if rec := request(http.MethodGet, "/object/1", key); rec.Code != http.StatusUnauthorized {
+		t.Errorf("Revoked key returned %d", rec.Code)
+	}
+}
+
+func TestRateLimitSharing(t *testing.T) {
+	limit := rateLimit{rate: 1, burst: 10}
+	first := newRateLimiter(limit, limit, nil, nil, time.Minute)
+	second := newRateLimiter(limit, limit, nil, nil, time.Minute)
+	first.taken, second.taken = make(map[string]float64), make(map[string]float64)
+	now := time.Unix(1500000000, 0)
+	first.now = func() time.Time { return now }
+	second.now = first.now
+
+	for i := 0; i < 8; i++ {
+		first.take("ip:1", limit, 1)
+	}
+	second.apply(first.flush())
+	if b, ok := second.take("ip:1", limit, 1); !ok || b.tokens != 1 {
+		t.Errorf("Bucket has %f tokens after the usage of another instance, expected 1", b.tokens)
+	}
+	if _, ok := second.take("ip:1", limit, 2); ok {
+		t.Error("Took more tokens than were left")
+	}
+	if taken := first.flush(); len(taken) != 0 {
+		t.Errorf("Usage was not cleared by flush: %v", taken)
+	}
+}
+
+func TestClientIP(t *testing.T) {
+	proxies, err := parseTrustedProxies("10.0.0.0/8, 192.168.1.10")
+	if err != nil {
+		t.Fatal(err)
+	}
+	limiter := newRateLimiter(rateLimit{}, rateLimit{}, nil, nil, time.Minute)
+	limiter.proxies = proxies
+	for _, c := range []struct {
+		remoteAddr   string
+		forwardedFor []string
+		expected     string
+	}{
+		{"203.0.113.5:1234", nil, "203.0.113.5"},
+		// only trusted proxies can forward
+		{"203.0.113.5:1234", []string{"198.51.100.1"}, "203.0.113.5"},
+		{"10.0.0.1:1234", []string{"198.51.100.1"}, "198.51.100.1"},
+		// entries a client sent ahead of its real address are skipped
+		{"10.0.0.1:1234", []string{"1.2.3.4, 198.51.100.1"}, "198.51.100.1"},
+		{"10.0.0.1:1234", []string{"1.2.3.4, 198.51.100.1, 192.168.1.10", "10.0.0.2"}, "198.51.100.1"},
+		{"10.0.0.1:1234", nil, "10.0.0.1"},
+		{"10.0.0.1:1234", []string{"10.0.0.2"}, "10.0.0.2"},
+	} {
+		if ip := limiter.clientIP(c.remoteAddr, c.forwardedFor); ip != c.expected {
+			t.Errorf("Client of %s forwarded for %v is %s, expected %s", c.remoteAddr, c.forwardedFor, ip, c.expected)
+		}
+	}
+	if _, err := parseTrustedProxies("10.0.0.0/33"); err == nil {
+		t.Error("Parsed an invalid range")
+	}
+}
@@ -0,0 +1,516 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gogo/protobuf/proto"
+	"github.com/kabergstrom/site/db"
+	"github.com/kabergstrom/site/protocol"
+	"github.com/kabergstrom/site/protocol/subjects"
+	"github.com/labstack/echo"
+	"github.com/nats-io/go-nats-streaming"
+	"github.com/ngaut/log"
+	"github.com/pkg/errors"
+	"golang.org/x/net/websocket"
+)
+
+const (
+	// streamWindow how long modified objects are collected before they are pushed
+	streamWindow = time.Second
+	// streamListingSize how many entries of a listing are streamed
+	streamListingSize = 100
+	// streamBuffer events buffered per client. A client that falls further behind gets a
+	// reset event and is disconnected
+	streamBuffer = 256
+	// streamHeartbeat interval of SSE comments that keep idle connections open through proxies
+	streamHeartbeat = time.Second * 30
+	// maxThreadDepth max parents followed to find the root of a comment
+	maxThreadDepth = 100
+)
+
+type streamEvent struct {
+	Event string      `json:"event"`
+	Data  interface{} `json:"data"`
+
+	// object and authors the object an object event was rendered from, for gRPC streams
+	object  db.Object
+	authors map[int64]author
+}
+
+// listingDiff the positions of a listing that changed. Clients set the IDs at the changed
+// indexes and truncate the listing to length
+type listingDiff struct {
+	Listing string          `json:"listing"`
+	Length  int             `json:"length"`
+	Changes []listingChange `json:"changes"`
+}
+
+type listingChange struct {
+	Index int    `json:"index"`
+	ID    string `json:"id"`
+}
+
+// streamFilter what a client subscribed to. Exactly one field is set
+type streamFilter struct {
+	// hot listing changes and objects in it
+	hot bool
+	// thread root post and all comments below it
+	thread int64
+	// user user object and everything it authors
+	user int64
+}
+
+type streamClient struct {
+	events  chan streamEvent
+	dropped chan struct{}
+	drop    sync.Once
+
+	mu      sync.Mutex
+	filters []streamFilter
+}
+
+func newStreamClient() *streamClient {
+	return &streamClient{
+		events:  make(chan streamEvent, streamBuffer),
+		dropped: make(chan struct{}),
+	}
+}
+
+// send queue e without blocking the hub. A client whose buffer is full is dropped
+func (c *streamClient) send(e streamEvent) {
+	select {
+	case c.events <- e:
+	default:
+		c.dropClient()
+	}
+}
+
+// dropClient end the stream of c with a reset event
+func (c *streamClient) dropClient() {
+	c.drop.Do(func() { close(c.dropped) })
+}
+
+func (c *streamClient) subscribe(f streamFilter) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, existing := range c.filters {
+		if existing == f {
+			return
+		}
+	}
+	c.filters = append(c.filters, f)
+}
+
+func (c *streamClient) unsubscribe(f streamFilter) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for i, existing := range c.filters {
+		if existing == f {
+			c.filters = append(c.filters[:i], c.filters[i+1:]...)
+			return
+		}
+	}
+}
+
+func (c *streamClient) getFilters() []streamFilter {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return append([]streamFilter(nil), c.filters...)
+}
+
+// streamHub pushes modified objects and listing changes to the connected clients
+type streamHub struct {
+	api      *apiCtx
+	modified chan int64
+
+	mu      sync.Mutex
+	clients map[*streamClient]bool
+	// hot the streamed part of the hot listing as last sent
+	hot []int64
+	// closed set when the hub stops. Clients that connect after are dropped right away
+	closed bool
+}
+
+func newStreamHub(api *apiCtx) *streamHub {
+	return &streamHub{
+		api:      api,
+		modified: make(chan int64, streamBuffer),
+		clients:  make(map[*streamClient]bool),
+	}
+}
+
+func (h *streamHub) add(c *streamClient) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.closed {
+		c.dropClient()
+		return
+	}
+	h.clients[c] = true
+}
+
+// close drop every client, so their streams end and they reconnect to another instance
+func (h *streamHub) close() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.closed = true
+	for c := range h.clients {
+		c.dropClient()
+	}
+}
+
+func (h *streamHub) remove(c *streamClient) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	delete(h.clients, c)
+}
+
+// subscribe add f to the filters of c. Subscribing to the hot listing sends its current state
+func (h *streamHub) subscribe(c *streamClient, f streamFilter) {
+	c.subscribe(f)
+	if !f.hot {
+		return
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	c.send(streamEvent{Event: "listing", Data: diffListing("hot", nil, h.hot)})
+}
+
+// Run push the objects modified on sc until ctx is done, then drop all clients. Modifications
+// are only streamed to connected clients, so the subscription is not durable
+func (h *streamHub) Run(ctx context.Context, sc stan.Conn) error {
+	sub, err := sc.Subscribe(subjects.ObjectsModified, func(m *stan.Msg) {
+		var mod protocol.ObjectModified
+		if err := proto.Unmarshal(m.Data, &mod); err != nil {
+			log.Errorf("Malformed object modification %d: %s", m.Sequence, err)
+			return
+		}
+		select {
+		case h.modified <- mod.Id:
+		case <-ctx.Done():
+		}
+	})
+	if err != nil {
+		return errors.Wrap(err, "Error subscribing to modified objects")
+	}
+	defer sub.Unsubscribe()
+	defer h.close()
+	ticker := time.NewTicker(streamWindow)
+	defer ticker.Stop()
+	modified := make(map[int64]bool)
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case id := <-h.modified:
+			modified[id] = true
+		case <-ticker.C:
+			if err := h.pushListing(); err != nil {
+				log.Error(err)
+			}
+			if len(modified) == 0 {
+				continue
+			}
+			ids := make([]int64, 0, len(modified))
+			for id := range modified {
+				ids = append(ids, id)
+			}
+			modified = make(map[int64]bool)
+			if err := h.pushObjects(ids); err != nil {
+				log.Error(err)
+			}
+		}
+	}
+}
+
+func (h *streamHub) snapshot() ([]*streamClient, map[int64]bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	clients := make([]*streamClient, 0, len(h.clients))
+	for c := range h.clients {
+		clients = append(clients, c)
+	}
+	hot := make(map[int64]bool, len(h.hot))
+	for _, id := range h.hot {
+		hot[id] = true
+	}
+	return clients, hot
+}
+
+func (h *streamHub) hotSubscribed(clients []*streamClient) bool {
+	for _, c := range clients {
+		for _, f := range c.getFilters() {
+			if f.hot {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// pushListing send the changes of the hot listing since it was last sent
+func (h *streamHub) pushListing() error {
+	clients, _ := h.snapshot()
+	if !h.hotSubscribed(clients) {
+		return nil
+	}
+	listing, err := h.api.listings.GetListing(db.ListingHot)
+	if err == db.ErrNotFound {
+		return nil
+	} else if err != nil {
+		return errors.Wrap(err, "Error getting hot listing for streaming")
+	}
+	hot := listing.Objects
+	if len(hot) > streamListingSize {
+		hot = hot[:streamListingSize]
+	}
+	h.mu.Lock()
+	diff := diffListing("hot", h.hot, hot)
+	unchanged := len(diff.Changes) == 0 && len(h.hot) == len(hot)
+	h.hot = append([]int64(nil), hot...)
+	h.mu.Unlock()
+	if unchanged {
+		return nil
+	}
+	for _, c := range clients {
+		for _, f := range c.getFilters() {
+			if f.hot {
+				c.send(streamEvent{Event: "listing", Data: diff})
+				break
+			}
+		}
+	}
+	return nil
+}
+
+// diffListing the changes that turn old into new
+func diffListing(name string, old []int64, new []int64) listingDiff {
+	diff := listingDiff{Listing: name, Length: len(new), Changes: []listingChange{}}
+	for i, id := range new {
+		if i < len(old) && old[i] == id {
+			continue
+		}
+		diff.Changes = append(diff.Changes, listingChange{Index: i, ID: strconv.FormatInt(id, 10)})
+	}
+	return diff
+}
+
+// threadRoot follow the parents of obj to the post at the root of its thread. parents caches
+// the objects read for a batch of modified objects
+func (h *streamHub) threadRoot(obj db.Object, parents map[int64]db.Object) (int64, error) {
+	for depth := 0; depth < maxThreadDepth; depth++ {
+		post, ok := obj.Data.(*db.Post)
+		if !ok || post.Parent == 0 {
+			return obj.ID, nil
+		}
+		parent, ok := parents[post.Parent]
+		if !ok {
+			var err error
+			parent, err = h.api.objects.GetObject(post.Parent)
+			if err == db.ErrNotFound {
+				// the parent is still being fetched
+				return post.Parent, nil
+			} else if err != nil {
+				return 0, err
+			}
+			parents[parent.ID] = parent
+		}
+		obj = parent
+	}
+	return obj.ID, nil
+}
+
+// pushObjects send the modified objects to the clients whose filters match them
+func (h *streamHub) pushObjects(ids []int64) error {
+	clients, hot := h.snapshot()
+	if len(clients) == 0 {
+		return nil
+	}
+	threads := false
+	for _, c := range clients {
+		for _, f := range c.getFilters() {
+			threads = threads || f.thread != 0
+		}
+	}
+	objects, err := h.api.objects.GetObjects(ids)
+	if err != nil {
+		return errors.Wrap(err, "Error getting modified objects for streaming")
+	}
+	modified := make([]db.Object, 0, len(objects))
+	for _, obj := range objects {
+		modified = append(modified, obj)
+	}
+	authors, err := h.api.objectAuthors(modified)
+	if err != nil {
+		return err
+	}
+	type streamedObject struct {
+		obj    db.Object
+		root   int64
+		author int64
+		event  streamEvent
+	}
+	streamed := make([]streamedObject, 0, len(objects))
+	parents := make(map[int64]db.Object)
+	for _, obj := range objects {
+		apiObj, err := dbObjectToAPIObject(obj, authors)
+		if err != nil {
+			log.Errorf("Error converting object %d for streaming: %s", obj.ID, err)
+			continue
+		}
+		s := streamedObject{obj: obj, author: getAuthor(obj), event: streamEvent{Event: "object", Data: apiObj, object: obj, authors: authors}}
+		if threads {
+			if s.root, err = h.threadRoot(obj, parents); err != nil {
+				return errors.Wrapf(err, "Error getting thread of object %d", obj.ID)
+			}
+		}
+		streamed = append(streamed, s)
+	}
+	for _, c := range clients {
+		filters := c.getFilters()
+		for _, s := range streamed {
+			for _, f := range filters {
+				if (f.hot && hot[s.obj.ID]) ||
+					(f.thread != 0 && f.thread == s.root) ||
+					(f.user != 0 && (f.user == s.obj.ID || f.user == s.author)) {
+					c.send(s.event)
+					break
+				}
+			}
+		}
+	}
+	return nil
+}
+
+func parseStreamFilter(listing string, thread string, user string) (f streamFilter, err error) {
+	switch {
+	case listing != "":
+		if listing != "hot" {
+			return f, fmt.Errorf("Unknown listing %s", listing)
+		}
+		f.hot = true
+	case thread != "":
+		f.thread, err = strconv.ParseInt(thread, 10, 64)
+	case user != "":
+		f.user, err = strconv.ParseInt(user, 10, 64)
+	default:
+		err = fmt.Errorf("No listing, thread or user")
+	}
+	return
+}
+
+// serveSSE stream the events matching f to c as Server-Sent Events until the client disconnects
+func (h *streamHub) serveSSE(c echo.Context, f streamFilter) error {
+	client := newStreamClient()
+	h.add(client)
+	defer h.remove(client)
+	h.subscribe(client, f)
+
+	res := c.Response()
+	res.Header().Set(echo.HeaderContentType, "text/event-stream")
+	res.Header().Set("Cache-Control", "no-cache")
+	res.WriteHeader(http.StatusOK)
+	res.Flush()
+	heartbeat := time.NewTicker(streamHeartbeat)
+	defer heartbeat.Stop()
+	for {
+		select {
+		case <-c.Request().Context().Done():
+			return nil
+		case <-client.dropped:
+			fmt.Fprint(res, "event: reset\ndata: {}\n\n")
+			res.Flush()
+			return nil
+		case <-heartbeat.C:
+			fmt.Fprint(res, ": heartbeat\n\n")
+			res.Flush()
+		case e := <-client.events:
+			data, err := json.Marshal(e.Data)
+			if err != nil {
+				return err
+			}
+			fmt.Fprintf(res, "event: %s\ndata: %s\n\n", e.Event, data)
+			res.Flush()
+		}
+	}
+}
+
+// streamRequest a message from a WebSocket client changing its filters
+type streamRequest struct {
+	Action  string `json:"action"`
+	Listing string `json:"listing"`
+	Thread  string `json:"thread"`
+	User    string `json:"user"`
+}
+
+// checkWebSocketOrigin the origin policy of /stream/ws. Clients without an Origin header are not
+// browsers and are accepted. Browsers are accepted from the API host and from siteBaseURL
+func checkWebSocketOrigin(siteBaseURL string) func(*websocket.Config, *http.Request) error {
+	return func(config *websocket.Config, req *http.Request) error {
+		origin, err := websocket.Origin(config, req)
+		if err != nil {
+			return err
+		}
+		config.Origin = origin
+		if origin == nil || origin.Host == req.Host {
+			return nil
+		}
+		if site, err := url.Parse(siteBaseURL); err == nil && siteBaseURL != "" && origin.Scheme == site.Scheme && origin.Host == site.Host {
+			return nil
+		}
+		return fmt.Errorf("Origin %s is not allowed", origin)
+	}
+}
+
+// serveWebSocket stream the events matching the filters a client subscribes to with
+// streamRequest messages until it disconnects
+func (h *streamHub) serveWebSocket(ws *websocket.Conn) {
+	defer ws.Close()
+	client := newStreamClient()
+	h.add(client)
+	defer h.remove(client)
+
+	closed := make(chan struct{})
+	go func() {
+		defer close(closed)
+		for {
+			var req streamRequest
+			if err := websocket.JSON.Receive(ws, &req); err != nil {
+				return
+			}
+			f, err := parseStreamFilter(req.Listing, req.Thread, req.User)
+			if err != nil {
+				client.send(streamEvent{Event: "error", Data: err.Error()})
+				continue
+			}
+			switch req.Action {
+			case "subscribe":
+				h.subscribe(client, f)
+			case "unsubscribe":
+				client.unsubscribe(f)
+			default:
+				client.send(streamEvent{Event: "error", Data: "Unknown action " + req.Action})
+			}
+		}
+	}()
+	for {
+		select {
+		case <-closed:
+			return
+		case <-client.dropped:
+			websocket.JSON.Send(ws, streamEvent{Event: "reset", Data: struct{}{}})
+			return
+		case e := <-client.events:
+			if err := websocket.JSON.Send(ws, e); err != nil {
+				return
+			}
+		}
+	}
+}
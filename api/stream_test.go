@@ -0,0 +1,61 @@
+package main
+
+import (
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"golang.org/x/net/websocket"
+)
+
+func TestDiffListing(t *testing.T) {
+	diff := diffListing("hot", []int64{1, 2, 3}, []int64{1, 3, 4, 5})
+	expected := listingDiff{Listing: "hot", Length: 4, Changes: []listingChange{{1, "3"}, {2, "4"}, {3, "5"}}}
+	if !reflect.DeepEqual(diff, expected) {
+		t.Errorf("Got diff %+v, expected %+v", diff, expected)
+	}
+	diff = diffListing("hot", []int64{1, 2, 3}, []int64{1, 2})
+	if diff.Length != 2 || len(diff.Changes) != 0 {
+		t.Errorf("Truncated listing diffed as %+v", diff)
+	}
+}
+
+func TestStreamClientDroppedWhenBehind(t *testing.T) {
+	c := newStreamClient()
+	for i := 0; i < streamBuffer; i++ {
+		c.send(streamEvent{Event: "object"})
+	}
+	select {
+	case <-c.dropped:
+		t.Fatal("Client dropped before its buffer was full")
+	default:
+	}
+	c.send(streamEvent{Event: "object"})
+	c.send(streamEvent{Event: "object"})
+	select {
+	case <-c.dropped:
+	default:
+		t.Fatal("Client not dropped with a full buffer")
+	}
+}
+
+func TestCheckWebSocketOrigin(t *testing.T) {
+	check := checkWebSocketOrigin("https://site.example.com")
+	for origin, allowed := range map[string]bool{
+		"":                          true,
+		"http://api.example.com":    true,
+		"https://site.example.com":  true,
+		"http://site.example.com":   false,
+		"https://other.example.com": false,
+		"null":                      false,
+	} {
+		req := httptest.NewRequest("GET", "http://api.example.com/stream/ws", nil)
+		if origin != "" {
+			req.Header.Set("Origin", origin)
+		}
+		err := check(&websocket.Config{Version: websocket.ProtocolVersionHybi13}, req)
+		if (err == nil) != allowed {
+			t.Errorf("Origin %q returned %v, expected allowed %t", origin, err, allowed)
+		}
+	}
+}
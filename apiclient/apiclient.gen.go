@@ -0,0 +1,2401 @@
+// Package apiclient provides primitives to interact with the openapi HTTP API.
+//
+// Code generated by github.com/deepmap/oapi-codegen version v1.12.4 DO NOT EDIT.
+package apiclient
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+
+	"github.com/deepmap/oapi-codegen/pkg/runtime"
+	"github.com/getkin/kin-openapi/openapi3"
+)
+
+const (
+	ApiKeyScopes = "apiKey.Scopes"
+)
+
+// Defines values for SearchParamsType.
+const (
+	SearchParamsTypeComment SearchParamsType = "comment"
+	SearchParamsTypeLink    SearchParamsType = "link"
+	SearchParamsTypeStory   SearchParamsType = "story"
+)
+
+// Defines values for SearchParamsSource.
+const (
+	Hackernews SearchParamsSource = "hackernews"
+	Site       SearchParamsSource = "site"
+)
+
+// Defines values for SearchParamsSort.
+const (
+	Date      SearchParamsSort = "date"
+	Relevance SearchParamsSort = "relevance"
+)
+
+// Author defines model for author.
+type Author struct {
+	Id   string `json:"id"`
+	Name string `json:"name"`
+}
+
+// BulkObjectRequest defines model for bulkObjectRequest.
+type BulkObjectRequest struct {
+	Ids []string `json:"ids"`
+}
+
+// Comment defines model for comment.
+type Comment struct {
+	Author Author `json:"author"`
+
+	// Created Unix time
+	Created int32  `json:"created"`
+	Deleted bool   `json:"deleted"`
+	Id      string `json:"id"`
+	NumKids int32  `json:"num_kids"`
+	Parent  string `json:"parent"`
+	Score   int64  `json:"score"`
+	Source  string `json:"source"`
+	Text    string `json:"text"`
+
+	// Type link, story, comment or user
+	Type string `json:"type"`
+}
+
+// GraphQLError defines model for graphQLError.
+type GraphQLError struct {
+	Locations *[]struct {
+		Column *int `json:"column,omitempty"`
+		Line   *int `json:"line,omitempty"`
+	} `json:"locations"`
+	Message string         `json:"message"`
+	Path    *[]interface{} `json:"path,omitempty"`
+}
+
+// GraphQLRequest defines model for graphQLRequest.
+type GraphQLRequest struct {
+	OperationName *string                 `json:"operationName,omitempty"`
+	Query         string                  `json:"query"`
+	Variables     *map[string]interface{} `json:"variables,omitempty"`
+}
+
+// GraphQLResult defines model for graphQLResult.
+type GraphQLResult struct {
+	Data   *map[string]interface{} `json:"data"`
+	Errors *[]GraphQLError         `json:"errors,omitempty"`
+}
+
+// LinkPost defines model for linkPost.
+type LinkPost struct {
+	Author Author `json:"author"`
+
+	// Created Unix time
+	Created int32  `json:"created"`
+	Dead    bool   `json:"dead"`
+	Deleted bool   `json:"deleted"`
+	Id      string `json:"id"`
+	NumKids int32  `json:"num_kids"`
+	Score   int64  `json:"score"`
+	Source  string `json:"source"`
+	Text    string `json:"text"`
+
+	// Type link, story, comment or user
+	Type string `json:"type"`
+	Url  string `json:"url"`
+}
+
+// Object defines model for object.
+type Object struct {
+	union json.RawMessage
+}
+
+// ObjectFields defines model for objectFields.
+type ObjectFields struct {
+	// Created Unix time
+	Created int32  `json:"created"`
+	Deleted bool   `json:"deleted"`
+	Id      string `json:"id"`
+	Score   int64  `json:"score"`
+	Source  string `json:"source"`
+
+	// Type link, story, comment or user
+	Type string `json:"type"`
+}
+
+// Objects defines model for objects.
+type Objects = []Object
+
+// Revision defines model for revision.
+type Revision struct {
+	Object Object `json:"object"`
+
+	// Replaced Unix time the revision was replaced
+	Replaced int64 `json:"replaced"`
+
+	// Version The object version the revision belonged to
+	Version int `json:"version"`
+}
+
+// SearchResult defines model for searchResult.
+type SearchResult struct {
+	Objects Objects `json:"objects"`
+	Total   int64   `json:"total"`
+}
+
+// TextPost defines model for textPost.
+type TextPost struct {
+	Author Author `json:"author"`
+
+	// Created Unix time
+	Created int32  `json:"created"`
+	Deleted bool   `json:"deleted"`
+	Id      string `json:"id"`
+	NumKids int32  `json:"num_kids"`
+	Score   int64  `json:"score"`
+	Source  string `json:"source"`
+	Text    string `json:"text"`
+	Title   string `json:"title"`
+
+	// Type link, story, comment or user
+	Type string `json:"type"`
+}
+
+// User defines model for user.
+type User struct {
+	About string `json:"about"`
+
+	// Created Unix time
+	Created int32  `json:"created"`
+	Deleted bool   `json:"deleted"`
+	Id      string `json:"id"`
+	Name    string `json:"name"`
+	Score   int64  `json:"score"`
+	Source  string `json:"source"`
+
+	// Type link, story, comment or user
+	Type string `json:"type"`
+}
+
+// Count defines model for count.
+type Count = int
+
+// Id defines model for id.
+type Id = string
+
+// Pretty defines model for pretty.
+type Pretty = string
+
+// Start defines model for start.
+type Start = int
+
+// Feed defines model for feed.
+type Feed = Objects
+
+// Listing defines model for listing.
+type Listing = Objects
+
+// GetHotParams defines parameters for GetHot.
+type GetHotParams struct {
+	// Start Index of the first entry
+	Start *Start `form:"start,omitempty" json:"start,omitempty"`
+
+	// Count Number of entries. Defaults to 30
+	Count *Count `form:"count,omitempty" json:"count,omitempty"`
+
+	// Pretty Indent the JSON when not empty
+	Pretty *Pretty `form:"pretty,omitempty" json:"pretty,omitempty"`
+}
+
+// GetNewParams defines parameters for GetNew.
+type GetNewParams struct {
+	// Start Index of the first entry
+	Start *Start `form:"start,omitempty" json:"start,omitempty"`
+
+	// Count Number of entries. Defaults to 30
+	Count *Count `form:"count,omitempty" json:"count,omitempty"`
+
+	// Pretty Indent the JSON when not empty
+	Pretty *Pretty `form:"pretty,omitempty" json:"pretty,omitempty"`
+}
+
+// GetObjectParams defines parameters for GetObject.
+type GetObjectParams struct {
+	// Pretty Indent the JSON when not empty
+	Pretty *Pretty `form:"pretty,omitempty" json:"pretty,omitempty"`
+}
+
+// GetCommentsParams defines parameters for GetComments.
+type GetCommentsParams struct {
+	// Pretty Indent the JSON when not empty
+	Pretty *Pretty `form:"pretty,omitempty" json:"pretty,omitempty"`
+}
+
+// GetHistoryParams defines parameters for GetHistory.
+type GetHistoryParams struct {
+	// Pretty Indent the JSON when not empty
+	Pretty *Pretty `form:"pretty,omitempty" json:"pretty,omitempty"`
+}
+
+// SearchParams defines parameters for Search.
+type SearchParams struct {
+	Q      string              `form:"q" json:"q"`
+	Type   *SearchParamsType   `form:"type,omitempty" json:"type,omitempty"`
+	Source *SearchParamsSource `form:"source,omitempty" json:"source,omitempty"`
+	Sort   *SearchParamsSort   `form:"sort,omitempty" json:"sort,omitempty"`
+
+	// Start Index of the first entry
+	Start *Start `form:"start,omitempty" json:"start,omitempty"`
+
+	// Count Number of entries. Defaults to 30
+	Count *Count `form:"count,omitempty" json:"count,omitempty"`
+
+	// Pretty Indent the JSON when not empty
+	Pretty *Pretty `form:"pretty,omitempty" json:"pretty,omitempty"`
+}
+
+// SearchParamsType defines parameters for Search.
+type SearchParamsType string
+
+// SearchParamsSource defines parameters for Search.
+type SearchParamsSource string
+
+// SearchParamsSort defines parameters for Search.
+type SearchParamsSort string
+
+// GetSubmissionsParams defines parameters for GetSubmissions.
+type GetSubmissionsParams struct {
+	// Pretty Indent the JSON when not empty
+	Pretty *Pretty `form:"pretty,omitempty" json:"pretty,omitempty"`
+}
+
+// GraphQLJSONRequestBody defines body for GraphQL for application/json ContentType.
+type GraphQLJSONRequestBody = GraphQLRequest
+
+// GetObjectsJSONRequestBody defines body for GetObjects for application/json ContentType.
+type GetObjectsJSONRequestBody = BulkObjectRequest
+
+// AsLinkPost returns the union data inside the Object as a LinkPost
+func (t Object) AsLinkPost() (LinkPost, error) {
+	var body LinkPost
+	err := json.Unmarshal(t.union, &body)
+	return body, err
+}
+
+// FromLinkPost overwrites any union data inside the Object as the provided LinkPost
+func (t *Object) FromLinkPost(v LinkPost) error {
+	v.Type = "link"
+	b, err := json.Marshal(v)
+	t.union = b
+	return err
+}
+
+// MergeLinkPost performs a merge with any union data inside the Object, using the provided LinkPost
+func (t *Object) MergeLinkPost(v LinkPost) error {
+	v.Type = "link"
+	b, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+
+	merged, err := runtime.JsonMerge(b, t.union)
+	t.union = merged
+	return err
+}
+
+// AsTextPost returns the union data inside the Object as a TextPost
+func (t Object) AsTextPost() (TextPost, error) {
+	var body TextPost
+	err := json.Unmarshal(t.union, &body)
+	return body, err
+}
+
+// FromTextPost overwrites any union data inside the Object as the provided TextPost
+func (t *Object) FromTextPost(v TextPost) error {
+	v.Type = "story"
+	b, err := json.Marshal(v)
+	t.union = b
+	return err
+}
+
+// MergeTextPost performs a merge with any union data inside the Object, using the provided TextPost
+func (t *Object) MergeTextPost(v TextPost) error {
+	v.Type = "story"
+	b, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+
+	merged, err := runtime.JsonMerge(b, t.union)
+	t.union = merged
+	return err
+}
+
+// AsComment returns the union data inside the Object as a Comment
+func (t Object) AsComment() (Comment, error) {
+	var body Comment
+	err := json.Unmarshal(t.union, &body)
+	return body, err
+}
+
+// FromComment overwrites any union data inside the Object as the provided Comment
+func (t *Object) FromComment(v Comment) error {
+	v.Type = "comment"
+	b, err := json.Marshal(v)
+	t.union = b
+	return err
+}
+
+// MergeComment performs a merge with any union data inside the Object, using the provided Comment
+func (t *Object) MergeComment(v Comment) error {
+	v.Type = "comment"
+	b, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+
+	merged, err := runtime.JsonMerge(b, t.union)
+	t.union = merged
+	return err
+}
+
+// AsUser returns the union data inside the Object as a User
+func (t Object) AsUser() (User, error) {
+	var body User
+	err := json.Unmarshal(t.union, &body)
+	return body, err
+}
+
+// FromUser overwrites any union data inside the Object as the provided User
+func (t *Object) FromUser(v User) error {
+	v.Type = "user"
+	b, err := json.Marshal(v)
+	t.union = b
+	return err
+}
+
+// MergeUser performs a merge with any union data inside the Object, using the provided User
+func (t *Object) MergeUser(v User) error {
+	v.Type = "user"
+	b, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+
+	merged, err := runtime.JsonMerge(b, t.union)
+	t.union = merged
+	return err
+}
+
+func (t Object) Discriminator() (string, error) {
+	var discriminator struct {
+		Discriminator string `json:"type"`
+	}
+	err := json.Unmarshal(t.union, &discriminator)
+	return discriminator.Discriminator, err
+}
+
+func (t Object) ValueByDiscriminator() (interface{}, error) {
+	discriminator, err := t.Discriminator()
+	if err != nil {
+		return nil, err
+	}
+	switch discriminator {
+	case "comment":
+		return t.AsComment()
+	case "link":
+		return t.AsLinkPost()
+	case "story":
+		return t.AsTextPost()
+	case "user":
+		return t.AsUser()
+	default:
+		return nil, errors.New("unknown discriminator value: " + discriminator)
+	}
+}
+
+func (t Object) MarshalJSON() ([]byte, error) {
+	b, err := t.union.MarshalJSON()
+	return b, err
+}
+
+func (t *Object) UnmarshalJSON(b []byte) error {
+	err := t.union.UnmarshalJSON(b)
+	return err
+}
+
+// RequestEditorFn  is the function signature for the RequestEditor callback function
+type RequestEditorFn func(ctx context.Context, req *http.Request) error
+
+// Doer performs HTTP requests.
+//
+// The standard http.Client implements this interface.
+type HttpRequestDoer interface {
+	Do(req *http.Request) (*http.Response, error)
+}
+
+// Client which conforms to the OpenAPI3 specification for this service.
+type Client struct {
+	// The endpoint of the server conforming to this interface, with scheme,
+	// https://api.deepmap.com for example. This can contain a path relative
+	// to the server, such as https://api.deepmap.com/dev-test, and all the
+	// paths in the swagger spec will be appended to the server.
+	Server string
+
+	// Doer for performing requests, typically a *http.Client with any
+	// customized settings, such as certificate chains.
+	Client HttpRequestDoer
+
+	// A list of callbacks for modifying requests which are generated before sending over
+	// the network.
+	RequestEditors []RequestEditorFn
+}
+
+// ClientOption allows setting custom parameters during construction
+type ClientOption func(*Client) error
+
+// Creates a new Client, with reasonable defaults
+func NewClient(server string, opts ...ClientOption) (*Client, error) {
+	// create a client with sane default values
+	client := Client{
+		Server: server,
+	}
+	// mutate client and add all optional params
+	for _, o := range opts {
+		if err := o(&client); err != nil {
+			return nil, err
+		}
+	}
+	// ensure the server URL always has a trailing slash
+	if !strings.HasSuffix(client.Server, "/") {
+		client.Server += "/"
+	}
+	// create httpClient, if not already present
+	if client.Client == nil {
+		client.Client = &http.Client{}
+	}
+	return &client, nil
+}
+
+// WithHTTPClient allows overriding the default Doer, which is
+// automatically created using http.Client. This is useful for tests.
+func WithHTTPClient(doer HttpRequestDoer) ClientOption {
+	return func(c *Client) error {
+		c.Client = doer
+		return nil
+	}
+}
+
+// WithRequestEditorFn allows setting up a callback function, which will be
+// called right before sending the request. This can be used to mutate the request.
+func WithRequestEditorFn(fn RequestEditorFn) ClientOption {
+	return func(c *Client) error {
+		c.RequestEditors = append(c.RequestEditors, fn)
+		return nil
+	}
+}
+
+// The interface specification for the client above.
+type ClientInterface interface {
+	// GraphQL request with any body
+	GraphQLWithBody(ctx context.Context, contentType string, body io.Reader, reqEditors ...RequestEditorFn) (*http.Response, error)
+
+	GraphQL(ctx context.Context, body GraphQLJSONRequestBody, reqEditors ...RequestEditorFn) (*http.Response, error)
+
+	// GetHot request
+	GetHot(ctx context.Context, params *GetHotParams, reqEditors ...RequestEditorFn) (*http.Response, error)
+
+	// GetNew request
+	GetNew(ctx context.Context, params *GetNewParams, reqEditors ...RequestEditorFn) (*http.Response, error)
+
+	// GetObjects request with any body
+	GetObjectsWithBody(ctx context.Context, contentType string, body io.Reader, reqEditors ...RequestEditorFn) (*http.Response, error)
+
+	GetObjects(ctx context.Context, body GetObjectsJSONRequestBody, reqEditors ...RequestEditorFn) (*http.Response, error)
+
+	// GetObject request
+	GetObject(ctx context.Context, id Id, params *GetObjectParams, reqEditors ...RequestEditorFn) (*http.Response, error)
+
+	// GetComments request
+	GetComments(ctx context.Context, id Id, params *GetCommentsParams, reqEditors ...RequestEditorFn) (*http.Response, error)
+
+	// GetHistory request
+	GetHistory(ctx context.Context, id Id, params *GetHistoryParams, reqEditors ...RequestEditorFn) (*http.Response, error)
+
+	// GetOpenAPI request
+	GetOpenAPI(ctx context.Context, reqEditors ...RequestEditorFn) (*http.Response, error)
+
+	// Search request
+	Search(ctx context.Context, params *SearchParams, reqEditors ...RequestEditorFn) (*http.Response, error)
+
+	// StreamHot request
+	StreamHot(ctx context.Context, reqEditors ...RequestEditorFn) (*http.Response, error)
+
+	// StreamThread request
+	StreamThread(ctx context.Context, id Id, reqEditors ...RequestEditorFn) (*http.Response, error)
+
+	// StreamUser request
+	StreamUser(ctx context.Context, id Id, reqEditors ...RequestEditorFn) (*http.Response, error)
+
+	// GetSubmissions request
+	GetSubmissions(ctx context.Context, name string, params *GetSubmissionsParams, reqEditors ...RequestEditorFn) (*http.Response, error)
+}
+
+func (c *Client) GraphQLWithBody(ctx context.Context, contentType string, body io.Reader, reqEditors ...RequestEditorFn) (*http.Response, error) {
+	req, err := NewGraphQLRequestWithBody(c.Server, contentType, body)
+	if err != nil {
+		return nil, err
+	}
+	req = req.WithContext(ctx)
+	if err := c.applyEditors(ctx, req, reqEditors); err != nil {
+		return nil, err
+	}
+	return c.Client.Do(req)
+}
+
+func (c *Client) GraphQL(ctx context.Context, body GraphQLJSONRequestBody, reqEditors ...RequestEditorFn) (*http.Response, error) {
+	req, err := NewGraphQLRequest(c.Server, body)
+	if err != nil {
+		return nil, err
+	}
+	req = req.WithContext(ctx)
+	if err := c.applyEditors(ctx, req, reqEditors); err != nil {
+		return nil, err
+	}
+	return c.Client.Do(req)
+}
+
+func (c *Client) GetHot(ctx context.Context, params *GetHotParams, reqEditors ...RequestEditorFn) (*http.Response, error) {
+	req, err := NewGetHotRequest(c.Server, params)
+	if err != nil {
+		return nil, err
+	}
+	req = req.WithContext(ctx)
+	if err := c.applyEditors(ctx, req, reqEditors); err != nil {
+		return nil, err
+	}
+	return c.Client.Do(req)
+}
+
+func (c *Client) GetNew(ctx context.Context, params *GetNewParams, reqEditors ...RequestEditorFn) (*http.Response, error) {
+	req, err := NewGetNewRequest(c.Server, params)
+	if err != nil {
+		return nil, err
+	}
+	req = req.WithContext(ctx)
+	if err := c.applyEditors(ctx, req, reqEditors); err != nil {
+		return nil, err
+	}
+	return c.Client.Do(req)
+}
+
+func (c *Client) GetObjectsWithBody(ctx context.Context, contentType string, body io.Reader, reqEditors ...RequestEditorFn) (*http.Response, error) {
+	req, err := NewGetObjectsRequestWithBody(c.Server, contentType, body)
+	if err != nil {
+		return nil, err
+	}
+	req = req.WithContext(ctx)
+	if err := c.applyEditors(ctx, req, reqEditors); err != nil {
+		return nil, err
+	}
+	return c.Client.Do(req)
+}
+
+func (c *Client) GetObjects(ctx context.Context, body GetObjectsJSONRequestBody, reqEditors ...RequestEditorFn) (*http.Response, error) {
+	req, err := NewGetObjectsRequest(c.Server, body)
+	if err != nil {
+		return nil, err
+	}
+	req = req.WithContext(ctx)
+	if err := c.applyEditors(ctx, req, reqEditors); err != nil {
+		return nil, err
+	}
+	return c.Client.Do(req)
+}
+
+func (c *Client) GetObject(ctx context.Context, id Id, params *GetObjectParams, reqEditors ...RequestEditorFn) (*http.Response, error) {
+	req, err := NewGetObjectRequest(c.Server, id, params)
+	if err != nil {
+		return nil, err
+	}
+	req = req.WithContext(ctx)
+	if err := c.applyEditors(ctx, req, reqEditors); err != nil {
+		return nil, err
+	}
+	return c.Client.Do(req)
+}
+
+func (c *Client) GetComments(ctx context.Context, id Id, params *GetCommentsParams, reqEditors ...RequestEditorFn) (*http.Response, error) {
+	req, err := NewGetCommentsRequest(c.Server, id, params)
+	if err != nil {
+		return nil, err
+	}
+	req = req.WithContext(ctx)
+	if err := c.applyEditors(ctx, req, reqEditors); err != nil {
+		return nil, err
+	}
+	return c.Client.Do(req)
+}
+
+func (c *Client) GetHistory(ctx context.Context, id Id, params *GetHistoryParams, reqEditors ...RequestEditorFn) (*http.Response, error) {
+	req, err := NewGetHistoryRequest(c.Server, id, params)
+	if err != nil {
+		return nil, err
+	}
+	req = req.WithContext(ctx)
+	if err := c.applyEditors(ctx, req, reqEditors); err != nil {
+		return nil, err
+	}
+	return c.Client.Do(req)
+}
+
+func (c *Client) GetOpenAPI(ctx context.Context, reqEditors ...RequestEditorFn) (*http.Response, error) {
+	req, err := NewGetOpenAPIRequest(c.Server)
+	if err != nil {
+		return nil, err
+	}
+	req = req.WithContext(ctx)
+	if err := c.applyEditors(ctx, req, reqEditors); err != nil {
+		return nil, err
+	}
+	return c.Client.Do(req)
+}
+
+func (c *Client) Search(ctx context.Context, params *SearchParams, reqEditors ...RequestEditorFn) (*http.Response, error) {
+	req, err := NewSearchRequest(c.Server, params)
+	if err != nil {
+		return nil, err
+	}
+	req = req.WithContext(ctx)
+	if err := c.applyEditors(ctx, req, reqEditors); err != nil {
+		return nil, err
+	}
+	return c.Client.Do(req)
+}
+
+func (c *Client) StreamHot(ctx context.Context, reqEditors ...RequestEditorFn) (*http.Response, error) {
+	req, err := NewStreamHotRequest(c.Server)
+	if err != nil {
+		return nil, err
+	}
+	req = req.WithContext(ctx)
+	if err := c.applyEditors(ctx, req, reqEditors); err != nil {
+		return nil, err
+	}
+	return c.Client.Do(req)
+}
+
+func (c *Client) StreamThread(ctx context.Context, id Id, reqEditors ...RequestEditorFn) (*http.Response, error) {
+	req, err := NewStreamThreadRequest(c.Server, id)
+	if err != nil {
+		return nil, err
+	}
+	req = req.WithContext(ctx)
+	if err := c.applyEditors(ctx, req, reqEditors); err != nil {
+		return nil, err
+	}
+	return c.Client.Do(req)
+}
+
+func (c *Client) StreamUser(ctx context.Context, id Id, reqEditors ...RequestEditorFn) (*http.Response, error) {
+	req, err := NewStreamUserRequest(c.Server, id)
+	if err != nil {
+		return nil, err
+	}
+	req = req.WithContext(ctx)
+	if err := c.applyEditors(ctx, req, reqEditors); err != nil {
+		return nil, err
+	}
+	return c.Client.Do(req)
+}
+
+func (c *Client) GetSubmissions(ctx context.Context, name string, params *GetSubmissionsParams, reqEditors ...RequestEditorFn) (*http.Response, error) {
+	req, err := NewGetSubmissionsRequest(c.Server, name, params)
+	if err != nil {
+		return nil, err
+	}
+	req = req.WithContext(ctx)
+	if err := c.applyEditors(ctx, req, reqEditors); err != nil {
+		return nil, err
+	}
+	return c.Client.Do(req)
+}
+
+// NewGraphQLRequest calls the generic GraphQL builder with application/json body
+func NewGraphQLRequest(server string, body GraphQLJSONRequestBody) (*http.Request, error) {
+	var bodyReader io.Reader
+	buf, err := json.Marshal(body)
+	if err != nil {
+		return nil, err
+	}
+	bodyReader = bytes.NewReader(buf)
+	return NewGraphQLRequestWithBody(server, "application/json", bodyReader)
+}
+
+// NewGraphQLRequestWithBody generates requests for GraphQL with any type of body
+func NewGraphQLRequestWithBody(server string, contentType string, body io.Reader) (*http.Request, error) {
+	var err error
+
+	serverURL, err := url.Parse(server)
+	if err != nil {
+		return nil, err
+	}
+
+	operationPath := fmt.Sprintf("/graphql")
+	if operationPath[0] == '/' {
+		operationPath = "." + operationPath
+	}
+
+	queryURL, err := serverURL.Parse(operationPath)
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequest("POST", queryURL.String(), body)
+	if err != nil {
+		return nil, err
+	}
+
+	req.Header.Add("Content-Type", contentType)
+
+	return req, nil
+}
+
+// NewGetHotRequest generates requests for GetHot
+func NewGetHotRequest(server string, params *GetHotParams) (*http.Request, error) {
+	var err error
+
+	serverURL, err := url.Parse(server)
+	if err != nil {
+		return nil, err
+	}
+
+	operationPath := fmt.Sprintf("/hot")
+	if operationPath[0] == '/' {
+		operationPath = "." + operationPath
+	}
+
+	queryURL, err := serverURL.Parse(operationPath)
+	if err != nil {
+		return nil, err
+	}
+
+	queryValues := queryURL.Query()
+
+	if params.Start != nil {
+
+		if queryFrag, err := runtime.StyleParamWithLocation("form", true, "start", runtime.ParamLocationQuery, *params.Start); err != nil {
+			return nil, err
+		} else if parsed, err := url.ParseQuery(queryFrag); err != nil {
+			return nil, err
+		} else {
+			for k, v := range parsed {
+				for _, v2 := range v {
+					queryValues.Add(k, v2)
+				}
+			}
+		}
+
+	}
+
+	if params.Count != nil {
+
+		if queryFrag, err := runtime.StyleParamWithLocation("form", true, "count", runtime.ParamLocationQuery, *params.Count); err != nil {
+			return nil, err
+		} else if parsed, err := url.ParseQuery(queryFrag); err != nil {
+			return nil, err
+		} else {
+			for k, v := range parsed {
+				for _, v2 := range v {
+					queryValues.Add(k, v2)
+				}
+			}
+		}
+
+	}
+
+	if params.Pretty != nil {
+
+		if queryFrag, err := runtime.StyleParamWithLocation("form", true, "pretty", runtime.ParamLocationQuery, *params.Pretty); err != nil {
+			return nil, err
+		} else if parsed, err := url.ParseQuery(queryFrag); err != nil {
+			return nil, err
+		} else {
+			for k, v := range parsed {
+				for _, v2 := range v {
+					queryValues.Add(k, v2)
+				}
+			}
+		}
+
+	}
+
+	queryURL.RawQuery = queryValues.Encode()
+
+	req, err := http.NewRequest("GET", queryURL.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	return req, nil
+}
+
+// NewGetNewRequest generates requests for GetNew
+func NewGetNewRequest(server string, params *GetNewParams) (*http.Request, error) {
+	var err error
+
+	serverURL, err := url.Parse(server)
+	if err != nil {
+		return nil, err
+	}
+
+	operationPath := fmt.Sprintf("/new")
+	if operationPath[0] == '/' {
+		operationPath = "." + operationPath
+	}
+
+	queryURL, err := serverURL.Parse(operationPath)
+	if err != nil {
+		return nil, err
+	}
+
+	queryValues := queryURL.Query()
+
+	if params.Start != nil {
+
+		if queryFrag, err := runtime.StyleParamWithLocation("form", true, "start", runtime.ParamLocationQuery, *params.Start); err != nil {
+			return nil, err
+		} else if parsed, err := url.ParseQuery(queryFrag); err != nil {
+			return nil, err
+		} else {
+			for k, v := range parsed {
+				for _, v2 := range v {
+					queryValues.Add(k, v2)
+				}
+			}
+		}
+
+	}
+
+	if params.Count != nil {
+
+		if queryFrag, err := runtime.StyleParamWithLocation("form", true, "count", runtime.ParamLocationQuery, *params.Count); err != nil {
+			return nil, err
+		} else if parsed, err := url.ParseQuery(queryFrag); err != nil {
+			return nil, err
+		} else {
+			for k, v := range parsed {
+				for _, v2 := range v {
+					queryValues.Add(k, v2)
+				}
+			}
+		}
+
+	}
+
+	if params.Pretty != nil {
+
+		if queryFrag, err := runtime.StyleParamWithLocation("form", true, "pretty", runtime.ParamLocationQuery, *params.Pretty); err != nil {
+			return nil, err
+		} else if parsed, err := url.ParseQuery(queryFrag); err != nil {
+			return nil, err
+		} else {
+			for k, v := range parsed {
+				for _, v2 := range v {
+					queryValues.Add(k, v2)
+				}
+			}
+		}
+
+	}
+
+	queryURL.RawQuery = queryValues.Encode()
+
+	req, err := http.NewRequest("GET", queryURL.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	return req, nil
+}
+
+// NewGetObjectsRequest calls the generic GetObjects builder with application/json body
+func NewGetObjectsRequest(server string, body GetObjectsJSONRequestBody) (*http.Request, error) {
+	var bodyReader io.Reader
+	buf, err := json.Marshal(body)
+	if err != nil {
+		return nil, err
+	}
+	bodyReader = bytes.NewReader(buf)
+	return NewGetObjectsRequestWithBody(server, "application/json", bodyReader)
+}
+
+// NewGetObjectsRequestWithBody generates requests for GetObjects with any type of body
+func NewGetObjectsRequestWithBody(server string, contentType string, body io.Reader) (*http.Request, error) {
+	var err error
+
+	serverURL, err := url.Parse(server)
+	if err != nil {
+		return nil, err
+	}
+
+	operationPath := fmt.Sprintf("/object/bulk")
+	if operationPath[0] == '/' {
+		operationPath = "." + operationPath
+	}
+
+	queryURL, err := serverURL.Parse(operationPath)
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequest("POST", queryURL.String(), body)
+	if err != nil {
+		return nil, err
+	}
+
+	req.Header.Add("Content-Type", contentType)
+
+	return req, nil
+}
+
+// NewGetObjectRequest generates requests for GetObject
+func NewGetObjectRequest(server string, id Id, params *GetObjectParams) (*http.Request, error) {
+	var err error
+
+	var pathParam0 string
+
+	pathParam0, err = runtime.StyleParamWithLocation("simple", false, "id", runtime.ParamLocationPath, id)
+	if err != nil {
+		return nil, err
+	}
+
+	serverURL, err := url.Parse(server)
+	if err != nil {
+		return nil, err
+	}
+
+	operationPath := fmt.Sprintf("/object/%s", pathParam0)
+	if operationPath[0] == '/' {
+		operationPath = "." + operationPath
+	}
+
+	queryURL, err := serverURL.Parse(operationPath)
+	if err != nil {
+		return nil, err
+	}
+
+	queryValues := queryURL.Query()
+
+	if params.Pretty != nil {
+
+		if queryFrag, err := runtime.StyleParamWithLocation("form", true, "pretty", runtime.ParamLocationQuery, *params.Pretty); err != nil {
+			return nil, err
+		} else if parsed, err := url.ParseQuery(queryFrag); err != nil {
+			return nil, err
+		} else {
+			for k, v := range parsed {
+				for _, v2 := range v {
+					queryValues.Add(k, v2)
+				}
+			}
+		}
+
+	}
+
+	queryURL.RawQuery = queryValues.Encode()
+
+	req, err := http.NewRequest("GET", queryURL.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	return req, nil
+}
+
+// NewGetCommentsRequest generates requests for GetComments
+func NewGetCommentsRequest(server string, id Id, params *GetCommentsParams) (*http.Request, error) {
+	var err error
+
+	var pathParam0 string
+
+	pathParam0, err = runtime.StyleParamWithLocation("simple", false, "id", runtime.ParamLocationPath, id)
+	if err != nil {
+		return nil, err
+	}
+
+	serverURL, err := url.Parse(server)
+	if err != nil {
+		return nil, err
+	}
+
+	operationPath := fmt.Sprintf("/object/%s/comments", pathParam0)
+	if operationPath[0] == '/' {
+		operationPath = "." + operationPath
+	}
+
+	queryURL, err := serverURL.Parse(operationPath)
+	if err != nil {
+		return nil, err
+	}
+
+	queryValues := queryURL.Query()
+
+	if params.Pretty != nil {
+
+		if queryFrag, err := runtime.StyleParamWithLocation("form", true, "pretty", runtime.ParamLocationQuery, *params.Pretty); err != nil {
+			return nil, err
+		} else if parsed, err := url.ParseQuery(queryFrag); err != nil {
+			return nil, err
+		} else {
+			for k, v := range parsed {
+				for _, v2 := range v {
+					queryValues.Add(k, v2)
+				}
+			}
+		}
+
+	}
+
+	queryURL.RawQuery = queryValues.Encode()
+
+	req, err := http.NewRequest("GET", queryURL.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	return req, nil
+}
+
+// NewGetHistoryRequest generates requests for GetHistory
+func NewGetHistoryRequest(server string, id Id, params *GetHistoryParams) (*http.Request, error) {
+	var err error
+
+	var pathParam0 string
+
+	pathParam0, err = runtime.StyleParamWithLocation("simple", false, "id", runtime.ParamLocationPath, id)
+	if err != nil {
+		return nil, err
+	}
+
+	serverURL, err := url.Parse(server)
+	if err != nil {
+		return nil, err
+	}
+
+	operationPath := fmt.Sprintf("/object/%s/history", pathParam0)
+	if operationPath[0] == '/' {
+		operationPath = "." + operationPath
+	}
+
+	queryURL, err := serverURL.Parse(operationPath)
+	if err != nil {
+		return nil, err
+	}
+
+	queryValues := queryURL.Query()
+
+	if params.Pretty != nil {
+
+		if queryFrag, err := runtime.StyleParamWithLocation("form", true, "pretty", runtime.ParamLocationQuery, *params.Pretty); err != nil {
+			return nil, err
+		} else if parsed, err := url.ParseQuery(queryFrag); err != nil {
+			return nil, err
+		} else {
+			for k, v := range parsed {
+				for _, v2 := range v {
+					queryValues.Add(k, v2)
+				}
+			}
+		}
+
+	}
+
+	queryURL.RawQuery = queryValues.Encode()
+
+	req, err := http.NewRequest("GET", queryURL.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	return req, nil
+}
+
+// NewGetOpenAPIRequest generates requests for GetOpenAPI
+func NewGetOpenAPIRequest(server string) (*http.Request, error) {
+	var err error
+
+	serverURL, err := url.Parse(server)
+	if err != nil {
+		return nil, err
+	}
+
+	operationPath := fmt.Sprintf("/openapi.json")
+	if operationPath[0] == '/' {
+		operationPath = "." + operationPath
+	}
+
+	queryURL, err := serverURL.Parse(operationPath)
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequest("GET", queryURL.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	return req, nil
+}
+
+// NewSearchRequest generates requests for Search
+func NewSearchRequest(server string, params *SearchParams) (*http.Request, error) {
+	var err error
+
+	serverURL, err := url.Parse(server)
+	if err != nil {
+		return nil, err
+	}
+
+	operationPath := fmt.Sprintf("/search")
+	if operationPath[0] == '/' {
+		operationPath = "." + operationPath
+	}
+
+	queryURL, err := serverURL.Parse(operationPath)
+	if err != nil {
+		return nil, err
+	}
+
+	queryValues := queryURL.Query()
+
+	if queryFrag, err := runtime.StyleParamWithLocation("form", true, "q", runtime.ParamLocationQuery, params.Q); err != nil {
+		return nil, err
+	} else if parsed, err := url.ParseQuery(queryFrag); err != nil {
+		return nil, err
+	} else {
+		for k, v := range parsed {
+			for _, v2 := range v {
+				queryValues.Add(k, v2)
+			}
+		}
+	}
+
+	if params.Type != nil {
+
+		if queryFrag, err := runtime.StyleParamWithLocation("form", true, "type", runtime.ParamLocationQuery, *params.Type); err != nil {
+			return nil, err
+		} else if parsed, err := url.ParseQuery(queryFrag); err != nil {
+			return nil, err
+		} else {
+			for k, v := range parsed {
+				for _, v2 := range v {
+					queryValues.Add(k, v2)
+				}
+			}
+		}
+
+	}
+
+	if params.Source != nil {
+
+		if queryFrag, err := runtime.StyleParamWithLocation("form", true, "source", runtime.ParamLocationQuery, *params.Source); err != nil {
+			return nil, err
+		} else if parsed, err := url.ParseQuery(queryFrag); err != nil {
+			return nil, err
+		} else {
+			for k, v := range parsed {
+				for _, v2 := range v {
+					queryValues.Add(k, v2)
+				}
+			}
+		}
+
+	}
+
+	if params.Sort != nil {
+
+		if queryFrag, err := runtime.StyleParamWithLocation("form", true, "sort", runtime.ParamLocationQuery, *params.Sort); err != nil {
+			return nil, err
+		} else if parsed, err := url.ParseQuery(queryFrag); err != nil {
+			return nil, err
+		} else {
+			for k, v := range parsed {
+				for _, v2 := range v {
+					queryValues.Add(k, v2)
+				}
+			}
+		}
+
+	}
+
+	if params.Start != nil {
+
+		if queryFrag, err := runtime.StyleParamWithLocation("form", true, "start", runtime.ParamLocationQuery, *params.Start); err != nil {
+			return nil, err
+		} else if parsed, err := url.ParseQuery(queryFrag); err != nil {
+			return nil, err
+		} else {
+			for k, v := range parsed {
+				for _, v2 := range v {
+					queryValues.Add(k, v2)
+				}
+			}
+		}
+
+	}
+
+	if params.Count != nil {
+
+		if queryFrag, err := runtime.StyleParamWithLocation("form", true, "count", runtime.ParamLocationQuery, *params.Count); err != nil {
+			return nil, err
+		} else if parsed, err := url.ParseQuery(queryFrag); err != nil {
+			return nil, err
+		} else {
+			for k, v := range parsed {
+				for _, v2 := range v {
+					queryValues.Add(k, v2)
+				}
+			}
+		}
+
+	}
+
+	if params.Pretty != nil {
+
+		if queryFrag, err := runtime.StyleParamWithLocation("form", true, "pretty", runtime.ParamLocationQuery, *params.Pretty); err != nil {
+			return nil, err
+		} else if parsed, err := url.ParseQuery(queryFrag); err != nil {
+			return nil, err
+		} else {
+			for k, v := range parsed {
+				for _, v2 := range v {
+					queryValues.Add(k, v2)
+				}
+			}
+		}
+
+	}
+
+	queryURL.RawQuery = queryValues.Encode()
+
+	req, err := http.NewRequest("GET", queryURL.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	return req, nil
+}
+
+// NewStreamHotRequest generates requests for StreamHot
+func NewStreamHotRequest(server string) (*http.Request, error) {
+	var err error
+
+	serverURL, err := url.Parse(server)
+	if err != nil {
+		return nil, err
+	}
+
+	operationPath := fmt.Sprintf("/stream/hot")
+	if operationPath[0] == '/' {
+		operationPath = "." + operationPath
+	}
+
+	queryURL, err := serverURL.Parse(operationPath)
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequest("GET", queryURL.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	return req, nil
+}
+
+// NewStreamThreadRequest generates requests for StreamThread
+func NewStreamThreadRequest(server string, id Id) (*http.Request, error) {
+	var err error
+
+	var pathParam0 string
+
+	pathParam0, err = runtime.StyleParamWithLocation("simple", false, "id", runtime.ParamLocationPath, id)
+	if err != nil {
+		return nil, err
+	}
+
+	serverURL, err := url.Parse(server)
+	if err != nil {
+		return nil, err
+	}
+
+	operationPath := fmt.Sprintf("/stream/thread/%s", pathParam0)
+	if operationPath[0] == '/' {
+		operationPath = "." + operationPath
+	}
+
+	queryURL, err := serverURL.Parse(operationPath)
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequest("GET", queryURL.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	return req, nil
+}
+
+// NewStreamUserRequest generates requests for StreamUser
+func NewStreamUserRequest(server string, id Id) (*http.Request, error) {
+	var err error
+
+	var pathParam0 string
+
+	pathParam0, err = runtime.StyleParamWithLocation("simple", false, "id", runtime.ParamLocationPath, id)
+	if err != nil {
+		return nil, err
+	}
+
+	serverURL, err := url.Parse(server)
+	if err != nil {
+		return nil, err
+	}
+
+	operationPath := fmt.Sprintf("/stream/user/%s", pathParam0)
+	if operationPath[0] == '/' {
+		operationPath = "." + operationPath
+	}
+
+	queryURL, err := serverURL.Parse(operationPath)
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequest("GET", queryURL.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	return req, nil
+}
+
+// NewGetSubmissionsRequest generates requests for GetSubmissions
+func NewGetSubmissionsRequest(server string, name string, params *GetSubmissionsParams) (*http.Request, error) {
+	var err error
+
+	var pathParam0 string
+
+	pathParam0, err = runtime.StyleParamWithLocation("simple", false, "name", runtime.ParamLocationPath, name)
+	if err != nil {
+		return nil, err
+	}
+
+	serverURL, err := url.Parse(server)
+	if err != nil {
+		return nil, err
+	}
+
+	operationPath := fmt.Sprintf("/user/%s/submissions", pathParam0)
+	if operationPath[0] == '/' {
+		operationPath = "." + operationPath
+	}
+
+	queryURL, err := serverURL.Parse(operationPath)
+	if err != nil {
+		return nil, err
+	}
+
+	queryValues := queryURL.Query()
+
+	if params.Pretty != nil {
+
+		if queryFrag, err := runtime.StyleParamWithLocation("form", true, "pretty", runtime.ParamLocationQuery, *params.Pretty); err != nil {
+			return nil, err
+		} else if parsed, err := url.ParseQuery(queryFrag); err != nil {
+			return nil, err
+		} else {
+			for k, v := range parsed {
+				for _, v2 := range v {
+					queryValues.Add(k, v2)
+				}
+			}
+		}
+
+	}
+
+	queryURL.RawQuery = queryValues.Encode()
+
+	req, err := http.NewRequest("GET", queryURL.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	return req, nil
+}
+
+func (c *Client) applyEditors(ctx context.Context, req *http.Request, additionalEditors []RequestEditorFn) error {
+	for _, r := range c.RequestEditors {
+		if err := r(ctx, req); err != nil {
+			return err
+		}
+	}
+	for _, r := range additionalEditors {
+		if err := r(ctx, req); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ClientWithResponses builds on ClientInterface to offer response payloads
+type ClientWithResponses struct {
+	ClientInterface
+}
+
+// NewClientWithResponses creates a new ClientWithResponses, which wraps
+// Client with return type handling
+func NewClientWithResponses(server string, opts ...ClientOption) (*ClientWithResponses, error) {
+	client, err := NewClient(server, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return &ClientWithResponses{client}, nil
+}
+
+// WithBaseURL overrides the baseURL.
+func WithBaseURL(baseURL string) ClientOption {
+	return func(c *Client) error {
+		newBaseURL, err := url.Parse(baseURL)
+		if err != nil {
+			return err
+		}
+		c.Server = newBaseURL.String()
+		return nil
+	}
+}
+
+// ClientWithResponsesInterface is the interface specification for the client with responses above.
+type ClientWithResponsesInterface interface {
+	// GraphQL request with any body
+	GraphQLWithBodyWithResponse(ctx context.Context, contentType string, body io.Reader, reqEditors ...RequestEditorFn) (*GraphQLResponse, error)
+
+	GraphQLWithResponse(ctx context.Context, body GraphQLJSONRequestBody, reqEditors ...RequestEditorFn) (*GraphQLResponse, error)
+
+	// GetHot request
+	GetHotWithResponse(ctx context.Context, params *GetHotParams, reqEditors ...RequestEditorFn) (*GetHotResponse, error)
+
+	// GetNew request
+	GetNewWithResponse(ctx context.Context, params *GetNewParams, reqEditors ...RequestEditorFn) (*GetNewResponse, error)
+
+	// GetObjects request with any body
+	GetObjectsWithBodyWithResponse(ctx context.Context, contentType string, body io.Reader, reqEditors ...RequestEditorFn) (*GetObjectsResponse, error)
+
+	GetObjectsWithResponse(ctx context.Context, body GetObjectsJSONRequestBody, reqEditors ...RequestEditorFn) (*GetObjectsResponse, error)
+
+	// GetObject request
+	GetObjectWithResponse(ctx context.Context, id Id, params *GetObjectParams, reqEditors ...RequestEditorFn) (*GetObjectResponse, error)
+
+	// GetComments request
+	GetCommentsWithResponse(ctx context.Context, id Id, params *GetCommentsParams, reqEditors ...RequestEditorFn) (*GetCommentsResponse, error)
+
+	// GetHistory request
+	GetHistoryWithResponse(ctx context.Context, id Id, params *GetHistoryParams, reqEditors ...RequestEditorFn) (*GetHistoryResponse, error)
+
+	// GetOpenAPI request
+	GetOpenAPIWithResponse(ctx context.Context, reqEditors ...RequestEditorFn) (*GetOpenAPIResponse, error)
+
+	// Search request
+	SearchWithResponse(ctx context.Context, params *SearchParams, reqEditors ...RequestEditorFn) (*SearchResponse, error)
+
+	// StreamHot request
+	StreamHotWithResponse(ctx context.Context, reqEditors ...RequestEditorFn) (*StreamHotResponse, error)
+
+	// StreamThread request
+	StreamThreadWithResponse(ctx context.Context, id Id, reqEditors ...RequestEditorFn) (*StreamThreadResponse, error)
+
+	// StreamUser request
+	StreamUserWithResponse(ctx context.Context, id Id, reqEditors ...RequestEditorFn) (*StreamUserResponse, error)
+
+	// GetSubmissions request
+	GetSubmissionsWithResponse(ctx context.Context, name string, params *GetSubmissionsParams, reqEditors ...RequestEditorFn) (*GetSubmissionsResponse, error)
+}
+
+type GraphQLResponse struct {
+	Body         []byte
+	HTTPResponse *http.Response
+	JSON200      *GraphQLResult
+	JSON400      *GraphQLResult
+}
+
+// Status returns HTTPResponse.Status
+func (r GraphQLResponse) Status() string {
+	if r.HTTPResponse != nil {
+		return r.HTTPResponse.Status
+	}
+	return http.StatusText(0)
+}
+
+// StatusCode returns HTTPResponse.StatusCode
+func (r GraphQLResponse) StatusCode() int {
+	if r.HTTPResponse != nil {
+		return r.HTTPResponse.StatusCode
+	}
+	return 0
+}
+
+type GetHotResponse struct {
+	Body         []byte
+	HTTPResponse *http.Response
+	JSON200      *Objects
+}
+
+// Status returns HTTPResponse.Status
+func (r GetHotResponse) Status() string {
+	if r.HTTPResponse != nil {
+		return r.HTTPResponse.Status
+	}
+	return http.StatusText(0)
+}
+
+// StatusCode returns HTTPResponse.StatusCode
+func (r GetHotResponse) StatusCode() int {
+	if r.HTTPResponse != nil {
+		return r.HTTPResponse.StatusCode
+	}
+	return 0
+}
+
+type GetNewResponse struct {
+	Body         []byte
+	HTTPResponse *http.Response
+	JSON200      *Objects
+}
+
+// Status returns HTTPResponse.Status
+func (r GetNewResponse) Status() string {
+	if r.HTTPResponse != nil {
+		return r.HTTPResponse.Status
+	}
+	return http.StatusText(0)
+}
+
+// StatusCode returns HTTPResponse.StatusCode
+func (r GetNewResponse) StatusCode() int {
+	if r.HTTPResponse != nil {
+		return r.HTTPResponse.StatusCode
+	}
+	return 0
+}
+
+type GetObjectsResponse struct {
+	Body         []byte
+	HTTPResponse *http.Response
+	JSON200      *Objects
+}
+
+// Status returns HTTPResponse.Status
+func (r GetObjectsResponse) Status() string {
+	if r.HTTPResponse != nil {
+		return r.HTTPResponse.Status
+	}
+	return http.StatusText(0)
+}
+
+// StatusCode returns HTTPResponse.StatusCode
+func (r GetObjectsResponse) StatusCode() int {
+	if r.HTTPResponse != nil {
+		return r.HTTPResponse.StatusCode
+	}
+	return 0
+}
+
+type GetObjectResponse struct {
+	Body         []byte
+	HTTPResponse *http.Response
+	JSON200      *Object
+}
+
+// Status returns HTTPResponse.Status
+func (r GetObjectResponse) Status() string {
+	if r.HTTPResponse != nil {
+		return r.HTTPResponse.Status
+	}
+	return http.StatusText(0)
+}
+
+// StatusCode returns HTTPResponse.StatusCode
+func (r GetObjectResponse) StatusCode() int {
+	if r.HTTPResponse != nil {
+		return r.HTTPResponse.StatusCode
+	}
+	return 0
+}
+
+type GetCommentsResponse struct {
+	Body         []byte
+	HTTPResponse *http.Response
+	JSON200      *Objects
+}
+
+// Status returns HTTPResponse.Status
+func (r GetCommentsResponse) Status() string {
+	if r.HTTPResponse != nil {
+		return r.HTTPResponse.Status
+	}
+	return http.StatusText(0)
+}
+
+// StatusCode returns HTTPResponse.StatusCode
+func (r GetCommentsResponse) StatusCode() int {
+	if r.HTTPResponse != nil {
+		return r.HTTPResponse.StatusCode
+	}
+	return 0
+}
+
+type GetHistoryResponse struct {
+	Body         []byte
+	HTTPResponse *http.Response
+	JSON200      *[]Revision
+}
+
+// Status returns HTTPResponse.Status
+func (r GetHistoryResponse) Status() string {
+	if r.HTTPResponse != nil {
+		return r.HTTPResponse.Status
+	}
+	return http.StatusText(0)
+}
+
+// StatusCode returns HTTPResponse.StatusCode
+func (r GetHistoryResponse) StatusCode() int {
+	if r.HTTPResponse != nil {
+		return r.HTTPResponse.StatusCode
+	}
+	return 0
+}
+
+type GetOpenAPIResponse struct {
+	Body         []byte
+	HTTPResponse *http.Response
+	JSON200      *map[string]interface{}
+}
+
+// Status returns HTTPResponse.Status
+func (r GetOpenAPIResponse) Status() string {
+	if r.HTTPResponse != nil {
+		return r.HTTPResponse.Status
+	}
+	return http.StatusText(0)
+}
+
+// StatusCode returns HTTPResponse.StatusCode
+func (r GetOpenAPIResponse) StatusCode() int {
+	if r.HTTPResponse != nil {
+		return r.HTTPResponse.StatusCode
+	}
+	return 0
+}
+
+type SearchResponse struct {
+	Body         []byte
+	HTTPResponse *http.Response
+	JSON200      *SearchResult
+}
+
+// Status returns HTTPResponse.Status
+func (r SearchResponse) Status() string {
+	if r.HTTPResponse != nil {
+		return r.HTTPResponse.Status
+	}
+	return http.StatusText(0)
+}
+
+// StatusCode returns HTTPResponse.StatusCode
+func (r SearchResponse) StatusCode() int {
+	if r.HTTPResponse != nil {
+		return r.HTTPResponse.StatusCode
+	}
+	return 0
+}
+
+type StreamHotResponse struct {
+	Body         []byte
+	HTTPResponse *http.Response
+}
+
+// Status returns HTTPResponse.Status
+func (r StreamHotResponse) Status() string {
+	if r.HTTPResponse != nil {
+		return r.HTTPResponse.Status
+	}
+	return http.StatusText(0)
+}
+
+// StatusCode returns HTTPResponse.StatusCode
+func (r StreamHotResponse) StatusCode() int {
+	if r.HTTPResponse != nil {
+		return r.HTTPResponse.StatusCode
+	}
+	return 0
+}
+
+type StreamThreadResponse struct {
+	Body         []byte
+	HTTPResponse *http.Response
+}
+
+// Status returns HTTPResponse.Status
+func (r StreamThreadResponse) Status() string {
+	if r.HTTPResponse != nil {
+		return r.HTTPResponse.Status
+	}
+	return http.StatusText(0)
+}
+
+// StatusCode returns HTTPResponse.StatusCode
+func (r StreamThreadResponse) StatusCode() int {
+	if r.HTTPResponse != nil {
+		return r.HTTPResponse.StatusCode
+	}
+	return 0
+}
+
+type StreamUserResponse struct {
+	Body         []byte
+	HTTPResponse *http.Response
+}
+
+// Status returns HTTPResponse.Status
+func (r StreamUserResponse) Status() string {
+	if r.HTTPResponse != nil {
+		return r.HTTPResponse.Status
+	}
+	return http.StatusText(0)
+}
+
+// StatusCode returns HTTPResponse.StatusCode
+func (r StreamUserResponse) StatusCode() int {
+	if r.HTTPResponse != nil {
+		return r.HTTPResponse.StatusCode
+	}
+	return 0
+}
+
+type GetSubmissionsResponse struct {
+	Body         []byte
+	HTTPResponse *http.Response
+	JSON200      *Objects
+}
+
+// Status returns HTTPResponse.Status
+func (r GetSubmissionsResponse) Status() string {
+	if r.HTTPResponse != nil {
+		return r.HTTPResponse.Status
+	}
+	return http.StatusText(0)
+}
+
+// StatusCode returns HTTPResponse.StatusCode
+func (r GetSubmissionsResponse) StatusCode() int {
+	if r.HTTPResponse != nil {
+		return r.HTTPResponse.StatusCode
+	}
+	return 0
+}
+
+// GraphQLWithBodyWithResponse request with arbitrary body returning *GraphQLResponse
+func (c *ClientWithResponses) GraphQLWithBodyWithResponse(ctx context.Context, contentType string, body io.Reader, reqEditors ...RequestEditorFn) (*GraphQLResponse, error) {
+	rsp, err := c.GraphQLWithBody(ctx, contentType, body, reqEditors...)
+	if err != nil {
+		return nil, err
+	}
+	return ParseGraphQLResponse(rsp)
+}
+
+func (c *ClientWithResponses) GraphQLWithResponse(ctx context.Context, body GraphQLJSONRequestBody, reqEditors ...RequestEditorFn) (*GraphQLResponse, error) {
+	rsp, err := c.GraphQL(ctx, body, reqEditors...)
+	if err != nil {
+		return nil, err
+	}
+	return ParseGraphQLResponse(rsp)
+}
+
+// GetHotWithResponse request returning *GetHotResponse
+func (c *ClientWithResponses) GetHotWithResponse(ctx context.Context, params *GetHotParams, reqEditors ...RequestEditorFn) (*GetHotResponse, error) {
+	rsp, err := c.GetHot(ctx, params, reqEditors...)
+	if err != nil {
+		return nil, err
+	}
+	return ParseGetHotResponse(rsp)
+}
+
+// GetNewWithResponse request returning *GetNewResponse
+func (c *ClientWithResponses) GetNewWithResponse(ctx context.Context, params *GetNewParams, reqEditors ...RequestEditorFn) (*GetNewResponse, error) {
+	rsp, err := c.GetNew(ctx, params, reqEditors...)
+	if err != nil {
+		return nil, err
+	}
+	return ParseGetNewResponse(rsp)
+}
+
+// GetObjectsWithBodyWithResponse request with arbitrary body returning *GetObjectsResponse
+func (c *ClientWithResponses) GetObjectsWithBodyWithResponse(ctx context.Context, contentType string, body io.Reader, reqEditors ...RequestEditorFn) (*GetObjectsResponse, error) {
+	rsp, err := c.GetObjectsWithBody(ctx, contentType, body, reqEditors...)
+	if err != nil {
+		return nil, err
+	}
+	return ParseGetObjectsResponse(rsp)
+}
+
+func (c *ClientWithResponses) GetObjectsWithResponse(ctx context.Context, body GetObjectsJSONRequestBody, reqEditors ...RequestEditorFn) (*GetObjectsResponse, error) {
+	rsp, err := c.GetObjects(ctx, body, reqEditors...)
+	if err != nil {
+		return nil, err
+	}
+	return ParseGetObjectsResponse(rsp)
+}
+
+// GetObjectWithResponse request returning *GetObjectResponse
+func (c *ClientWithResponses) GetObjectWithResponse(ctx context.Context, id Id, params *GetObjectParams, reqEditors ...RequestEditorFn) (*GetObjectResponse, error) {
+	rsp, err := c.GetObject(ctx, id, params, reqEditors...)
+	if err != nil {
+		return nil, err
+	}
+	return ParseGetObjectResponse(rsp)
+}
+
+// GetCommentsWithResponse request returning *GetCommentsResponse
+func (c *ClientWithResponses) GetCommentsWithResponse(ctx context.Context, id Id, params *GetCommentsParams, reqEditors ...RequestEditorFn) (*GetCommentsResponse, error) {
+	rsp, err := c.GetComments(ctx, id, params, reqEditors...)
+	if err != nil {
+		return nil, err
+	}
+	return ParseGetCommentsResponse(rsp)
+}
+
+// GetHistoryWithResponse request returning *GetHistoryResponse
+func (c *ClientWithResponses) GetHistoryWithResponse(ctx context.Context, id Id, params *GetHistoryParams, reqEditors ...RequestEditorFn) (*GetHistoryResponse, error) {
+	rsp, err := c.GetHistory(ctx, id, params, reqEditors...)
+	if err != nil {
+		return nil, err
+	}
+	return ParseGetHistoryResponse(rsp)
+}
+
+// GetOpenAPIWithResponse request returning *GetOpenAPIResponse
+func (c *ClientWithResponses) GetOpenAPIWithResponse(ctx context.Context, reqEditors ...RequestEditorFn) (*GetOpenAPIResponse, error) {
+	rsp, err := c.GetOpenAPI(ctx, reqEditors...)
+	if err != nil {
+		return nil, err
+	}
+	return ParseGetOpenAPIResponse(rsp)
+}
+
+// SearchWithResponse request returning *SearchResponse
+func (c *ClientWithResponses) SearchWithResponse(ctx context.Context, params *SearchParams, reqEditors ...RequestEditorFn) (*SearchResponse, error) {
+	rsp, err := c.Search(ctx, params, reqEditors...)
+	if err != nil {
+		return nil, err
+	}
+	return ParseSearchResponse(rsp)
+}
+
+// StreamHotWithResponse request returning *StreamHotResponse
+func (c *ClientWithResponses) StreamHotWithResponse(ctx context.Context, reqEditors ...RequestEditorFn) (*StreamHotResponse, error) {
+	rsp, err := c.StreamHot(ctx, reqEditors...)
+	if err != nil {
+		return nil, err
+	}
+	return ParseStreamHotResponse(rsp)
+}
+
+// StreamThreadWithResponse request returning *StreamThreadResponse
+func (c *ClientWithResponses) StreamThreadWithResponse(ctx context.Context, id Id, reqEditors ...RequestEditorFn) (*StreamThreadResponse, error) {
+	rsp, err := c.StreamThread(ctx, id, reqEditors...)
+	if err != nil {
+		return nil, err
+	}
+	return ParseStreamThreadResponse(rsp)
+}
+
+// StreamUserWithResponse request returning *StreamUserResponse
+func (c *ClientWithResponses) StreamUserWithResponse(ctx context.Context, id Id, reqEditors ...RequestEditorFn) (*StreamUserResponse, error) {
+	rsp, err := c.StreamUser(ctx, id, reqEditors...)
+	if err != nil {
+		return nil, err
+	}
+	return ParseStreamUserResponse(rsp)
+}
+
+// GetSubmissionsWithResponse request returning *GetSubmissionsResponse
+func (c *ClientWithResponses) GetSubmissionsWithResponse(ctx context.Context, name string, params *GetSubmissionsParams, reqEditors ...RequestEditorFn) (*GetSubmissionsResponse, error) {
+	rsp, err := c.GetSubmissions(ctx, name, params, reqEditors...)
+	if err != nil {
+		return nil, err
+	}
+	return ParseGetSubmissionsResponse(rsp)
+}
+
+// ParseGraphQLResponse parses an HTTP response from a GraphQLWithResponse call
+func ParseGraphQLResponse(rsp *http.Response) (*GraphQLResponse, error) {
+	bodyBytes, err := io.ReadAll(rsp.Body)
+	defer func() { _ = rsp.Body.Close() }()
+	if err != nil {
+		return nil, err
+	}
+
+	response := &GraphQLResponse{
+		Body:         bodyBytes,
+		HTTPResponse: rsp,
+	}
+
+	switch {
+	case strings.Contains(rsp.Header.Get("Content-Type"), "json") && rsp.StatusCode == 200:
+		var dest GraphQLResult
+		if err := json.Unmarshal(bodyBytes, &dest); err != nil {
+			return nil, err
+		}
+		response.JSON200 = &dest
+
+	case strings.Contains(rsp.Header.Get("Content-Type"), "json") && rsp.StatusCode == 400:
+		var dest GraphQLResult
+		if err := json.Unmarshal(bodyBytes, &dest); err != nil {
+			return nil, err
+		}
+		response.JSON400 = &dest
+
+	}
+
+	return response, nil
+}
+
+// ParseGetHotResponse parses an HTTP response from a GetHotWithResponse call
+func ParseGetHotResponse(rsp *http.Response) (*GetHotResponse, error) {
+	bodyBytes, err := io.ReadAll(rsp.Body)
+	defer func() { _ = rsp.Body.Close() }()
+	if err != nil {
+		return nil, err
+	}
+
+	response := &GetHotResponse{
+		Body:         bodyBytes,
+		HTTPResponse: rsp,
+	}
+
+	switch {
+	case strings.Contains(rsp.Header.Get("Content-Type"), "json") && rsp.StatusCode == 200:
+		var dest Objects
+		if err := json.Unmarshal(bodyBytes, &dest); err != nil {
+			return nil, err
+		}
+		response.JSON200 = &dest
+
+	case rsp.StatusCode == 200:
+		// Content-type (application/rss+xml) unsupported
+
+	}
+
+	return response, nil
+}
+
+// ParseGetNewResponse parses an HTTP response from a GetNewWithResponse call
+func ParseGetNewResponse(rsp *http.Response) (*GetNewResponse, error) {
+	bodyBytes, err := io.ReadAll(rsp.Body)
+	defer func() { _ = rsp.Body.Close() }()
+	if err != nil {
+		return nil, err
+	}
+
+	response := &GetNewResponse{
+		Body:         bodyBytes,
+		HTTPResponse: rsp,
+	}
+
+	switch {
+	case strings.Contains(rsp.Header.Get("Content-Type"), "json") && rsp.StatusCode == 200:
+		var dest Objects
+		if err := json.Unmarshal(bodyBytes, &dest); err != nil {
+			return nil, err
+		}
+		response.JSON200 = &dest
+
+	case rsp.StatusCode == 200:
+		// Content-type (application/rss+xml) unsupported
+
+	}
+
+	return response, nil
+}
+
+// ParseGetObjectsResponse parses an HTTP response from a GetObjectsWithResponse call
+func ParseGetObjectsResponse(rsp *http.Response) (*GetObjectsResponse, error) {
+	bodyBytes, err := io.ReadAll(rsp.Body)
+	defer func() { _ = rsp.Body.Close() }()
+	if err != nil {
+		return nil, err
+	}
+
+	response := &GetObjectsResponse{
+		Body:         bodyBytes,
+		HTTPResponse: rsp,
+	}
+
+	switch {
+	case strings.Contains(rsp.Header.Get("Content-Type"), "json") && rsp.StatusCode == 200:
+		var dest Objects
+		if err := json.Unmarshal(bodyBytes, &dest); err != nil {
+			return nil, err
+		}
+		response.JSON200 = &dest
+
+	}
+
+	return response, nil
+}
+
+// ParseGetObjectResponse parses an HTTP response from a GetObjectWithResponse call
+func ParseGetObjectResponse(rsp *http.Response) (*GetObjectResponse, error) {
+	bodyBytes, err := io.ReadAll(rsp.Body)
+	defer func() { _ = rsp.Body.Close() }()
+	if err != nil {
+		return nil, err
+	}
+
+	response := &GetObjectResponse{
+		Body:         bodyBytes,
+		HTTPResponse: rsp,
+	}
+
+	switch {
+	case strings.Contains(rsp.Header.Get("Content-Type"), "json") && rsp.StatusCode == 200:
+		var dest Object
+		if err := json.Unmarshal(bodyBytes, &dest); err != nil {
+			return nil, err
+		}
+		response.JSON200 = &dest
+
+	}
+
+	return response, nil
+}
+
+// ParseGetCommentsResponse parses an HTTP response from a GetCommentsWithResponse call
+func ParseGetCommentsResponse(rsp *http.Response) (*GetCommentsResponse, error) {
+	bodyBytes, err := io.ReadAll(rsp.Body)
+	defer func() { _ = rsp.Body.Close() }()
+	if err != nil {
+		return nil, err
+	}
+
+	response := &GetCommentsResponse{
+		Body:         bodyBytes,
+		HTTPResponse: rsp,
+	}
+
+	switch {
+	case strings.Contains(rsp.Header.Get("Content-Type"), "json") && rsp.StatusCode == 200:
+		var dest Objects
+		if err := json.Unmarshal(bodyBytes, &dest); err != nil {
+			return nil, err
+		}
+		response.JSON200 = &dest
+
+	case rsp.StatusCode == 200:
+		// Content-type (application/rss+xml) unsupported
+
+	}
+
+	return response, nil
+}
+
+// ParseGetHistoryResponse parses an HTTP response from a GetHistoryWithResponse call
+func ParseGetHistoryResponse(rsp *http.Response) (*GetHistoryResponse, error) {
+	bodyBytes, err := io.ReadAll(rsp.Body)
+	defer func() { _ = rsp.Body.Close() }()
+	if err != nil {
+		return nil, err
+	}
+
+	response := &GetHistoryResponse{
+		Body:         bodyBytes,
+		HTTPResponse: rsp,
+	}
+
+	switch {
+	case strings.Contains(rsp.Header.Get("Content-Type"), "json") && rsp.StatusCode == 200:
+		var dest []Revision
+		if err := json.Unmarshal(bodyBytes, &dest); err != nil {
+			return nil, err
+		}
+		response.JSON200 = &dest
+
+	}
+
+	return response, nil
+}
+
+// ParseGetOpenAPIResponse parses an HTTP response from a GetOpenAPIWithResponse call
+func ParseGetOpenAPIResponse(rsp *http.Response) (*GetOpenAPIResponse, error) {
+	bodyBytes, err := io.ReadAll(rsp.Body)
+	defer func() { _ = rsp.Body.Close() }()
+	if err != nil {
+		return nil, err
+	}
+
+	response := &GetOpenAPIResponse{
+		Body:         bodyBytes,
+		HTTPResponse: rsp,
+	}
+
+	switch {
+	case strings.Contains(rsp.Header.Get("Content-Type"), "json") && rsp.StatusCode == 200:
+		var dest map[string]interface{}
+		if err := json.Unmarshal(bodyBytes, &dest); err != nil {
+			return nil, err
+		}
+		response.JSON200 = &dest
+
+	}
+
+	return response, nil
+}
+
+// ParseSearchResponse parses an HTTP response from a SearchWithResponse call
+func ParseSearchResponse(rsp *http.Response) (*SearchResponse, error) {
+	bodyBytes, err := io.ReadAll(rsp.Body)
+	defer func() { _ = rsp.Body.Close() }()
+	if err != nil {
+		return nil, err
+	}
+
+	response := &SearchResponse{
+		Body:         bodyBytes,
+		HTTPResponse: rsp,
+	}
+
+	switch {
+	case strings.Contains(rsp.Header.Get("Content-Type"), "json") && rsp.StatusCode == 200:
+		var dest SearchResult
+		if err := json.Unmarshal(bodyBytes, &dest); err != nil {
+			return nil, err
+		}
+		response.JSON200 = &dest
+
+	}
+
+	return response, nil
+}
+
+// ParseStreamHotResponse parses an HTTP response from a StreamHotWithResponse call
+func ParseStreamHotResponse(rsp *http.Response) (*StreamHotResponse, error) {
+	bodyBytes, err := io.ReadAll(rsp.Body)
+	defer func() { _ = rsp.Body.Close() }()
+	if err != nil {
+		return nil, err
+	}
+
+	response := &StreamHotResponse{
+		Body:         bodyBytes,
+		HTTPResponse: rsp,
+	}
+
+	return response, nil
+}
+
+// ParseStreamThreadResponse parses an HTTP response from a StreamThreadWithResponse call
+func ParseStreamThreadResponse(rsp *http.Response) (*StreamThreadResponse, error) {
+	bodyBytes, err := io.ReadAll(rsp.Body)
+	defer func() { _ = rsp.Body.Close() }()
+	if err != nil {
+		return nil, err
+	}
+
+	response := &StreamThreadResponse{
+		Body:         bodyBytes,
+		HTTPResponse: rsp,
+	}
+
+	return response, nil
+}
+
+// ParseStreamUserResponse parses an HTTP response from a StreamUserWithResponse call
+func ParseStreamUserResponse(rsp *http.Response) (*StreamUserResponse, error) {
+	bodyBytes, err := io.ReadAll(rsp.Body)
+	defer func() { _ = rsp.Body.Close() }()
+	if err != nil {
+		return nil, err
+	}
+
+	response := &StreamUserResponse{
+		Body:         bodyBytes,
+		HTTPResponse: rsp,
+	}
+
+	return response, nil
+}
+
+// ParseGetSubmissionsResponse parses an HTTP response from a GetSubmissionsWithResponse call
+func ParseGetSubmissionsResponse(rsp *http.Response) (*GetSubmissionsResponse, error) {
+	bodyBytes, err := io.ReadAll(rsp.Body)
+	defer func() { _ = rsp.Body.Close() }()
+	if err != nil {
+		return nil, err
+	}
+
+	response := &GetSubmissionsResponse{
+		Body:         bodyBytes,
+		HTTPResponse: rsp,
+	}
+
+	switch {
+	case strings.Contains(rsp.Header.Get("Content-Type"), "json") && rsp.StatusCode == 200:
+		var dest Objects
+		if err := json.Unmarshal(bodyBytes, &dest); err != nil {
+			return nil, err
+		}
+		response.JSON200 = &dest
+
+	case rsp.StatusCode == 200:
+		// Content-type (application/rss+xml) unsupported
+
+	}
+
+	return response, nil
+}
+
+// Base64 encoded, gzipped, json marshaled Swagger object
+var swaggerSpec = []string{
+
+	"H4sIAAAAAAAC/+xbWW8bOfL/KgT/8zCDoWznmD8wfll4c8xoN4fXTrADBN4F1V1Sc9xNdshqHRvouy94",
+	"9KU+JCeaODvwSyKpq6uKVT8W66A/0UhluZIg0dDzTzQBHoN2H5/xKIHJMyVRq9T+EIOJtMhRKEnP6a9q",
+	"RVIlFyRKhX2bcBmTXKu1AEMyviGRfZ9gAkSDyZU0QBk1UQIZt9xwkwM9pwa1kAu63TL64h1fdOX8E/gt",
+	"sY+Imre4MWJAIlklIMkStBFKGsI1EL7kIuWzdJ+8K0C9mVzMEXRX7DVESsaGFBJFGuR+LMAgibgkM/sV",
+	"tYC4T4aQCAvQTshvkyuO8EpkAifu366o13xNUN2CNNUSOQJJLTWZFdEtYPnA2/ouMq8g40LaJXfkvvMy",
+	"U5gjEdLx99Luxt8AHmK+sBBhyLxIU8IXXMhxQVtGc655BhgQGalC9sh6U2Qz0NZEIK1PzAl5DnNepGgI",
+	"KvLkjDIqLOHHAvSGMip5ZiV5dk0VMr4WWZHR80dnZ4xmQvpvZ6zPCiK2rzjGOcek5issKCxahIaYnqMu",
+	"oCkk54ig7Wv/mvzlw9nk55sfv6OsB5+5BsRNd71TGVvgW6P+7frtG78DpEICWY6bgcUGZuM7wiDX2C9w",
+	"XUJwLrRBZ+khUZ5Ly65jltwyWm5p5+UZj6/8VvM+lwje6whrPM1Ti5vzTyPr2LId/S9IhSOitEejijcW",
+	"i0IueSpiumUUlmUQ3JXpnkwMauDZHUWr2e8QISOpMCjkwgVJDQaQBHFbRucA8Y5YnuepiLhlcspRZT+u",
+	"s3RcMmu987tRO0b6TsOcntP/O63j/al/ak69kqbDRRuzX3Bnye8SIBJWYJAExoQbh1Rmrc8N4cQumQgP",
+	"qIsoghyJP3lIrmEO2hAlwdrGwkRLnr7QWulj4WEamBIDegmagGO+ZTR46U/kDAv9BZR7t0Lh5/mDjaYH",
+	"fYsK9Kdt4sZZP/aSo3FrkgpfqkLGxwKAhai3M4kVGB8818Ig9cKmWZ5CBhLhqCJBxrkS0h2CTqS0WUrs",
+	"D18XjAxyGUHQ4rWKxVx4FbrMXEokJJnOJ2+UhMlrjlFCMvsvuLCCSr3mchNiqTnmQhr5SUDWxeWU3MLG",
+	"AsrnKGR6aZcJ6wggdmlSAzs7mdcYCJqkQ+nU2PvdF8YSpEM51S8NpUOHc7IvODsXkheYKC3+c1zYlb4R",
+	"Nh27lWolrZs0LNUtxP7cdwyda7wK9lOuVQ4ahT+VRdwjrzzy+yJgnQB98BmRI72pEgC//yyPWZHevnXf",
+	"Guf+rnT/H0JmDs+hmE3opv6dMqMrv1bEXGu+6dHY9OoaqSwrj4U0fTun5x8OCecvBaSx3ZW7C6vNPcYk",
+	"UFl7F9m/b4M15kpnHH0u9eQx7aZWLn8uEbRrGgup/Z5zVKxUs2LYUKRrpZstowvN8+Qfr6pju73qVPlD",
+	"bcepLZpIpUUm+woDe05LGKhNOh6TReqLwZCIt93OaAbG8AX02sjl9Q0Vt3tQU/LqQ06wyCDE7WdnlDf9",
+	"W4qFNLvvyZJrYdfoIRXHwvLh6WVDQGvxpVY76nsBo8qbIu3RPebI94ke8EMtw2VhbUSM7YkWwvoc0xGQ",
+	"Cnl7qcz9bd4YeDOKzpRKgcvP2NYDe5fRQqcH72lLG3RqbPA9+zp8tj4X9pzJhOTobZDxPK+S5xAl+y1S",
+	"PvYuGaKq3MWoQaU3Q3R2OYGuMKCHyNyzLStduPHbzK/RLkzCAYCodNqyccJKqX2EpS320Xn1axcEUHbD",
+	"pgaOfTnjeynWBEUGlB0CsRhSCHy6cB1IBkykNOxC+P+f9vI3qtBRf5zzP+zqb03PiEMCI8FqNo9xhmGH",
+	"JCBBZKAt1a2Xyirj9YVA/+nw+FS/uXviaFgKI5TsOq/eXYdx1pCnPBr1dmhdeolkxQ2pXmKH+Cl0Vvtr",
+	"kFBDBZq2qBnY7jDEBBXt7Z81/VNKaSypijV9zjDAdZQMHUcNVx1UaTOKCnnai9w9TcBWXHVMaqT0KV7F",
+	"hf+RBHLwpEGB6QGZvydjnTxyzzHjA/mxTDRTBX5B9eKoWGDTp68DZFRogZtrq1IQm4u/Q0/79m3uU6QT",
+	"UpbmZCUwIdwVaVw3y2uIyWzjfhfSIPDY1tuzDZlelr1XX1PWzdffJheX04kVXAcer4irDoWcqx6VQp/u",
+	"+1wZNFV4NcxFV/ODa1uG5pEh3ycKmW3x/eAbaE5HnosTMn3uJzAxRCKz/TVnUNNYaWd5Yelu/lHOCHLQ",
+	"ZdHqWlQ5NLsK9g1VoLeXZR16xyThSyCdep+R3sLdLalTiIeulzmhFcKpEWjdXwVC+ujk7OTMHQk5SJ4L",
+	"ek6fnJydPKG+YHDO9+npRxdT8rDfqwx/GtNz+ovPX8OoAAz+VcWbkc7j3bqIO9XGto1pm4Hvtt0fn50d",
+	"X7qLz0NNJPe0bCC52uOEuHTezcHmbjsTTDiSSBVp7FpmbvBmVGpRZ7EkJAl1w5bRp197CU7pxhjBN1Rn",
+	"aumP3YyvSQw5JvZnKyOFtcCNV/XRkAaVV05bDSH70uOf97+02/Zz0anIMu4y6KtCEk4C9oL+yvbAy93N",
+	"yE4McBvFhQHH6jRRzrIL6MM04K8KaXtuNxC8a5JTPzDasr2EfmJ3AGGYdm1v+kE+bsFgCmvxJ2dP99M3",
+	"W7U1CsffaQy5PhsNB+rmO+efDR9GfzpkQe1BTRt0v4CN1s1BRKKQVGa2qJKwGkPVG1g9oOoBVXtQJWFV",
+	"ooqVI0gXzfzQ2iPNp22ntuncPJx3JoTPw8kTq3o45A4cd1tCFXhCyqQpHENS2SkziqhIuR0zx6BtFtGB",
+	"cnjtDzr3u730r3z01+PLkalbMG41cvtq4L5PrGZFiiJPaxvMtcoIJ8Zf7/G/2hS6hdNPIt6ORUbv7DsH",
+	"R3fl4UsD3hEBM46X+5s8P4Tq44VqI+Sign8H5GUn1Iyh/VlJcy94HzeAu8bzAJkjQgbrm0SNamSzSkCD",
+	"6y+ubAKgTA+YEhFmBiOVSiD5tkPnQb3mqqPcnYMNlN6e3jxgr5of/nTImnbuBvVDNrfmVYWpzWzPdy5J",
+	"eRkwYLqZlPpO0knp/8HTPgd5cTmlXwiq3TFwL0iCLGJyiMQ8MGvc97nPNoY3tTBt5bwt/Wxg0IrX/nFn",
+	"1/fdZP04epE3E/IVyAUmzeskdQ+5n2U1eyq5gLTThQ9+FFqOOuuLJjcHc67GW13eCY9uQUtYGcp8P/Mu",
+	"bDX2MtWQwtJdV2M05oM8v7Uq/ShJa2v+NLB/3DiIyOpyeria5/ppdd3qfrX96MY06s9YDh0jwL4s0nRi",
+	"J0nE278MRq5Tz4h9wsj7q1fexG6pxKLY0vk+gH1Q5Zk+Wrhb3aNdzWtH4hubd08L63veX9lHX2rta3c5",
+	"enINEskLtwg/rLEWjxIuF2B62nnOxNio9IUkAlu2xkQDj8crW2/zd47yszK0my/11be+Bf8o9/qM2rkR",
+	"lnY8UN618Am3CH9xhQlsAgxazi0M6ENc+95f23hw7Fd0rPVNw7GVn0sPCwxR0wz42DvXhtTtqSlmmTCm",
+	"vMU5lLFeN8j6c672H0+5/8ayrrunGPdY1T+UScNlUqtB3zyYiYMWhssPHrZ027xlYcFjHV9esfhws73Z",
+	"/ncAGPsklss6AAA=",
+}
+
+// GetSwagger returns the content of the embedded swagger specification file
+// or error if failed to decode
+func decodeSpec() ([]byte, error) {
+	zipped, err := base64.StdEncoding.DecodeString(strings.Join(swaggerSpec, ""))
+	if err != nil {
+		return nil, fmt.Errorf("error base64 decoding spec: %s", err)
+	}
+	zr, err := gzip.NewReader(bytes.NewReader(zipped))
+	if err != nil {
+		return nil, fmt.Errorf("error decompressing spec: %s", err)
+	}
+	var buf bytes.Buffer
+	_, err = buf.ReadFrom(zr)
+	if err != nil {
+		return nil, fmt.Errorf("error decompressing spec: %s", err)
+	}
+
+	return buf.Bytes(), nil
+}
+
+var rawSpec = decodeSpecCached()
+
+// a naive cached of a decoded swagger spec
+func decodeSpecCached() func() ([]byte, error) {
+	data, err := decodeSpec()
+	return func() ([]byte, error) {
+		return data, err
+	}
+}
+
+// Constructs a synthetic filesystem for resolving external references when loading openapi specifications.
+func PathToRawSpec(pathToFile string) map[string]func() ([]byte, error) {
+	var res = make(map[string]func() ([]byte, error))
+	if len(pathToFile) > 0 {
+		res[pathToFile] = rawSpec
+	}
+
+	return res
+}
+
+// GetSwagger returns the Swagger specification corresponding to the generated code
+// in this file. The external references of Swagger specification are resolved.
+// The logic of resolving external references is tightly connected to "import-mapping" feature.
+// Externally referenced files must be embedded in the corresponding golang packages.
+// Urls can be supported but this task was out of the scope.
+func GetSwagger() (swagger *openapi3.T, err error) {
+	var resolvePath = PathToRawSpec("")
+
+	loader := openapi3.NewLoader()
+	loader.IsExternalRefsAllowed = true
+	loader.ReadFromURIFunc = func(loader *openapi3.Loader, url *url.URL) ([]byte, error) {
+		var pathToFile = url.String()
+		pathToFile = path.Clean(pathToFile)
+		getSpec, ok := resolvePath[pathToFile]
+		if !ok {
+			err1 := fmt.Errorf("path not found: %s", pathToFile)
+			return nil, err1
+		}
+		return getSpec()
+	}
+	var specData []byte
+	specData, err = rawSpec()
+	if err != nil {
+		return
+	}
+	swagger, err = loader.LoadFromData(specData)
+	if err != nil {
+		return
+	}
+	return
+}
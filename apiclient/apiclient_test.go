@@ -0,0 +1,35 @@
+package apiclient
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/getkin/kin-openapi/openapi3"
+)
+
+// TestGenerated check that apiclient.gen.go was regenerated after openapi.json changed
+func TestGenerated(t *testing.T) {
+	spec, err := openapi3.NewLoader().LoadFromFile("openapi.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := spec.Validate(openapi3.NewLoader().Context); err != nil {
+		t.Fatal(err)
+	}
+	// oapi-codegen capitalizes the operation IDs of the spec it embeds
+	for _, item := range spec.Paths {
+		for _, op := range item.Operations() {
+			op.OperationID = strings.ToUpper(op.OperationID[:1]) + op.OperationID[1:]
+		}
+	}
+	generated, err := GetSwagger()
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected, _ := json.Marshal(spec)
+	got, _ := json.Marshal(generated)
+	if string(got) != string(expected) {
+		t.Error("apiclient.gen.go is out of date, run go generate")
+	}
+}
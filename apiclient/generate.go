@@ -0,0 +1,3 @@
+package apiclient
+
+//go:generate oapi-codegen -generate types,client,spec -package apiclient -o apiclient.gen.go openapi.json
@@ -0,0 +1,25 @@
+package db
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+)
+
+// apiKeyPrefix prefix of issued keys, so they can be recognized in logs and config
+const apiKeyPrefix = "site_"
+
+// newAPIKey generate a random key
+func newAPIKey() (string, error) {
+	b := make([]byte, 24)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return apiKeyPrefix + hex.EncodeToString(b), nil
+}
+
+// hashAPIKey the hash keys are stored and looked up by
+func hashAPIKey(key string) []byte {
+	h := sha256.Sum256([]byte(key))
+	return h[:]
+}
@@ -0,0 +1,89 @@
+package db
+
+import (
+	"fmt"
+
+	"github.com/gogo/protobuf/proto"
+	"github.com/golang/snappy"
+	"github.com/klauspost/compress/zstd"
+)
+
+// CompressionType compression of the data and kids blobs of an object row
+type CompressionType uint8
+
+const (
+	// None no compression
+	None = CompressionType(1)
+	// Snappy snappy block compression
+	Snappy = CompressionType(2)
+	// Zstd zstandard compression
+	Zstd = CompressionType(3)
+)
+
+var (
+	zstdEncoder, _ = zstd.NewWriter(nil)
+	zstdDecoder, _ = zstd.NewReader(nil)
+)
+
+// ParseCompression parse a compression name as used in configuration: none, snappy or zstd
+func ParseCompression(name string) (CompressionType, error) {
+	switch name {
+	case "", "none":
+		return None, nil
+	case "snappy":
+		return Snappy, nil
+	case "zstd":
+		return Zstd, nil
+	default:
+		return 0, fmt.Errorf("Unknown compression %s", name)
+	}
+}
+
+func (c CompressionType) String() string {
+	switch c {
+	case None:
+		return "none"
+	case Snappy:
+		return "snappy"
+	case Zstd:
+		return "zstd"
+	default:
+		return fmt.Sprintf("CompressionType(%d)", uint8(c))
+	}
+}
+
+// encodeBlob compress payload and prefix it with its varint length. The prefix is what
+// lets the legacy object_data view find the end of the data column
+func encodeBlob(payload []byte, c CompressionType) ([]byte, error) {
+	switch c {
+	case None:
+	case Snappy:
+		payload = snappy.Encode(nil, payload)
+	case Zstd:
+		payload = zstdEncoder.EncodeAll(payload, nil)
+	default:
+		return nil, fmt.Errorf("Unhandled compression %d", c)
+	}
+	buf := proto.NewBuffer(make([]byte, 0, len(payload)+proto.SizeVarint(uint64(len(payload)))))
+	if err := buf.EncodeRawBytes(payload); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func decodeBlob(blob []byte, c CompressionType) ([]byte, error) {
+	payload, err := proto.NewBuffer(blob).DecodeRawBytes(false)
+	if err != nil {
+		return nil, err
+	}
+	switch c {
+	case None:
+		return payload, nil
+	case Snappy:
+		return snappy.Decode(nil, payload)
+	case Zstd:
+		return zstdDecoder.DecodeAll(payload, nil)
+	default:
+		return nil, fmt.Errorf("Unhandled compression %d", c)
+	}
+}
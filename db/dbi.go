@@ -1,13 +1,16 @@
 package db
 
 import (
+	"bytes"
+	"crypto/sha256"
 	"database/sql"
 	"fmt"
-	"io"
 	"strings"
+	"time"
 
 	"reflect"
 
+	mysql "github.com/go-sql-driver/mysql"
 	"github.com/gogo/protobuf/proto"
 	"github.com/kabergstrom/site/protocol"
 )
@@ -15,6 +18,8 @@ import (
 const (
 	// ListingHot ID for the cache of the "hot" listing
 	ListingHot = 1
+	// ListingNew ID for the cache of the "new" listing, newest posts first
+	ListingNew = 2
 
 	// MaxListingSize the max size of a listing
 	MaxListingSize = 800
@@ -28,55 +33,46 @@ type Database struct {
 	insertSourceIDToObjectID    *sql.Stmt
 	getObject                   *sql.Stmt
 	getObjectIDFromSourceIDStmt *sql.Stmt
+	insertPendingSourceID       *sql.Stmt
+	getSourceIDMapping          *sql.Stmt
+	clearPendingSourceID        *sql.Stmt
+	getListing                  *sql.Stmt
+	getListingVersion           *sql.Stmt
+	setListing                  *sql.Stmt
+	scanObjects                 *sql.Stmt
+	rewriteObject               *sql.Stmt
+	getVersionData              *sql.Stmt
+	insertHistory               *sql.Stmt
+	getHistory                  *sql.Stmt
+	pruneHistory                *sql.Stmt
 	db                          *sql.DB
+	// tx is set on the copies of Database handed to WithTx callbacks
+	tx *sql.Tx
 }
 
-// ParseMemCacheObj parses the object_data innodb memcached view into a db.Object
-func ParseMemCacheObj(val []byte) (obj Object, err error) {
-	str := string(val)
-	endIndex := 0
-	for i := 0; i < 10; i++ {
-		increment := strings.Index(str[endIndex+1:], "|")
-		if increment == -1 {
-			err = io.EOF
-			return
-		}
-		endIndex += increment + 1
-	}
-	deletedNum := 0
-	wotStr := string(val[:endIndex])
-	_, err = fmt.Sscanf(wotStr, "%d|%d|%d|%d|%d|%d|%d|%d|%d|%d", &obj.ID, &obj.Source, &obj.Type, &obj.Score, &obj.SourceScore, &deletedNum, &obj.UnixTime, &obj.Compression, &obj.Encoding, &obj.NumKids)
-	if err != nil {
-		return
-	}
-	data, err := DecodeData(val[endIndex+1:], obj.Type)
-	if err != nil {
-		return
-	}
-	obj.Data = data
+const selectObjectColumns = "SELECT id, source, type, score, source_score, deleted, unixtime, compression, encoding, data, kids, num_kids, version FROM object"
 
-	serializedSize, err := proto.NewBuffer(val[endIndex+1:]).DecodeVarint()
-	if err != nil {
-		return
+// translateError maps driver errors onto the store errors shared by all backends
+func translateError(err error) error {
+	if err == sql.ErrNoRows {
+		return ErrNotFound
 	}
-	newStart := endIndex + int(serializedSize) + 2 + proto.SizeVarint(uint64(serializedSize))
-	kids, err := DecodeKids(val[newStart:])
-	if err != nil {
-		return
+	if me, ok := err.(*mysql.MySQLError); ok && me.Number == 1062 {
+		return ErrDuplicate
 	}
-	obj.Kids = kids
-	return
+	return err
 }
 
 // NewDBI initialize a new database. Prepares statements
 func NewDBI(db *sql.DB) (retVal *Database, err error) {
 	var i Database
-	insertObjectStmt, err := db.Prepare("INSERT INTO object (id, source, type, score, source_score, deleted, unixtime, compression, encoding, data, kids, num_kids) VALUES (?, ?, ? ,? ,? , ?, ?, ? ,?, ?, ?, ?)")
+	i.db = db
+	insertObjectStmt, err := db.Prepare("INSERT INTO object (id, source, type, score, source_score, deleted, unixtime, compression, encoding, data, kids, num_kids, record) VALUES (?, ?, ? ,? ,? , ?, ?, ? ,?, ?, ?, ?, ?)")
 	if err != nil {
 		return
 	}
 	i.insertObjectStmt = insertObjectStmt
-	updateSourceObjectStmt, err := db.Prepare("UPDATE object SET source_score = ?, deleted = ?, compression = ?, encoding = ?, data = ?, kids = ?, num_kids = ?, version = version + 1 WHERE id = ? AND version = ?")
+	updateSourceObjectStmt, err := db.Prepare("UPDATE object SET source_score = ?, deleted = ?, compression = ?, encoding = ?, data = ?, kids = ?, num_kids = ?, record = ?, version = version + 1 WHERE id = ? AND version = ?")
 	if err != nil {
 		return
 	}
@@ -91,7 +87,7 @@ func NewDBI(db *sql.DB) (retVal *Database, err error) {
 		return
 	}
 	i.insertSourceIDToObjectID = insertSourceIDToObjectID
-	getObjectStmt, err := db.Prepare("SELECT id, source, type, score, source_score, deleted, unixtime, compression, encoding, data, kids, num_kids, version FROM object WHERE id = ?")
+	getObjectStmt, err := db.Prepare(selectObjectColumns + " WHERE id = ?")
 	if err != nil {
 		return
 	}
@@ -101,12 +97,79 @@ func NewDBI(db *sql.DB) (retVal *Database, err error) {
 		return
 	}
 	i.getObjectIDFromSourceIDStmt = getObjectIDFromSourceID
+	insertPendingSourceID, err := db.Prepare("INSERT INTO source_id_to_object_id (source, source_id, object_id, pending) VALUES (?, ?, ?, TRUE)")
+	if err != nil {
+		return
+	}
+	i.insertPendingSourceID = insertPendingSourceID
+	getSourceIDMapping, err := db.Prepare("SELECT object_id, pending FROM source_id_to_object_id WHERE source = ? AND source_id = ?")
+	if err != nil {
+		return
+	}
+	i.getSourceIDMapping = getSourceIDMapping
+	clearPendingSourceID, err := db.Prepare("UPDATE source_id_to_object_id SET pending = FALSE WHERE source = ? AND source_id = ?")
+	if err != nil {
+		return
+	}
+	i.clearPendingSourceID = clearPendingSourceID
+	getListing, err := db.Prepare("SELECT data FROM listing_cache WHERE id = ?")
+	if err != nil {
+		return
+	}
+	i.getListing = getListing
+	getListingVersion, err := db.Prepare("SELECT version FROM listing_cache WHERE id = ?")
+	if err != nil {
+		return
+	}
+	i.getListingVersion = getListingVersion
+	setListing, err := db.Prepare("INSERT INTO listing_cache (id, data, version) VALUES (?, ?, 0) ON DUPLICATE KEY UPDATE data = VALUES(data), version = version + 1")
+	if err != nil {
+		return
+	}
+	i.setListing = setListing
+	scanObjects, err := db.Prepare(selectObjectColumns + " WHERE id > ? ORDER BY id LIMIT ?")
+	if err != nil {
+		return
+	}
+	i.scanObjects = scanObjects
+	rewriteObject, err := db.Prepare("UPDATE object SET compression = ?, encoding = ?, data = ?, kids = ?, record = ?, version = version + 1 WHERE id = ? AND version = ?")
+	if err != nil {
+		return
+	}
+	i.rewriteObject = rewriteObject
+	// the data of the version being updated, which is copied to object_history if the update changes it
+	getVersionData, err := db.Prepare("SELECT compression, encoding, data FROM object WHERE id = ? AND version = ? FOR UPDATE")
+	if err != nil {
+		return
+	}
+	i.getVersionData = getVersionData
+	insertHistory, err := db.Prepare("INSERT INTO object_history (object_id, version, compression, encoding, data, replaced_at) VALUES (?, ?, ?, ?, ?, ?)")
+	if err != nil {
+		return
+	}
+	i.insertHistory = insertHistory
+	getHistory, err := db.Prepare("SELECT h.version, h.compression, h.encoding, h.data, h.replaced_at, o.type FROM object_history h JOIN object o ON o.id = h.object_id WHERE h.object_id = ? ORDER BY h.version DESC")
+	if err != nil {
+		return
+	}
+	i.getHistory = getHistory
+	pruneHistory, err := db.Prepare("DELETE FROM object_history WHERE replaced_at < ?")
+	if err != nil {
+		return
+	}
+	i.pruneHistory = pruneHistory
 	retVal = new(Database)
 	*retVal = i
 	return
 }
 
-func (i *Database) close() {
+// Ping check the MySQL connection
+func (i *Database) Ping() error {
+	return i.db.Ping()
+}
+
+// Close close the prepared statements and the MySQL connection
+func (i *Database) Close() error {
 	// close all statements
 	e := reflect.ValueOf(i).Elem()
 	t := e.Type()
@@ -120,8 +183,64 @@ func (i *Database) close() {
 		}
 	}
 	if i.db != nil {
-		i.db.Close()
+		return i.db.Close()
+	}
+	return nil
+}
+
+// WithTx run f with a Database whose statements run in one transaction. The transaction is
+// committed when f returns nil and rolled back otherwise. Calling WithTx on the Database passed
+// to f runs in the same transaction
+func (i *Database) WithTx(f func(tx SourceStore) error) (err error) {
+	if i.tx != nil {
+		return f(i)
+	}
+	tx, err := i.db.Begin()
+	if err != nil {
+		return
+	}
+	defer func() {
+		if p := recover(); p != nil {
+			tx.Rollback()
+			panic(p)
+		}
+	}()
+	txi := *i
+	txi.tx = tx
+	// use the statements prepared on the connection pool within the transaction
+	e := reflect.ValueOf(&txi).Elem()
+	for idx := 0; idx < e.NumField(); idx++ {
+		field := e.Field(idx)
+		if field.Type() == reflect.TypeOf((*sql.Stmt)(nil)) && !field.IsNil() {
+			field.Set(reflect.ValueOf(tx.Stmt(field.Interface().(*sql.Stmt))))
+		}
 	}
+	if err = f(&txi); err != nil {
+		tx.Rollback()
+		return
+	}
+	return tx.Commit()
+}
+
+func (i *Database) query(query string, args ...interface{}) (*sql.Rows, error) {
+	if i.tx != nil {
+		return i.tx.Query(query, args...)
+	}
+	return i.db.Query(query, args...)
+}
+
+func (i *Database) queryRow(query string, args ...interface{}) *sql.Row {
+	if i.tx != nil {
+		return i.tx.QueryRow(query, args...)
+	}
+	return i.db.QueryRow(query, args...)
+}
+
+func (i *Database) exec(query string, args ...interface{}) (sql.Result, error) {
+	if i.tx != nil {
+		return i.tx.Exec(query, args...)
+	}
+	return i.db.Exec(query, args...)
 }
 
 // GetObjectIDFromSourceID get object ID from content source ID
@@ -129,90 +248,518 @@ func (i *Database) GetObjectIDFromSourceID(source protocol.SourceID, sourceID []
 	row := i.getObjectIDFromSourceIDStmt.QueryRow(source, sourceID)
 	var objectID int64
 	err := row.Scan(&objectID)
-	return objectID, err
+	return objectID, translateError(err)
 }
 
 // InsertObject insert a dbObject
 func (i *Database) InsertObject(obj Object) (err error) {
-	objData, err := EncodeData(obj.Data)
+	objData, err := EncodeData(obj.Data, obj.Encoding, obj.Compression)
 	if err != nil {
 		return
 	}
-	objKids, err := EncodeKids(obj.Kids)
+	objKids, err := EncodeKids(obj.Kids, obj.Encoding, obj.Compression)
 	if err != nil {
 		return
 	}
-	_, err = i.insertObjectStmt.Exec(obj.ID, obj.Source, obj.Type, obj.Score, obj.SourceScore, obj.Deleted, obj.UnixTime, obj.Compression, obj.Encoding, objData, objKids, obj.NumKids)
+	record := encodeRecord(obj, objData, objKids)
+	_, err = i.insertObjectStmt.Exec(obj.ID, obj.Source, obj.Type, obj.Score, obj.SourceScore, obj.Deleted, obj.UnixTime, obj.Compression, obj.Encoding, objData, objKids, obj.NumKids, record)
+	err = translateError(err)
 	return
 }
 
 // InsertSourceIDToObjectID insert a mapping between id from a content source and object id
 func (i *Database) InsertSourceIDToObjectID(objID int64, source protocol.SourceID, sourceID []byte) (err error) {
 	_, err = i.insertSourceIDToObjectID.Exec(source, sourceID, objID)
-	return err
+	return translateError(err)
+}
+
+// InsertPendingSourceIDToObjectID insert a mapping whose object is still being fetched from its source
+func (i *Database) InsertPendingSourceIDToObjectID(objID int64, source protocol.SourceID, sourceID []byte) (err error) {
+	_, err = i.insertPendingSourceID.Exec(source, sourceID, objID)
+	return translateError(err)
+}
+
+// GetSourceIDMapping get object ID from content source ID and whether its object is still pending
+func (i *Database) GetSourceIDMapping(source protocol.SourceID, sourceID []byte) (objID int64, pending bool, err error) {
+	err = i.getSourceIDMapping.QueryRow(source, sourceID).Scan(&objID, &pending)
+	err = translateError(err)
+	return
+}
+
+// ClearPendingSourceID mark the object of a mapping as stored
+func (i *Database) ClearPendingSourceID(source protocol.SourceID, sourceID []byte) (err error) {
+	_, err = i.clearPendingSourceID.Exec(source, sourceID)
+	return
+}
+
+// InsertURL insert the post a normalized URL was first submitted in
+func (i *Database) InsertURL(url string, postID int64) error {
+	hash := sha256.Sum256([]byte(url))
+	_, err := i.insertURL.Exec(hash[:], url, postID)
+	return translateError(err)
+}
+
+// InsertSubmission record a post as a submission of its author
+func (i *Database) InsertSubmission(authorID int64, postID int64, unixTime int32) error {
+	_, err := i.exec("INSERT INTO submission (author_id, post_id, unixtime) VALUES (?, ?, ?)", authorID, postID, unixTime)
+	return translateError(err)
+}
+
+// GetSubmissions get the IDs of the newest count posts of an author, newest first
+func (i *Database) GetSubmissions(authorID int64, count int) ([]int64, error) {
+	rows, err := i.query("SELECT post_id FROM submission WHERE author_id = ? ORDER BY unixtime DESC, post_id DESC LIMIT ?", authorID, count)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var postIDs []int64
+	for rows.Next() {
+		var postID int64
+		if err := rows.Scan(&postID); err != nil {
+			return nil, err
+		}
+		postIDs = append(postIDs, postID)
+	}
+	return postIDs, rows.Err()
 }
 
-// UpdateSourceObject update object fields that come from content sources
+// maxBatchSize max rows per multi-row statement, keeping the placeholders well below the MySQL limit
+const maxBatchSize = 500
+
+// GetObjectIDsFromSourceIDs get the mappings of multiple content source IDs, keyed by source ID.
+// Source IDs without a mapping are left out of the result
+func (i *Database) GetObjectIDsFromSourceIDs(source protocol.SourceID, sourceIDs [][]byte) (map[string]SourceIDMapping, error) {
+	mappings := make(map[string]SourceIDMapping, len(sourceIDs))
+	for start := 0; start < len(sourceIDs); start += maxBatchSize {
+		batch := sourceIDs[start:]
+		if len(batch) > maxBatchSize {
+			batch = batch[:maxBatchSize]
+		}
+		args := make([]interface{}, 0, len(batch)+1)
+		args = append(args, source)
+		for _, sourceID := range batch {
+			args = append(args, sourceID)
+		}
+		placeholders := strings.Repeat("?, ", len(batch)-1) + "?"
+		rows, err := i.query("SELECT source_id, object_id, pending FROM source_id_to_object_id WHERE source = ? AND source_id IN ("+placeholders+")", args...)
+		if err != nil {
+			return nil, err
+		}
+		for rows.Next() {
+			var mapping SourceIDMapping
+			if err := rows.Scan(&mapping.SourceID, &mapping.ObjectID, &mapping.Pending); err != nil {
+				rows.Close()
+				return nil, err
+			}
+			mappings[string(mapping.SourceID)] = mapping
+		}
+		err = rows.Err()
+		rows.Close()
+		if err != nil {
+			return nil, err
+		}
+	}
+	return mappings, nil
+}
+
+// InsertSourceIDMappings insert multiple mappings of content source IDs. Source IDs that are
+// already mapped keep their mapping, read them back with GetObjectIDsFromSourceIDs
+func (i *Database) InsertSourceIDMappings(source protocol.SourceID, mappings []SourceIDMapping) error {
+	for start := 0; start < len(mappings); start += maxBatchSize {
+		batch := mappings[start:]
+		if len(batch) > maxBatchSize {
+			batch = batch[:maxBatchSize]
+		}
+		args := make([]interface{}, 0, len(batch)*4)
+		for _, mapping := range batch {
+			args = append(args, source, mapping.SourceID, mapping.ObjectID, mapping.Pending)
+		}
+		placeholders := strings.Repeat("(?, ?, ?, ?), ", len(batch)-1) + "(?, ?, ?, ?)"
+		_, err := i.exec("INSERT INTO source_id_to_object_id (source, source_id, object_id, pending) VALUES "+placeholders+" ON DUPLICATE KEY UPDATE object_id = object_id", args...)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// InsertObjects insert multiple objects. Returns ErrDuplicate if any of them exists. Objects are
+// inserted in statements of up to maxBatchSize rows, use WithTx to insert all or none of them
+func (i *Database) InsertObjects(objs []Object) error {
+	for start := 0; start < len(objs); start += maxBatchSize {
+		batch := objs[start:]
+		if len(batch) > maxBatchSize {
+			batch = batch[:maxBatchSize]
+		}
+		args := make([]interface{}, 0, len(batch)*13)
+		for _, obj := range batch {
+			objData, err := EncodeData(obj.Data, obj.Encoding, obj.Compression)
+			if err != nil {
+				return err
+			}
+			objKids, err := EncodeKids(obj.Kids, obj.Encoding, obj.Compression)
+			if err != nil {
+				return err
+			}
+			record := encodeRecord(obj, objData, objKids)
+			args = append(args, obj.ID, obj.Source, obj.Type, obj.Score, obj.SourceScore, obj.Deleted, obj.UnixTime, obj.Compression, obj.Encoding, objData, objKids, obj.NumKids, record)
+		}
+		row := "(?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)"
+		placeholders := strings.Repeat(row+", ", len(batch)-1) + row
+		_, err := i.exec("INSERT INTO object (id, source, type, score, source_score, deleted, unixtime, compression, encoding, data, kids, num_kids, record) VALUES "+placeholders, args...)
+		if err != nil {
+			return translateError(err)
+		}
+	}
+	return nil
+}
+
+// UpdateSourceObject update object fields that come from content sources.
+// obj must be the complete object as read with GetObjectVersion since it is also
+// serialized into the record column served by the object_record view.
+// The replaced data is recorded in object_history if the update changes it.
+// Returns ErrConflict if the stored version is not version
 func (i *Database) UpdateSourceObject(obj Object, version int) (err error) {
-	objData, err := EncodeData(obj.Data)
+	objData, err := EncodeData(obj.Data, obj.Encoding, obj.Compression)
 	if err != nil {
 		return
 	}
-	objKids, err := EncodeKids(obj.Kids)
+	objKids, err := EncodeKids(obj.Kids, obj.Encoding, obj.Compression)
 	if err != nil {
 		return
 	}
-	_, err = i.updateSourceObject.Exec(obj.SourceScore, obj.Deleted, obj.Compression, obj.Encoding, objData, objKids, obj.NumKids, obj.ID, version)
+	record := encodeRecord(obj, objData, objKids)
+	return i.WithTx(func(tx SourceStore) error {
+		txi := tx.(*Database)
+		var (
+			compression CompressionType
+			encoding    EncodingType
+			data        []byte
+		)
+		err := txi.getVersionData.QueryRow(obj.ID, version).Scan(&compression, &encoding, &data)
+		if err == sql.ErrNoRows {
+			return ErrConflict
+		}
+		if err != nil {
+			return err
+		}
+		same, err := sameData(data, encoding, compression, obj, objData)
+		if err != nil {
+			return err
+		}
+		if !same {
+			if _, err := txi.insertHistory.Exec(obj.ID, version, compression, encoding, data, time.Now().Unix()); err != nil {
+				return translateError(err)
+			}
+		}
+		res, err := txi.updateSourceObject.Exec(obj.SourceScore, obj.Deleted, obj.Compression, obj.Encoding, objData, objKids, obj.NumKids, record, obj.ID, version)
+		if err != nil {
+			return err
+		}
+		affected, err := res.RowsAffected()
+		if err != nil {
+			return err
+		}
+		if affected == 0 {
+			// the object was updated since version was read, or deleted
+			return ErrConflict
+		}
+		return nil
+	})
+}
+
+// GetObjectHistory get the revisions of an object, newest first
+func (i *Database) GetObjectHistory(objID int64) ([]Revision, error) {
+	rows, err := i.getHistory.Query(objID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var revisions []Revision
+	for rows.Next() {
+		var (
+			revision    Revision
+			compression CompressionType
+			encoding    EncodingType
+			data        []byte
+			objType     protocol.ObjectType
+		)
+		if err := rows.Scan(&revision.Version, &compression, &encoding, &data, &revision.ReplacedAt, &objType); err != nil {
+			return nil, err
+		}
+		revision.ObjectID = objID
+		if revision.Data, err = DecodeData(data, objType, encoding, compression); err != nil {
+			return nil, err
+		}
+		revisions = append(revisions, revision)
+	}
+	return revisions, rows.Err()
+}
+
+// PruneHistory delete revisions replaced before before. Returns the number of deleted revisions
+func (i *Database) PruneHistory(before time.Time) (int64, error) {
+	res, err := i.pruneHistory.Exec(before.Unix())
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
+// api keys are only used by api and dbtool, so their statements are not prepared by NewDBI
+const selectAPIKeyColumns = "SELECT id, name, rate, burst, created_at, revoked_at FROM api_key"
+
+// CreateAPIKey issue a key. Returns the key, which can not be read again
+func (i *Database) CreateAPIKey(name string, rate int, burst int) (string, APIKey, error) {
+	key, err := newAPIKey()
+	if err != nil {
+		return "", APIKey{}, err
+	}
+	apiKey := APIKey{Name: name, Rate: rate, Burst: burst, CreatedAt: time.Now().Unix()}
+	res, err := i.exec("INSERT INTO api_key (key_hash, name, rate, burst, created_at) VALUES (?, ?, ?, ?, ?)", hashAPIKey(key), name, rate, burst, apiKey.CreatedAt)
+	if err != nil {
+		return "", APIKey{}, translateError(err)
+	}
+	if apiKey.ID, err = res.LastInsertId(); err != nil {
+		return "", APIKey{}, err
+	}
+	return key, apiKey, nil
+}
+
+// GetAPIKey get a key, including revoked keys. Returns ErrNotFound if it does not exist
+func (i *Database) GetAPIKey(key string) (apiKey APIKey, err error) {
+	err = i.queryRow(selectAPIKeyColumns+" WHERE key_hash = ?", hashAPIKey(key)).Scan(&apiKey.ID, &apiKey.Name, &apiKey.Rate, &apiKey.Burst, &apiKey.CreatedAt, &apiKey.RevokedAt)
+	return apiKey, translateError(err)
+}
+
+// ListAPIKeys get all keys, oldest first
+func (i *Database) ListAPIKeys() ([]APIKey, error) {
+	rows, err := i.query(selectAPIKeyColumns + " ORDER BY id")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var keys []APIKey
+	for rows.Next() {
+		var k APIKey
+		if err := rows.Scan(&k.ID, &k.Name, &k.Rate, &k.Burst, &k.CreatedAt, &k.RevokedAt); err != nil {
+			return nil, err
+		}
+		keys = append(keys, k)
+	}
+	return keys, rows.Err()
+}
+
+// RevokeAPIKey revoke the key with the given ID. Returns ErrNotFound if it does not exist
+func (i *Database) RevokeAPIKey(id int64) error {
+	var revokedAt int64
+	if err := i.queryRow("SELECT revoked_at FROM api_key WHERE id = ?", id).Scan(&revokedAt); err != nil {
+		return translateError(err)
+	}
+	if revokedAt != 0 {
+		return nil
+	}
+	_, err := i.exec("UPDATE api_key SET revoked_at = ? WHERE id = ?", time.Now().Unix(), id)
+	return err
+}
+
+// GetObjectVersion get object and the version used for optimistic updates
+func (i *Database) GetObjectVersion(objID int64) (obj Object, version int, err error) {
+	obj, version, err = scanObject(i.getObject.QueryRow(objID))
 	return
 }
 
 // GetObject get object
-func (i *Database) GetObject(objID int64) (obj Object, version int, err error) {
-	row := i.getObject.QueryRow(objID)
-	var data []byte
-	var kids []byte
-	err = row.Scan(&obj.ID, &obj.Source, &obj.Type, &obj.Score, &obj.SourceScore, &obj.Deleted, &obj.UnixTime, &obj.Compression, &obj.Encoding, &data, &kids, &obj.NumKids, &version)
-	m, err := DecodeData(data, obj.Type)
+func (i *Database) GetObject(objID int64) (Object, error) {
+	obj, _, err := scanObject(i.getObject.QueryRow(objID))
+	return obj, err
+}
+
+// GetObjects get multiple objects. IDs that do not exist are left out of the result
+func (i *Database) GetObjects(objIDs []int64) (map[int64]Object, error) {
+	objects := make(map[int64]Object, len(objIDs))
+	for start := 0; start < len(objIDs); start += maxBatchSize {
+		batch := objIDs[start:]
+		if len(batch) > maxBatchSize {
+			batch = batch[:maxBatchSize]
+		}
+		args := make([]interface{}, len(batch))
+		for idx, id := range batch {
+			args[idx] = id
+		}
+		placeholders := strings.Repeat("?, ", len(args)-1) + "?"
+		rows, err := i.query(selectObjectColumns+" WHERE id IN ("+placeholders+")", args...)
+		if err != nil {
+			return nil, err
+		}
+		for rows.Next() {
+			obj, _, err := scanObject(rows)
+			if err != nil {
+				rows.Close()
+				return nil, err
+			}
+			objects[obj.ID] = obj
+		}
+		err = rows.Err()
+		rows.Close()
+		if err != nil {
+			return nil, err
+		}
+	}
+	return objects, nil
+}
+
+// GetObjectVersions get the versions of multiple objects. IDs that do not exist are left out of the result
+func (i *Database) GetObjectVersions(objIDs []int64) (map[int64]int, error) {
+	versions := make(map[int64]int, len(objIDs))
+	for start := 0; start < len(objIDs); start += maxBatchSize {
+		batch := objIDs[start:]
+		if len(batch) > maxBatchSize {
+			batch = batch[:maxBatchSize]
+		}
+		args := make([]interface{}, len(batch))
+		for idx, id := range batch {
+			args[idx] = id
+		}
+		placeholders := strings.Repeat("?, ", len(args)-1) + "?"
+		rows, err := i.query("SELECT id, version FROM object WHERE id IN ("+placeholders+")", args...)
+		if err != nil {
+			return nil, err
+		}
+		for rows.Next() {
+			var id int64
+			var version int
+			if err := rows.Scan(&id, &version); err != nil {
+				rows.Close()
+				return nil, err
+			}
+			versions[id] = version
+		}
+		err = rows.Err()
+		rows.Close()
+		if err != nil {
+			return nil, err
+		}
+	}
+	return versions, nil
+}
+
+// ScanObjects get up to limit objects with an ID greater than afterID, in ID order, and their versions
+func (i *Database) ScanObjects(afterID int64, limit int) (objects []Object, versions []int, err error) {
+	rows, err := i.scanObjects.Query(afterID, limit)
 	if err != nil {
 		return
 	}
-	obj.Data = m
-	kidsObj, err := DecodeKids(kids)
+	defer rows.Close()
+	for rows.Next() {
+		obj, version, err := scanObject(rows)
+		if err != nil {
+			return nil, nil, err
+		}
+		objects = append(objects, obj)
+		versions = append(versions, version)
+	}
+	err = rows.Err()
+	return
+}
+
+// RewriteObject re-serialize the data and kids of an object with its Compression and Encoding.
+// Returns false without writing anything if the stored version no longer matches version
+func (i *Database) RewriteObject(obj Object, version int) (bool, error) {
+	objData, err := EncodeData(obj.Data, obj.Encoding, obj.Compression)
 	if err != nil {
+		return false, err
+	}
+	objKids, err := EncodeKids(obj.Kids, obj.Encoding, obj.Compression)
+	if err != nil {
+		return false, err
+	}
+	record := encodeRecord(obj, objData, objKids)
+	res, err := i.rewriteObject.Exec(obj.Compression, obj.Encoding, objData, objKids, record, obj.ID, version)
+	if err != nil {
+		return false, err
+	}
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return affected == 1, nil
+}
+
+// GetListing get a cached listing
+func (i *Database) GetListing(listingID int) (listing Listing, err error) {
+	var data []byte
+	if err = i.getListing.QueryRow(listingID).Scan(&data); err != nil {
+		err = translateError(err)
 		return
 	}
-	obj.Kids = kidsObj
+	err = proto.Unmarshal(data, &listing)
+	return
+}
+
+// GetListingVersion get the version of a cached listing
+func (i *Database) GetListingVersion(listingID int) (version int, err error) {
+	err = translateError(i.getListingVersion.QueryRow(listingID).Scan(&version))
+	return
+}
+
+// SetListing replace a cached listing
+func (i *Database) SetListing(listingID int, listing Listing) error {
+	data, err := proto.Marshal(&listing)
+	if err != nil {
+		return err
+	}
+	_, err = i.setListing.Exec(listingID, data)
+	return err
+}
+
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanObject(row rowScanner) (obj Object, version int, err error) {
+	var data []byte
+	var kids []byte
+	err = row.Scan(&obj.ID, &obj.Source, &obj.Type, &obj.Score, &obj.SourceScore, &obj.Deleted, &obj.UnixTime, &obj.Compression, &obj.Encoding, &data, &kids, &obj.NumKids, &version)
+	if err != nil {
+		err = translateError(err)
+		return
+	}
+	obj, err = decodeObjectBlobs(obj, data, kids)
 	return
 }
 
 // DecodeKids deserialize kids field
-func DecodeKids(bytes []byte) (Kids, error) {
+func DecodeKids(bytes []byte, e EncodingType, c CompressionType) (Kids, error) {
 	var kids Kids
-	buffer := proto.NewBuffer(bytes)
-	err := buffer.DecodeMessage(&kids)
+	payload, err := decodeBlob(bytes, c)
 	if err != nil {
 		return Kids{}, err
 	}
+	if err := unmarshalMessage(payload, &kids, e); err != nil {
+		return Kids{}, err
+	}
 	return kids, nil
 }
 
 // EncodeKids serialized kids field
-func EncodeKids(kids Kids) ([]byte, error) {
-	buffer := proto.NewBuffer(nil)
-	err := buffer.EncodeMessage(&kids)
+func EncodeKids(kids Kids, e EncodingType, c CompressionType) ([]byte, error) {
+	payload, err := marshalMessage(&kids, e)
 	if err != nil {
 		return nil, err
 	}
-	return buffer.Bytes(), nil
+	return encodeBlob(payload, c)
 }
 
 // DecodeData decode data part of objects
-func DecodeData(data []byte, t protocol.ObjectType) (m proto.Message, err error) {
-	buf := proto.NewBuffer(data)
+func DecodeData(data []byte, t protocol.ObjectType, e EncodingType, c CompressionType) (m proto.Message, err error) {
+	payload, err := decodeBlob(data, c)
+	if err != nil {
+		return
+	}
 	switch t {
 	case protocol.User:
 		var u User
-		err = buf.DecodeMessage(&u)
+		err = unmarshalMessage(payload, &u, e)
 		if err != nil {
 			return
 		}
@@ -229,7 +776,7 @@ func DecodeData(data []byte, t protocol.ObjectType) (m proto.Message, err error)
 		fallthrough
 	case protocol.PollOpt:
 		var p Post
-		err = buf.DecodeMessage(&p)
+		err = unmarshalMessage(payload, &p, e)
 		if err != nil {
 			return
 		}
@@ -242,28 +789,27 @@ func DecodeData(data []byte, t protocol.ObjectType) (m proto.Message, err error)
 }
 
 // EncodeData encoding data part of objects
-func EncodeData(m proto.Message) ([]byte, error) {
-	buf := proto.NewBuffer(nil)
-	err := buf.EncodeMessage(m)
+func EncodeData(m proto.Message, e EncodingType, c CompressionType) ([]byte, error) {
+	payload, err := marshalMessage(m, e)
 	if err != nil {
 		return nil, err
 	}
-	return buf.Bytes(), nil
+	return encodeBlob(payload, c)
 }
 
-type compressionType uint8
-
-const (
-	// None no compression
-	None = compressionType(1)
-)
-
-type encodingType uint8
-
-const (
-	// Protobuf protobuf encoding
-	Protobuf = encodingType(1)
-)
+// sameData whether data stored with encoding e and compression c holds the same message as the data
+// of obj, encoded as objData. Blobs with the same encoding and compression are compared as they are,
+// others are decoded first since rewriting an object changes its bytes but not its data
+func sameData(data []byte, e EncodingType, c CompressionType, obj Object, objData []byte) (bool, error) {
+	if e == obj.Encoding && c == obj.Compression {
+		return bytes.Equal(data, objData), nil
+	}
+	m, err := DecodeData(data, obj.Type, e, c)
+	if err != nil {
+		return false, err
+	}
+	return proto.Equal(m, obj.Data), nil
+}
 
 // Object a content object
 type Object struct {
@@ -274,8 +820,8 @@ type Object struct {
 	SourceScore int64
 	Deleted     bool
 	UnixTime    int32
-	Compression compressionType
-	Encoding    encodingType
+	Compression CompressionType
+	Encoding    EncodingType
 	Data        proto.Message
 	Kids        Kids
 	NumKids     int32
@@ -0,0 +1,70 @@
+package db
+
+import (
+	"bytes"
+	"fmt"
+
+	"github.com/gogo/protobuf/jsonpb"
+	"github.com/gogo/protobuf/proto"
+)
+
+// EncodingType serialization of the data and kids blobs of an object row
+type EncodingType uint8
+
+const (
+	// Protobuf protobuf encoding
+	Protobuf = EncodingType(1)
+	// JSON protobuf JSON mapping, readable when querying MySQL directly
+	JSON = EncodingType(2)
+)
+
+var jsonMarshaler = jsonpb.Marshaler{OrigName: true}
+
+// ParseEncoding parse an encoding name as used in configuration: protobuf or json
+func ParseEncoding(name string) (EncodingType, error) {
+	switch name {
+	case "", "protobuf":
+		return Protobuf, nil
+	case "json":
+		return JSON, nil
+	default:
+		return 0, fmt.Errorf("Unknown encoding %s", name)
+	}
+}
+
+func (e EncodingType) String() string {
+	switch e {
+	case Protobuf:
+		return "protobuf"
+	case JSON:
+		return "json"
+	default:
+		return fmt.Sprintf("EncodingType(%d)", uint8(e))
+	}
+}
+
+func marshalMessage(m proto.Message, e EncodingType) ([]byte, error) {
+	switch e {
+	case Protobuf:
+		return proto.Marshal(m)
+	case JSON:
+		var buf bytes.Buffer
+		if err := jsonMarshaler.Marshal(&buf, m); err != nil {
+			return nil, err
+		}
+		return buf.Bytes(), nil
+	default:
+		return nil, fmt.Errorf("Unhandled encoding %d", e)
+	}
+}
+
+func unmarshalMessage(payload []byte, m proto.Message, e EncodingType) error {
+	switch e {
+	case Protobuf:
+		return proto.Unmarshal(payload, m)
+	case JSON:
+		return jsonpb.Unmarshal(bytes.NewReader(payload), m)
+	default:
+		return fmt.Errorf("Unhandled encoding %d", e)
+	}
+}
@@ -0,0 +1,300 @@
+package db
+
+import (
+	"strconv"
+
+	"github.com/gogo/protobuf/proto"
+	"github.com/ngaut/log"
+	"github.com/pkg/errors"
+	"github.com/rainycape/memcache"
+)
+
+const (
+	// ObjectRecordView name of the innodb memcache container for object.record
+	ObjectRecordView = "object_record"
+	// ObjectView name of the legacy innodb memcache container joining the object columns.
+	// Only read for rows that do not have a record yet
+	ObjectView = "object_data"
+	// ListingView name of the innodb memcache container for the listing_cache table
+	ListingView = "listing_data"
+	// ObjectVersionView name of the innodb memcache container for object.version
+	ObjectVersionView = "object_version"
+	// ListingVersionView name of the innodb memcache container for listing_cache.version
+	ListingVersionView = "listing_version"
+
+	defaultMultiGetSize = 100
+)
+
+// MemcacheStore reads objects and listings through the MySQL InnoDB memcache plugin
+type MemcacheStore struct {
+	mcRecord  *memcache.Client
+	mcObj     *memcache.Client
+	mcListing *memcache.Client
+	// mcObjVersion and mcListingVersion are nil if the version containers do not exist
+	mcObjVersion     *memcache.Client
+	mcListingVersion *memcache.Client
+
+	// MultiGetSize max number of keys sent in a single multi-get. Larger batches are split
+	MultiGetSize int
+}
+
+// OpenMemcachedView connects to the memcache plugin and selects the container viewName
+func OpenMemcachedView(url string, viewName string) (*memcache.Client, error) {
+	mc, err := memcache.New(url)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := mc.Get("@@" + viewName); err != nil {
+		return nil, err
+	}
+	return mc, err
+}
+
+// NewMemcacheStore connects to the object and listing views on the memcache plugin at addr
+func NewMemcacheStore(addr string) (*MemcacheStore, error) {
+	mcRecord, err := OpenMemcachedView(addr, ObjectRecordView)
+	if err != nil {
+		return nil, errors.Wrapf(err, "Failed to open %s on %s", ObjectRecordView, addr)
+	}
+	mcObj, err := OpenMemcachedView(addr, ObjectView)
+	if err != nil {
+		return nil, errors.Wrapf(err, "Failed to open %s on %s", ObjectView, addr)
+	}
+	mcListing, err := OpenMemcachedView(addr, ListingView)
+	if err != nil {
+		return nil, errors.Wrapf(err, "Failed to open %s on %s", ListingView, addr)
+	}
+	s := &MemcacheStore{
+		mcRecord:     mcRecord,
+		mcObj:        mcObj,
+		mcListing:    mcListing,
+		MultiGetSize: defaultMultiGetSize,
+	}
+	mcObjVersion, err := OpenMemcachedView(addr, ObjectVersionView)
+	if err != nil {
+		log.Warnf("Failed to open %s on %s, versions are not available: %s", ObjectVersionView, addr, err)
+		return s, nil
+	}
+	mcListingVersion, err := OpenMemcachedView(addr, ListingVersionView)
+	if err != nil {
+		log.Warnf("Failed to open %s on %s, versions are not available: %s", ListingVersionView, addr, err)
+		return s, nil
+	}
+	s.mcObjVersion, s.mcListingVersion = mcObjVersion, mcListingVersion
+	return s, nil
+}
+
+// HasVersions whether the version containers exist and the store can be used as a VersionStore
+func (s *MemcacheStore) HasVersions() bool {
+	return s.mcObjVersion != nil
+}
+
+// Ping check the memcache plugin by reading the hot listing. A missing listing is not an error
+func (s *MemcacheStore) Ping() error {
+	if _, err := s.mcListing.Get(strconv.Itoa(ListingHot)); err != nil && err != memcache.ErrCacheMiss {
+		return err
+	}
+	return nil
+}
+
+// Close close the connections to the memcache plugin
+func (s *MemcacheStore) Close() error {
+	clients := []*memcache.Client{s.mcRecord, s.mcObj, s.mcListing, s.mcObjVersion, s.mcListingVersion}
+	var firstErr error
+	for _, mc := range clients {
+		if mc == nil {
+			continue
+		}
+		if err := mc.Close(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+// GetObject get a single object
+func (s *MemcacheStore) GetObject(objID int64) (obj Object, err error) {
+	key := strconv.FormatInt(objID, 10)
+	item, err := s.mcRecord.Get(key)
+	if err != nil && err != memcache.ErrCacheMiss {
+		return
+	}
+	if err == memcache.ErrCacheMiss || len(item.Value) == 0 {
+		item, err = s.mcObj.Get(key)
+		if err != nil {
+			if err == memcache.ErrCacheMiss {
+				err = ErrNotFound
+			}
+			return
+		}
+	}
+	return ParseMemCacheObj(item.Value)
+}
+
+// GetObjects get multiple objects. IDs that do not exist are left out of the result
+func (s *MemcacheStore) GetObjects(objIDs []int64) (map[int64]Object, error) {
+	keys := make([]string, len(objIDs))
+	for i, id := range objIDs {
+		keys[i] = strconv.FormatInt(id, 10)
+	}
+	items, err := getMulti(s.mcRecord, keys, s.MultiGetSize)
+	if err != nil {
+		return nil, err
+	}
+	var legacyKeys []string
+	for _, key := range keys {
+		if item, ok := items[key]; !ok || len(item.Value) == 0 {
+			delete(items, key)
+			legacyKeys = append(legacyKeys, key)
+		}
+	}
+	if len(legacyKeys) > 0 {
+		legacyItems, err := getMulti(s.mcObj, legacyKeys, s.MultiGetSize)
+		if err != nil {
+			return nil, err
+		}
+		for key, item := range legacyItems {
+			items[key] = item
+		}
+	}
+	objects := make(map[int64]Object, len(items))
+	for key, item := range items {
+		obj, err := ParseMemCacheObj(item.Value)
+		if err != nil {
+			return nil, errors.Wrapf(err, "Failed to parse object for id %s", key)
+		}
+		objects[obj.ID] = obj
+	}
+	return objects, nil
+}
+
+// GetListing get a cached listing
+func (s *MemcacheStore) GetListing(listingID int) (listing Listing, err error) {
+	item, err := s.mcListing.Get(strconv.Itoa(listingID))
+	if err != nil {
+		if err == memcache.ErrCacheMiss {
+			err = ErrNotFound
+		}
+		return
+	}
+	err = proto.Unmarshal(item.Value, &listing)
+	return
+}
+
+// SetListing replace a cached listing
+func (s *MemcacheStore) SetListing(listingID int, listing Listing) error {
+	data, err := proto.Marshal(&listing)
+	if err != nil {
+		return err
+	}
+	return s.mcListing.Set(&memcache.Item{
+		Key:   strconv.Itoa(listingID),
+		Value: data,
+	})
+}
+
+// GetObjectVersions get the versions of multiple objects. IDs that do not exist are left out of the result
+func (s *MemcacheStore) GetObjectVersions(objIDs []int64) (map[int64]int, error) {
+	if s.mcObjVersion == nil {
+		return nil, errors.Errorf("%s is not available", ObjectVersionView)
+	}
+	keys := make([]string, len(objIDs))
+	for i, id := range objIDs {
+		keys[i] = strconv.FormatInt(id, 10)
+	}
+	items, err := getMulti(s.mcObjVersion, keys, s.MultiGetSize)
+	if err != nil {
+		return nil, err
+	}
+	versions := make(map[int64]int, len(items))
+	for i, key := range keys {
+		item, ok := items[key]
+		if !ok {
+			continue
+		}
+		version, err := strconv.Atoi(string(item.Value))
+		if err != nil {
+			return nil, errors.Wrapf(err, "Failed to parse version for id %s", key)
+		}
+		versions[objIDs[i]] = version
+	}
+	return versions, nil
+}
+
+// GetListingVersion get the version of a cached listing
+func (s *MemcacheStore) GetListingVersion(listingID int) (int, error) {
+	if s.mcListingVersion == nil {
+		return 0, errors.Errorf("%s is not available", ListingVersionView)
+	}
+	key := strconv.Itoa(listingID)
+	item, err := s.mcListingVersion.Get(key)
+	if err != nil {
+		if err == memcache.ErrCacheMiss {
+			err = ErrNotFound
+		}
+		return 0, err
+	}
+	version, err := strconv.Atoi(string(item.Value))
+	if err != nil {
+		return 0, errors.Wrapf(err, "Failed to parse version for listing %s", key)
+	}
+	return version, nil
+}
+
+// multiGetter the memcache calls of getMulti
+type multiGetter interface {
+	Get(key string) (*memcache.Item, error)
+	GetMulti(keys []string) (map[string]*memcache.Item, error)
+}
+
+// getMulti fetches keys from mc in chunks of at most chunkSize keys. The InnoDB
+// memcache plugin rejects multi-gets above its configured limit with a server error,
+// so a chunk rejected that way is split in half and retried until it is down to single gets.
+// Other errors are returned. Keys that are not present are left out of the returned map.
+func getMulti(mc multiGetter, keys []string, chunkSize int) (map[string]*memcache.Item, error) {
+	if chunkSize < 1 {
+		chunkSize = 1
+	}
+	items := make(map[string]*memcache.Item, len(keys))
+	for len(keys) > 0 {
+		n := chunkSize
+		if n > len(keys) {
+			n = len(keys)
+		}
+		if err := getMultiChunk(mc, keys[:n], items); err != nil {
+			return nil, err
+		}
+		keys = keys[n:]
+	}
+	return items, nil
+}
+
+func getMultiChunk(mc multiGetter, keys []string, items map[string]*memcache.Item) error {
+	if len(keys) == 1 {
+		item, err := mc.Get(keys[0])
+		if err != nil {
+			if err == memcache.ErrCacheMiss {
+				return nil
+			}
+			return errors.Wrapf(err, "Failed to get item %s", keys[0])
+		}
+		items[keys[0]] = item
+		return nil
+	}
+	chunk, err := mc.GetMulti(keys)
+	if err != nil && err != memcache.ErrServerError {
+		return errors.Wrapf(err, "Failed to get %d items", len(keys))
+	}
+	if err != nil {
+		log.Warnf("GetMulti of %d keys failed, retrying in smaller chunks: %s", len(keys), err)
+		half := len(keys) / 2
+		if err := getMultiChunk(mc, keys[:half], items); err != nil {
+			return err
+		}
+		return getMultiChunk(mc, keys[half:], items)
+	}
+	for key, item := range chunk {
+		items[key] = item
+	}
+	return nil
+}
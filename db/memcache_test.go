@@ -0,0 +1,100 @@
+package db
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"testing"
+
+	"github.com/rainycape/memcache"
+)
+
+// fakeMemcache serves the keys in items, and rejects multi-gets of more than maxKeys keys like the
+// InnoDB memcache plugin. err is returned by every call when set
+type fakeMemcache struct {
+	items   map[string]*memcache.Item
+	maxKeys int
+	err     error
+	calls   [][]string
+}
+
+func (m *fakeMemcache) Get(key string) (*memcache.Item, error) {
+	m.calls = append(m.calls, []string{key})
+	if m.err != nil {
+		return nil, m.err
+	}
+	item, ok := m.items[key]
+	if !ok {
+		return nil, memcache.ErrCacheMiss
+	}
+	return item, nil
+}
+
+func (m *fakeMemcache) GetMulti(keys []string) (map[string]*memcache.Item, error) {
+	m.calls = append(m.calls, keys)
+	if m.err != nil {
+		return nil, m.err
+	}
+	if len(keys) > m.maxKeys {
+		return nil, memcache.ErrServerError
+	}
+	items := make(map[string]*memcache.Item)
+	for _, key := range keys {
+		if item, ok := m.items[key]; ok {
+			items[key] = item
+		}
+	}
+	return items, nil
+}
+
+func TestGetMulti(t *testing.T) {
+	mc := &fakeMemcache{items: make(map[string]*memcache.Item), maxKeys: 3}
+	var keys []string
+	for i := 0; i < 10; i++ {
+		key := fmt.Sprint(i)
+		keys = append(keys, key)
+		// odd keys are missing
+		if i%2 == 0 {
+			mc.items[key] = &memcache.Item{Key: key}
+		}
+	}
+	items, err := getMulti(mc, keys, 4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var found []string
+	for key := range items {
+		found = append(found, key)
+	}
+	sort.Strings(found)
+	if expected := []string{"0", "2", "4", "6", "8"}; !reflect.DeepEqual(found, expected) {
+		t.Errorf("Found %v, expected %v", found, expected)
+	}
+	// chunks of 4 are rejected and split in half, the last chunk of 2 is not
+	var sizes []int
+	for _, call := range mc.calls {
+		sizes = append(sizes, len(call))
+	}
+	if expected := []int{4, 2, 2, 4, 2, 2, 2}; !reflect.DeepEqual(sizes, expected) {
+		t.Errorf("Got chunks of %v, expected %v", sizes, expected)
+	}
+
+	// only a single key is left to get with Get
+	mc.calls, mc.maxKeys = nil, 0
+	if _, err := getMulti(mc, keys[:2], 2); err != nil {
+		t.Fatal(err)
+	}
+	if len(mc.calls) != 3 {
+		t.Errorf("Got %v, expected a multi-get split into two gets", mc.calls)
+	}
+}
+
+func TestGetMultiError(t *testing.T) {
+	mc := &fakeMemcache{maxKeys: 100, err: memcache.ErrNoServers}
+	if _, err := getMulti(mc, []string{"1", "2", "3", "4"}, 4); err == nil {
+		t.Fatal("Error was not returned")
+	}
+	if len(mc.calls) != 1 {
+		t.Errorf("Error other than a rejected multi-get was retried in %d calls", len(mc.calls))
+	}
+}
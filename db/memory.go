@@ -0,0 +1,746 @@
+package db
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/kabergstrom/site/protocol"
+)
+
+// MemoryStore keeps objects, listings and source ID mappings in process memory.
+// Objects are stored encoded, like the SQL backend, so callers never share data
+type MemoryStore struct {
+	mu        sync.RWMutex
+	objects   map[int64]memoryObject
+	listings  map[int]memoryListing
+	sourceIDs map[memorySourceKey]memorySourceID
+	urls      map[string]int64
+	// submissions posts of each author
+	submissions map[int64][]memorySubmission
+	// history revisions of each object, oldest first
+	history map[int64][]memoryRevision
+	// apiKeys issued keys by key hash
+	apiKeys map[string]APIKey
+
+	// txMu serializes transactions
+	txMu sync.Mutex
+
+	onModified func(objID int64)
+}
+
+// memoryTx a MemoryStore transaction. Writes are applied immediately and undone on rollback,
+// so readers outside the transaction can see uncommitted writes
+type memoryTx struct {
+	*MemoryStore
+	undo        []func()
+	modifiedIDs []int64
+}
+
+type memoryObject struct {
+	obj     Object
+	data    []byte
+	kids    []byte
+	version int
+}
+
+type memoryListing struct {
+	listing Listing
+	version int
+}
+
+type memoryRevision struct {
+	version     int
+	compression CompressionType
+	encoding    EncodingType
+	data        []byte
+	replacedAt  int64
+}
+
+type memorySubmission struct {
+	postID   int64
+	unixTime int32
+}
+
+type memorySourceKey struct {
+	source   protocol.SourceID
+	sourceID string
+}
+
+type memorySourceID struct {
+	objID   int64
+	pending bool
+}
+
+// NewMemoryStore create an empty MemoryStore
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		objects:     make(map[int64]memoryObject),
+		listings:    make(map[int]memoryListing),
+		sourceIDs:   make(map[memorySourceKey]memorySourceID),
+		urls:        make(map[string]int64),
+		submissions: make(map[int64][]memorySubmission),
+		history:     make(map[int64][]memoryRevision),
+		apiKeys:     make(map[string]APIKey),
+	}
+}
+
+func encodeMemoryObject(obj Object, version int) (memoryObject, error) {
+	data, err := EncodeData(obj.Data, obj.Encoding, obj.Compression)
+	if err != nil {
+		return memoryObject{}, err
+	}
+	kids, err := EncodeKids(obj.Kids, obj.Encoding, obj.Compression)
+	if err != nil {
+		return memoryObject{}, err
+	}
+	obj.Data = nil
+	obj.Kids = Kids{}
+	return memoryObject{obj: obj, data: data, kids: kids, version: version}, nil
+}
+
+func (m memoryObject) decode() (Object, error) {
+	return decodeObjectBlobs(m.obj, m.data, m.kids)
+}
+
+// OnModified set a handler called after every object insert or update. It plays the
+// role mysql2nats has for the MySQL backends
+func (s *MemoryStore) OnModified(handler func(objID int64)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.onModified = handler
+}
+
+func (s *MemoryStore) modified(objID int64) {
+	s.mu.RLock()
+	handler := s.onModified
+	s.mu.RUnlock()
+	if handler != nil {
+		handler(objID)
+	}
+}
+
+// Ping always succeeds
+func (s *MemoryStore) Ping() error {
+	return nil
+}
+
+// GetObject get a single object
+func (s *MemoryStore) GetObject(objID int64) (Object, error) {
+	obj, _, err := s.GetObjectVersion(objID)
+	return obj, err
+}
+
+// GetObjectVersion get object and the version used for optimistic updates
+func (s *MemoryStore) GetObjectVersion(objID int64) (Object, int, error) {
+	s.mu.RLock()
+	stored, ok := s.objects[objID]
+	s.mu.RUnlock()
+	if !ok {
+		return Object{}, 0, ErrNotFound
+	}
+	obj, err := stored.decode()
+	return obj, stored.version, err
+}
+
+// GetObjectVersions get the versions of multiple objects. IDs that do not exist are left out of the result
+func (s *MemoryStore) GetObjectVersions(objIDs []int64) (map[int64]int, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	versions := make(map[int64]int, len(objIDs))
+	for _, id := range objIDs {
+		if stored, ok := s.objects[id]; ok {
+			versions[id] = stored.version
+		}
+	}
+	return versions, nil
+}
+
+// GetObjects get multiple objects. IDs that do not exist are left out of the result
+func (s *MemoryStore) GetObjects(objIDs []int64) (map[int64]Object, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	objects := make(map[int64]Object, len(objIDs))
+	for _, id := range objIDs {
+		stored, ok := s.objects[id]
+		if !ok {
+			continue
+		}
+		obj, err := stored.decode()
+		if err != nil {
+			return nil, err
+		}
+		objects[id] = obj
+	}
+	return objects, nil
+}
+
+// InsertObject insert an object
+func (s *MemoryStore) InsertObject(obj Object) error {
+	if _, err := s.insertObject(obj); err != nil {
+		return err
+	}
+	s.modified(obj.ID)
+	return nil
+}
+
+func (s *MemoryStore) insertObject(obj Object) (func(), error) {
+	stored, err := encodeMemoryObject(obj, 0)
+	if err != nil {
+		return nil, err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.objects[obj.ID]; ok {
+		return nil, ErrDuplicate
+	}
+	s.objects[obj.ID] = stored
+	return func() {
+		s.mu.Lock()
+		delete(s.objects, obj.ID)
+		s.mu.Unlock()
+	}, nil
+}
+
+// InsertObjects insert multiple objects. Returns ErrDuplicate if any of them exists, then none are inserted
+func (s *MemoryStore) InsertObjects(objs []Object) error {
+	if _, err := s.insertObjects(objs); err != nil {
+		return err
+	}
+	for _, obj := range objs {
+		s.modified(obj.ID)
+	}
+	return nil
+}
+
+func (s *MemoryStore) insertObjects(objs []Object) (func(), error) {
+	stored := make([]memoryObject, len(objs))
+	for idx, obj := range objs {
+		var err error
+		if stored[idx], err = encodeMemoryObject(obj, 0); err != nil {
+			return nil, err
+		}
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, obj := range objs {
+		if _, ok := s.objects[obj.ID]; ok {
+			return nil, ErrDuplicate
+		}
+	}
+	for idx, obj := range objs {
+		s.objects[obj.ID] = stored[idx]
+	}
+	return func() {
+		s.mu.Lock()
+		for _, obj := range objs {
+			delete(s.objects, obj.ID)
+		}
+		s.mu.Unlock()
+	}, nil
+}
+
+// UpdateSourceObject update object fields that come from content sources.
+// Returns ErrConflict if version does not match the stored version
+func (s *MemoryStore) UpdateSourceObject(obj Object, version int) error {
+	if _, err := s.updateSourceObject(obj, version); err != nil {
+		return err
+	}
+	s.modified(obj.ID)
+	return nil
+}
+
+func (s *MemoryStore) updateSourceObject(obj Object, version int) (func(), error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	existing, ok := s.objects[obj.ID]
+	if !ok || existing.version != version {
+		return nil, ErrConflict
+	}
+	updated := existing.obj
+	updated.SourceScore = obj.SourceScore
+	updated.Deleted = obj.Deleted
+	updated.Compression = obj.Compression
+	updated.Encoding = obj.Encoding
+	updated.NumKids = obj.NumKids
+	updated.Data = obj.Data
+	updated.Kids = obj.Kids
+	stored, err := encodeMemoryObject(updated, version+1)
+	if err != nil {
+		return nil, err
+	}
+	same, err := sameData(existing.data, existing.obj.Encoding, existing.obj.Compression, updated, stored.data)
+	if err != nil {
+		return nil, err
+	}
+	s.objects[obj.ID] = stored
+	history := s.history[obj.ID]
+	if !same {
+		s.history[obj.ID] = append(history, memoryRevision{
+			version:     version,
+			compression: existing.obj.Compression,
+			encoding:    existing.obj.Encoding,
+			data:        existing.data,
+			replacedAt:  time.Now().Unix(),
+		})
+	}
+	return func() {
+		s.mu.Lock()
+		s.objects[obj.ID] = existing
+		s.history[obj.ID] = history
+		s.mu.Unlock()
+	}, nil
+}
+
+// GetObjectHistory get the revisions of an object, newest first
+func (s *MemoryStore) GetObjectHistory(objID int64) ([]Revision, error) {
+	s.mu.RLock()
+	history := s.history[objID]
+	stored, ok := s.objects[objID]
+	s.mu.RUnlock()
+	if !ok {
+		return nil, nil
+	}
+	revisions := make([]Revision, 0, len(history))
+	for idx := len(history) - 1; idx >= 0; idx-- {
+		r := history[idx]
+		data, err := DecodeData(r.data, stored.obj.Type, r.encoding, r.compression)
+		if err != nil {
+			return nil, err
+		}
+		revisions = append(revisions, Revision{ObjectID: objID, Version: r.version, ReplacedAt: r.replacedAt, Data: data})
+	}
+	return revisions, nil
+}
+
+// PruneHistory delete revisions replaced before before. Returns the number of deleted revisions
+func (s *MemoryStore) PruneHistory(before time.Time) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var deleted int64
+	for objID, history := range s.history {
+		var kept []memoryRevision
+		for _, r := range history {
+			if r.replacedAt < before.Unix() {
+				deleted++
+				continue
+			}
+			kept = append(kept, r)
+		}
+		if len(kept) == 0 {
+			delete(s.history, objID)
+		} else {
+			s.history[objID] = kept
+		}
+	}
+	return deleted, nil
+}
+
+// GetObjectIDFromSourceID get object ID from content source ID
+func (s *MemoryStore) GetObjectIDFromSourceID(source protocol.SourceID, sourceID []byte) (int64, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	mapping, ok := s.sourceIDs[memorySourceKey{source, string(sourceID)}]
+	if !ok {
+		return 0, ErrNotFound
+	}
+	return mapping.objID, nil
+}
+
+// GetSourceIDMapping get object ID from content source ID and whether its object is still pending
+func (s *MemoryStore) GetSourceIDMapping(source protocol.SourceID, sourceID []byte) (int64, bool, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	mapping, ok := s.sourceIDs[memorySourceKey{source, string(sourceID)}]
+	if !ok {
+		return 0, false, ErrNotFound
+	}
+	return mapping.objID, mapping.pending, nil
+}
+
+// GetObjectIDsFromSourceIDs get the mappings of multiple content source IDs, keyed by source ID.
+// Source IDs without a mapping are left out of the result
+func (s *MemoryStore) GetObjectIDsFromSourceIDs(source protocol.SourceID, sourceIDs [][]byte) (map[string]SourceIDMapping, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	mappings := make(map[string]SourceIDMapping, len(sourceIDs))
+	for _, sourceID := range sourceIDs {
+		mapping, ok := s.sourceIDs[memorySourceKey{source, string(sourceID)}]
+		if !ok {
+			continue
+		}
+		mappings[string(sourceID)] = SourceIDMapping{
+			SourceID: append([]byte(nil), sourceID...),
+			ObjectID: mapping.objID,
+			Pending:  mapping.pending,
+		}
+	}
+	return mappings, nil
+}
+
+// InsertSourceIDMappings insert multiple mappings of content source IDs. Source IDs that are
+// already mapped keep their mapping
+func (s *MemoryStore) InsertSourceIDMappings(source protocol.SourceID, mappings []SourceIDMapping) error {
+	s.insertSourceIDMappings(source, mappings)
+	return nil
+}
+
+func (s *MemoryStore) insertSourceIDMappings(source protocol.SourceID, mappings []SourceIDMapping) func() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var inserted []memorySourceKey
+	for _, mapping := range mappings {
+		key := memorySourceKey{source, string(mapping.SourceID)}
+		if _, ok := s.sourceIDs[key]; ok {
+			continue
+		}
+		s.sourceIDs[key] = memorySourceID{objID: mapping.ObjectID, pending: mapping.Pending}
+		inserted = append(inserted, key)
+	}
+	return func() {
+		s.mu.Lock()
+		for _, key := range inserted {
+			delete(s.sourceIDs, key)
+		}
+		s.mu.Unlock()
+	}
+}
+
+// InsertSourceIDToObjectID insert a mapping between id from a content source and object id
+func (s *MemoryStore) InsertSourceIDToObjectID(objID int64, source protocol.SourceID, sourceID []byte) error {
+	_, err := s.insertSourceIDToObjectID(memorySourceID{objID: objID}, source, sourceID)
+	return err
+}
+
+// InsertPendingSourceIDToObjectID insert a mapping whose object is still being fetched from its source
+func (s *MemoryStore) InsertPendingSourceIDToObjectID(objID int64, source protocol.SourceID, sourceID []byte) error {
+	_, err := s.insertSourceIDToObjectID(memorySourceID{objID: objID, pending: true}, source, sourceID)
+	return err
+}
+
+func (s *MemoryStore) insertSourceIDToObjectID(mapping memorySourceID, source protocol.SourceID, sourceID []byte) (func(), error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	key := memorySourceKey{source, string(sourceID)}
+	if _, ok := s.sourceIDs[key]; ok {
+		return nil, ErrDuplicate
+	}
+	s.sourceIDs[key] = mapping
+	return func() {
+		s.mu.Lock()
+		delete(s.sourceIDs, key)
+		s.mu.Unlock()
+	}, nil
+}
+
+// ClearPendingSourceID mark the object of a mapping as stored
+func (s *MemoryStore) ClearPendingSourceID(source protocol.SourceID, sourceID []byte) error {
+	_, err := s.clearPendingSourceID(source, sourceID)
+	return err
+}
+
+func (s *MemoryStore) clearPendingSourceID(source protocol.SourceID, sourceID []byte) (func(), error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	key := memorySourceKey{source, string(sourceID)}
+	mapping, ok := s.sourceIDs[key]
+	if !ok || !mapping.pending {
+		return func() {}, nil
+	}
+	s.sourceIDs[key] = memorySourceID{objID: mapping.objID}
+	return func() {
+		s.mu.Lock()
+		s.sourceIDs[key] = mapping
+		s.mu.Unlock()
+	}, nil
+}
+
+// InsertURL record the post a normalized URL was first submitted in
+func (s *MemoryStore) InsertURL(url string, postID int64) error {
+	_, err := s.insertURL(url, postID)
+	return err
+}
+
+func (s *MemoryStore) insertURL(url string, postID int64) (func(), error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.urls[url]; ok {
+		return nil, ErrDuplicate
+	}
+	s.urls[url] = postID
+	return func() {
+		s.mu.Lock()
+		delete(s.urls, url)
+		s.mu.Unlock()
+	}, nil
+}
+
+// InsertSubmission record a post as a submission of its author
+func (s *MemoryStore) InsertSubmission(authorID int64, postID int64, unixTime int32) error {
+	_, err := s.insertSubmission(authorID, postID, unixTime)
+	return err
+}
+
+func (s *MemoryStore) insertSubmission(authorID int64, postID int64, unixTime int32) (func(), error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, submission := range s.submissions[authorID] {
+		if submission.postID == postID {
+			return nil, ErrDuplicate
+		}
+	}
+	s.submissions[authorID] = append(s.submissions[authorID], memorySubmission{postID: postID, unixTime: unixTime})
+	return func() {
+		s.mu.Lock()
+		submissions := s.submissions[authorID]
+		for i, submission := range submissions {
+			if submission.postID == postID {
+				s.submissions[authorID] = append(submissions[:i:i], submissions[i+1:]...)
+				break
+			}
+		}
+		s.mu.Unlock()
+	}, nil
+}
+
+// GetSubmissions get the IDs of the newest count posts of an author, newest first
+func (s *MemoryStore) GetSubmissions(authorID int64, count int) ([]int64, error) {
+	s.mu.RLock()
+	submissions := append([]memorySubmission(nil), s.submissions[authorID]...)
+	s.mu.RUnlock()
+	sort.Slice(submissions, func(i, j int) bool {
+		if submissions[i].unixTime != submissions[j].unixTime {
+			return submissions[i].unixTime > submissions[j].unixTime
+		}
+		return submissions[i].postID > submissions[j].postID
+	})
+	if len(submissions) > count {
+		submissions = submissions[:count]
+	}
+	postIDs := make([]int64, len(submissions))
+	for i, submission := range submissions {
+		postIDs[i] = submission.postID
+	}
+	return postIDs, nil
+}
+
+// CreateAPIKey issue a key. Returns the key, which can not be read again
+func (s *MemoryStore) CreateAPIKey(name string, rate int, burst int) (string, APIKey, error) {
+	key, err := newAPIKey()
+	if err != nil {
+		return "", APIKey{}, err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	apiKey := APIKey{ID: int64(len(s.apiKeys) + 1), Name: name, Rate: rate, Burst: burst, CreatedAt: time.Now().Unix()}
+	s.apiKeys[string(hashAPIKey(key))] = apiKey
+	return key, apiKey, nil
+}
+
+// GetAPIKey get a key, including revoked keys. Returns ErrNotFound if it does not exist
+func (s *MemoryStore) GetAPIKey(key string) (APIKey, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	apiKey, ok := s.apiKeys[string(hashAPIKey(key))]
+	if !ok {
+		return APIKey{}, ErrNotFound
+	}
+	return apiKey, nil
+}
+
+// ListAPIKeys get all keys, oldest first
+func (s *MemoryStore) ListAPIKeys() ([]APIKey, error) {
+	s.mu.RLock()
+	keys := make([]APIKey, 0, len(s.apiKeys))
+	for _, apiKey := range s.apiKeys {
+		keys = append(keys, apiKey)
+	}
+	s.mu.RUnlock()
+	sort.Slice(keys, func(i, j int) bool { return keys[i].ID < keys[j].ID })
+	return keys, nil
+}
+
+// RevokeAPIKey revoke the key with the given ID. Returns ErrNotFound if it does not exist
+func (s *MemoryStore) RevokeAPIKey(id int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for hash, apiKey := range s.apiKeys {
+		if apiKey.ID != id {
+			continue
+		}
+		if apiKey.RevokedAt == 0 {
+			apiKey.RevokedAt = time.Now().Unix()
+			s.apiKeys[hash] = apiKey
+		}
+		return nil
+	}
+	return ErrNotFound
+}
+
+// WithTx run f in a transaction. OnModified handlers are called for the written objects after commit
+func (s *MemoryStore) WithTx(f func(tx SourceStore) error) error {
+	tx := &memoryTx{MemoryStore: s}
+	if err := tx.run(f); err != nil {
+		return err
+	}
+	for _, objID := range tx.modifiedIDs {
+		s.modified(objID)
+	}
+	return nil
+}
+
+// run f holding the transaction lock. The writes of f are undone if it fails or panics
+func (tx *memoryTx) run(f func(tx SourceStore) error) (err error) {
+	tx.txMu.Lock()
+	defer tx.txMu.Unlock()
+	defer func() {
+		if p := recover(); p != nil {
+			tx.rollback()
+			panic(p)
+		}
+	}()
+	if err = f(tx); err != nil {
+		tx.rollback()
+	}
+	return
+}
+
+// rollback undo the writes of the transaction, newest first
+func (tx *memoryTx) rollback() {
+	for i := len(tx.undo) - 1; i >= 0; i-- {
+		tx.undo[i]()
+	}
+}
+
+// WithTx run f in the current transaction
+func (tx *memoryTx) WithTx(f func(tx SourceStore) error) error {
+	return f(tx)
+}
+
+// InsertObject insert an object
+func (tx *memoryTx) InsertObject(obj Object) error {
+	undo, err := tx.insertObject(obj)
+	if err != nil {
+		return err
+	}
+	tx.undo = append(tx.undo, undo)
+	tx.modifiedIDs = append(tx.modifiedIDs, obj.ID)
+	return nil
+}
+
+// InsertObjects insert multiple objects
+func (tx *memoryTx) InsertObjects(objs []Object) error {
+	undo, err := tx.insertObjects(objs)
+	if err != nil {
+		return err
+	}
+	tx.undo = append(tx.undo, undo)
+	for _, obj := range objs {
+		tx.modifiedIDs = append(tx.modifiedIDs, obj.ID)
+	}
+	return nil
+}
+
+// UpdateSourceObject update object fields that come from content sources
+func (tx *memoryTx) UpdateSourceObject(obj Object, version int) error {
+	undo, err := tx.updateSourceObject(obj, version)
+	if err != nil {
+		return err
+	}
+	tx.undo = append(tx.undo, undo)
+	tx.modifiedIDs = append(tx.modifiedIDs, obj.ID)
+	return nil
+}
+
+// InsertSourceIDToObjectID insert a mapping between id from a content source and object id
+func (tx *memoryTx) InsertSourceIDToObjectID(objID int64, source protocol.SourceID, sourceID []byte) error {
+	undo, err := tx.insertSourceIDToObjectID(memorySourceID{objID: objID}, source, sourceID)
+	if err != nil {
+		return err
+	}
+	tx.undo = append(tx.undo, undo)
+	return nil
+}
+
+// InsertPendingSourceIDToObjectID insert a mapping whose object is still being fetched from its source
+func (tx *memoryTx) InsertPendingSourceIDToObjectID(objID int64, source protocol.SourceID, sourceID []byte) error {
+	undo, err := tx.insertSourceIDToObjectID(memorySourceID{objID: objID, pending: true}, source, sourceID)
+	if err != nil {
+		return err
+	}
+	tx.undo = append(tx.undo, undo)
+	return nil
+}
+
+// InsertSourceIDMappings insert multiple mappings of content source IDs
+func (tx *memoryTx) InsertSourceIDMappings(source protocol.SourceID, mappings []SourceIDMapping) error {
+	tx.undo = append(tx.undo, tx.insertSourceIDMappings(source, mappings))
+	return nil
+}
+
+// ClearPendingSourceID mark the object of a mapping as stored
+func (tx *memoryTx) ClearPendingSourceID(source protocol.SourceID, sourceID []byte) error {
+	undo, err := tx.clearPendingSourceID(source, sourceID)
+	if err != nil {
+		return err
+	}
+	tx.undo = append(tx.undo, undo)
+	return nil
+}
+
+// InsertURL record the post a normalized URL was first submitted in
+func (tx *memoryTx) InsertURL(url string, postID int64) error {
+	undo, err := tx.insertURL(url, postID)
+	if err != nil {
+		return err
+	}
+	tx.undo = append(tx.undo, undo)
+	return nil
+}
+
+// InsertSubmission record a post as a submission of its author
+func (tx *memoryTx) InsertSubmission(authorID int64, postID int64, unixTime int32) error {
+	undo, err := tx.insertSubmission(authorID, postID, unixTime)
+	if err != nil {
+		return err
+	}
+	tx.undo = append(tx.undo, undo)
+	return nil
+}
+
+// GetListing get a cached listing
+func (s *MemoryStore) GetListing(listingID int) (Listing, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	stored, ok := s.listings[listingID]
+	if !ok {
+		return Listing{}, ErrNotFound
+	}
+	return Listing{Objects: append([]int64(nil), stored.listing.Objects...)}, nil
+}
+
+// GetListingVersion get the version of a cached listing
+func (s *MemoryStore) GetListingVersion(listingID int) (int, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	stored, ok := s.listings[listingID]
+	if !ok {
+		return 0, ErrNotFound
+	}
+	return stored.version, nil
+}
+
+// SetListing replace a cached listing
+func (s *MemoryStore) SetListing(listingID int, listing Listing) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	version := 0
+	if stored, ok := s.listings[listingID]; ok {
+		version = stored.version + 1
+	}
+	s.listings[listingID] = memoryListing{
+		listing: Listing{Objects: append([]int64(nil), listing.Objects...)},
+		version: version,
+	}
+	return nil
+}
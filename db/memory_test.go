@@ -0,0 +1,121 @@
+package db
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/kabergstrom/site/protocol"
+)
+
+func TestMemoryStoreSourceIDMappings(t *testing.T) {
+	s := NewMemoryStore()
+	if err := s.InsertSourceIDToObjectID(1, protocol.HackerNews, []byte("p1")); err != nil {
+		t.Fatal(err)
+	}
+	err := s.InsertSourceIDMappings(protocol.HackerNews, []SourceIDMapping{
+		{SourceID: []byte("p1"), ObjectID: 10, Pending: true},
+		{SourceID: []byte("p2"), ObjectID: 20, Pending: true},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	mappings, err := s.GetObjectIDsFromSourceIDs(protocol.HackerNews, [][]byte{[]byte("p1"), []byte("p2"), []byte("p3")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := map[string]SourceIDMapping{
+		"p1": {SourceID: []byte("p1"), ObjectID: 1},
+		"p2": {SourceID: []byte("p2"), ObjectID: 20, Pending: true},
+	}
+	if !reflect.DeepEqual(mappings, expected) {
+		t.Errorf("Got mappings %+v, expected %+v", mappings, expected)
+	}
+}
+
+func TestMemoryStoreInsertObjects(t *testing.T) {
+	s := NewMemoryStore()
+	first, second := testObject(), testObject()
+	second.ID++
+	if err := s.InsertObject(second); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.InsertObjects([]Object{first, second}); err != ErrDuplicate {
+		t.Fatalf("Inserting an existing object returned %v, expected ErrDuplicate", err)
+	}
+	if _, err := s.GetObject(first.ID); err != ErrNotFound {
+		t.Errorf("Object of a failed batch was inserted")
+	}
+	second.ID++
+	if err := s.InsertObjects([]Object{first, second}); err != nil {
+		t.Fatal(err)
+	}
+	objects, err := s.GetObjects([]int64{first.ID, second.ID})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(objects) != 2 {
+		t.Errorf("Got %d objects, expected 2", len(objects))
+	}
+}
+
+func TestMemoryStoreHistory(t *testing.T) {
+	s := NewMemoryStore()
+	obj := testObject()
+	if err := s.InsertObject(obj); err != nil {
+		t.Fatal(err)
+	}
+	// a kids only update leaves no revision
+	obj.Kids = Kids{Kids: []int64{124, 125, 126}}
+	if err := s.UpdateSourceObject(obj, 0); err != nil {
+		t.Fatal(err)
+	}
+	// neither does recompressing the same data
+	obj.Compression = Zstd
+	if err := s.UpdateSourceObject(obj, 1); err != nil {
+		t.Fatal(err)
+	}
+	edited := testObject()
+	edited.Kids = obj.Kids
+	edited.Data = &Post{Author: 99, Parent: 7, Text: "edited"}
+	if err := s.UpdateSourceObject(edited, 2); err != nil {
+		t.Fatal(err)
+	}
+	revisions, err := s.GetObjectHistory(obj.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(revisions) != 1 || revisions[0].Version != 2 || !reflect.DeepEqual(revisions[0].Data, obj.Data) {
+		t.Fatalf("Unexpected revisions %+v", revisions)
+	}
+	if deleted, err := s.PruneHistory(time.Unix(revisions[0].ReplacedAt, 0)); err != nil || deleted != 0 {
+		t.Errorf("Pruning before the revision deleted %d, %v", deleted, err)
+	}
+	if deleted, err := s.PruneHistory(time.Unix(revisions[0].ReplacedAt+1, 0)); err != nil || deleted != 1 {
+		t.Errorf("Pruning after the revision deleted %d, %v", deleted, err)
+	}
+}
+
+func TestMemoryStoreTxPanic(t *testing.T) {
+	s := NewMemoryStore()
+	func() {
+		defer func() {
+			if p := recover(); p != "failed" {
+				t.Errorf("Recovered %v", p)
+			}
+		}()
+		s.WithTx(func(tx SourceStore) error {
+			if err := tx.InsertObject(testObject()); err != nil {
+				t.Fatal(err)
+			}
+			panic("failed")
+		})
+	}()
+	if _, err := s.GetObject(testObject().ID); err != ErrNotFound {
+		t.Errorf("Insert of a panicking transaction was kept: %v", err)
+	}
+	// the transaction lock was released
+	if err := s.WithTx(func(tx SourceStore) error { return tx.InsertObject(testObject()) }); err != nil {
+		t.Fatal(err)
+	}
+}
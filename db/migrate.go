@@ -0,0 +1,196 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	mysql "github.com/go-sql-driver/mysql"
+	"github.com/pkg/errors"
+)
+
+// Migration a numbered change of the database schema. Up and Down are run statement by statement
+type Migration struct {
+	Version int
+	Name    string
+	Up      []string
+	Down    []string
+}
+
+// MigrationStatus whether a migration is applied and when
+type MigrationStatus struct {
+	Migration
+	Applied   bool
+	AppliedAt time.Time
+}
+
+// MySQL errors meaning a statement's change is already present. They are ignored so databases
+// created with the old db.sql, or left half way by a failed migration, can be migrated.
+// MySQL DDL is not transactional so a failed migration is not rolled back
+var alreadyAppliedErrors = map[uint16]bool{
+	1050: true, // table already exists
+	1060: true, // duplicate column name
+	1061: true, // duplicate key name
+	1091: true, // can't drop field or key, check that it exists
+}
+
+const (
+	migrationLock        = "site_schema_migration"
+	migrationLockTimeout = 30
+)
+
+// Migrator applies Migrations to a database and records them in the schema_version table
+type Migrator struct {
+	db         *sql.DB
+	migrations []Migration
+}
+
+// OpenMigrator opens a MySQL connection for migrating. Unlike OpenSQL it does not prepare
+// statements, so it works on a database without tables
+func OpenMigrator(dataSourceName string) (*Migrator, error) {
+	conn, err := sql.Open("mysql", dataSourceName)
+	if err != nil {
+		return nil, err
+	}
+	return NewMigrator(conn, Migrations)
+}
+
+// NewMigrator create a Migrator for migrations, which must be ordered by version
+func NewMigrator(db *sql.DB, migrations []Migration) (*Migrator, error) {
+	for i, m := range migrations {
+		if m.Version <= 0 || (i > 0 && m.Version <= migrations[i-1].Version) {
+			return nil, fmt.Errorf("Migration %d %s is out of order", m.Version, m.Name)
+		}
+	}
+	return &Migrator{db: db, migrations: migrations}, nil
+}
+
+// Close close the database connection
+func (m *Migrator) Close() error {
+	return m.db.Close()
+}
+
+// Status get all migrations and whether they are applied
+func (m *Migrator) Status() ([]MigrationStatus, error) {
+	ctx := context.Background()
+	conn, err := m.db.Conn(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	return m.status(ctx, conn)
+}
+
+// Up apply migrations up to and including version target. A target of 0 applies all migrations
+func (m *Migrator) Up(target int) error {
+	return m.locked(func(ctx context.Context, conn *sql.Conn, status []MigrationStatus) error {
+		for _, s := range status {
+			if s.Applied || (target > 0 && s.Version > target) {
+				continue
+			}
+			if err := m.run(ctx, conn, s.Migration, s.Up); err != nil {
+				return err
+			}
+			if _, err := conn.ExecContext(ctx, "INSERT INTO schema_version (version, name) VALUES (?, ?)", s.Version, s.Name); err != nil {
+				return errors.Wrapf(err, "Failed to record migration %d", s.Version)
+			}
+		}
+		return nil
+	})
+}
+
+// Down revert the last steps applied migrations
+func (m *Migrator) Down(steps int) error {
+	return m.locked(func(ctx context.Context, conn *sql.Conn, status []MigrationStatus) error {
+		for i := len(status) - 1; i >= 0 && steps > 0; i-- {
+			s := status[i]
+			if !s.Applied {
+				continue
+			}
+			if err := m.run(ctx, conn, s.Migration, s.Down); err != nil {
+				return err
+			}
+			if _, err := conn.ExecContext(ctx, "DELETE FROM schema_version WHERE version = ?", s.Version); err != nil {
+				return errors.Wrapf(err, "Failed to record revert of migration %d", s.Version)
+			}
+			steps--
+		}
+		return nil
+	})
+}
+
+// locked run f holding a MySQL named lock, so migrations started at the same time in
+// several environments or instances do not interleave
+func (m *Migrator) locked(f func(ctx context.Context, conn *sql.Conn, status []MigrationStatus) error) error {
+	ctx := context.Background()
+	conn, err := m.db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	var acquired sql.NullInt64
+	if err := conn.QueryRowContext(ctx, "SELECT GET_LOCK(?, ?)", migrationLock, migrationLockTimeout).Scan(&acquired); err != nil {
+		return err
+	}
+	if acquired.Int64 != 1 {
+		return fmt.Errorf("Timed out waiting for lock %s held by another migration", migrationLock)
+	}
+	defer conn.ExecContext(ctx, "SELECT RELEASE_LOCK(?)", migrationLock)
+	if _, err := conn.ExecContext(ctx, `CREATE TABLE IF NOT EXISTS schema_version (
+		version INT NOT NULL PRIMARY KEY,
+		name VARCHAR(255) NOT NULL,
+		applied_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+	)`); err != nil {
+		return err
+	}
+	status, err := m.status(ctx, conn)
+	if err != nil {
+		return err
+	}
+	return f(ctx, conn, status)
+}
+
+func (m *Migrator) status(ctx context.Context, conn *sql.Conn) ([]MigrationStatus, error) {
+	status := make([]MigrationStatus, len(m.migrations))
+	index := make(map[int]int, len(m.migrations))
+	for i, migration := range m.migrations {
+		status[i].Migration = migration
+		index[migration.Version] = i
+	}
+	rows, err := conn.QueryContext(ctx, "SELECT version, applied_at FROM schema_version")
+	if err != nil {
+		if me, ok := err.(*mysql.MySQLError); ok && me.Number == 1146 {
+			// schema_version does not exist yet, nothing is applied
+			return status, nil
+		}
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var version int
+		var appliedAt mysql.NullTime
+		if err := rows.Scan(&version, &appliedAt); err != nil {
+			return nil, err
+		}
+		i, ok := index[version]
+		if !ok {
+			return nil, fmt.Errorf("Database has migration %d applied which is unknown to this version", version)
+		}
+		status[i].Applied = true
+		status[i].AppliedAt = appliedAt.Time
+	}
+	return status, rows.Err()
+}
+
+func (m *Migrator) run(ctx context.Context, conn *sql.Conn, migration Migration, statements []string) error {
+	for _, stmt := range statements {
+		if _, err := conn.ExecContext(ctx, stmt); err != nil {
+			if me, ok := err.(*mysql.MySQLError); ok && alreadyAppliedErrors[me.Number] {
+				continue
+			}
+			return errors.Wrapf(err, "Migration %d %s failed", migration.Version, migration.Name)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,174 @@
+package db
+
+// Migrations the schema of the site database, oldest first. Append new migrations with the
+// next version number and never edit one that has been released
+var Migrations = []Migration{
+	{
+		Version: 1,
+		Name:    "initial schema",
+		Up: []string{
+			`CREATE TABLE IF NOT EXISTS object (
+				id BIGINT NOT NULL PRIMARY KEY,
+				source TINYINT UNSIGNED NOT NULL,
+				type TINYINT UNSIGNED NOT NULL,
+				score BIGINT NOT NULL,
+				source_score BIGINT NOT NULL,
+				deleted BOOLEAN NOT NULL,
+				unixtime INT NOT NULL,
+				compression TINYINT UNSIGNED NOT NULL,
+				encoding TINYINT UNSIGNED NOT NULL,
+				data BLOB NOT NULL,
+				kids BLOB NOT NULL,
+				num_kids INT NOT NULL,
+				version INT NOT NULL DEFAULT 0
+			)`,
+			`CREATE TABLE IF NOT EXISTS urls (
+				url_hash BINARY(32) NOT NULL PRIMARY KEY,
+				url TEXT NOT NULL,
+				post_id BIGINT NOT NULL
+			)`,
+			`CREATE TABLE IF NOT EXISTS votes (
+				user_id BIGINT NOT NULL,
+				post_id BIGINT NOT NULL,
+				type TINYINT UNSIGNED NOT NULL, -- vote, report
+				amount INT NOT NULL, -- vote amount: upvote or downvote. 0 if removed
+				PRIMARY KEY(user_id, post_id, type)
+			)`,
+			`CREATE TABLE IF NOT EXISTS source_id_to_object_id (
+				source TINYINT NOT NULL,
+				source_id VARBINARY(767) NOT NULL,
+				object_id BIGINT NOT NULL,
+				PRIMARY KEY(source, source_id),
+				UNIQUE INDEX obj_id(object_id)
+			)`,
+			`CREATE TABLE IF NOT EXISTS listing_cache (
+				id INT NOT NULL,
+				data BLOB NOT NULL,
+				version INT NOT NULL,
+				PRIMARY KEY(id)
+			)`,
+			memcacheContainer(ObjectView, "object", "id|source|type|score|source_score|deleted|unixtime|compression|encoding|num_kids|data|kids"),
+			memcacheContainer(ListingView, "listing_cache", "data"),
+		},
+		Down: []string{
+			"DELETE FROM innodb_memcache.containers WHERE name IN ('" + ObjectView + "', '" + ListingView + "')",
+			"DROP TABLE IF EXISTS listing_cache",
+			"DROP TABLE IF EXISTS source_id_to_object_id",
+			"DROP TABLE IF EXISTS votes",
+			"DROP TABLE IF EXISTS urls",
+			"DROP TABLE IF EXISTS object",
+		},
+	},
+	{
+		Version: 2,
+		Name:    "object record column",
+		Up: []string{
+			// all object columns in the self-describing record format read through object_record. NULL for rows written before it existed
+			"ALTER TABLE object ADD COLUMN record BLOB NULL",
+			memcacheContainer(ObjectRecordView, "object", "record"),
+		},
+		Down: []string{
+			"DELETE FROM innodb_memcache.containers WHERE name = '" + ObjectRecordView + "'",
+			"ALTER TABLE object DROP COLUMN record",
+		},
+	},
+	{
+		Version: 3,
+		Name:    "pending source ID mappings",
+		Up: []string{
+			// set while the object of a mapping is being fetched from its source
+			"ALTER TABLE source_id_to_object_id ADD COLUMN pending BOOLEAN NOT NULL DEFAULT FALSE",
+			// mappings written without their object by earlier versions of nats2db
+			"UPDATE source_id_to_object_id m LEFT JOIN object o ON o.id = m.object_id SET m.pending = TRUE WHERE o.id IS NULL",
+		},
+		Down: []string{
+			"ALTER TABLE source_id_to_object_id DROP COLUMN pending",
+		},
+	},
+	{
+		Version: 4,
+		Name:    "object history",
+		Up: []string{
+			// the data of an object before each update that changed it
+			`CREATE TABLE IF NOT EXISTS object_history (
+				object_id BIGINT NOT NULL,
+				version INT NOT NULL,
+				compression TINYINT UNSIGNED NOT NULL,
+				encoding TINYINT UNSIGNED NOT NULL,
+				data BLOB NOT NULL,
+				replaced_at BIGINT NOT NULL,
+				PRIMARY KEY(object_id, version),
+				INDEX replaced_at(replaced_at)
+			)`,
+		},
+		Down: []string{
+			"DROP TABLE IF EXISTS object_history",
+		},
+	},
+	{
+		Version: 5,
+		Name:    "version containers",
+		Up: []string{
+			// the version column alone, for ETags that are checked without reading the data
+			memcacheContainer(ObjectVersionView, "object", "version"),
+			memcacheContainer(ListingVersionView, "listing_cache", "version"),
+		},
+		Down: []string{
+			"DELETE FROM innodb_memcache.containers WHERE name IN ('" + ObjectVersionView + "', '" + ListingVersionView + "')",
+		},
+	},
+	{
+		Version: 6,
+		Name:    "api keys",
+		Up: []string{
+			`CREATE TABLE IF NOT EXISTS api_key (
+				id BIGINT NOT NULL AUTO_INCREMENT PRIMARY KEY,
+				key_hash BINARY(32) NOT NULL,
+				name VARCHAR(255) NOT NULL,
+				rate INT NOT NULL, -- tokens per second, 0 for the api default
+				burst INT NOT NULL, -- max tokens, 0 for the api default
+				created_at BIGINT NOT NULL,
+				revoked_at BIGINT NOT NULL DEFAULT 0,
+				UNIQUE INDEX key_hash(key_hash)
+			)`,
+		},
+		Down: []string{
+			"DROP TABLE IF EXISTS api_key",
+		},
+	},
+	{
+		Version: 7,
+		Name:    "submissions",
+		Up: []string{
+			`CREATE TABLE IF NOT EXISTS submission (
+				author_id BIGINT NOT NULL,
+				post_id BIGINT NOT NULL,
+				unixtime INT NOT NULL,
+				PRIMARY KEY(author_id, post_id),
+				INDEX author_time(author_id, unixtime)
+			)`,
+		},
+		Down: []string{
+			"DROP TABLE IF EXISTS submission",
+		},
+	},
+	{
+		Version: 8,
+		Name:    "object record mediumblob",
+		Up: []string{
+			// the record holds the data and kids blobs and a header, so it outgrows a BLOB before they do
+			"ALTER TABLE object MODIFY COLUMN record MEDIUMBLOB NULL",
+		},
+		Down: []string{
+			"ALTER TABLE object MODIFY COLUMN record BLOB NULL",
+		},
+	},
+}
+
+// memcacheContainer statement creating or replacing an innodb_memcache container for a table
+// keyed by id in the current database
+func memcacheContainer(name string, table string, valueColumns string) string {
+	return "REPLACE INTO innodb_memcache.containers " +
+		"(name, db_schema, db_table, key_columns, value_columns, flags, cas_column, expire_time_column, unique_idx_name_on_key) " +
+		"VALUES ('" + name + "', DATABASE(), '" + table + "', 'id', '" + valueColumns + "', '0', 'version', '0', 'PRIMARY')"
+}
@@ -0,0 +1,260 @@
+package db
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+
+	"github.com/gogo/protobuf/proto"
+	"github.com/kabergstrom/site/protocol"
+)
+
+// Objects are read through the InnoDB memcache plugin in one of two formats.
+//
+// The legacy format is what the object_data container returns: the value columns
+// id|source|type|score|source_score|deleted|unixtime|compression|encoding|num_kids|data|kids
+// joined with '|', where data and kids are varint length prefixed protobuf.
+//
+// The record format is the object.record column served by the object_record container.
+// It starts with a format byte followed by fields encoded as uvarint tag, uvarint length
+// and value, so fields can be added without breaking older readers and no separator is
+// ever scanned for.
+const (
+	recordFormatLegacy = 1
+	recordFormatTLV    = 2
+)
+
+const (
+	recordTagID uint64 = 1 + iota
+	recordTagSource
+	recordTagType
+	recordTagScore
+	recordTagSourceScore
+	recordTagDeleted
+	recordTagUnixTime
+	recordTagCompression
+	recordTagEncoding
+	recordTagNumKids
+	recordTagData
+	recordTagKids
+)
+
+// legacyNumericFields number of '|' separated numeric columns before data in the legacy format
+const legacyNumericFields = 10
+
+var errMalformedRecord = errors.New("db: malformed object record")
+
+// RecordFormat returns the format of a value read from the object views
+func RecordFormat(val []byte) (int, error) {
+	if len(val) == 0 {
+		return 0, io.ErrUnexpectedEOF
+	}
+	switch {
+	case val[0] == recordFormatTLV:
+		return recordFormatTLV, nil
+	case val[0] == '-' || (val[0] >= '0' && val[0] <= '9'):
+		return recordFormatLegacy, nil
+	default:
+		return 0, fmt.Errorf("Unknown object record format %d", val[0])
+	}
+}
+
+// ParseMemCacheObj parses a value from the object_record or object_data innodb memcached views into a db.Object
+func ParseMemCacheObj(val []byte) (obj Object, err error) {
+	format, err := RecordFormat(val)
+	if err != nil {
+		return
+	}
+	if format == recordFormatTLV {
+		return parseRecord(val[1:])
+	}
+	return parseLegacyMemCacheObj(val)
+}
+
+// EncodeRecord serialize an object into the record format
+func EncodeRecord(obj Object) ([]byte, error) {
+	data, err := EncodeData(obj.Data, obj.Encoding, obj.Compression)
+	if err != nil {
+		return nil, err
+	}
+	kids, err := EncodeKids(obj.Kids, obj.Encoding, obj.Compression)
+	if err != nil {
+		return nil, err
+	}
+	return encodeRecord(obj, data, kids), nil
+}
+
+func encodeRecord(obj Object, data []byte, kids []byte) []byte {
+	buf := make([]byte, 0, len(data)+len(kids)+64)
+	buf = append(buf, recordFormatTLV)
+	var scratch [binary.MaxVarintLen64]byte
+	putInt := func(tag uint64, v int64) {
+		n := binary.PutVarint(scratch[:], v)
+		buf = appendRecordField(buf, tag, scratch[:n])
+	}
+	putInt(recordTagID, obj.ID)
+	putInt(recordTagSource, int64(obj.Source))
+	putInt(recordTagType, int64(obj.Type))
+	putInt(recordTagScore, obj.Score)
+	putInt(recordTagSourceScore, obj.SourceScore)
+	deleted := int64(0)
+	if obj.Deleted {
+		deleted = 1
+	}
+	putInt(recordTagDeleted, deleted)
+	putInt(recordTagUnixTime, int64(obj.UnixTime))
+	putInt(recordTagCompression, int64(obj.Compression))
+	putInt(recordTagEncoding, int64(obj.Encoding))
+	putInt(recordTagNumKids, int64(obj.NumKids))
+	buf = appendRecordField(buf, recordTagData, data)
+	buf = appendRecordField(buf, recordTagKids, kids)
+	return buf
+}
+
+func appendRecordField(buf []byte, tag uint64, value []byte) []byte {
+	var scratch [binary.MaxVarintLen64]byte
+	n := binary.PutUvarint(scratch[:], tag)
+	buf = append(buf, scratch[:n]...)
+	n = binary.PutUvarint(scratch[:], uint64(len(value)))
+	buf = append(buf, scratch[:n]...)
+	return append(buf, value...)
+}
+
+func recordInt(value []byte, min int64, max int64) (int64, error) {
+	v, n := binary.Varint(value)
+	if n <= 0 || n != len(value) || v < min || v > max {
+		return 0, errMalformedRecord
+	}
+	return v, nil
+}
+
+func parseRecord(b []byte) (obj Object, err error) {
+	var data, kids []byte
+	var hasData, hasKids bool
+	for len(b) > 0 {
+		tag, n := binary.Uvarint(b)
+		if n <= 0 {
+			return Object{}, errMalformedRecord
+		}
+		b = b[n:]
+		length, n := binary.Uvarint(b)
+		if n <= 0 || length > uint64(len(b)-n) {
+			return Object{}, errMalformedRecord
+		}
+		value := b[n : n+int(length)]
+		b = b[n+int(length):]
+
+		var v int64
+		switch tag {
+		case recordTagID:
+			v, err = recordInt(value, -1<<63, 1<<63-1)
+			obj.ID = v
+		case recordTagSource:
+			v, err = recordInt(value, 0, 255)
+			obj.Source = protocol.SourceID(v)
+		case recordTagType:
+			v, err = recordInt(value, 0, 255)
+			obj.Type = protocol.ObjectType(v)
+		case recordTagScore:
+			v, err = recordInt(value, -1<<63, 1<<63-1)
+			obj.Score = v
+		case recordTagSourceScore:
+			v, err = recordInt(value, -1<<63, 1<<63-1)
+			obj.SourceScore = v
+		case recordTagDeleted:
+			v, err = recordInt(value, 0, 1)
+			obj.Deleted = v == 1
+		case recordTagUnixTime:
+			v, err = recordInt(value, -1<<31, 1<<31-1)
+			obj.UnixTime = int32(v)
+		case recordTagCompression:
+			v, err = recordInt(value, 0, 255)
+			obj.Compression = CompressionType(v)
+		case recordTagEncoding:
+			v, err = recordInt(value, 0, 255)
+			obj.Encoding = EncodingType(v)
+		case recordTagNumKids:
+			v, err = recordInt(value, -1<<31, 1<<31-1)
+			obj.NumKids = int32(v)
+		case recordTagData:
+			data, hasData = value, true
+		case recordTagKids:
+			kids, hasKids = value, true
+		default:
+			// fields added by newer writers are skipped
+		}
+		if err != nil {
+			return Object{}, err
+		}
+	}
+	if !hasData || !hasKids {
+		return Object{}, errMalformedRecord
+	}
+	return decodeObjectBlobs(obj, data, kids)
+}
+
+func parseLegacyMemCacheObj(val []byte) (obj Object, err error) {
+	fields := bytes.SplitN(val, []byte("|"), legacyNumericFields+1)
+	if len(fields) != legacyNumericFields+1 {
+		err = io.ErrUnexpectedEOF
+		return
+	}
+	var nums [legacyNumericFields]int64
+	for i := range nums {
+		nums[i], err = strconv.ParseInt(string(fields[i]), 10, 64)
+		if err != nil {
+			return
+		}
+	}
+	bits := [legacyNumericFields]uint{64, 8, 8, 64, 64, 1, 32, 8, 8, 32}
+	for i, n := range nums {
+		if bits[i] == 64 {
+			continue
+		}
+		if bits[i] == 32 {
+			if n < -1<<31 || n > 1<<31-1 {
+				return obj, errMalformedRecord
+			}
+		} else if n < 0 || n >= 1<<bits[i] {
+			return obj, errMalformedRecord
+		}
+	}
+	obj.ID = nums[0]
+	obj.Source = protocol.SourceID(nums[1])
+	obj.Type = protocol.ObjectType(nums[2])
+	obj.Score = nums[3]
+	obj.SourceScore = nums[4]
+	obj.Deleted = nums[5] == 1
+	obj.UnixTime = int32(nums[6])
+	obj.Compression = CompressionType(nums[7])
+	obj.Encoding = EncodingType(nums[8])
+	obj.NumKids = int32(nums[9])
+
+	// data is varint length prefixed, so a '|' inside it is never mistaken for the separator
+	rest := fields[legacyNumericFields]
+	dataSize, n := proto.DecodeVarint(rest)
+	if n == 0 || dataSize > uint64(len(rest)-n) {
+		return obj, io.ErrUnexpectedEOF
+	}
+	dataEnd := n + int(dataSize)
+	if dataEnd >= len(rest) || rest[dataEnd] != '|' {
+		return obj, errMalformedRecord
+	}
+	return decodeObjectBlobs(obj, rest[:dataEnd], rest[dataEnd+1:])
+}
+
+func decodeObjectBlobs(obj Object, data []byte, kids []byte) (Object, error) {
+	m, err := DecodeData(data, obj.Type, obj.Encoding, obj.Compression)
+	if err != nil {
+		return Object{}, err
+	}
+	obj.Data = m
+	obj.Kids, err = DecodeKids(kids, obj.Encoding, obj.Compression)
+	if err != nil {
+		return Object{}, err
+	}
+	return obj, nil
+}
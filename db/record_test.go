@@ -0,0 +1,168 @@
+package db
+
+import (
+	"bytes"
+	"fmt"
+	"reflect"
+	"testing"
+
+	"github.com/kabergstrom/site/protocol"
+)
+
+func testObject() Object {
+	return Object{
+		ID:          1234567890123,
+		Source:      protocol.HackerNews,
+		Type:        protocol.Comment,
+		Score:       -3,
+		SourceScore: 42,
+		Deleted:     true,
+		UnixTime:    1500000000,
+		Compression: None,
+		Encoding:    Protobuf,
+		Data:        &Post{Author: 99, Parent: 7, Text: "a | b || c|", Parts: []int64{1, 2}},
+		Kids:        Kids{Kids: []int64{124, 125}},
+		NumKids:     2,
+	}
+}
+
+// legacyValue builds a value the way the object_data container joins the object columns
+func legacyValue(t testing.TB, obj Object) []byte {
+	data, err := EncodeData(obj.Data, obj.Encoding, obj.Compression)
+	if err != nil {
+		t.Fatal(err)
+	}
+	kids, err := EncodeKids(obj.Kids, obj.Encoding, obj.Compression)
+	if err != nil {
+		t.Fatal(err)
+	}
+	deleted := 0
+	if obj.Deleted {
+		deleted = 1
+	}
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "%d|%d|%d|%d|%d|%d|%d|%d|%d|%d|", obj.ID, obj.Source, obj.Type, obj.Score, obj.SourceScore, deleted, obj.UnixTime, obj.Compression, obj.Encoding, obj.NumKids)
+	buf.Write(data)
+	buf.WriteByte('|')
+	buf.Write(kids)
+	return buf.Bytes()
+}
+
+func TestParseMemCacheObjFormats(t *testing.T) {
+	obj := testObject()
+	record, err := EncodeRecord(obj)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, val := range map[string][]byte{
+		"record": record,
+		"legacy": legacyValue(t, obj),
+	} {
+		parsed, err := ParseMemCacheObj(val)
+		if err != nil {
+			t.Errorf("%s: %s", name, err)
+			continue
+		}
+		if !reflect.DeepEqual(parsed, obj) {
+			t.Errorf("%s: parsed %+v, expected %+v", name, parsed, obj)
+		}
+	}
+}
+
+func TestParseMemCacheObjCompression(t *testing.T) {
+	for _, e := range []EncodingType{Protobuf, JSON} {
+		for _, c := range []CompressionType{None, Snappy, Zstd} {
+			obj := testObject()
+			obj.Encoding = e
+			obj.Compression = c
+			record, err := EncodeRecord(obj)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for name, val := range map[string][]byte{
+				"record": record,
+				"legacy": legacyValue(t, obj),
+			} {
+				parsed, err := ParseMemCacheObj(val)
+				if err != nil {
+					t.Errorf("%s %s %s: %s", e, c, name, err)
+					continue
+				}
+				if !reflect.DeepEqual(parsed, obj) {
+					t.Errorf("%s %s %s: parsed %+v, expected %+v", e, c, name, parsed, obj)
+				}
+			}
+		}
+	}
+}
+
+func TestParseRecordSkipsUnknownFields(t *testing.T) {
+	obj := testObject()
+	record, err := EncodeRecord(obj)
+	if err != nil {
+		t.Fatal(err)
+	}
+	record = appendRecordField(record, 1000, []byte("from a newer writer"))
+	parsed, err := ParseMemCacheObj(record)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(parsed, obj) {
+		t.Errorf("parsed %+v, expected %+v", parsed, obj)
+	}
+}
+
+func TestParseMemCacheObjTruncated(t *testing.T) {
+	obj := testObject()
+	record, err := EncodeRecord(obj)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, val := range map[string][]byte{
+		"record": record,
+		"legacy": legacyValue(t, obj),
+	} {
+		for i := 0; i < len(val); i++ {
+			if _, err := ParseMemCacheObj(val[:i]); err == nil {
+				t.Errorf("%s: parsing %d of %d bytes did not fail", name, i, len(val))
+			}
+		}
+	}
+}
+
+func FuzzParseMemCacheObj(f *testing.F) {
+	obj := testObject()
+	record, err := EncodeRecord(obj)
+	if err != nil {
+		f.Fatal(err)
+	}
+	f.Add(record)
+	f.Add(legacyValue(f, obj))
+	obj.Compression = Zstd
+	f.Add(legacyValue(f, obj))
+	obj.Compression = Snappy
+	f.Add(legacyValue(f, obj))
+	obj.Encoding = JSON
+	f.Add(legacyValue(f, obj))
+	user := Object{ID: 1, Source: protocol.HackerNews, Type: protocol.User, Compression: None, Encoding: Protobuf, Data: &User{Name: "pg|", About: "|"}}
+	f.Add(legacyValue(f, user))
+	f.Add([]byte("1|2|3|4|5|0|6|1|1|0|"))
+	f.Add([]byte{recordFormatTLV})
+	f.Fuzz(func(t *testing.T, val []byte) {
+		obj, err := ParseMemCacheObj(val)
+		if err != nil {
+			return
+		}
+		record, err := EncodeRecord(obj)
+		if err != nil {
+			t.Fatalf("Failed to encode parsed object %+v: %s", obj, err)
+		}
+		reparsed, err := ParseMemCacheObj(record)
+		if err != nil {
+			t.Fatalf("Failed to parse re-encoded object %+v: %s", obj, err)
+		}
+		if !reflect.DeepEqual(reparsed, obj) {
+			t.Fatalf("Re-encoded object %+v parsed as %+v", obj, reparsed)
+		}
+	})
+}
@@ -0,0 +1,208 @@
+package db
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/gogo/protobuf/proto"
+
+	"github.com/kabergstrom/site/protocol"
+)
+
+var (
+	// ErrNotFound returned by stores when an object, listing or source ID mapping does not exist
+	ErrNotFound = errors.New("db: not found")
+
+	// ErrDuplicate returned by stores when inserting a row whose key already exists
+	ErrDuplicate = errors.New("db: duplicate key")
+
+	// ErrConflict returned by stores when an optimistic update finds a different version than it was given
+	ErrConflict = errors.New("db: version conflict")
+)
+
+// ObjectStore read access to content objects
+type ObjectStore interface {
+	// GetObject get a single object. Returns ErrNotFound if it does not exist
+	GetObject(objID int64) (Object, error)
+	// GetObjects get multiple objects. IDs that do not exist are left out of the result
+	GetObjects(objIDs []int64) (map[int64]Object, error)
+}
+
+// ListingStore access to the cached listings maintained by ranking
+type ListingStore interface {
+	// GetListing get a listing. Returns ErrNotFound if it has not been stored yet
+	GetListing(listingID int) (Listing, error)
+	// SetListing replace a listing
+	SetListing(listingID int, listing Listing) error
+}
+
+// SourceIDMapping the object ID a content source ID is mapped to
+type SourceIDMapping struct {
+	SourceID []byte
+	ObjectID int64
+	// Pending the object is still being fetched from its source
+	Pending bool
+}
+
+// SourceStore write access for objects that come from content sources
+type SourceStore interface {
+	ObjectStore
+	GetObjectIDFromSourceID(source protocol.SourceID, sourceID []byte) (int64, error)
+	InsertSourceIDToObjectID(objID int64, source protocol.SourceID, sourceID []byte) error
+	// InsertPendingSourceIDToObjectID insert a mapping whose object is still being fetched from its source
+	InsertPendingSourceIDToObjectID(objID int64, source protocol.SourceID, sourceID []byte) error
+	// GetSourceIDMapping get object ID from content source ID and whether its object is still pending
+	GetSourceIDMapping(source protocol.SourceID, sourceID []byte) (objID int64, pending bool, err error)
+	// GetObjectIDsFromSourceIDs get the mappings of multiple source IDs, keyed by source ID. Source IDs without a mapping are left out of the result
+	GetObjectIDsFromSourceIDs(source protocol.SourceID, sourceIDs [][]byte) (map[string]SourceIDMapping, error)
+	// InsertSourceIDMappings insert multiple mappings. Source IDs that are already mapped keep their mapping
+	InsertSourceIDMappings(source protocol.SourceID, mappings []SourceIDMapping) error
+	// ClearPendingSourceID mark the object of a mapping as stored
+	ClearPendingSourceID(source protocol.SourceID, sourceID []byte) error
+	InsertObject(obj Object) error
+	// InsertObjects insert multiple objects. Returns ErrDuplicate if any of them exists
+	InsertObjects(objs []Object) error
+	GetObjectVersion(objID int64) (Object, int, error)
+	// UpdateSourceObject update obj if its stored version is version. Returns ErrConflict otherwise
+	UpdateSourceObject(obj Object, version int) error
+	// InsertURL record the post a normalized URL was first submitted in. Returns ErrDuplicate if the URL is known
+	InsertURL(url string, postID int64) error
+	// InsertSubmission record postID, created at unixTime, as a submission of authorID. Returns ErrDuplicate if it is recorded
+	InsertSubmission(authorID int64, postID int64, unixTime int32) error
+	// WithTx run f with a store whose writes are committed together if f returns nil and discarded otherwise
+	WithTx(f func(tx SourceStore) error) error
+}
+
+// Revision the data of an object before an update replaced it
+type Revision struct {
+	ObjectID int64
+	// Version the object version the data belonged to
+	Version int
+	// ReplacedAt unix time of the update that replaced the data
+	ReplacedAt int64
+	Data       proto.Message
+}
+
+// HistoryStore access to the previous data of objects. Stores that implement it record a
+// Revision whenever UpdateSourceObject changes the data of an object
+type HistoryStore interface {
+	// GetObjectHistory get the revisions of an object, newest first
+	GetObjectHistory(objID int64) ([]Revision, error)
+	// PruneHistory delete revisions replaced before before. Returns the number of deleted revisions
+	PruneHistory(before time.Time) (int64, error)
+}
+
+// SubmissionStore reads the posts of users. A submission is recorded with its post, so it is
+// kept even if the author is stored later
+type SubmissionStore interface {
+	// GetSubmissions get the IDs of the newest count posts of an author, newest first
+	GetSubmissions(authorID int64, count int) ([]int64, error)
+}
+
+// VersionStore reads the versions of objects and listings without their data. A version changes
+// with every write of its object or listing
+type VersionStore interface {
+	// GetObjectVersions get the versions of multiple objects. IDs that do not exist are left out of the result
+	GetObjectVersions(objIDs []int64) (map[int64]int, error)
+	// GetListingVersion get the version of a listing. Returns ErrNotFound if it has not been stored yet
+	GetListingVersion(listingID int) (int, error)
+}
+
+// APIKey a key issued to a client of the api. Only the SHA-256 hash of the key itself is stored
+type APIKey struct {
+	ID   int64
+	Name string
+	// Rate tokens per second and Burst max tokens of the rate limit of the key. 0 uses the defaults of the api
+	Rate      int
+	Burst     int
+	CreatedAt int64
+	// RevokedAt unix time the key was revoked, 0 if it is valid
+	RevokedAt int64
+}
+
+// APIKeyStore issues and looks up the keys of api clients
+type APIKeyStore interface {
+	// CreateAPIKey issue a key. Returns the key, which can not be read again
+	CreateAPIKey(name string, rate int, burst int) (string, APIKey, error)
+	// GetAPIKey get a key, including revoked keys. Returns ErrNotFound if it does not exist
+	GetAPIKey(key string) (APIKey, error)
+	// ListAPIKeys get all keys, oldest first
+	ListAPIKeys() ([]APIKey, error)
+	// RevokeAPIKey revoke the key with the given ID. Returns ErrNotFound if it does not exist
+	RevokeAPIKey(id int64) error
+}
+
+// Store an object and listing backend
+type Store interface {
+	ObjectStore
+	ListingStore
+}
+
+// Close close the connections of store, if its backend has any
+func Close(store interface{}) error {
+	if closer, ok := store.(io.Closer); ok {
+		return closer.Close()
+	}
+	return nil
+}
+
+// Pinger a backend that can check it is reachable
+type Pinger interface {
+	// Ping returns an error if the backend can not be reached
+	Ping() error
+}
+
+const (
+	// BackendMemcache reads through the InnoDB memcache plugin views
+	BackendMemcache = "memcache"
+	// BackendSQL reads and writes the site tables with plain SQL
+	BackendSQL = "sql"
+	// BackendMemory keeps everything in process memory, for tests and local development
+	BackendMemory = "memory"
+)
+
+// OpenStore opens the store backend with the given name. addr is the memcache address
+// for BackendMemcache and the MySQL data source name for BackendSQL. An empty backend
+// defaults to BackendMemcache
+func OpenStore(backend string, addr string) (Store, error) {
+	switch backend {
+	case "", BackendMemcache:
+		return NewMemcacheStore(addr)
+	case BackendSQL:
+		return OpenSQL(addr)
+	case BackendMemory:
+		return NewMemoryStore(), nil
+	default:
+		return nil, fmt.Errorf("Unknown store backend %s", backend)
+	}
+}
+
+// OpenSourceStore opens a store backend that supports writes from content sources.
+// BackendMemcache is not supported since the memcache views can not resolve source IDs
+func OpenSourceStore(backend string, addr string) (SourceStore, error) {
+	switch backend {
+	case "", BackendSQL:
+		return OpenSQL(addr)
+	case BackendMemory:
+		return NewMemoryStore(), nil
+	default:
+		return nil, fmt.Errorf("Store backend %s does not support source writes", backend)
+	}
+}
+
+// OpenSQL opens a MySQL connection and prepares a Database on it
+func OpenSQL(dataSourceName string) (*Database, error) {
+	conn, err := sql.Open("mysql", dataSourceName)
+	if err != nil {
+		return nil, err
+	}
+	dbi, err := NewDBI(conn)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return dbi, nil
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+	"text/tabwriter"
+	"time"
+
+	"github.com/kabergstrom/site/db"
+)
+
+const apiKeyUsage = `Usage: dbtool apikey <create|list|revoke> [flags]
+
+  create [-rate n] [-burst n] <name>  issue a key and print it
+  list                                list keys
+  revoke <id>                         revoke a key
+`
+
+// apiKey issue, list and revoke the keys of api clients
+func apiKey(dbi *db.Database, args []string) error {
+	if len(args) == 0 {
+		fmt.Fprint(os.Stderr, apiKeyUsage)
+		os.Exit(2)
+	}
+	switch args[0] {
+	case "create":
+		flags := flag.NewFlagSet("apikey create", flag.ExitOnError)
+		rate := flags.Int("rate", 0, "tokens per second, 0 for the api default")
+		burst := flags.Int("burst", 0, "max tokens, 0 for the api default")
+		flags.Parse(args[1:])
+		if flags.NArg() != 1 {
+			return fmt.Errorf("Usage: dbtool apikey create [flags] <name>")
+		}
+		key, k, err := dbi.CreateAPIKey(flags.Arg(0), *rate, *burst)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(os.Stderr, "Created key %d for %s. The key can not be shown again\n", k.ID, k.Name)
+		fmt.Println(key)
+		return nil
+	case "list":
+		keys, err := dbi.ListAPIKeys()
+		if err != nil {
+			return err
+		}
+		w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(w, "ID\tNAME\tRATE\tBURST\tCREATED\tREVOKED")
+		for _, k := range keys {
+			revoked := ""
+			if k.RevokedAt != 0 {
+				revoked = time.Unix(k.RevokedAt, 0).Format(time.RFC3339)
+			}
+			fmt.Fprintf(w, "%d\t%s\t%s\t%s\t%s\t%s\n", k.ID, k.Name, limitName(k.Rate), limitName(k.Burst), time.Unix(k.CreatedAt, 0).Format(time.RFC3339), revoked)
+		}
+		return w.Flush()
+	case "revoke":
+		if len(args) != 2 {
+			return fmt.Errorf("Usage: dbtool apikey revoke <id>")
+		}
+		id, err := strconv.ParseInt(args[1], 10, 64)
+		if err != nil {
+			return fmt.Errorf("Invalid key id %s", args[1])
+		}
+		if err := dbi.RevokeAPIKey(id); err == db.ErrNotFound {
+			return fmt.Errorf("Key %d not found", id)
+		} else if err != nil {
+			return err
+		}
+		return nil
+	default:
+		fmt.Fprint(os.Stderr, apiKeyUsage)
+		os.Exit(2)
+	}
+	return nil
+}
+
+// limitName a rate or burst of a key, where 0 is the api default
+func limitName(limit int) string {
+	if limit == 0 {
+		return "default"
+	}
+	return strconv.Itoa(limit)
+}
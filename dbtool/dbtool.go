@@ -0,0 +1,127 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/kabergstrom/site/db"
+	"github.com/ngaut/log"
+)
+
+const usage = `Usage: dbtool <command> [flags]
+
+Commands:
+  migrate     apply or revert schema migrations: migrate up|down|status
+  dump        print objects by ID as JSON, whatever their encoding and compression
+  recompress  rewrite object rows that are not stored with the given compression
+  reindex     rebuild a search index from all objects: reindex <index path>
+  apikey      issue, list and revoke api keys: apikey create|list|revoke
+`
+
+func main() {
+	log.SetFlags(log.LstdFlags | log.Lshortfile)
+	if len(os.Args) < 2 {
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+	dataSourceName := os.Getenv("MYSQL_DATA_SOURCE_NAME")
+	var err error
+	switch os.Args[1] {
+	case "migrate":
+		err = migrate(dataSourceName, os.Args[2:])
+	case "dump":
+		err = withDatabase(dataSourceName, os.Args[2:], dump)
+	case "recompress":
+		err = withDatabase(dataSourceName, os.Args[2:], recompress)
+	case "reindex":
+		err = withDatabase(dataSourceName, os.Args[2:], reindex)
+	case "apikey":
+		err = withDatabase(dataSourceName, os.Args[2:], apiKey)
+	default:
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+}
+
+func withDatabase(dataSourceName string, args []string, command func(*db.Database, []string) error) error {
+	dbi, err := db.OpenSQL(dataSourceName)
+	if err != nil {
+		return err
+	}
+	defer dbi.Close()
+	return command(dbi, args)
+}
+
+// maxRewriteAttempts how many times a row that keeps changing under the rewrite is retried
+const maxRewriteAttempts = 5
+
+func recompress(dbi *db.Database, args []string) error {
+	flags := flag.NewFlagSet("recompress", flag.ExitOnError)
+	compressionName := flags.String("compression", "zstd", "target compression: none, snappy or zstd")
+	batchSize := flags.Int("batch", 500, "rows read per batch")
+	pause := flags.Duration("pause", 100*time.Millisecond, "pause between batches to limit load on MySQL")
+	startID := flags.Int64("start", 0, "only rewrite objects with an ID greater than this, to resume an earlier run")
+	flags.Parse(args)
+
+	compression, err := db.ParseCompression(*compressionName)
+	if err != nil {
+		return err
+	}
+	afterID := *startID
+	var scanned, rewritten, skipped int
+	for {
+		objects, versions, err := dbi.ScanObjects(afterID, *batchSize)
+		if err != nil {
+			return err
+		}
+		if len(objects) == 0 {
+			break
+		}
+		for i, obj := range objects {
+			afterID = obj.ID
+			scanned++
+			if obj.Compression == compression {
+				continue
+			}
+			ok, err := rewriteCompression(dbi, obj, versions[i], compression)
+			if err != nil {
+				return err
+			}
+			if ok {
+				rewritten++
+			} else {
+				skipped++
+				log.Warnf("Object %d kept changing, skipped it", obj.ID)
+			}
+		}
+		log.Infof("Scanned %d objects, rewrote %d, skipped %d. Last id %d", scanned, rewritten, skipped, afterID)
+		time.Sleep(*pause)
+	}
+	log.Infof("Done. Scanned %d objects, rewrote %d, skipped %d", scanned, rewritten, skipped)
+	return nil
+}
+
+// rewriteCompression rewrites obj with compression. When the row was updated since it was read
+// it is read again and retried, so concurrent writes from nats2db are never overwritten
+func rewriteCompression(dbi *db.Database, obj db.Object, version int, compression db.CompressionType) (bool, error) {
+	for attempt := 0; attempt < maxRewriteAttempts; attempt++ {
+		if obj.Compression == compression {
+			return true, nil
+		}
+		obj.Compression = compression
+		ok, err := dbi.RewriteObject(obj, version)
+		if err != nil || ok {
+			return ok, err
+		}
+		obj, version, err = dbi.GetObjectVersion(obj.ID)
+		if err != nil {
+			return false, err
+		}
+	}
+	return false, nil
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/gogo/protobuf/jsonpb"
+	"github.com/kabergstrom/site/db"
+	"github.com/kabergstrom/site/protocol"
+)
+
+var sourceNames = map[protocol.SourceID]string{
+	protocol.Site:       "site",
+	protocol.HackerNews: "hackernews",
+}
+
+var typeNames = map[protocol.ObjectType]string{
+	protocol.LinkPost: "link",
+	protocol.Comment:  "comment",
+	protocol.TextPost: "text",
+	protocol.Job:      "job",
+	protocol.Poll:     "poll",
+	protocol.PollOpt:  "pollopt",
+	protocol.User:     "user",
+}
+
+type dumpedObject struct {
+	ID          int64           `json:"id"`
+	Version     int             `json:"version"`
+	Source      string          `json:"source"`
+	Type        string          `json:"type"`
+	Score       int64           `json:"score"`
+	SourceScore int64           `json:"source_score"`
+	Deleted     bool            `json:"deleted"`
+	Time        string          `json:"time"`
+	Compression string          `json:"compression"`
+	Encoding    string          `json:"encoding"`
+	NumKids     int32           `json:"num_kids"`
+	Kids        []int64         `json:"kids"`
+	Data        json.RawMessage `json:"data"`
+}
+
+func sourceName(source protocol.SourceID) string {
+	if name, ok := sourceNames[source]; ok {
+		return name
+	}
+	return strconv.Itoa(int(source))
+}
+
+func typeName(t protocol.ObjectType) string {
+	if name, ok := typeNames[t]; ok {
+		return name
+	}
+	return strconv.Itoa(int(t))
+}
+
+// dump print objects as indented JSON, whatever encoding and compression they are stored with
+func dump(dbi *db.Database, args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("Usage: dbtool dump <id>...")
+	}
+	marshaler := jsonpb.Marshaler{OrigName: true}
+	for _, arg := range args {
+		id, err := strconv.ParseInt(arg, 10, 64)
+		if err != nil {
+			return fmt.Errorf("Invalid object id %s", arg)
+		}
+		obj, version, err := dbi.GetObjectVersion(id)
+		if err == db.ErrNotFound {
+			return fmt.Errorf("Object %d not found", id)
+		} else if err != nil {
+			return err
+		}
+		var data bytes.Buffer
+		if err := marshaler.Marshal(&data, obj.Data); err != nil {
+			return err
+		}
+		out, err := json.MarshalIndent(dumpedObject{
+			ID:          obj.ID,
+			Version:     version,
+			Source:      sourceName(obj.Source),
+			Type:        typeName(obj.Type),
+			Score:       obj.Score,
+			SourceScore: obj.SourceScore,
+			Deleted:     obj.Deleted,
+			Time:        time.Unix(int64(obj.UnixTime), 0).UTC().Format(time.RFC3339),
+			Compression: obj.Compression.String(),
+			Encoding:    obj.Encoding.String(),
+			NumKids:     obj.NumKids,
+			Kids:        obj.Kids.Kids,
+			Data:        data.Bytes(),
+		}, "", "  ")
+		if err != nil {
+			return err
+		}
+		fmt.Fprintln(os.Stdout, string(out))
+	}
+	return nil
+}
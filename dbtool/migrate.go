@@ -0,0 +1,64 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/kabergstrom/site/db"
+)
+
+const migrateUsage = `Usage: dbtool migrate <up|down|status> [flags]
+
+  up [-to version]  apply migrations up to version, all by default
+  down [-steps n]   revert the last n applied migrations, 1 by default
+  status            list migrations and whether they are applied
+`
+
+func migrate(dataSourceName string, args []string) error {
+	if len(args) == 0 {
+		fmt.Fprint(os.Stderr, migrateUsage)
+		os.Exit(2)
+	}
+	m, err := db.OpenMigrator(dataSourceName)
+	if err != nil {
+		return err
+	}
+	defer m.Close()
+	switch args[0] {
+	case "up":
+		flags := flag.NewFlagSet("migrate up", flag.ExitOnError)
+		to := flags.Int("to", 0, "version to migrate to, 0 for the latest")
+		flags.Parse(args[1:])
+		if err := m.Up(*to); err != nil {
+			return err
+		}
+	case "down":
+		flags := flag.NewFlagSet("migrate down", flag.ExitOnError)
+		steps := flags.Int("steps", 1, "number of migrations to revert")
+		flags.Parse(args[1:])
+		if err := m.Down(*steps); err != nil {
+			return err
+		}
+	case "status":
+	default:
+		fmt.Fprint(os.Stderr, migrateUsage)
+		os.Exit(2)
+	}
+	status, err := m.Status()
+	if err != nil {
+		return err
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "VERSION\tNAME\tAPPLIED")
+	for _, s := range status {
+		applied := "pending"
+		if s.Applied {
+			applied = s.AppliedAt.Format(time.RFC3339)
+		}
+		fmt.Fprintf(w, "%d\t%s\t%s\n", s.Version, s.Name, applied)
+	}
+	return w.Flush()
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"time"
+
+	"github.com/kabergstrom/site/db"
+	"github.com/kabergstrom/site/search"
+	"github.com/ngaut/log"
+)
+
+func reindex(dbi *db.Database, args []string) error {
+	flags := flag.NewFlagSet("reindex", flag.ExitOnError)
+	batchSize := flags.Int("batch", 500, "rows read per batch")
+	pause := flags.Duration("pause", 0, "pause between batches to limit load on MySQL")
+	startID := flags.Int64("start", 0, "only index objects with an ID greater than this, to resume an earlier run")
+	flags.Parse(args)
+	if flags.NArg() != 1 {
+		return fmt.Errorf("Usage: dbtool reindex [flags] <index path>")
+	}
+
+	// the index can only be opened by one process, so the api using it must be stopped
+	index, err := search.Open(flags.Arg(0))
+	if err != nil {
+		return err
+	}
+	defer index.Close()
+	afterID := *startID
+	scanned := 0
+	for {
+		objects, _, err := dbi.ScanObjects(afterID, *batchSize)
+		if err != nil {
+			return err
+		}
+		if len(objects) == 0 {
+			break
+		}
+		authors, err := search.AuthorNames(dbi, objects)
+		if err != nil {
+			return err
+		}
+		if err := index.Update(objects, authors); err != nil {
+			return err
+		}
+		scanned += len(objects)
+		afterID = objects[len(objects)-1].ID
+		log.Infof("Indexed %d objects. Last id %d", scanned, afterID)
+		time.Sleep(*pause)
+	}
+	log.Infof("Done. Indexed %d objects", scanned)
+	return nil
+}
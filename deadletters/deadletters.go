@@ -0,0 +1,152 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/gogo/protobuf/proto"
+	"github.com/kabergstrom/site/protocol"
+	"github.com/kabergstrom/site/protocol/deadletter"
+	"github.com/kabergstrom/site/protocol/subjects"
+	"github.com/nats-io/go-nats-streaming"
+	"github.com/ngaut/log"
+)
+
+const usage = `Usage: deadletters <command> [flags] <consumer>
+
+Commands:
+  list    print the dead letters of a consumer (nats2db, ranking, hackernews)
+  replay  publish dead letters to their original subject again
+
+Flags:
+`
+
+// letter a dead letter and its sequence in the dead letter subject, used to pick letters to replay
+type letter struct {
+	id uint64
+	protocol.DeadLetter
+}
+
+func main() {
+	log.SetFlags(log.LstdFlags | log.Lshortfile)
+	flags := flag.NewFlagSet("deadletters", flag.ExitOnError)
+	wait := flags.Duration("wait", 2*time.Second, "stop reading letters when none arrived for this long")
+	after := flags.Uint64("after", 0, "only use letters with an ID greater than this")
+	flags.Usage = func() {
+		fmt.Fprint(os.Stderr, usage)
+		flags.PrintDefaults()
+	}
+	if len(os.Args) < 2 {
+		flags.Usage()
+		os.Exit(2)
+	}
+	command := os.Args[1]
+	flags.Parse(os.Args[2:])
+	if flags.NArg() < 1 || (command != "list" && command != "replay") {
+		flags.Usage()
+		os.Exit(2)
+	}
+	consumer := flags.Arg(0)
+	ids := make(map[uint64]bool)
+	for _, arg := range flags.Args()[1:] {
+		id, err := strconv.ParseUint(arg, 10, 64)
+		if err != nil {
+			log.Fatalf("Invalid letter id %s", arg)
+		}
+		ids[id] = true
+	}
+
+	clusterID := os.Getenv("NATS_CLUSTER_ID")
+	clientID := os.Getenv("NATS_CLIENT_ID")
+	if clientID == "" {
+		clientID = "deadletters"
+	}
+	natsURL := os.Getenv("NATS_URL")
+	if natsURL == "" {
+		natsURL = stan.DefaultNatsURL
+	}
+	nc, err := stan.Connect(clusterID, clientID, stan.NatsURL(natsURL))
+	if err != nil {
+		log.Fatalf("Error connecting to nats-streaming server: %s", err)
+	}
+	defer nc.Close()
+
+	letters, err := readLetters(nc, consumer, *after, *wait)
+	if err != nil {
+		log.Fatal(err)
+	}
+	for _, l := range letters {
+		if len(ids) > 0 && !ids[l.id] {
+			continue
+		}
+		switch command {
+		case "list":
+			printLetter(l)
+		case "replay":
+			if err := replay(nc, l); err != nil {
+				log.Fatal(err)
+			}
+			log.Infof("Replayed letter %d to %s", l.id, l.Subject)
+		}
+	}
+}
+
+// readLetters read all letters of consumer with an ID greater than after. NATS Streaming has no
+// end of subject marker, so reading stops when no letter arrived for wait
+func readLetters(nc stan.Conn, consumer string, after uint64, wait time.Duration) ([]letter, error) {
+	msgs := make(chan *stan.Msg, 64)
+	sub, err := nc.Subscribe(deadletter.Subject(consumer), func(m *stan.Msg) { msgs <- m }, stan.StartAtSequence(after+1))
+	if err != nil {
+		return nil, err
+	}
+	defer sub.Close()
+	var letters []letter
+	for {
+		select {
+		case m := <-msgs:
+			l := letter{id: m.Sequence}
+			if err := proto.Unmarshal(m.Data, &l.DeadLetter); err != nil {
+				log.Errorf("Skipping malformed letter %d: %s", m.Sequence, err)
+				continue
+			}
+			letters = append(letters, l)
+		case <-time.After(wait):
+			return letters, nil
+		}
+	}
+}
+
+func printLetter(l letter) {
+	fmt.Printf("%d\t%s\t%s", l.id, time.Unix(l.FailedAt, 0).UTC().Format(time.RFC3339), l.Subject)
+	if l.Sequence != 0 {
+		fmt.Printf(" #%d", l.Sequence)
+	}
+	fmt.Printf("\n\terror: %s\n", l.Error)
+	var payload proto.Message
+	switch l.Subject {
+	case subjects.HackerNewsPosts:
+		payload = &protocol.HnPost{}
+	case subjects.HackerNewsUsers:
+		payload = &protocol.HnUser{}
+	case subjects.HackerNewsGetObject:
+		payload = &protocol.HnObjectRequest{}
+	case subjects.ObjectsModified:
+		payload = &protocol.ObjectModified{}
+	}
+	if payload != nil && proto.Unmarshal(l.Data, payload) == nil {
+		fmt.Printf("\tdata: %s\n", proto.CompactTextString(payload))
+	} else {
+		fmt.Printf("\tdata: %q\n", l.Data)
+	}
+}
+
+// replay publish the original message again. Letters without a sequence came from core NATS
+func replay(nc stan.Conn, l letter) error {
+	if l.Sequence == 0 {
+		return nc.NatsConn().Publish(l.Subject, l.Data)
+	}
+	return nc.Publish(l.Subject, l.Data)
+}
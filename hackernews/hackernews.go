@@ -1,10 +1,12 @@
 package main
 
 import (
+	"context"
 	"fmt"
 
 	"os"
 	"strconv"
+	"sync"
 	"time"
 
 	"github.com/ngaut/log"
@@ -12,10 +14,14 @@ import (
 	"net/http"
 
 	"github.com/gogo/protobuf/proto"
+	"github.com/kabergstrom/site/lifecycle"
+	"github.com/kabergstrom/site/monitor"
 	"github.com/kabergstrom/site/protocol"
+	"github.com/kabergstrom/site/protocol/deadletter"
 	"github.com/kabergstrom/site/protocol/subjects"
 	nats "github.com/nats-io/go-nats"
 	"github.com/nats-io/go-nats-streaming"
+	"github.com/pkg/errors"
 	"gopkg.in/zabawaba99/firego.v1"
 )
 
@@ -46,6 +52,9 @@ type hnProfile struct {
 }
 
 const (
+	// deadLetterConsumer names the dead letter subject for malformed object requests
+	deadLetterConsumer = "hackernews"
+
 	updateURL  = "https://hacker-news.firebaseio.com/v0/updates.json?print=pretty"
 	itemURL    = "https://hacker-news.firebaseio.com/v0/item/%d.json?print=pretty"
 	profileURL = "https://hacker-news.firebaseio.com/v0/user/%s.json?print=pretty"
@@ -104,8 +113,13 @@ func main() {
 		log.Infof("Discovered nats server %s", server)
 	}
 
-	defer nc.Close()
+	mon := monitor.NewServer()
+	mon.AddCheck("nats", monitor.NATSConnected(nc.NatsConn()))
 
+	lc := lifecycle.New()
+	lc.Go("Monitoring", func(ctx context.Context) error {
+		return mon.Serve(ctx, monitor.Addr("", "MONITOR_PORT", monitor.HackerNewsPort))
+	})
 	client := &http.Client{}
 
 	notifications := make(chan firego.Event)
@@ -113,27 +127,70 @@ func main() {
 	if err := f.Watch(notifications); err != nil {
 		log.Fatal(err)
 	}
-	defer f.StopWatching()
 
+	// pending publishes whose ack has not been received yet
+	var pending sync.WaitGroup
+	ackHandler := func(ackedNuid string, err error) {
+		if err != nil {
+			log.Errorf("Warning: error publishing msg id %s: %v\n", ackedNuid, err.Error())
+		}
+		pending.Done()
+	}
+	publishAsync := func(subject string, data []byte) {
+		pending.Add(1)
+		if _, err := nc.PublishAsync(subject, data, ackHandler); err != nil {
+			log.Errorf("Error publishing to %s: %s", subject, err)
+			pending.Done()
+		}
+	}
+	// replies to requests without a reply subject are published to the stream, so they are
+	// processed like changed objects
+	reply := func(m *nats.Msg, subject string, data []byte) {
+		if m.Reply == "" {
+			publishAsync(subject, data)
+		} else {
+			nc.NatsConn().Publish(subject, data)
+		}
+	}
+	var sub *nats.Subscription
 	{
 		getChan := make(chan *nats.Msg)
-		nc.NatsConn().Subscribe(subjects.HackerNewsGetObject, func(m *nats.Msg) {
-			getChan <- m
+		var err error
+		sub, err = nc.NatsConn().Subscribe(subjects.HackerNewsGetObject, func(m *nats.Msg) {
+			select {
+			case getChan <- m:
+			case <-lc.Done():
+				// dropped, the requester times out and retries on another instance
+			}
 		})
+		if err != nil {
+			log.Fatalf("Error subscribing to %s: %s", subjects.HackerNewsGetObject, err)
+		}
 		concurrency, err := strconv.Atoi(os.Getenv("HN_REQUEST_CONCURRENCY"))
 		if err != nil {
 			concurrency = 1
 		}
 		for i := 0; i < concurrency; i++ {
-			go func(c chan *nats.Msg) {
+			lc.Go("Request worker", func(ctx context.Context) error {
 				reqFgo := firego.New("", client)
 				for {
-					m := <-c
+					var m *nats.Msg
+					select {
+					case m = <-getChan:
+					case <-ctx.Done():
+						return nil
+					}
 					start := time.Now()
 					replySubject := m.Reply
 					var request protocol.HnObjectRequest
 					if err := proto.Unmarshal(m.Data, &request); err != nil {
-						log.Fatal(err)
+						err = errors.Wrapf(err, "Malformed request on %s", m.Subject)
+						log.Errorf("Moving request to %s: %s", deadletter.Subject(deadLetterConsumer), err)
+						if err := deadletter.Publish(nc, deadletter.FromNats(deadLetterConsumer, m, err)); err != nil {
+							log.Error(err)
+						}
+						monitor.MessageProcessed(m.Subject, monitor.ResultDeadLetter, start)
+						continue
 					}
 					switch request.Type {
 					case protocol.HnObjectRequest_USER:
@@ -144,14 +201,17 @@ func main() {
 						var profile hnProfile
 						err := reqFgo.Value(&profile)
 						if err != nil {
-							return
+							// the worker keeps serving requests, the requester retries if it waits for a reply
+							log.Errorf("Error fetching HN user %s: %s", request.Username, err)
+							monitor.MessageProcessed(m.Subject, monitor.ResultFailed, start)
+							continue
 						}
 						p := hnUserToProtocol(profile)
 						replyBuffer, err := proto.Marshal(&p)
 						if err != nil {
-							log.Fatal(fmt.Sprintf("Error marshalling reply for %s", subjects.HackerNewsGetObject))
+							return errors.Wrapf(err, "Error marshalling reply for %s", subjects.HackerNewsGetObject)
 						}
-						nc.NatsConn().Publish(replySubject, replyBuffer)
+						reply(m, replySubject, replyBuffer)
 					case protocol.HnObjectRequest_POST:
 						if replySubject == "" {
 							replySubject = subjects.HackerNewsPosts
@@ -160,59 +220,98 @@ func main() {
 						var post hnPost
 						err := reqFgo.Value(&post)
 						if err != nil {
-							return
+							log.Errorf("Error fetching HN id %d: %s", request.Id, err)
+							monitor.MessageProcessed(m.Subject, monitor.ResultFailed, start)
+							continue
 						}
 						p := hnPostToProtocol(post)
 						replyBuffer, err := proto.Marshal(&p)
 						if err != nil {
-							log.Fatal(fmt.Sprintf("Error marshalling reply for %s", subjects.HackerNewsGetObject))
+							return errors.Wrapf(err, "Error marshalling reply for %s", subjects.HackerNewsGetObject)
 						}
-						nc.NatsConn().Publish(replySubject, replyBuffer)
+						reply(m, replySubject, replyBuffer)
 					}
+					monitor.MessageProcessed(m.Subject, monitor.ResultOK, start)
 					fmt.Printf("Response sent in %s for %s\n", time.Now().Sub(start).String(), request.Type.String())
 				}
-			}(getChan)
+			})
 		}
 	}
 
 	fireGoClient := firego.New("", client)
-	ackHandler := func(ackedNuid string, err error) {
-		if err != nil {
-			log.Errorf("Warning: error publishing msg id %s: %v\n", ackedNuid, err.Error())
+Watch:
+	for {
+		var event firego.Event
+		var ok bool
+		select {
+		case event, ok = <-notifications:
+			if !ok {
+				lc.Fail(errors.New("Watching HackerNews updates stopped"))
+				break Watch
+			}
+		case <-lc.Done():
+			break Watch
 		}
-	}
-	for event := range notifications {
+		start := time.Now()
 		var items map[string][]interface{}
 		if err := event.Value(&items); err != nil {
-			log.Fatal(err)
+			lc.Fail(err)
+			break Watch
 		}
 		for _, element := range items["items"] {
 			fireGoClient.SetURL(fmt.Sprintf(itemURL, int(element.(float64))))
 			var p hnPost
 			if err := fireGoClient.Value(&p); err != nil {
-				log.Fatal(err)
+				lc.Fail(err)
+				break Watch
 			}
 
 			o := hnPostToProtocol(p)
 
 			if bytes, err := proto.Marshal(&o); err != nil {
-				log.Fatal(err)
+				lc.Fail(err)
+				break Watch
 			} else {
-				nc.PublishAsync(subjects.HackerNewsPosts, bytes, ackHandler)
+				publishAsync(subjects.HackerNewsPosts, bytes)
+				monitor.MessageProcessed(subjects.HackerNewsPosts, monitor.ResultOK, start)
 			}
 		}
 		for _, element := range items["profiles"] {
 			fireGoClient.SetURL(fmt.Sprintf(profileURL, element))
 			var p hnProfile
 			if err := fireGoClient.Value(&p); err != nil {
-				log.Fatal(err)
+				lc.Fail(err)
+				break Watch
 			}
 			u := hnUserToProtocol(p)
 			if bytes, err := proto.Marshal(&u); err != nil {
-				log.Fatal(err)
+				lc.Fail(err)
+				break Watch
 			} else {
-				nc.PublishAsync(subjects.HackerNewsUsers, bytes, ackHandler)
+				publishAsync(subjects.HackerNewsUsers, bytes)
+				monitor.MessageProcessed(subjects.HackerNewsUsers, monitor.ResultOK, start)
 			}
 		}
 	}
+
+	f.StopWatching()
+	if err := sub.Unsubscribe(); err != nil {
+		log.Errorf("Error unsubscribing from %s: %s", subjects.HackerNewsGetObject, err)
+	}
+	lc.Wait(lifecycle.DefaultTimeout)
+	// objects published before the shutdown are only sent once their acks arrive
+	acked := make(chan struct{})
+	go func() {
+		pending.Wait()
+		close(acked)
+	}()
+	select {
+	case <-acked:
+	case <-time.After(lifecycle.DefaultTimeout):
+		log.Errorf("Publishes were not acked within %s", lifecycle.DefaultTimeout)
+	}
+	if err := nc.Close(); err != nil {
+		log.Errorf("Error closing nats-streaming connection: %s", err)
+	}
+	lc.Exit()
 }
@@ -0,0 +1,107 @@
+// Package harness runs an embedded NATS Streaming server and a db.MemoryStore so the
+// services can be tested together in one process without MySQL
+package harness
+
+import (
+	"fmt"
+	"net"
+	"sync"
+	"testing"
+
+	"github.com/gogo/protobuf/proto"
+	"github.com/kabergstrom/site/db"
+	"github.com/kabergstrom/site/protocol"
+	"github.com/kabergstrom/site/protocol/subjects"
+	natsd "github.com/nats-io/gnatsd/server"
+	"github.com/nats-io/go-nats-streaming"
+	"github.com/nats-io/nats-streaming-server/server"
+)
+
+// ClusterID NATS Streaming cluster ID of the embedded server
+const ClusterID = "site-test"
+
+// Harness an embedded NATS Streaming server and in-memory store.
+// Every object written to Store is announced on objects.modified, like mysql2nats does
+type Harness struct {
+	URL   string
+	Store *db.MemoryStore
+
+	t      testing.TB
+	server *server.StanServer
+	mu     sync.Mutex
+	conns  []stan.Conn
+}
+
+// Start run a NATS Streaming server on a free local port
+func Start(t testing.TB) *Harness {
+	t.Helper()
+	port, err := freePort()
+	if err != nil {
+		t.Fatalf("Failed to find a free port: %s", err)
+	}
+	stanOpts := server.GetDefaultOptions()
+	stanOpts.ID = ClusterID
+	natsOpts := natsd.Options{
+		Host:   "127.0.0.1",
+		Port:   port,
+		NoLog:  true,
+		NoSigs: true,
+	}
+	s, err := server.RunServerWithOpts(stanOpts, &natsOpts)
+	if err != nil {
+		t.Fatalf("Failed to start nats-streaming server: %s", err)
+	}
+	h := &Harness{
+		URL:    fmt.Sprintf("nats://127.0.0.1:%d", port),
+		Store:  db.NewMemoryStore(),
+		t:      t,
+		server: s,
+	}
+	notifier := h.Connect("mysql2nats")
+	h.Store.OnModified(func(objID int64) {
+		payload, err := proto.Marshal(&protocol.ObjectModified{Id: objID})
+		if err != nil {
+			t.Errorf("Failed to marshal modification of %d: %s", objID, err)
+			return
+		}
+		if err := notifier.Publish(subjects.ObjectsModified, payload); err != nil {
+			t.Errorf("Failed to publish modification of %d: %s", objID, err)
+		}
+	})
+	return h
+}
+
+// Connect open a NATS Streaming connection to the embedded server. It is closed by Close
+func (h *Harness) Connect(clientID string) stan.Conn {
+	h.t.Helper()
+	sc, err := stan.Connect(ClusterID, clientID, stan.NatsURL(h.URL))
+	if err != nil {
+		h.t.Fatalf("Failed to connect %s to nats-streaming: %s", clientID, err)
+	}
+	h.mu.Lock()
+	h.conns = append(h.conns, sc)
+	h.mu.Unlock()
+	return sc
+}
+
+// Close close all connections and stop the server
+func (h *Harness) Close() {
+	h.Store.OnModified(nil)
+	h.mu.Lock()
+	conns := h.conns
+	h.conns = nil
+	h.mu.Unlock()
+	for i := len(conns) - 1; i >= 0; i-- {
+		conns[i].Close()
+	}
+	h.server.Shutdown()
+}
+
+func freePort() (int, error) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return 0, err
+	}
+	defer l.Close()
+	return l.Addr().(*net.TCPAddr).Port, nil
+}
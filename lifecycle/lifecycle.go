@@ -0,0 +1,116 @@
+// Package lifecycle stops a service gracefully on SIGINT and SIGTERM, or when one of its
+// goroutines fails, and exits with a status that tells the two apart
+package lifecycle
+
+import (
+	"context"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/ngaut/log"
+	"github.com/pkg/errors"
+)
+
+// DefaultTimeout how long a service waits for its goroutines to finish their work when stopping
+const DefaultTimeout = 30 * time.Second
+
+// Lifecycle a context that is canceled when the service should stop
+type Lifecycle struct {
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+
+	mu  sync.Mutex
+	err error
+}
+
+// New create a Lifecycle that stops on SIGINT or SIGTERM. A second signal exits right away
+func New() *Lifecycle {
+	l := newLifecycle()
+	signals := make(chan os.Signal, 2)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		sig := <-signals
+		log.Infof("Received %s, shutting down", sig)
+		l.cancel()
+		sig = <-signals
+		log.Errorf("Received %s while shutting down, exiting", sig)
+		os.Exit(1)
+	}()
+	return l
+}
+
+func newLifecycle() *Lifecycle {
+	l := &Lifecycle{}
+	l.ctx, l.cancel = context.WithCancel(context.Background())
+	return l
+}
+
+// Done closed when the service should stop
+func (l *Lifecycle) Done() <-chan struct{} {
+	return l.ctx.Done()
+}
+
+// Stop stop the service without an error
+func (l *Lifecycle) Stop() {
+	l.cancel()
+}
+
+// Fail stop the service because of err. Only the first failure is kept
+func (l *Lifecycle) Fail(err error) {
+	l.mu.Lock()
+	if l.err == nil {
+		l.err = err
+	}
+	l.mu.Unlock()
+	l.cancel()
+}
+
+// Err the failure that stopped the service, nil if it was stopped by a signal or is running
+func (l *Lifecycle) Err() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.err
+}
+
+// Go run f in a goroutine until it returns. f must return when ctx is done. An error
+// returned by f stops the service
+func (l *Lifecycle) Go(name string, f func(ctx context.Context) error) {
+	l.wg.Add(1)
+	go func() {
+		defer l.wg.Done()
+		if err := f(l.ctx); err != nil {
+			l.Fail(errors.Wrapf(err, "%s failed", name))
+		}
+	}()
+}
+
+// Wait wait for the goroutines started with Go to return. Returns false if they did not
+// return within timeout
+func (l *Lifecycle) Wait(timeout time.Duration) bool {
+	done := make(chan struct{})
+	go func() {
+		l.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return true
+	case <-time.After(timeout):
+		log.Errorf("Goroutines did not stop within %s", timeout)
+		return false
+	}
+}
+
+// Exit exit with status 1 if the service failed, or 0 if it was stopped by a signal
+func (l *Lifecycle) Exit() {
+	if err := l.Err(); err != nil {
+		log.Errorf("Stopped: %s", err)
+		os.Exit(1)
+	}
+	log.Info("Stopped")
+	os.Exit(0)
+}
@@ -0,0 +1,52 @@
+package lifecycle
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestLifecycle(t *testing.T) {
+	l := newLifecycle()
+	stopped := make(chan struct{})
+	l.Go("worker", func(ctx context.Context) error {
+		<-ctx.Done()
+		close(stopped)
+		return nil
+	})
+	l.Go("failing", func(ctx context.Context) error {
+		return errors.New("connection lost")
+	})
+	select {
+	case <-l.Done():
+	case <-time.After(time.Second):
+		t.Fatal("A failed goroutine did not stop the service")
+	}
+	if !l.Wait(time.Second) {
+		t.Fatal("Goroutines did not return")
+	}
+	<-stopped
+	if err := l.Err(); err == nil || err.Error() != "failing failed: connection lost" {
+		t.Errorf("Unexpected error %v", err)
+	}
+	l.Fail(errors.New("later failure"))
+	if err := l.Err(); err.Error() != "failing failed: connection lost" {
+		t.Errorf("First failure was replaced by %s", err)
+	}
+}
+
+func TestStop(t *testing.T) {
+	l := newLifecycle()
+	l.Go("hanging", func(ctx context.Context) error {
+		time.Sleep(time.Second)
+		return nil
+	})
+	l.Stop()
+	if l.Wait(time.Millisecond) {
+		t.Error("Wait returned before the goroutine")
+	}
+	if err := l.Err(); err != nil {
+		t.Errorf("Stopped service has error %s", err)
+	}
+}
@@ -0,0 +1,79 @@
+package monitor
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const namespace = "site"
+
+// Results of a processed message
+const (
+	// ResultOK the message was processed and acked
+	ResultOK = "ok"
+	// ResultRetry processing failed and the message is redelivered
+	ResultRetry = "retry"
+	// ResultDeadLetter the message can never be processed and was moved to the dead letter subject
+	ResultDeadLetter = "dead_letter"
+	// ResultFailed processing failed and the message is dropped without being redelivered
+	ResultFailed = "failed"
+)
+
+var (
+	messagesProcessed = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "messages_processed_total",
+		Help:      "Messages processed, by subject and result.",
+	}, []string{"subject", "result"})
+	processingSeconds = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "message_processing_seconds",
+		Help:      "Time taken to process a message, by subject.",
+		Buckets:   prometheus.ExponentialBuckets(0.001, 4, 10),
+	}, []string{"subject"})
+	natsRequestTimeouts = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "nats_request_timeouts_total",
+		Help:      "NATS requests that got no reply in time, by subject.",
+	}, []string{"subject"})
+	rankingSeconds = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "ranking_duration_seconds",
+		Help:      "Time taken to update a listing, by listing.",
+		Buckets:   prometheus.ExponentialBuckets(0.001, 4, 10),
+	}, []string{"listing"})
+	httpRequestSeconds = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "http_request_duration_seconds",
+		Help:      "Time taken to serve an API request, by method, route and status code.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"method", "route", "status"})
+)
+
+func init() {
+	prometheus.MustRegister(messagesProcessed, processingSeconds, natsRequestTimeouts, rankingSeconds, httpRequestSeconds)
+}
+
+// MessageProcessed count a message on subject that was processed with result, starting at start
+func MessageProcessed(subject string, result string, start time.Time) {
+	messagesProcessed.WithLabelValues(subject, result).Inc()
+	processingSeconds.WithLabelValues(subject).Observe(time.Since(start).Seconds())
+}
+
+// NATSRequestTimeout count a request on subject that timed out
+func NATSRequestTimeout(subject string) {
+	natsRequestTimeouts.WithLabelValues(subject).Inc()
+}
+
+// Ranked record the time taken to update listing, starting at start
+func Ranked(listing string, start time.Time) {
+	rankingSeconds.WithLabelValues(listing).Observe(time.Since(start).Seconds())
+}
+
+// HTTPRequest record the time taken to serve a request to route, starting at start. route is the
+// route pattern, like /object/:id, so requests for different objects share a series
+func HTTPRequest(method string, route string, status int, start time.Time) {
+	httpRequestSeconds.WithLabelValues(method, route, strconv.Itoa(status)).Observe(time.Since(start).Seconds())
+}
@@ -0,0 +1,161 @@
+// Package monitor serves the health, readiness and Prometheus metrics endpoints of the services
+// and holds the metrics they share
+package monitor
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	nats "github.com/nats-io/go-nats"
+	"github.com/ngaut/log"
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// Ports each service serves the monitoring endpoints on when none is configured. Every service
+// has its own, so they can run on one host
+const (
+	APIPort        = "9181"
+	HackerNewsPort = "9182"
+	NATS2DBPort    = "9183"
+	MySQL2NATSPort = "9184"
+	RankingPort    = "9185"
+)
+
+const (
+	// CheckTimeout max time a readiness check may take before it fails, so a hanging
+	// dependency does not hang the readiness probe
+	CheckTimeout = 2 * time.Second
+	// shutdownTimeout max time the monitoring server waits for requests in flight when stopping
+	shutdownTimeout = 5 * time.Second
+)
+
+// Check returns an error if a dependency of the service is not usable
+type Check func() error
+
+// Server serves /healthz, which is ok as long as the process serves requests, /readyz, which
+// runs the readiness checks, and /metrics
+type Server struct {
+	mu     sync.Mutex
+	checks map[string]Check
+}
+
+// NewServer create a Server without readiness checks
+func NewServer() *Server {
+	return &Server{checks: make(map[string]Check)}
+}
+
+// AddCheck add a readiness check. /readyz fails while any check returns an error or takes
+// longer than CheckTimeout
+func (s *Server) AddCheck(name string, check Check) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.checks[name] = withTimeout(check, CheckTimeout)
+}
+
+// ready run the readiness checks. Returns the result of each check, in name order
+func (s *Server) ready() ([]string, bool) {
+	s.mu.Lock()
+	names := make([]string, 0, len(s.checks))
+	for name := range s.checks {
+		names = append(names, name)
+	}
+	checks := s.checks
+	s.mu.Unlock()
+	sort.Strings(names)
+	ok := true
+	results := make([]string, len(names))
+	for i, name := range names {
+		if err := checks[name](); err != nil {
+			results[i] = fmt.Sprintf("%s: %s", name, err)
+			ok = false
+		} else {
+			results[i] = fmt.Sprintf("%s: ok", name)
+		}
+	}
+	return results, ok
+}
+
+// Handler the monitoring endpoints
+func (s *Server) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/healthz", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintln(w, "ok")
+	})
+	mux.HandleFunc("/readyz", func(w http.ResponseWriter, r *http.Request) {
+		results, ok := s.ready()
+		if !ok {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+		for _, result := range results {
+			fmt.Fprintln(w, result)
+		}
+	})
+	mux.Handle("/metrics", promhttp.Handler())
+	return mux
+}
+
+// Addr the address to serve the monitoring endpoints on, from the port in environment variable
+// portEnv or defaultPort
+func Addr(host string, portEnv string, defaultPort string) string {
+	port := os.Getenv(portEnv)
+	if port == "" {
+		port = defaultPort
+	}
+	return net.JoinHostPort(host, port)
+}
+
+// Serve serve the monitoring endpoints on addr until ctx is done. Returns an error if addr can not
+// be listened on or serving fails
+func (s *Server) Serve(ctx context.Context, addr string) error {
+	lis, err := net.Listen("tcp", addr)
+	if err != nil {
+		return errors.Wrapf(err, "Failed to listen for health and metrics on %s", addr)
+	}
+	log.Infof("Serving health and metrics on %s", addr)
+	srv := &http.Server{Handler: s.Handler()}
+	served := make(chan error, 1)
+	go func() {
+		served <- srv.Serve(lis)
+	}()
+	select {
+	case err := <-served:
+		return errors.Wrap(err, "Error serving health and metrics")
+	case <-ctx.Done():
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+		defer cancel()
+		return srv.Shutdown(shutdownCtx)
+	}
+}
+
+// NATSConnected check nc is connected to a NATS server
+func NATSConnected(nc *nats.Conn) Check {
+	return func() error {
+		if !nc.IsConnected() {
+			return fmt.Errorf("NATS is not connected, status %d", nc.Status())
+		}
+		return nil
+	}
+}
+
+// withTimeout fail check if it does not return within timeout
+func withTimeout(check Check, timeout time.Duration) Check {
+	return func() error {
+		result := make(chan error, 1)
+		go func() {
+			result <- check()
+		}()
+		select {
+		case err := <-result:
+			return err
+		case <-time.After(timeout):
+			return fmt.Errorf("Timed out after %s", timeout)
+		}
+	}
+}
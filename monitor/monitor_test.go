@@ -0,0 +1,103 @@
+package monitor
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestServer(t *testing.T) {
+	s := NewServer()
+	s.AddCheck("nats", func() error { return nil })
+	h := s.Handler()
+	get := func(path string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+		return rec
+	}
+
+	if rec := get("/readyz"); rec.Code != http.StatusOK || rec.Body.String() != "nats: ok\n" {
+		t.Errorf("Ready service returned %d: %s", rec.Code, rec.Body.String())
+	}
+	s.AddCheck("store", func() error { return errors.New("connection refused") })
+	if rec := get("/readyz"); rec.Code != http.StatusServiceUnavailable || rec.Body.String() != "nats: ok\nstore: connection refused\n" {
+		t.Errorf("Service with a failed check returned %d: %s", rec.Code, rec.Body.String())
+	}
+	if rec := get("/healthz"); rec.Code != http.StatusOK {
+		t.Errorf("Health check returned %d", rec.Code)
+	}
+
+	MessageProcessed("objects.modified", ResultOK, time.Now())
+	HTTPRequest(http.MethodGet, "/object/:id", http.StatusOK, time.Now())
+	rec := get("/metrics")
+	for _, series := range []string{
+		`site_messages_processed_total{result="ok",subject="objects.modified"} 1`,
+		`site_http_request_duration_seconds_count{method="GET",route="/object/:id",status="200"} 1`,
+	} {
+		if !strings.Contains(rec.Body.String(), series) {
+			t.Errorf("Metrics are missing %s", series)
+		}
+	}
+}
+
+func TestCheckTimeout(t *testing.T) {
+	check := withTimeout(func() error {
+		time.Sleep(time.Second)
+		return nil
+	}, time.Millisecond)
+	if err := check(); err == nil {
+		t.Error("Hanging check did not time out")
+	}
+}
+
+func TestServe(t *testing.T) {
+	taken, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer taken.Close()
+	s := NewServer()
+	if err := s.Serve(context.Background(), taken.Addr().String()); err == nil {
+		t.Error("Serving on a port in use did not fail")
+	}
+
+	free, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := free.Addr().String()
+	free.Close()
+	ctx, cancel := context.WithCancel(context.Background())
+	served := make(chan error, 1)
+	go func() {
+		served <- s.Serve(ctx, addr)
+	}()
+	var res *http.Response
+	for attempt := 0; ; attempt++ {
+		if res, err = http.Get("http://" + addr + "/healthz"); err == nil || attempt == 50 {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		t.Errorf("Health check returned %d", res.StatusCode)
+	}
+	cancel()
+	select {
+	case err := <-served:
+		if err != nil {
+			t.Errorf("Stopping returned %s", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Server did not stop")
+	}
+}
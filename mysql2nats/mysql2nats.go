@@ -1,10 +1,13 @@
 package main
 
 import (
+	"context"
 	"os"
 	"time"
 
 	"github.com/gogo/protobuf/proto"
+	"github.com/kabergstrom/site/lifecycle"
+	"github.com/kabergstrom/site/monitor"
 	"github.com/kabergstrom/site/protocol"
 	"github.com/kabergstrom/site/protocol/subjects"
 	"github.com/nats-io/go-nats-streaming"
@@ -45,9 +48,10 @@ func (h *myEventHandler) OnRow(e *canal.RowsEvent) error {
 			}
 			publishStart := time.Now()
 			if err = h.nats.Publish(subjects.ObjectsModified, modBuf); err != nil {
-				errors.Wrapf(err, "Error publishing object modification for pk %d at pos %s %d", pk.(int64), publishPos.Name, publishPos.Name)
-				return err
+				monitor.MessageProcessed(subjects.ObjectsModified, monitor.ResultRetry, publishStart)
+				return errors.Wrapf(err, "Error publishing object modification for pk %d at pos %s %d", pk.(int64), publishPos.Name, publishPos.Pos)
 			}
+			monitor.MessageProcessed(subjects.ObjectsModified, monitor.ResultOK, publishStart)
 			log.Infof("%s pk %v publish %s\n", e.Action, pk, time.Now().Sub(publishStart))
 		}
 	}
@@ -78,20 +82,31 @@ func main() {
 	for _, server := range nats.NatsConn().DiscoveredServers() {
 		log.Infof("Discovered nats server %s", server)
 	}
-	defer nats.Close()
+	mon := monitor.NewServer()
+	mon.AddCheck("nats", monitor.NATSConnected(nats.NatsConn()))
+	// replaced by a query on the canal connection once the binlog is read
+	mon.AddCheck("mysql", func() error { return errors.New("Reading start position") })
+	lc := lifecycle.New()
+	lc.Go("Monitoring", func(ctx context.Context) error {
+		return mon.Serve(ctx, monitor.Addr("", "MONITOR_PORT", monitor.MySQL2NATSPort))
+	})
 	// get starting position
 	startPos := mysql.Position{}
 	{
 		positionChan := make(chan mysql.Position)
+		scanned := make(chan struct{})
 		sub, err := nats.Subscribe(subjects.ObjectsModified, func(m *stan.Msg) {
 			var objMod protocol.ObjectModified
 			if err := proto.Unmarshal(m.Data, &objMod); err != nil {
 				log.Fatal(err)
 			}
 			if objMod.MysqlFile != "" {
-				positionChan <- mysql.Position{
+				select {
+				case positionChan <- mysql.Position{
 					Name: objMod.MysqlFile,
 					Pos:  objMod.MysqlPos,
+				}:
+				case <-scanned:
 				}
 			}
 		}, stan.StartAt(pb.StartPosition_First))
@@ -107,14 +122,24 @@ func main() {
 				startPos = pos
 			case <-timeoutChecker.C:
 				if startPos.Name == oldPos.Name && startPos.Pos == oldPos.Pos {
-					timeoutChecker.Stop()
 					break Loop
 				}
 				oldPos = startPos
+			case <-lc.Done():
+				break Loop
 			}
 		}
+		timeoutChecker.Stop()
+		close(scanned)
 		sub.Unsubscribe()
 	}
+	select {
+	case <-lc.Done():
+		lc.Wait(lifecycle.DefaultTimeout)
+		nats.Close()
+		lc.Exit()
+	default:
+	}
 	cfg := canal.NewDefaultConfig()
 	cfg.Addr = os.Getenv("MYSQL_ADDRESS")
 	cfg.User = os.Getenv("MYSQL_USER")
@@ -141,11 +166,21 @@ func main() {
 	if err != nil {
 		log.Fatal(err)
 	}
-	defer c.Close()
+	mon.AddCheck("mysql", func() error {
+		_, err := c.Execute("SELECT 1")
+		return err
+	})
 	select {
 	case <-c.Ctx().Done():
+		lc.Fail(errors.Wrap(c.Ctx().Err(), "Canal stopped"))
+	case <-lc.Done():
 	}
-	if c.Ctx().Err() != nil {
-		errors.Wrap(c.Ctx().Err(), "Canal done with error")
+	// the position is published with every modification, so the next start resumes after the
+	// last published one
+	c.Close()
+	lc.Wait(lifecycle.DefaultTimeout)
+	if err := nats.Close(); err != nil {
+		log.Errorf("Error closing nats-streaming connection: %s", err)
 	}
+	lc.Exit()
 }
@@ -0,0 +1,32 @@
+package processor
+
+import "github.com/kabergstrom/site/db"
+
+// mergeSourceObject apply the fields a content source owns from obj to the stored object existing.
+// Kids are joined since an object can have comments from different sources
+func mergeSourceObject(existing db.Object, obj db.Object) db.Object {
+	existing.Deleted = obj.Deleted
+	existing.SourceScore = obj.SourceScore
+	existing.Compression = obj.Compression
+	existing.Encoding = obj.Encoding
+	existing.Data = obj.Data
+	existing.Kids = db.Kids{Kids: mergeKids(existing.Kids.Kids, obj.Kids.Kids)}
+	existing.NumKids = int32(len(existing.Kids.Kids))
+	return existing
+}
+
+// mergeKids join kid IDs without duplicates. Existing kids keep their order and kids only in
+// incoming are appended in their order
+func mergeKids(existing []int64, incoming []int64) []int64 {
+	seen := make(map[int64]bool, len(existing)+len(incoming))
+	merged := make([]int64, 0, len(existing)+len(incoming))
+	for _, kids := range [][]int64{existing, incoming} {
+		for _, kid := range kids {
+			if !seen[kid] {
+				seen[kid] = true
+				merged = append(merged, kid)
+			}
+		}
+	}
+	return merged
+}
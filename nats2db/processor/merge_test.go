@@ -0,0 +1,73 @@
+package processor
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/kabergstrom/site/db"
+	"github.com/kabergstrom/site/protocol"
+)
+
+func TestMergeKids(t *testing.T) {
+	for _, c := range []struct {
+		name     string
+		existing []int64
+		incoming []int64
+		expected []int64
+	}{
+		{"empty", nil, nil, []int64{}},
+		{"new object", nil, []int64{3, 1, 2}, []int64{3, 1, 2}},
+		{"no new kids", []int64{1, 2}, nil, []int64{1, 2}},
+		{"same kids", []int64{1, 2}, []int64{1, 2}, []int64{1, 2}},
+		{"new kid from source", []int64{1, 2}, []int64{1, 2, 3}, []int64{1, 2, 3}},
+		{"kids from other sources kept", []int64{1, 10, 2}, []int64{1, 2, 3}, []int64{1, 10, 2, 3}},
+		{"removed by source kept", []int64{1, 2}, []int64{2}, []int64{1, 2}},
+		{"duplicates", []int64{1, 1}, []int64{2, 2, 1}, []int64{1, 2}},
+	} {
+		merged := mergeKids(c.existing, c.incoming)
+		if !reflect.DeepEqual(merged, c.expected) {
+			t.Errorf("%s: merged %v and %v into %v, expected %v", c.name, c.existing, c.incoming, merged, c.expected)
+		}
+	}
+}
+
+func TestMergeSourceObject(t *testing.T) {
+	existing := db.Object{
+		ID:          1,
+		Source:      protocol.HackerNews,
+		Type:        protocol.TextPost,
+		Score:       7,
+		SourceScore: 10,
+		UnixTime:    1500000000,
+		Compression: db.None,
+		Encoding:    db.Protobuf,
+		Data:        &db.Post{Title: "old"},
+		Kids:        db.Kids{Kids: []int64{5, 6}},
+		NumKids:     2,
+	}
+	obj := db.Object{
+		ID:          1,
+		Source:      protocol.HackerNews,
+		Type:        protocol.TextPost,
+		SourceScore: 20,
+		Deleted:     true,
+		UnixTime:    1500000000,
+		Compression: db.Zstd,
+		Encoding:    db.JSON,
+		Data:        &db.Post{Title: "new"},
+		Kids:        db.Kids{Kids: []int64{6, 7}},
+		NumKids:     2,
+	}
+	merged := mergeSourceObject(existing, obj)
+	expected := existing
+	expected.SourceScore = 20
+	expected.Deleted = true
+	expected.Compression = db.Zstd
+	expected.Encoding = db.JSON
+	expected.Data = &db.Post{Title: "new"}
+	expected.Kids = db.Kids{Kids: []int64{5, 6, 7}}
+	expected.NumKids = 3
+	if !reflect.DeepEqual(merged, expected) {
+		t.Errorf("merged %+v, expected %+v", merged, expected)
+	}
+}
@@ -0,0 +1,637 @@
+// Package processor implements the nats2db message handling: objects published by
+// content sources are assigned object IDs and written to a db.SourceStore
+package processor
+
+import (
+	"sync"
+	"time"
+
+	"github.com/ngaut/log"
+
+	"strconv"
+
+	"github.com/PuerkitoBio/purell"
+	"github.com/bwmarrin/snowflake"
+	"github.com/gogo/protobuf/proto"
+	"github.com/kabergstrom/site/db"
+	"github.com/kabergstrom/site/monitor"
+	"github.com/kabergstrom/site/protocol"
+	"github.com/kabergstrom/site/protocol/deadletter"
+	"github.com/kabergstrom/site/protocol/subjects"
+	"github.com/nats-io/go-nats-streaming"
+	"github.com/nats-io/go-nats-streaming/pb"
+
+	"github.com/pkg/errors"
+)
+
+// PostProcessor stores content source objects received through NATS Streaming
+type PostProcessor struct {
+	db        db.SourceStore
+	snowflake *snowflake.Node
+	stan      stan.Conn
+	// consumer the durable name, also used for the dead letter subject
+	consumer string
+
+	// Compression used for the data and kids of written objects
+	Compression db.CompressionType
+	// Encoding used for the data and kids of written objects
+	Encoding db.EncodingType
+	// RequestTimeout max time a single hacker-news.get-object request waits for a reply
+	RequestTimeout time.Duration
+	// RequestBackoff initial wait before a timed out request is retried. Doubles with each retry
+	RequestBackoff time.Duration
+	// RequestMaxBackoff max wait between request retries
+	RequestMaxBackoff time.Duration
+	// MaxInflight max number of unacked posts delivered to the processor at once
+	MaxInflight int
+	// FetchBudget max number of objects a single post may fetch. Referenced objects beyond
+	// the budget keep their pending ID mapping and are fetched when referenced again
+	FetchBudget int
+
+	// fetch queues a HN post for fetching, enqueueFetch unless replaced by tests
+	fetch   func(hnID int64) error
+	ackWait time.Duration
+	sub     stan.Subscription
+	// stop closed by Close to stop the workers
+	stop    chan struct{}
+	workers sync.WaitGroup
+	// published objects.modified messages whose ack has not arrived yet
+	published sync.WaitGroup
+}
+type processingContext struct {
+	processedUsers map[string]int64
+	processedPosts map[int64]int64
+	// deadline for requests, before the message is redelivered
+	deadline time.Time
+	budget   *fetchBudget
+}
+
+// fetchBudget the fetches left for processing a post
+type fetchBudget struct {
+	remaining int
+	skipped   int
+}
+
+// take use one fetch of the budget. Returns false if it is exhausted
+func (b *fetchBudget) take() bool {
+	if b.remaining <= 0 {
+		b.skipped++
+		return false
+	}
+	b.remaining--
+	return true
+}
+
+func typeToTypeID(source protocol.SourceID, typeStr string) (protocol.ObjectType, error) {
+	if source == protocol.HackerNews {
+		switch typeStr {
+		case "job":
+			return protocol.Job, nil
+		case "story":
+			return protocol.TextPost, nil
+		case "comment":
+			return protocol.Comment, nil
+		case "poll":
+			return protocol.Poll, nil
+		case "pollopt":
+			return protocol.PollOpt, nil
+		}
+	}
+	return 0, deadletter.Permanentf("Unrecognized type %s for sourceID %d", typeStr, source)
+}
+
+func hnUserIDtoDatabaseID(id string) []byte {
+	return []byte("u" + id)
+}
+func hnPostIDtoDatabaseID(id int64) []byte {
+	return []byte("p" + string(strconv.FormatInt(id, 10)))
+}
+
+func hnUserToDBObject(user protocol.HnUser, id int64, submitted []int64) (obj db.Object, err error) {
+	obj.ID = id
+	obj.Source = protocol.HackerNews
+	obj.Type = protocol.User
+	obj.Score = 0
+	obj.SourceScore = user.Karma
+	obj.Deleted = false
+	obj.UnixTime = user.Created
+	obj.Compression = db.None
+	obj.Encoding = db.Protobuf
+	var serializedUser db.User
+	serializedUser.Name = user.Id
+	serializedUser.About = user.About
+	obj.Data = &serializedUser
+	obj.Kids = db.Kids{Kids: submitted}
+	return
+}
+
+func (proc *PostProcessor) processHnPost(m *stan.Msg, received time.Time) {
+	if time.Since(received) >= proc.ackWait {
+		// already redelivered while it waited for the worker
+		log.Infof("Skipping post %s, it waited longer than AckWait", strconv.FormatInt(int64(m.Sequence), 10))
+		return
+	}
+	log.Infof("Processing post %s\n", strconv.FormatInt(int64(m.Sequence), 10))
+	start := time.Now()
+	var ctx processingContext
+	ctx.processedPosts = make(map[int64]int64)
+	ctx.processedUsers = make(map[string]int64)
+	// leave a tenth of AckWait for writing the objects
+	ctx.deadline = received.Add(proc.ackWait - proc.ackWait/10)
+	ctx.budget = &fetchBudget{remaining: proc.FetchBudget}
+	err := proc.onHackerNewsPost(m.Data, ctx)
+	if ctx.budget.skipped > 0 {
+		log.Warnf("Fetch budget of post %s exhausted, %d objects left pending", strconv.FormatInt(int64(m.Sequence), 10), ctx.budget.skipped)
+	}
+	if err == nil {
+		m.Ack()
+		log.Infof("Acked post %s\n", strconv.FormatInt(int64(m.Sequence), 10))
+		monitor.MessageProcessed(m.Subject, monitor.ResultOK, start)
+		return
+	}
+	if !deadletter.IsPermanent(err) {
+		// not acked, the post is redelivered after AckWait
+		log.Infof("Error processing post %s: %s", strconv.FormatInt(int64(m.Sequence), 10), err)
+		monitor.MessageProcessed(m.Subject, monitor.ResultRetry, start)
+		return
+	}
+	log.Errorf("Moving post %s to %s: %s", strconv.FormatInt(int64(m.Sequence), 10), deadletter.Subject(proc.consumer), err)
+	if err := deadletter.Publish(proc.stan, deadletter.FromStan(proc.consumer, m, err)); err != nil {
+		log.Error(err)
+		monitor.MessageProcessed(m.Subject, monitor.ResultRetry, start)
+		return
+	}
+	m.Ack()
+	monitor.MessageProcessed(m.Subject, monitor.ResultDeadLetter, start)
+}
+
+// getUserIDFromHNID get the object ID of a HN user, fetching and storing the user if needed.
+// The ID mapping of a new user is written as pending before the fetch and the pending mark is
+// cleared together with storing the user, so a failed fetch or a user beyond the fetch budget
+// is repaired by the next post that refers to it
+func (proc *PostProcessor) getUserIDFromHNID(author string, ctx processingContext) (userID int64, err error) {
+	dbAuthor := hnUserIDtoDatabaseID(author)
+	source := protocol.HackerNews
+	userID, ok := ctx.processedUsers[author]
+	if ok {
+		return
+	}
+	userID, pending, err := proc.allocateObjectID(source, dbAuthor)
+	if err != nil {
+		return 0, errors.Wrapf(err, "Error getting user ID for HN user %s", author)
+	}
+	ctx.processedUsers[author] = userID
+	if !pending || !ctx.budget.take() {
+		return
+	}
+	request := protocol.HnObjectRequest{
+		Username: author,
+		Type:     protocol.HnObjectRequest_USER,
+	}
+	msg, err := proc.request(&request, ctx.deadline)
+	if err != nil {
+		return 0, errors.Wrapf(err, "Error requesting HN user %s", author)
+	}
+	var user protocol.HnUser
+	if err := proto.Unmarshal(msg.Data, &user); err != nil {
+		return 0, deadletter.Permanent(errors.Wrapf(err, "Malformed reply for HN user %s", author))
+	}
+	var submittedIDs []int64
+	/*for _, submitted := range user.Submitted {
+		dbID, err := proc.getPostIDFromHNID(submitted, ctx)
+		if err != nil {
+			log.Fatal(err)
+		}
+		submittedIDs = append(submittedIDs, dbID)
+	}*/
+	dbObj, err := hnUserToDBObject(user, userID, submittedIDs)
+	if err != nil {
+		return 0, err
+	}
+	dbObj.Compression = proc.Compression
+	dbObj.Encoding = proc.Encoding
+	err = proc.db.WithTx(func(tx db.SourceStore) error {
+		// a duplicate is the user stored by another worker since the mapping was read
+		if err := tx.InsertObject(dbObj); err != nil && err != db.ErrDuplicate {
+			return err
+		}
+		return tx.ClearPendingSourceID(source, dbAuthor)
+	})
+	if err != nil {
+		return 0, errors.Wrapf(err, "Error storing HN user %s", author)
+	}
+	return
+}
+
+// allocateObjectID get the object ID mapped to a source ID and whether its object is still pending.
+// A source ID without a mapping is assigned a new object ID with a pending mapping
+func (proc *PostProcessor) allocateObjectID(source protocol.SourceID, sourceID []byte) (objID int64, pending bool, err error) {
+	objID, pending, err = proc.db.GetSourceIDMapping(source, sourceID)
+	if err != db.ErrNotFound {
+		return
+	}
+	objID = proc.snowflake.Generate().Int64()
+	pending = true
+	err = proc.db.InsertPendingSourceIDToObjectID(objID, source, sourceID)
+	if err == db.ErrDuplicate {
+		// allocated by another worker since the mapping was read
+		objID, pending, err = proc.db.GetSourceIDMapping(source, sourceID)
+	}
+	return
+}
+
+// resolvePostIDs get the object IDs of HN posts into ctx.processedPosts with one lookup and one insert.
+// Posts that are not stored yet are assigned an ID with a pending mapping and queued for fetching
+// instead of being processed here, so resolving a comment tree never recurses
+func (proc *PostProcessor) resolvePostIDs(hnIDs []int64, ctx processingContext) error {
+	source := protocol.HackerNews
+	var sourceIDs [][]byte
+	for _, hnID := range hnIDs {
+		if _, ok := ctx.processedPosts[hnID]; !ok {
+			sourceIDs = append(sourceIDs, hnPostIDtoDatabaseID(hnID))
+		}
+	}
+	if len(sourceIDs) == 0 {
+		return nil
+	}
+	mappings, err := proc.db.GetObjectIDsFromSourceIDs(source, sourceIDs)
+	if err != nil {
+		return errors.Wrap(err, "Error getting object IDs of HN posts")
+	}
+	var missing []db.SourceIDMapping
+	var missingIDs [][]byte
+	for _, sourceID := range sourceIDs {
+		if _, ok := mappings[string(sourceID)]; !ok {
+			missing = append(missing, db.SourceIDMapping{
+				SourceID: sourceID,
+				ObjectID: proc.snowflake.Generate().Int64(),
+				Pending:  true,
+			})
+			missingIDs = append(missingIDs, sourceID)
+		}
+	}
+	if len(missing) > 0 {
+		if err := proc.db.InsertSourceIDMappings(source, missing); err != nil {
+			return errors.Wrap(err, "Error inserting object IDs of HN posts")
+		}
+		// read back the mappings, some may have been inserted by another worker in between
+		inserted, err := proc.db.GetObjectIDsFromSourceIDs(source, missingIDs)
+		if err != nil {
+			return errors.Wrap(err, "Error getting object IDs of HN posts")
+		}
+		for sourceID, mapping := range inserted {
+			mappings[sourceID] = mapping
+		}
+	}
+	for _, hnID := range hnIDs {
+		if _, ok := ctx.processedPosts[hnID]; ok {
+			continue
+		}
+		mapping, ok := mappings[string(hnPostIDtoDatabaseID(hnID))]
+		if !ok {
+			return errors.Errorf("Object ID mapping of HN id %d was not stored", hnID)
+		}
+		ctx.processedPosts[hnID] = mapping.ObjectID
+		if mapping.Pending && ctx.budget.take() {
+			if err := proc.fetch(hnID); err != nil {
+				return errors.Wrapf(err, "Error requesting HN id %d", hnID)
+			}
+		}
+	}
+	return nil
+}
+
+// enqueueFetch request a HN post without a reply subject. hackernews publishes the post to
+// hacker-news.posts, where it is processed like any other post
+func (proc *PostProcessor) enqueueFetch(hnID int64) error {
+	request := protocol.HnObjectRequest{
+		Id:   hnID,
+		Type: protocol.HnObjectRequest_POST,
+	}
+	payload, err := proto.Marshal(&request)
+	if err != nil {
+		return err
+	}
+	return proc.stan.NatsConn().Publish(subjects.HackerNewsGetObject, payload)
+}
+
+func (proc *PostProcessor) onHackerNewsPost(postData []byte, ctx processingContext) error {
+
+	var p protocol.HnPost
+	if err := proto.Unmarshal(postData, &p); err != nil {
+		return deadletter.Permanent(errors.Wrap(err, "Malformed post"))
+	}
+	// a post is validated before its ID is allocated, so an invalid post does not leave a pending mapping
+	objectType, err := typeToTypeID(protocol.SourceID(p.Source), p.Type)
+	if err != nil {
+		return deadletter.Permanent(errors.Wrapf(err, "Invalid HN id %d\n", p.Id))
+	}
+	url, err := purell.NormalizeURLString(p.Url, purell.FlagLowercaseScheme|purell.FlagLowercaseHost|purell.FlagUppercaseEscapes)
+	if err != nil {
+		return deadletter.Permanent(errors.Wrapf(err, "Invalid url %s of HN id %d\n", p.Url, p.Id))
+	}
+
+	// the mapping of a new post is written as pending before the object, so kids and parents
+	// that refer back to this post get the same ID
+	objectID, pending, err := proc.allocateObjectID(protocol.SourceID(p.Source), hnPostIDtoDatabaseID(p.Id))
+	if err != nil {
+		return errors.Wrapf(err, "Error getting object ID for HN id %d\n", p.Id)
+	}
+	ctx.processedPosts[p.Id] = objectID
+	if p.Type == "title" {
+		log.Infof("Processed post with title %s\n", p.Title)
+	}
+
+	var dbData db.Post
+	if p.Author != "" {
+		userID, err := proc.getUserIDFromHNID(p.Author, ctx)
+		if err != nil {
+			return errors.Wrapf(err, "Error getting author from HN name %s\n", p.Author)
+		}
+		dbData.Author = userID
+	}
+
+	// the parent, parts and kids are resolved in one batch
+	referenced := append(append([]int64(nil), p.Parts...), p.Kids...)
+	if p.Parent != 0 {
+		referenced = append(referenced, p.Parent)
+	}
+	if err := proc.resolvePostIDs(referenced, ctx); err != nil {
+		return errors.Wrapf(err, "Error resolving posts referenced by HN id %d\n", p.Id)
+	}
+
+	dbData.Dead = p.Dead
+	dbData.Parent = ctx.processedPosts[p.Parent]
+	dbData.Url = url
+	dbData.Title = p.Title
+	dbData.Text = p.Text
+	for _, hnPartID := range p.Parts {
+		dbData.Parts = append(dbData.Parts, ctx.processedPosts[hnPartID])
+	}
+
+	var obj db.Object
+	obj.ID = objectID
+	obj.Source = protocol.HackerNews
+	obj.Type = objectType
+	obj.SourceScore = p.Score
+	obj.Deleted = p.Deleted
+	obj.UnixTime = int32(p.Time)
+	obj.Compression = proc.Compression
+	obj.Encoding = proc.Encoding
+	obj.Data = &dbData
+
+	var commentIDs []int64
+	for _, hnCommentID := range p.Kids {
+		commentIDs = append(commentIDs, ctx.processedPosts[hnCommentID])
+	}
+	obj.Kids = db.Kids{Kids: commentIDs}
+	obj.NumKids = int32(len(commentIDs))
+	// the update retries in a new transaction since a transaction keeps reading the version it conflicted with
+	var updated bool
+	for attempt := 1; ; attempt++ {
+		updated, err = proc.writePost(obj, protocol.SourceID(p.Source), hnPostIDtoDatabaseID(p.Id), pending, url)
+		if errors.Cause(err) != db.ErrConflict || attempt == maxUpdateAttempts {
+			break
+		}
+		log.Warnf("Conflict writing object %d for HN id %d, attempt %d", objectID, p.Id, attempt)
+	}
+	if err != nil {
+		return errors.Wrapf(err, "Error writing HN id %d\n", p.Id)
+	}
+	if updated {
+		mod := protocol.ObjectModified{
+			Id: objectID,
+		}
+		payload, err := proto.Marshal(&mod)
+		if err != nil {
+			return err
+		}
+		proc.publishAsync(subjects.ObjectsModified, payload)
+	}
+	return nil
+}
+
+// publishAsync publish data to subject, tracking its ack so Close can wait for it
+func (proc *PostProcessor) publishAsync(subject string, data []byte) {
+	proc.published.Add(1)
+	ackHandler := func(ackedNuid string, err error) {
+		if err != nil {
+			log.Errorf("Error publishing msg id %s to %s: %s", ackedNuid, subject, err)
+		}
+		proc.published.Done()
+	}
+	if _, err := proc.stan.PublishAsync(subject, data, ackHandler); err != nil {
+		log.Errorf("Error publishing to %s: %s", subject, err)
+		proc.published.Done()
+	}
+}
+
+// publishAckTimeout how long Close waits for the acks of published messages
+const publishAckTimeout = 30 * time.Second
+
+// maxUpdateAttempts how many times writing an object is tried when it is concurrently updated
+const maxUpdateAttempts = 5
+
+// writePost insert obj with its url, the parent's kids and its submission row and clear its
+// pending ID mapping in one transaction, or update the stored object if it exists. Returns whether
+// an existing object was updated
+func (proc *PostProcessor) writePost(obj db.Object, source protocol.SourceID, sourceID []byte, pending bool, url string) (updated bool, err error) {
+	err = proc.db.WithTx(func(tx db.SourceStore) error {
+		if pending {
+			if err := tx.ClearPendingSourceID(source, sourceID); err != nil {
+				return errors.Wrap(err, "Error clearing pending object ID mapping")
+			}
+		}
+		err := tx.InsertObject(obj)
+		if err == nil {
+			if url != "" {
+				// the urls row is kept for the first post of a URL
+				if err := tx.InsertURL(url, obj.ID); err != nil && err != db.ErrDuplicate {
+					return errors.Wrap(err, "Error inserting url")
+				}
+			}
+			if parent := obj.Data.(*db.Post).Parent; parent != 0 {
+				if err := addKid(tx, parent, obj.ID); err != nil {
+					return errors.Wrap(err, "Error adding object to the kids of its parent")
+				}
+			}
+			// recorded by author ID, so the submissions of a user that is still pending are kept
+			if author := obj.Data.(*db.Post).Author; author != 0 {
+				if err := tx.InsertSubmission(author, obj.ID, obj.UnixTime); err != nil && err != db.ErrDuplicate {
+					return errors.Wrap(err, "Error inserting submission")
+				}
+			}
+			return nil
+		}
+		// if it's not duplicate key error, bail
+		if err != db.ErrDuplicate {
+			return err
+		}
+		existingObj, version, err := tx.GetObjectVersion(obj.ID)
+		if err != nil {
+			return err
+		}
+		if err := tx.UpdateSourceObject(mergeSourceObject(existingObj, obj), version); err != nil {
+			return err
+		}
+		updated = true
+		return nil
+	})
+	return
+}
+
+// addKid add kidID to the kids of parentID. Parents that are not stored yet are skipped,
+// they get their kids from the content source when they are
+func addKid(tx db.SourceStore, parentID int64, kidID int64) error {
+	parent, version, err := tx.GetObjectVersion(parentID)
+	if err == db.ErrNotFound {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	kids := mergeKids(parent.Kids.Kids, []int64{kidID})
+	if len(kids) == len(parent.Kids.Kids) {
+		return nil
+	}
+	parent.Kids = db.Kids{Kids: kids}
+	parent.NumKids = int32(len(kids))
+	return tx.UpdateSourceObject(parent, version)
+}
+
+const (
+	// DefaultFetchBudget max number of objects a single post fetches
+	DefaultFetchBudget = 50
+	// DefaultMaxInflight max number of unacked posts delivered at once
+	DefaultMaxInflight = 100
+)
+
+// New create a PostProcessor writing to store
+func New(store db.SourceStore, node *snowflake.Node, sc stan.Conn) *PostProcessor {
+	proc := &PostProcessor{
+		db:                store,
+		snowflake:         node,
+		stan:              sc,
+		Compression:       db.None,
+		Encoding:          db.Protobuf,
+		RequestTimeout:    DefaultRequestTimeout,
+		RequestBackoff:    DefaultRequestBackoff,
+		RequestMaxBackoff: DefaultRequestMaxBackoff,
+		FetchBudget:       DefaultFetchBudget,
+		MaxInflight:       DefaultMaxInflight,
+	}
+	proc.fetch = proc.enqueueFetch
+	return proc
+}
+
+// Subscribe start consuming hacker news posts with concurrency workers. Posts are sharded to
+// workers by HN item ID, so updates of one item are not processed concurrently
+func (proc *PostProcessor) Subscribe(durableName string, concurrency int, ackWait time.Duration) (stan.Subscription, error) {
+	if concurrency < 1 {
+		concurrency = 1
+	}
+	maxInflight := proc.MaxInflight
+	if maxInflight < 1 {
+		maxInflight = DefaultMaxInflight
+	}
+	proc.consumer = durableName
+	proc.ackWait = ackWait
+	proc.stop = make(chan struct{})
+	// no more than maxInflight unacked posts are delivered, so a shard queue of that size is
+	// never full and a busy worker does not hold up delivery to the others
+	q := newShardQueue(concurrency, maxInflight, proc.stop)
+	sub, err := proc.stan.Subscribe(subjects.HackerNewsPosts, q.dispatch,
+		stan.SetManualAckMode(), stan.AckWait(ackWait), stan.MaxInflight(maxInflight),
+		stan.DurableName(durableName), stan.StartAt(pb.StartPosition_First))
+	if err != nil {
+		return nil, err
+	}
+	proc.sub = sub
+	q.run(&proc.workers, func(d delivery) {
+		proc.processHnPost(d.msg, d.received)
+	})
+	return sub, nil
+}
+
+// Close stop consuming posts and wait for the workers to finish the posts they are processing, and
+// for the acks of the modifications they published. The subscription is closed rather than unsubscribed, so the durable position is kept
+func (proc *PostProcessor) Close() error {
+	close(proc.stop)
+	err := proc.sub.Close()
+	proc.workers.Wait()
+	// modifications published by the workers are lost if the connection is closed before their acks
+	acked := make(chan struct{})
+	go func() {
+		proc.published.Wait()
+		close(acked)
+	}()
+	select {
+	case <-acked:
+	case <-time.After(publishAckTimeout):
+		log.Errorf("Timed out waiting for the acks of %s", subjects.ObjectsModified)
+	}
+	if err != nil {
+		return errors.Wrapf(err, "Failed to close subscription %s", proc.consumer)
+	}
+	return nil
+}
+
+// delivery a post waiting for its worker
+type delivery struct {
+	msg *stan.Msg
+	// received when the post was delivered, which its AckWait runs from
+	received time.Time
+}
+
+// shardQueue the queues of the workers processing posts, one per worker
+type shardQueue struct {
+	queues []chan delivery
+	stop   chan struct{}
+}
+
+// newShardQueue create the queues of shards workers, each holding up to size posts
+func newShardQueue(shards int, size int, stop chan struct{}) *shardQueue {
+	q := &shardQueue{queues: make([]chan delivery, shards), stop: stop}
+	for i := range q.queues {
+		q.queues[i] = make(chan delivery, size)
+	}
+	return q
+}
+
+// dispatch queue a post for the worker of its HN item
+func (q *shardQueue) dispatch(m *stan.Msg) {
+	d := delivery{msg: m, received: time.Now()}
+	select {
+	case q.queues[shardOf(m.Data, len(q.queues))] <- d:
+	case <-q.stop:
+		// not acked, the post is redelivered after AckWait
+	}
+}
+
+// run start a worker for each queue, calling process for each post until stop is closed.
+// Posts left in the queues are not acked and are redelivered
+func (q *shardQueue) run(workers *sync.WaitGroup, process func(delivery)) {
+	for _, queue := range q.queues {
+		workers.Add(1)
+		go func(c chan delivery) {
+			defer workers.Done()
+			for {
+				select {
+				case d := <-c:
+					process(d)
+				case <-q.stop:
+					return
+				}
+			}
+		}(queue)
+	}
+}
+
+// shardOf the worker for a hacker news post. Malformed posts go to the first worker, which
+// moves them to the dead letter subject
+func shardOf(postData []byte, shards int) int {
+	var p protocol.HnPost
+	if err := proto.Unmarshal(postData, &p); err != nil {
+		return 0
+	}
+	return int(uint64(p.Id) % uint64(shards))
+}
@@ -0,0 +1,260 @@
+package processor
+
+import (
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/bwmarrin/snowflake"
+	"github.com/gogo/protobuf/proto"
+	"github.com/kabergstrom/site/db"
+	"github.com/kabergstrom/site/protocol"
+	"github.com/kabergstrom/site/protocol/deadletter"
+	"github.com/nats-io/go-nats-streaming"
+	"github.com/nats-io/go-nats-streaming/pb"
+)
+
+func postMsg(t *testing.T, post protocol.HnPost) *stan.Msg {
+	data, err := proto.Marshal(&post)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &stan.Msg{MsgProto: pb.MsgProto{Data: data}}
+}
+
+func TestShardOf(t *testing.T) {
+	for id := int64(1); id < 100; id++ {
+		shard := shardOf(postMsg(t, protocol.HnPost{Id: id, Type: "story", Title: "First"}).Data, 7)
+		update := shardOf(postMsg(t, protocol.HnPost{Id: id, Type: "story", Title: "Edited", Score: 10, Kids: []int64{id + 1}}).Data, 7)
+		if shard != update {
+			t.Fatalf("Updates of item %d went to shards %d and %d", id, shard, update)
+		}
+		if shard < 0 || shard >= 7 {
+			t.Fatalf("Item %d went to shard %d of 7", id, shard)
+		}
+	}
+	if shard := shardOf([]byte{0xff}, 7); shard != 0 {
+		t.Errorf("Malformed post went to shard %d", shard)
+	}
+}
+
+func TestShardQueue(t *testing.T) {
+	stop := make(chan struct{})
+	q := newShardQueue(2, 10, stop)
+	busy := make(chan struct{})
+	processed := make(chan int64, 10)
+	var workers sync.WaitGroup
+	q.run(&workers, func(d delivery) {
+		var post protocol.HnPost
+		if err := proto.Unmarshal(d.msg.Data, &post); err != nil {
+			t.Error(err)
+		}
+		if post.Id == 2 {
+			<-busy
+		}
+		processed <- post.Id
+	})
+
+	// item 2 blocks the first worker, the posts queued behind it must not hold up item 1
+	dispatched := make(chan struct{})
+	go func() {
+		for _, id := range []int64{2, 4, 6, 1} {
+			q.dispatch(postMsg(t, protocol.HnPost{Id: id}))
+		}
+		close(dispatched)
+	}()
+	select {
+	case <-dispatched:
+	case <-time.After(time.Second):
+		t.Fatal("Dispatch blocked on a busy worker")
+	}
+	select {
+	case id := <-processed:
+		if id != 1 {
+			t.Errorf("Processed item %d while the first worker was busy", id)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Busy worker stalled the other worker")
+	}
+	close(busy)
+	for _, expected := range []int64{2, 4, 6} {
+		if id := <-processed; id != expected {
+			t.Errorf("Processed item %d, expected %d", id, expected)
+		}
+	}
+	close(stop)
+	workers.Wait()
+}
+
+func newTestProcessor(t *testing.T, store db.SourceStore) *PostProcessor {
+	node, err := snowflake.NewNode(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return New(store, node, nil)
+}
+
+func newTestContext(budget int) processingContext {
+	return processingContext{
+		processedUsers: make(map[string]int64),
+		processedPosts: make(map[int64]int64),
+		deadline:       time.Now().Add(time.Second),
+		budget:         &fetchBudget{remaining: budget},
+	}
+}
+
+func TestPendingAuthorSubmissions(t *testing.T) {
+	store := db.NewMemoryStore()
+	proc := newTestProcessor(t, store)
+	process := func(post protocol.HnPost) int64 {
+		data, err := proto.Marshal(&post)
+		if err != nil {
+			t.Fatal(err)
+		}
+		// no budget, so the author is left pending instead of being fetched
+		if err := proc.onHackerNewsPost(data, newTestContext(0)); err != nil {
+			t.Fatal(err)
+		}
+		id, err := store.GetObjectIDFromSourceID(protocol.HackerNews, hnPostIDtoDatabaseID(post.Id))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return id
+	}
+	first := process(protocol.HnPost{Id: 1, Type: "story", Author: "alice", Time: 1500000000, Title: "First", Source: int32(protocol.HackerNews)})
+
+	authorID, pending, err := store.GetSourceIDMapping(protocol.HackerNews, hnUserIDtoDatabaseID("alice"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !pending {
+		t.Fatal("Author beyond the fetch budget is not pending")
+	}
+	if _, err := store.GetObject(authorID); err != db.ErrNotFound {
+		t.Fatalf("Pending author was stored: %v", err)
+	}
+	author, err := hnUserToDBObject(protocol.HnUser{Id: "alice"}, authorID, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := store.InsertObject(author); err != nil {
+		t.Fatal(err)
+	}
+	second := process(protocol.HnPost{Id: 2, Type: "comment", Author: "alice", Time: 1500000001, Parent: 1, Text: "Reply", Source: int32(protocol.HackerNews)})
+
+	submissions, err := store.GetSubmissions(authorID, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(submissions, []int64{second, first}) {
+		t.Errorf("Submissions %v, expected %v", submissions, []int64{second, first})
+	}
+	if _, version, err := store.GetObjectVersion(authorID); err != nil || version != 0 {
+		t.Errorf("Author was rewritten by a post, version %d: %v", version, err)
+	}
+}
+
+func TestInvalidPostNotAllocated(t *testing.T) {
+	store := db.NewMemoryStore()
+	proc := newTestProcessor(t, store)
+	for _, post := range []protocol.HnPost{
+		{Id: 1, Type: "unknown", Time: 1500000000, Source: int32(protocol.HackerNews)},
+		{Id: 2, Type: "story", Time: 1500000000, Url: "http://[::1", Source: int32(protocol.HackerNews)},
+	} {
+		data, err := proto.Marshal(&post)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := proc.onHackerNewsPost(data, newTestContext(0)); !deadletter.IsPermanent(err) {
+			t.Errorf("Invalid HN id %d returned %v", post.Id, err)
+		}
+		if _, _, err := store.GetSourceIDMapping(protocol.HackerNews, hnPostIDtoDatabaseID(post.Id)); err != db.ErrNotFound {
+			t.Errorf("Invalid HN id %d was allocated an ID: %v", post.Id, err)
+		}
+	}
+}
+
+// fetchRecorder replaces the fetches of proc, returning the HN ids it queued
+func fetchRecorder(proc *PostProcessor) *[]int64 {
+	var fetched []int64
+	proc.fetch = func(hnID int64) error {
+		fetched = append(fetched, hnID)
+		return nil
+	}
+	return &fetched
+}
+
+func TestResolvePostIDs(t *testing.T) {
+	store := db.NewMemoryStore()
+	proc := newTestProcessor(t, store)
+	fetched := fetchRecorder(proc)
+	if err := store.InsertPendingSourceIDToObjectID(100, protocol.HackerNews, hnPostIDtoDatabaseID(10)); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.ClearPendingSourceID(protocol.HackerNews, hnPostIDtoDatabaseID(10)); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := newTestContext(10)
+	if err := proc.resolvePostIDs([]int64{10, 11, 12, 1}, ctx); err != nil {
+		t.Fatal(err)
+	}
+	if ctx.processedPosts[10] != 100 {
+		t.Errorf("Stored post resolved to %d, expected 100", ctx.processedPosts[10])
+	}
+	// missing posts get their IDs eagerly and are queued, not requested and processed, so nothing
+	// they refer to is resolved. The processor has no NATS connection, so a request would panic
+	for _, hnID := range []int64{11, 12, 1} {
+		objID, pending, err := store.GetSourceIDMapping(protocol.HackerNews, hnPostIDtoDatabaseID(hnID))
+		if err != nil || !pending || objID != ctx.processedPosts[hnID] {
+			t.Errorf("HN id %d resolved to %d, mapped to %d pending %t: %v", hnID, ctx.processedPosts[hnID], objID, pending, err)
+		}
+		if _, err := store.GetObject(objID); err != db.ErrNotFound {
+			t.Errorf("HN id %d was stored: %v", hnID, err)
+		}
+	}
+	if !reflect.DeepEqual(*fetched, []int64{11, 12, 1}) {
+		t.Errorf("Fetched %v, expected the missing posts %v", *fetched, []int64{11, 12, 1})
+	}
+	if len(ctx.processedPosts) != 4 {
+		t.Errorf("Resolved %v, expected only the referenced posts", ctx.processedPosts)
+	}
+}
+
+func TestResolvePostIDsBudget(t *testing.T) {
+	store := db.NewMemoryStore()
+	proc := newTestProcessor(t, store)
+	fetched := fetchRecorder(proc)
+
+	ctx := newTestContext(1)
+	if err := proc.resolvePostIDs([]int64{11, 12, 13}, ctx); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(*fetched, []int64{11}) || ctx.budget.skipped != 2 {
+		t.Errorf("Fetched %v and skipped %d with a budget of 1", *fetched, ctx.budget.skipped)
+	}
+	ids := make(map[int64]int64)
+	for _, hnID := range []int64{11, 12, 13} {
+		objID, pending, err := store.GetSourceIDMapping(protocol.HackerNews, hnPostIDtoDatabaseID(hnID))
+		if err != nil || !pending {
+			t.Errorf("HN id %d is not pending: %v", hnID, err)
+		}
+		ids[hnID] = objID
+	}
+
+	// posts beyond the budget stay pending with the same ID, and are fetched when referenced again
+	*fetched = nil
+	ctx = newTestContext(10)
+	if err := proc.resolvePostIDs([]int64{12, 13}, ctx); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(*fetched, []int64{12, 13}) {
+		t.Errorf("Fetched %v when referenced again", *fetched)
+	}
+	for _, hnID := range []int64{12, 13} {
+		if ctx.processedPosts[hnID] != ids[hnID] {
+			t.Errorf("HN id %d resolved to %d, then %d", hnID, ids[hnID], ctx.processedPosts[hnID])
+		}
+	}
+}
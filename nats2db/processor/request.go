@@ -0,0 +1,62 @@
+package processor
+
+import (
+	"math/rand"
+	"time"
+
+	"github.com/gogo/protobuf/proto"
+	"github.com/kabergstrom/site/monitor"
+	"github.com/kabergstrom/site/protocol"
+	"github.com/kabergstrom/site/protocol/subjects"
+	nats "github.com/nats-io/go-nats"
+	"github.com/ngaut/log"
+	"github.com/pkg/errors"
+)
+
+const (
+	// DefaultRequestTimeout max time a single hacker-news.get-object request waits for a reply
+	DefaultRequestTimeout = 10 * time.Second
+	// DefaultRequestBackoff initial wait before a timed out request is retried
+	DefaultRequestBackoff = 200 * time.Millisecond
+	// DefaultRequestMaxBackoff max wait between request retries
+	DefaultRequestMaxBackoff = 5 * time.Second
+)
+
+// request send a hacker-news.get-object request. Timeouts are retried with exponential backoff
+// and full jitter until deadline, after which the message would be redelivered anyway
+func (proc *PostProcessor) request(request *protocol.HnObjectRequest, deadline time.Time) (*nats.Msg, error) {
+	payload, err := proto.Marshal(request)
+	if err != nil {
+		return nil, err
+	}
+	backoff := proc.RequestBackoff
+	for attempt := 1; ; attempt++ {
+		timeout := proc.RequestTimeout
+		if remaining := time.Until(deadline); remaining < timeout {
+			timeout = remaining
+		}
+		if timeout <= 0 {
+			return nil, errors.Errorf("Deadline passed after %d attempts", attempt-1)
+		}
+		requestStart := time.Now()
+		msg, err := proc.stan.NatsConn().Request(subjects.HackerNewsGetObject, payload, timeout)
+		if err == nil {
+			log.Infof("Request for %s took %s\n", request.String(), time.Now().Sub(requestStart).String())
+			return msg, nil
+		}
+		if err != nats.ErrTimeout {
+			return nil, err
+		}
+		monitor.NATSRequestTimeout(subjects.HackerNewsGetObject)
+		wait := time.Duration(rand.Int63n(int64(backoff) + 1))
+		if time.Until(deadline) <= wait {
+			return nil, errors.Wrapf(err, "Deadline passed after %d attempts", attempt)
+		}
+		log.Warnf("Request for %s timed out after %s, retrying in %s", request.String(), timeout, wait)
+		time.Sleep(wait)
+		backoff *= 2
+		if backoff > proc.RequestMaxBackoff {
+			backoff = proc.RequestMaxBackoff
+		}
+	}
+}
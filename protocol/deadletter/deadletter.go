@@ -0,0 +1,79 @@
+// Package deadletter moves messages that can never be processed out of the way of their
+// consumer. A dead letter keeps the original message and the error it failed with, so it
+// can be inspected and replayed once the consumer is fixed
+package deadletter
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/gogo/protobuf/proto"
+	"github.com/kabergstrom/site/protocol"
+	"github.com/kabergstrom/site/protocol/subjects"
+	nats "github.com/nats-io/go-nats"
+	"github.com/nats-io/go-nats-streaming"
+	"github.com/pkg/errors"
+)
+
+// Subject the NATS Streaming subject for the dead letters of consumer
+func Subject(consumer string) string {
+	return subjects.DeadLetterPrefix + consumer
+}
+
+type permanentError struct {
+	err error
+}
+
+func (e permanentError) Error() string {
+	return e.err.Error()
+}
+
+// Permanent mark err as a failure that processing the message again can not fix
+func Permanent(err error) error {
+	return permanentError{err}
+}
+
+// Permanentf create a permanent error
+func Permanentf(format string, args ...interface{}) error {
+	return permanentError{fmt.Errorf(format, args...)}
+}
+
+// IsPermanent whether err, or the error it wraps, was created with Permanent
+func IsPermanent(err error) bool {
+	_, ok := errors.Cause(err).(permanentError)
+	return ok
+}
+
+// FromStan the dead letter for a NATS Streaming message
+func FromStan(consumer string, m *stan.Msg, reason error) protocol.DeadLetter {
+	return protocol.DeadLetter{
+		Subject:   m.Subject,
+		Consumer:  consumer,
+		Sequence:  m.Sequence,
+		Timestamp: m.Timestamp,
+		Data:      m.Data,
+		Error:     reason.Error(),
+		FailedAt:  time.Now().Unix(),
+	}
+}
+
+// FromNats the dead letter for a core NATS message. It has no sequence
+func FromNats(consumer string, m *nats.Msg, reason error) protocol.DeadLetter {
+	return protocol.DeadLetter{
+		Subject:  m.Subject,
+		Consumer: consumer,
+		Data:     m.Data,
+		Error:    reason.Error(),
+		FailedAt: time.Now().Unix(),
+	}
+}
+
+// Publish store letter in the dead letter subject of its consumer. It returns once NATS Streaming
+// acknowledged the letter, so the original message can be acked after a nil return
+func Publish(sc stan.Conn, letter protocol.DeadLetter) error {
+	payload, err := proto.Marshal(&letter)
+	if err != nil {
+		return err
+	}
+	return errors.Wrapf(sc.Publish(Subject(letter.Consumer), payload), "Error publishing dead letter for %s", letter.Consumer)
+}
@@ -13,6 +13,9 @@
 		HnPost
 		HnUser
 		ObjectModified
+		DeadLetter
+		RateLimitUsage
+		RateLimitTaken
 */
 package protocol
 
@@ -304,11 +307,126 @@ func (m *ObjectModified) GetMysqlPos() uint32 {
 	return 0
 }
 
+type DeadLetter struct {
+	Subject   string `protobuf:"bytes,1,opt,name=subject,proto3" json:"subject,omitempty"`
+	Consumer  string `protobuf:"bytes,2,opt,name=consumer,proto3" json:"consumer,omitempty"`
+	Sequence  uint64 `protobuf:"varint,3,opt,name=sequence,proto3" json:"sequence,omitempty"`
+	Timestamp int64  `protobuf:"varint,4,opt,name=timestamp,proto3" json:"timestamp,omitempty"`
+	Data      []byte `protobuf:"bytes,5,opt,name=data,proto3" json:"data,omitempty"`
+	Error     string `protobuf:"bytes,6,opt,name=error,proto3" json:"error,omitempty"`
+	FailedAt  int64  `protobuf:"varint,7,opt,name=failed_at,json=failedAt,proto3" json:"failed_at,omitempty"`
+}
+
+func (m *DeadLetter) Reset()                    { *m = DeadLetter{} }
+func (m *DeadLetter) String() string            { return proto.CompactTextString(m) }
+func (*DeadLetter) ProtoMessage()               {}
+func (*DeadLetter) Descriptor() ([]byte, []int) { return fileDescriptorNatsMsg, []int{4} }
+
+func (m *DeadLetter) GetSubject() string {
+	if m != nil {
+		return m.Subject
+	}
+	return ""
+}
+
+func (m *DeadLetter) GetConsumer() string {
+	if m != nil {
+		return m.Consumer
+	}
+	return ""
+}
+
+func (m *DeadLetter) GetSequence() uint64 {
+	if m != nil {
+		return m.Sequence
+	}
+	return 0
+}
+
+func (m *DeadLetter) GetTimestamp() int64 {
+	if m != nil {
+		return m.Timestamp
+	}
+	return 0
+}
+
+func (m *DeadLetter) GetData() []byte {
+	if m != nil {
+		return m.Data
+	}
+	return nil
+}
+
+func (m *DeadLetter) GetError() string {
+	if m != nil {
+		return m.Error
+	}
+	return ""
+}
+
+func (m *DeadLetter) GetFailedAt() int64 {
+	if m != nil {
+		return m.FailedAt
+	}
+	return 0
+}
+
+type RateLimitUsage struct {
+	Instance string            `protobuf:"bytes,1,opt,name=instance,proto3" json:"instance,omitempty"`
+	Taken    []*RateLimitTaken `protobuf:"bytes,2,rep,name=taken" json:"taken,omitempty"`
+}
+
+func (m *RateLimitUsage) Reset()                    { *m = RateLimitUsage{} }
+func (m *RateLimitUsage) String() string            { return proto.CompactTextString(m) }
+func (*RateLimitUsage) ProtoMessage()               {}
+func (*RateLimitUsage) Descriptor() ([]byte, []int) { return fileDescriptorNatsMsg, []int{5} }
+
+func (m *RateLimitUsage) GetInstance() string {
+	if m != nil {
+		return m.Instance
+	}
+	return ""
+}
+
+func (m *RateLimitUsage) GetTaken() []*RateLimitTaken {
+	if m != nil {
+		return m.Taken
+	}
+	return nil
+}
+
+type RateLimitTaken struct {
+	Bucket string  `protobuf:"bytes,1,opt,name=bucket,proto3" json:"bucket,omitempty"`
+	Tokens float64 `protobuf:"fixed64,2,opt,name=tokens,proto3" json:"tokens,omitempty"`
+}
+
+func (m *RateLimitTaken) Reset()                    { *m = RateLimitTaken{} }
+func (m *RateLimitTaken) String() string            { return proto.CompactTextString(m) }
+func (*RateLimitTaken) ProtoMessage()               {}
+func (*RateLimitTaken) Descriptor() ([]byte, []int) { return fileDescriptorNatsMsg, []int{6} }
+
+func (m *RateLimitTaken) GetBucket() string {
+	if m != nil {
+		return m.Bucket
+	}
+	return ""
+}
+
+func (m *RateLimitTaken) GetTokens() float64 {
+	if m != nil {
+		return m.Tokens
+	}
+	return 0
+}
+
 func init() {
 	proto.RegisterType((*HnObjectRequest)(nil), "protocol.hn_object_request")
 	proto.RegisterType((*HnPost)(nil), "protocol.hn_post")
 	proto.RegisterType((*HnUser)(nil), "protocol.hn_user")
 	proto.RegisterType((*ObjectModified)(nil), "protocol.object_modified")
+	proto.RegisterType((*DeadLetter)(nil), "protocol.dead_letter")
+	proto.RegisterType((*RateLimitUsage)(nil), "protocol.rate_limit_usage")
+	proto.RegisterType((*RateLimitTaken)(nil), "protocol.rate_limit_taken")
 	proto.RegisterEnum("protocol.HnObjectRequestObjectType", HnObjectRequestObjectType_name, HnObjectRequestObjectType_value)
 }
 func (m *HnObjectRequest) Marshal() (dAtA []byte, err error) {
@@ -576,6 +694,128 @@ func (m *ObjectModified) MarshalTo(dAtA []byte) (int, error) {
 	return i, nil
 }
 
+func (m *DeadLetter) Marshal() (dAtA []byte, err error) {
+	size := m.Size()
+	dAtA = make([]byte, size)
+	n, err := m.MarshalTo(dAtA)
+	if err != nil {
+		return nil, err
+	}
+	return dAtA[:n], nil
+}
+
+func (m *DeadLetter) MarshalTo(dAtA []byte) (int, error) {
+	var i int
+	_ = i
+	var l int
+	_ = l
+	if len(m.Subject) > 0 {
+		dAtA[i] = 0xa
+		i++
+		i = encodeVarintNatsMsg(dAtA, i, uint64(len(m.Subject)))
+		i += copy(dAtA[i:], m.Subject)
+	}
+	if len(m.Consumer) > 0 {
+		dAtA[i] = 0x12
+		i++
+		i = encodeVarintNatsMsg(dAtA, i, uint64(len(m.Consumer)))
+		i += copy(dAtA[i:], m.Consumer)
+	}
+	if m.Sequence != 0 {
+		dAtA[i] = 0x18
+		i++
+		i = encodeVarintNatsMsg(dAtA, i, uint64(m.Sequence))
+	}
+	if m.Timestamp != 0 {
+		dAtA[i] = 0x20
+		i++
+		i = encodeVarintNatsMsg(dAtA, i, uint64(m.Timestamp))
+	}
+	if len(m.Data) > 0 {
+		dAtA[i] = 0x2a
+		i++
+		i = encodeVarintNatsMsg(dAtA, i, uint64(len(m.Data)))
+		i += copy(dAtA[i:], m.Data)
+	}
+	if len(m.Error) > 0 {
+		dAtA[i] = 0x32
+		i++
+		i = encodeVarintNatsMsg(dAtA, i, uint64(len(m.Error)))
+		i += copy(dAtA[i:], m.Error)
+	}
+	if m.FailedAt != 0 {
+		dAtA[i] = 0x38
+		i++
+		i = encodeVarintNatsMsg(dAtA, i, uint64(m.FailedAt))
+	}
+	return i, nil
+}
+
+func (m *RateLimitUsage) Marshal() (dAtA []byte, err error) {
+	size := m.Size()
+	dAtA = make([]byte, size)
+	n, err := m.MarshalTo(dAtA)
+	if err != nil {
+		return nil, err
+	}
+	return dAtA[:n], nil
+}
+
+func (m *RateLimitUsage) MarshalTo(dAtA []byte) (int, error) {
+	var i int
+	_ = i
+	var l int
+	_ = l
+	if len(m.Instance) > 0 {
+		dAtA[i] = 0xa
+		i++
+		i = encodeVarintNatsMsg(dAtA, i, uint64(len(m.Instance)))
+		i += copy(dAtA[i:], m.Instance)
+	}
+	if len(m.Taken) > 0 {
+		for _, msg := range m.Taken {
+			dAtA[i] = 0x12
+			i++
+			i = encodeVarintNatsMsg(dAtA, i, uint64(msg.Size()))
+			n, err := msg.MarshalTo(dAtA[i:])
+			if err != nil {
+				return 0, err
+			}
+			i += n
+		}
+	}
+	return i, nil
+}
+
+func (m *RateLimitTaken) Marshal() (dAtA []byte, err error) {
+	size := m.Size()
+	dAtA = make([]byte, size)
+	n, err := m.MarshalTo(dAtA)
+	if err != nil {
+		return nil, err
+	}
+	return dAtA[:n], nil
+}
+
+func (m *RateLimitTaken) MarshalTo(dAtA []byte) (int, error) {
+	var i int
+	_ = i
+	var l int
+	_ = l
+	if len(m.Bucket) > 0 {
+		dAtA[i] = 0xa
+		i++
+		i = encodeVarintNatsMsg(dAtA, i, uint64(len(m.Bucket)))
+		i += copy(dAtA[i:], m.Bucket)
+	}
+	if m.Tokens != 0 {
+		dAtA[i] = 0x11
+		i++
+		i = encodeFixed64NatsMsg(dAtA, i, uint64(math.Float64bits(float64(m.Tokens))))
+	}
+	return i, nil
+}
+
 func encodeFixed64NatsMsg(dAtA []byte, offset int, v uint64) int {
 	dAtA[offset] = uint8(v)
 	dAtA[offset+1] = uint8(v >> 8)
@@ -729,6 +969,66 @@ func (m *ObjectModified) Size() (n int) {
 	return n
 }
 
+func (m *DeadLetter) Size() (n int) {
+	var l int
+	_ = l
+	l = len(m.Subject)
+	if l > 0 {
+		n += 1 + l + sovNatsMsg(uint64(l))
+	}
+	l = len(m.Consumer)
+	if l > 0 {
+		n += 1 + l + sovNatsMsg(uint64(l))
+	}
+	if m.Sequence != 0 {
+		n += 1 + sovNatsMsg(uint64(m.Sequence))
+	}
+	if m.Timestamp != 0 {
+		n += 1 + sovNatsMsg(uint64(m.Timestamp))
+	}
+	l = len(m.Data)
+	if l > 0 {
+		n += 1 + l + sovNatsMsg(uint64(l))
+	}
+	l = len(m.Error)
+	if l > 0 {
+		n += 1 + l + sovNatsMsg(uint64(l))
+	}
+	if m.FailedAt != 0 {
+		n += 1 + sovNatsMsg(uint64(m.FailedAt))
+	}
+	return n
+}
+
+func (m *RateLimitUsage) Size() (n int) {
+	var l int
+	_ = l
+	l = len(m.Instance)
+	if l > 0 {
+		n += 1 + l + sovNatsMsg(uint64(l))
+	}
+	if len(m.Taken) > 0 {
+		for _, e := range m.Taken {
+			l = e.Size()
+			n += 1 + l + sovNatsMsg(uint64(l))
+		}
+	}
+	return n
+}
+
+func (m *RateLimitTaken) Size() (n int) {
+	var l int
+	_ = l
+	l = len(m.Bucket)
+	if l > 0 {
+		n += 1 + l + sovNatsMsg(uint64(l))
+	}
+	if m.Tokens != 0 {
+		n += 9
+	}
+	return n
+}
+
 func sovNatsMsg(x uint64) (n int) {
 	for {
 		n++
@@ -1676,6 +1976,438 @@ func (m *ObjectModified) Unmarshal(dAtA []byte) error {
 	}
 	return nil
 }
+func (m *DeadLetter) Unmarshal(dAtA []byte) error {
+	l := len(dAtA)
+	iNdEx := 0
+	for iNdEx < l {
+		preIndex := iNdEx
+		var wire uint64
+		for shift := uint(0); ; shift += 7 {
+			if shift >= 64 {
+				return ErrIntOverflowNatsMsg
+			}
+			if iNdEx >= l {
+				return io.ErrUnexpectedEOF
+			}
+			b := dAtA[iNdEx]
+			iNdEx++
+			wire |= (uint64(b) & 0x7F) << shift
+			if b < 0x80 {
+				break
+			}
+		}
+		fieldNum := int32(wire >> 3)
+		wireType := int(wire & 0x7)
+		if wireType == 4 {
+			return fmt.Errorf("proto: dead_letter: wiretype end group for non-group")
+		}
+		if fieldNum <= 0 {
+			return fmt.Errorf("proto: dead_letter: illegal tag %d (wire type %d)", fieldNum, wire)
+		}
+		switch fieldNum {
+		case 1:
+			if wireType != 2 {
+				return fmt.Errorf("proto: wrong wireType = %d for field Subject", wireType)
+			}
+			var stringLen uint64
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowNatsMsg
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				stringLen |= (uint64(b) & 0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+			intStringLen := int(stringLen)
+			if intStringLen < 0 {
+				return ErrInvalidLengthNatsMsg
+			}
+			postIndex := iNdEx + intStringLen
+			if postIndex > l {
+				return io.ErrUnexpectedEOF
+			}
+			m.Subject = string(dAtA[iNdEx:postIndex])
+			iNdEx = postIndex
+		case 2:
+			if wireType != 2 {
+				return fmt.Errorf("proto: wrong wireType = %d for field Consumer", wireType)
+			}
+			var stringLen uint64
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowNatsMsg
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				stringLen |= (uint64(b) & 0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+			intStringLen := int(stringLen)
+			if intStringLen < 0 {
+				return ErrInvalidLengthNatsMsg
+			}
+			postIndex := iNdEx + intStringLen
+			if postIndex > l {
+				return io.ErrUnexpectedEOF
+			}
+			m.Consumer = string(dAtA[iNdEx:postIndex])
+			iNdEx = postIndex
+		case 3:
+			if wireType != 0 {
+				return fmt.Errorf("proto: wrong wireType = %d for field Sequence", wireType)
+			}
+			m.Sequence = 0
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowNatsMsg
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				m.Sequence |= (uint64(b) & 0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+		case 4:
+			if wireType != 0 {
+				return fmt.Errorf("proto: wrong wireType = %d for field Timestamp", wireType)
+			}
+			m.Timestamp = 0
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowNatsMsg
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				m.Timestamp |= (int64(b) & 0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+		case 5:
+			if wireType != 2 {
+				return fmt.Errorf("proto: wrong wireType = %d for field Data", wireType)
+			}
+			var byteLen int
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowNatsMsg
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				byteLen |= (int(b) & 0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+			if byteLen < 0 {
+				return ErrInvalidLengthNatsMsg
+			}
+			postIndex := iNdEx + byteLen
+			if postIndex > l {
+				return io.ErrUnexpectedEOF
+			}
+			m.Data = append(m.Data[:0], dAtA[iNdEx:postIndex]...)
+			if m.Data == nil {
+				m.Data = []byte{}
+			}
+			iNdEx = postIndex
+		case 6:
+			if wireType != 2 {
+				return fmt.Errorf("proto: wrong wireType = %d for field Error", wireType)
+			}
+			var stringLen uint64
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowNatsMsg
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				stringLen |= (uint64(b) & 0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+			intStringLen := int(stringLen)
+			if intStringLen < 0 {
+				return ErrInvalidLengthNatsMsg
+			}
+			postIndex := iNdEx + intStringLen
+			if postIndex > l {
+				return io.ErrUnexpectedEOF
+			}
+			m.Error = string(dAtA[iNdEx:postIndex])
+			iNdEx = postIndex
+		case 7:
+			if wireType != 0 {
+				return fmt.Errorf("proto: wrong wireType = %d for field FailedAt", wireType)
+			}
+			m.FailedAt = 0
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowNatsMsg
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				m.FailedAt |= (int64(b) & 0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+		default:
+			iNdEx = preIndex
+			skippy, err := skipNatsMsg(dAtA[iNdEx:])
+			if err != nil {
+				return err
+			}
+			if skippy < 0 {
+				return ErrInvalidLengthNatsMsg
+			}
+			if (iNdEx + skippy) > l {
+				return io.ErrUnexpectedEOF
+			}
+			iNdEx += skippy
+		}
+	}
+
+	if iNdEx > l {
+		return io.ErrUnexpectedEOF
+	}
+	return nil
+}
+func (m *RateLimitUsage) Unmarshal(dAtA []byte) error {
+	l := len(dAtA)
+	iNdEx := 0
+	for iNdEx < l {
+		preIndex := iNdEx
+		var wire uint64
+		for shift := uint(0); ; shift += 7 {
+			if shift >= 64 {
+				return ErrIntOverflowNatsMsg
+			}
+			if iNdEx >= l {
+				return io.ErrUnexpectedEOF
+			}
+			b := dAtA[iNdEx]
+			iNdEx++
+			wire |= (uint64(b) & 0x7F) << shift
+			if b < 0x80 {
+				break
+			}
+		}
+		fieldNum := int32(wire >> 3)
+		wireType := int(wire & 0x7)
+		if wireType == 4 {
+			return fmt.Errorf("proto: rate_limit_usage: wiretype end group for non-group")
+		}
+		if fieldNum <= 0 {
+			return fmt.Errorf("proto: rate_limit_usage: illegal tag %d (wire type %d)", fieldNum, wire)
+		}
+		switch fieldNum {
+		case 1:
+			if wireType != 2 {
+				return fmt.Errorf("proto: wrong wireType = %d for field Instance", wireType)
+			}
+			var stringLen uint64
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowNatsMsg
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				stringLen |= (uint64(b) & 0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+			intStringLen := int(stringLen)
+			if intStringLen < 0 {
+				return ErrInvalidLengthNatsMsg
+			}
+			postIndex := iNdEx + intStringLen
+			if postIndex > l {
+				return io.ErrUnexpectedEOF
+			}
+			m.Instance = string(dAtA[iNdEx:postIndex])
+			iNdEx = postIndex
+		case 2:
+			if wireType != 2 {
+				return fmt.Errorf("proto: wrong wireType = %d for field Taken", wireType)
+			}
+			var msglen int
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowNatsMsg
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				msglen |= (int(b) & 0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+			if msglen < 0 {
+				return ErrInvalidLengthNatsMsg
+			}
+			postIndex := iNdEx + msglen
+			if postIndex > l {
+				return io.ErrUnexpectedEOF
+			}
+			m.Taken = append(m.Taken, &RateLimitTaken{})
+			if err := m.Taken[len(m.Taken)-1].Unmarshal(dAtA[iNdEx:postIndex]); err != nil {
+				return err
+			}
+			iNdEx = postIndex
+		default:
+			iNdEx = preIndex
+			skippy, err := skipNatsMsg(dAtA[iNdEx:])
+			if err != nil {
+				return err
+			}
+			if skippy < 0 {
+				return ErrInvalidLengthNatsMsg
+			}
+			if (iNdEx + skippy) > l {
+				return io.ErrUnexpectedEOF
+			}
+			iNdEx += skippy
+		}
+	}
+
+	if iNdEx > l {
+		return io.ErrUnexpectedEOF
+	}
+	return nil
+}
+func (m *RateLimitTaken) Unmarshal(dAtA []byte) error {
+	l := len(dAtA)
+	iNdEx := 0
+	for iNdEx < l {
+		preIndex := iNdEx
+		var wire uint64
+		for shift := uint(0); ; shift += 7 {
+			if shift >= 64 {
+				return ErrIntOverflowNatsMsg
+			}
+			if iNdEx >= l {
+				return io.ErrUnexpectedEOF
+			}
+			b := dAtA[iNdEx]
+			iNdEx++
+			wire |= (uint64(b) & 0x7F) << shift
+			if b < 0x80 {
+				break
+			}
+		}
+		fieldNum := int32(wire >> 3)
+		wireType := int(wire & 0x7)
+		if wireType == 4 {
+			return fmt.Errorf("proto: rate_limit_taken: wiretype end group for non-group")
+		}
+		if fieldNum <= 0 {
+			return fmt.Errorf("proto: rate_limit_taken: illegal tag %d (wire type %d)", fieldNum, wire)
+		}
+		switch fieldNum {
+		case 1:
+			if wireType != 2 {
+				return fmt.Errorf("proto: wrong wireType = %d for field Bucket", wireType)
+			}
+			var stringLen uint64
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowNatsMsg
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				stringLen |= (uint64(b) & 0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+			intStringLen := int(stringLen)
+			if intStringLen < 0 {
+				return ErrInvalidLengthNatsMsg
+			}
+			postIndex := iNdEx + intStringLen
+			if postIndex > l {
+				return io.ErrUnexpectedEOF
+			}
+			m.Bucket = string(dAtA[iNdEx:postIndex])
+			iNdEx = postIndex
+		case 2:
+			if wireType != 1 {
+				return fmt.Errorf("proto: wrong wireType = %d for field Tokens", wireType)
+			}
+			var v uint64
+			if (iNdEx + 8) > l {
+				return io.ErrUnexpectedEOF
+			}
+			iNdEx += 8
+			v = uint64(dAtA[iNdEx-8])
+			v |= uint64(dAtA[iNdEx-7]) << 8
+			v |= uint64(dAtA[iNdEx-6]) << 16
+			v |= uint64(dAtA[iNdEx-5]) << 24
+			v |= uint64(dAtA[iNdEx-4]) << 32
+			v |= uint64(dAtA[iNdEx-3]) << 40
+			v |= uint64(dAtA[iNdEx-2]) << 48
+			v |= uint64(dAtA[iNdEx-1]) << 56
+			m.Tokens = float64(math.Float64frombits(v))
+		default:
+			iNdEx = preIndex
+			skippy, err := skipNatsMsg(dAtA[iNdEx:])
+			if err != nil {
+				return err
+			}
+			if skippy < 0 {
+				return ErrInvalidLengthNatsMsg
+			}
+			if (iNdEx + skippy) > l {
+				return io.ErrUnexpectedEOF
+			}
+			iNdEx += skippy
+		}
+	}
+
+	if iNdEx > l {
+		return io.ErrUnexpectedEOF
+	}
+	return nil
+}
 func skipNatsMsg(dAtA []byte) (n int, err error) {
 	l := len(dAtA)
 	iNdEx := 0
@@ -1784,35 +2516,45 @@ var (
 func init() { proto.RegisterFile("nats_msg.proto", fileDescriptorNatsMsg) }
 
 var fileDescriptorNatsMsg = []byte{
-	// 477 bytes of a gzipped FileDescriptorProto
-	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0x6c, 0x92, 0xbf, 0x8e, 0x13, 0x31,
-	0x10, 0xc6, 0xcf, 0xd9, 0xfc, 0xd9, 0x9d, 0x70, 0xb9, 0x60, 0x9d, 0x90, 0xc5, 0x9f, 0x68, 0x49,
-	0x43, 0xaa, 0x14, 0x50, 0xd2, 0x21, 0x41, 0xcb, 0xc9, 0x07, 0x25, 0x8a, 0x9c, 0xf5, 0x1c, 0x31,
-	0xb7, 0xbb, 0xce, 0xd9, 0x5e, 0xe9, 0xf2, 0x1c, 0x34, 0x74, 0xbc, 0x0e, 0x25, 0x0d, 0x3d, 0x0a,
-	0x2f, 0x82, 0x3c, 0xbb, 0x81, 0x48, 0x77, 0xd5, 0xce, 0xef, 0x93, 0x3d, 0xf3, 0xf9, 0xdb, 0x81,
-	0x49, 0xad, 0x82, 0x5f, 0x55, 0xfe, 0xf3, 0x72, 0xeb, 0x6c, 0xb0, 0x3c, 0xa5, 0x4f, 0x61, 0xcb,
-	0xf9, 0x77, 0x06, 0x0f, 0x37, 0xf5, 0xca, 0xae, 0xbf, 0x60, 0x11, 0x56, 0x0e, 0x6f, 0x1a, 0xf4,
-	0x81, 0x4f, 0xa0, 0x67, 0xb4, 0x60, 0x39, 0x5b, 0x24, 0xb2, 0x67, 0x34, 0x7f, 0x0c, 0x69, 0xe3,
-	0xd1, 0xd5, 0xaa, 0x42, 0xd1, 0xcb, 0xd9, 0x22, 0x93, 0xff, 0x98, 0xbf, 0x86, 0x7e, 0xd8, 0x6d,
-	0x51, 0x24, 0x39, 0x5b, 0x4c, 0x5e, 0xbe, 0x58, 0x1e, 0x5a, 0x2f, 0xef, 0xb4, 0x5d, 0x76, 0x18,
-	0x8f, 0x4b, 0xba, 0x34, 0x7f, 0x0e, 0xe3, 0x23, 0x91, 0xa7, 0xd0, 0xbf, 0x78, 0x7f, 0xf9, 0x61,
-	0x7a, 0x12, 0xab, 0x8f, 0x97, 0x6f, 0xe5, 0x94, 0xcd, 0x7f, 0xf5, 0x60, 0xb4, 0xa9, 0x57, 0x5b,
-	0x7b, 0x8f, 0x2f, 0x01, 0x23, 0x8d, 0x25, 0x06, 0xd4, 0x64, 0x2b, 0x95, 0x07, 0xe4, 0xfc, 0xc8,
-	0x55, 0xd6, 0x0e, 0xe3, 0x8f, 0x60, 0xa8, 0x9a, 0xb0, 0xb1, 0x4e, 0xf4, 0x49, 0xed, 0x88, 0xce,
-	0x9a, 0x0a, 0xc5, 0x20, 0x67, 0x8b, 0x81, 0xa4, 0x3a, 0x6a, 0x1a, 0x95, 0x16, 0x43, 0x6a, 0x4b,
-	0x75, 0xbc, 0xbf, 0x55, 0x0e, 0xeb, 0x20, 0x46, 0xe4, 0xa0, 0xa3, 0x78, 0xf6, 0xda, 0x68, 0x2f,
-	0xd2, 0x3c, 0x59, 0x24, 0x92, 0x6a, 0x3e, 0x85, 0xa4, 0x71, 0xa5, 0xc8, 0x68, 0x50, 0x2c, 0xf9,
-	0x39, 0x0c, 0x82, 0x09, 0x25, 0x0a, 0x20, 0xad, 0x85, 0xa8, 0x6e, 0x95, 0x0b, 0x5e, 0x8c, 0xe9,
-	0x72, 0x0b, 0x3c, 0x87, 0xb1, 0x46, 0x5f, 0x60, 0xad, 0x55, 0x1d, 0xbc, 0x78, 0x40, 0xe3, 0x8e,
-	0x25, 0xf2, 0x8c, 0xb7, 0x41, 0x9c, 0x76, 0xef, 0xc3, 0xdb, 0x10, 0xfd, 0x79, 0xdb, 0xb8, 0x02,
-	0xc5, 0x84, 0x5e, 0xd2, 0x51, 0x9c, 0xe1, 0x0b, 0xeb, 0x50, 0x9c, 0x51, 0x9f, 0x16, 0xe6, 0x5f,
-	0x19, 0xe5, 0x1a, 0xff, 0xe3, 0x51, 0xae, 0x19, 0xe5, 0x7a, 0x0e, 0x03, 0x8d, 0xa5, 0xda, 0x51,
-	0xaa, 0x03, 0xd9, 0x42, 0x4c, 0xbb, 0x70, 0xa8, 0x62, 0xda, 0x09, 0xe9, 0x07, 0x8c, 0xe7, 0xaf,
-	0x95, 0xab, 0x14, 0x05, 0x9b, 0xc8, 0x16, 0xa2, 0xaa, 0xd6, 0xb6, 0x09, 0x14, 0x6c, 0x26, 0x5b,
-	0xe0, 0x4f, 0x21, 0xf3, 0xcd, 0xba, 0x32, 0x21, 0xf6, 0x19, 0xd2, 0xab, 0xff, 0x0b, 0xf3, 0x4f,
-	0x70, 0xd6, 0x2d, 0x44, 0x65, 0xb5, 0xb9, 0x32, 0xa8, 0xef, 0xfc, 0xf4, 0x67, 0x00, 0xd5, 0xce,
-	0xdf, 0x94, 0xab, 0x2b, 0x53, 0x1e, 0xd6, 0x31, 0x23, 0xe5, 0x9d, 0x29, 0x91, 0x3f, 0x81, 0x16,
-	0xe2, 0xc6, 0x90, 0xcf, 0x53, 0x99, 0x92, 0x70, 0x61, 0xfd, 0x9b, 0xe9, 0x8f, 0xfd, 0x8c, 0xfd,
-	0xdc, 0xcf, 0xd8, 0xef, 0xfd, 0x8c, 0x7d, 0xfb, 0x33, 0x3b, 0x59, 0x0f, 0x69, 0x5f, 0x5f, 0xfd,
-	0x0d, 0x00, 0x00, 0xff, 0xff, 0xb6, 0x1b, 0xe8, 0xa1, 0x23, 0x03, 0x00, 0x00,
+	// 633 bytes of a gzipped FileDescriptorProto
+	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0x6c, 0x93, 0xcf, 0x6e, 0xd3, 0x4c,
+	0x14, 0xc5, 0xeb, 0x38, 0x49, 0xe3, 0x49, 0x9b, 0xe6, 0x1b, 0x55, 0x9f, 0x46, 0x05, 0xa2, 0xe0,
+	0x0d, 0x59, 0x45, 0xa8, 0x2c, 0x59, 0x51, 0x09, 0xb6, 0x54, 0x53, 0x58, 0x22, 0x33, 0xf1, 0xdc,
+	0xb6, 0x43, 0x6c, 0x4f, 0x3a, 0x33, 0x96, 0xda, 0xe7, 0x60, 0xc3, 0x8e, 0x97, 0x61, 0xc1, 0x92,
+	0x0d, 0x7b, 0x54, 0x5e, 0x04, 0xdd, 0x6b, 0xbb, 0x0d, 0x2a, 0xab, 0xce, 0xef, 0x74, 0xe6, 0xfe,
+	0x39, 0x3e, 0x61, 0x93, 0x4a, 0x05, 0x9f, 0x95, 0xfe, 0x62, 0xb9, 0x71, 0x36, 0x58, 0x3e, 0xa2,
+	0x3f, 0xb9, 0x2d, 0xd2, 0xaf, 0x11, 0xfb, 0xef, 0xb2, 0xca, 0xec, 0xea, 0x13, 0xe4, 0x21, 0x73,
+	0x70, 0x55, 0x83, 0x0f, 0x7c, 0xc2, 0x7a, 0x46, 0x8b, 0x68, 0x1e, 0x2d, 0x62, 0xd9, 0x33, 0x9a,
+	0x1f, 0xb1, 0x51, 0xed, 0xc1, 0x55, 0xaa, 0x04, 0xd1, 0x9b, 0x47, 0x8b, 0x44, 0xde, 0x31, 0x7f,
+	0xc9, 0xfa, 0xe1, 0x66, 0x03, 0x22, 0x9e, 0x47, 0x8b, 0xc9, 0xf1, 0xb3, 0x65, 0x57, 0x7a, 0xf9,
+	0xa0, 0xec, 0xb2, 0x45, 0xbc, 0x2e, 0xe9, 0x51, 0xfa, 0x94, 0x8d, 0xb7, 0x44, 0x3e, 0x62, 0xfd,
+	0xd3, 0xb7, 0x67, 0xef, 0xa6, 0x3b, 0x78, 0x7a, 0x7f, 0xf6, 0x5a, 0x4e, 0xa3, 0xf4, 0x67, 0x8f,
+	0xed, 0x5e, 0x56, 0xd9, 0xc6, 0xfe, 0x63, 0x2e, 0xc1, 0x76, 0x35, 0x14, 0x10, 0x40, 0xd3, 0x58,
+	0x23, 0xd9, 0x21, 0xe7, 0x5b, 0x53, 0x25, 0x4d, 0x33, 0xfe, 0x3f, 0x1b, 0xaa, 0x3a, 0x5c, 0x5a,
+	0x27, 0xfa, 0xa4, 0xb6, 0x44, 0x77, 0x4d, 0x09, 0x62, 0x30, 0x8f, 0x16, 0x03, 0x49, 0x67, 0xd4,
+	0x34, 0x28, 0x2d, 0x86, 0x54, 0x96, 0xce, 0xf8, 0x7e, 0xa3, 0x1c, 0x54, 0x41, 0xec, 0xd2, 0x04,
+	0x2d, 0xe1, 0xdd, 0xb5, 0xd1, 0x5e, 0x8c, 0xe6, 0xf1, 0x22, 0x96, 0x74, 0xe6, 0x53, 0x16, 0xd7,
+	0xae, 0x10, 0x09, 0x35, 0xc2, 0x23, 0x3f, 0x64, 0x83, 0x60, 0x42, 0x01, 0x82, 0x91, 0xd6, 0x00,
+	0xaa, 0x1b, 0xe5, 0x82, 0x17, 0x63, 0x7a, 0xdc, 0x00, 0x9f, 0xb3, 0xb1, 0x06, 0x9f, 0x43, 0xa5,
+	0x55, 0x15, 0xbc, 0xd8, 0xa3, 0x76, 0xdb, 0x12, 0xcd, 0x0c, 0xd7, 0x41, 0xec, 0xb7, 0xfb, 0xc1,
+	0x75, 0xc0, 0xf9, 0xbc, 0xad, 0x5d, 0x0e, 0x62, 0x42, 0x9b, 0xb4, 0x84, 0x3d, 0x7c, 0x6e, 0x1d,
+	0x88, 0x03, 0xaa, 0xd3, 0x40, 0xfa, 0x39, 0x22, 0x5f, 0xf1, 0x3b, 0x6e, 0xf9, 0x9a, 0x90, 0xaf,
+	0x87, 0x6c, 0xa0, 0xa1, 0x50, 0x37, 0xe4, 0xea, 0x40, 0x36, 0x80, 0x6e, 0xe7, 0x0e, 0x14, 0xba,
+	0x1d, 0x93, 0xde, 0x21, 0xde, 0x5f, 0x2b, 0x57, 0x2a, 0x32, 0x36, 0x96, 0x0d, 0xa0, 0xaa, 0x56,
+	0xb6, 0x0e, 0x64, 0x6c, 0x22, 0x1b, 0xe0, 0x8f, 0x59, 0xe2, 0xeb, 0x55, 0x69, 0x02, 0xd6, 0x19,
+	0xd2, 0xd6, 0xf7, 0x42, 0xfa, 0x81, 0x1d, 0xb4, 0x81, 0x28, 0xad, 0x36, 0xe7, 0x06, 0xf4, 0x83,
+	0x8f, 0xfe, 0x84, 0xb1, 0xf2, 0xc6, 0x5f, 0x15, 0xd9, 0xb9, 0x29, 0xba, 0x38, 0x26, 0xa4, 0xbc,
+	0x31, 0x05, 0xf0, 0x47, 0xac, 0x01, 0x4c, 0x0c, 0xcd, 0xb9, 0x2f, 0x47, 0x24, 0x9c, 0x5a, 0x9f,
+	0x7e, 0x8b, 0xd0, 0x59, 0xa5, 0xb3, 0x02, 0x42, 0x00, 0x87, 0x2b, 0xf9, 0x9a, 0xfa, 0xb5, 0xdb,
+	0x77, 0x88, 0x91, 0xcf, 0x6d, 0xe5, 0xeb, 0x12, 0x5c, 0x17, 0xf9, 0x8e, 0xf1, 0x7f, 0x1e, 0x23,
+	0x5d, 0xe5, 0x4d, 0xc0, 0xfa, 0xf2, 0x8e, 0x71, 0x3d, 0x0c, 0x90, 0x0f, 0xaa, 0xdc, 0xb4, 0x76,
+	0xdc, 0x0b, 0x14, 0x2b, 0x15, 0x14, 0x39, 0xb2, 0x27, 0xe9, 0x8c, 0x36, 0x81, 0x73, 0xd6, 0x51,
+	0xd6, 0x12, 0xd9, 0x00, 0xae, 0x71, 0xae, 0x4c, 0x01, 0x3a, 0x53, 0x5d, 0xde, 0x46, 0x8d, 0xf0,
+	0x2a, 0xa4, 0x1f, 0xd9, 0xd4, 0xa9, 0x00, 0x59, 0x61, 0x4a, 0x13, 0xb2, 0xda, 0xab, 0x0b, 0xc0,
+	0xa1, 0x4c, 0xe5, 0x83, 0xc2, 0xa1, 0x9a, 0x5d, 0xee, 0x98, 0x3f, 0x67, 0x83, 0xa0, 0xd6, 0x50,
+	0x89, 0xde, 0x3c, 0x5e, 0x8c, 0x8f, 0x8f, 0xee, 0x7f, 0xa4, 0x5b, 0x65, 0xe8, 0x86, 0x6c, 0x2e,
+	0xa6, 0x27, 0x7f, 0x75, 0x20, 0x0d, 0xf3, 0xb5, 0xaa, 0xf3, 0x35, 0x74, 0x5e, 0xb5, 0x84, 0x7a,
+	0xb0, 0x6b, 0xa8, 0x3c, 0x19, 0x15, 0xc9, 0x96, 0x4e, 0xa6, 0xdf, 0x6f, 0x67, 0xd1, 0x8f, 0xdb,
+	0x59, 0xf4, 0xeb, 0x76, 0x16, 0x7d, 0xf9, 0x3d, 0xdb, 0x59, 0x0d, 0xa9, 0xef, 0x8b, 0x3f, 0x03,
+	0x00, 0x93, 0xc4, 0x81, 0x8f, 0x90, 0x04, 0x00, 0x00,
 }
@@ -12,4 +12,10 @@ const (
 
 	// ObjectsModified subject for requesting objects from hacker news
 	ObjectsModified string = "objects.modified"
+
+	// RateLimitUsage subject where api instances share the tokens taken from their rate limit buckets
+	RateLimitUsage string = "api.rate-limit-usage"
+
+	// DeadLetterPrefix prefix of the subjects where each consumer publishes messages it can never process
+	DeadLetterPrefix string = "dead-letter."
 )
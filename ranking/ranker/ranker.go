@@ -0,0 +1,209 @@
+// Package ranker maintains the cached listings from the objects.modified stream
+package ranker
+
+import (
+	"context"
+	"reflect"
+	"sort"
+	"time"
+
+	"github.com/gogo/protobuf/proto"
+	"github.com/kabergstrom/site/db"
+	"github.com/kabergstrom/site/monitor"
+	"github.com/kabergstrom/site/protocol"
+	"github.com/kabergstrom/site/protocol/deadletter"
+	"github.com/kabergstrom/site/protocol/subjects"
+	"github.com/nats-io/go-nats-streaming"
+	"github.com/nats-io/go-nats-streaming/pb"
+	"github.com/ngaut/log"
+	"github.com/pkg/errors"
+)
+
+const (
+	// DefaultWindow how long modified objects are buffered before listings are updated
+	DefaultWindow = time.Second * 5
+	// DefaultMaxInFlight max number of unacked modifications, also the max window size
+	DefaultMaxInFlight = 4096
+)
+
+// Ranker updates listings in batches of modified objects
+type Ranker struct {
+	stan     stan.Conn
+	objects  db.ObjectStore
+	listings db.ListingStore
+
+	// Window how long modified objects are buffered before listings are updated
+	Window time.Duration
+	// MaxInFlight max number of unacked modifications, also the max window size
+	MaxInFlight int
+}
+
+// New create a Ranker reading objects from objects and writing to listings
+func New(sc stan.Conn, objects db.ObjectStore, listings db.ListingStore) *Ranker {
+	return &Ranker{
+		stan:        sc,
+		objects:     objects,
+		listings:    listings,
+		Window:      DefaultWindow,
+		MaxInFlight: DefaultMaxInFlight,
+	}
+}
+
+// HotSort orders objects by descending total score
+type HotSort []db.Object
+
+func (a HotSort) Len() int      { return len(a) }
+func (a HotSort) Swap(i, j int) { a[i], a[j] = a[j], a[i] }
+func (a HotSort) Less(i, j int) bool {
+	return a[i].Score+a[i].SourceScore > a[j].Score+a[j].SourceScore
+}
+
+// NewSort orders objects by descending creation time
+type NewSort []db.Object
+
+func (a NewSort) Len() int      { return len(a) }
+func (a NewSort) Swap(i, j int) { a[i], a[j] = a[j], a[i] }
+func (a NewSort) Less(i, j int) bool {
+	return a[i].UnixTime > a[j].UnixTime
+}
+
+func (r *Ranker) updateCaches(objectsChanged []int64, listingType int, sortFunc func(values []db.Object) sort.Interface) error {
+
+	listing, err := r.listings.GetListing(listingType)
+	if err != nil {
+		if err != db.ErrNotFound {
+			return errors.Wrapf(err, "Error getting listing with id %d", listingType)
+		}
+		err = nil
+	}
+	allObjects := make(map[int64]bool, len(listing.Objects)+len(objectsChanged))
+	for _, val := range listing.Objects {
+		allObjects[val] = true
+	}
+	for _, val := range objectsChanged {
+		allObjects[val] = true
+	}
+	ids := make([]int64, 0, len(allObjects))
+	for val := range allObjects {
+		ids = append(ids, val)
+	}
+	objects, err := r.objects.GetObjects(ids)
+	if err != nil {
+		return errors.Wrapf(err, "Error getting objects for listing %d", listingType)
+	}
+	dbObjects := make([]db.Object, 0, len(objects))
+	for _, obj := range objects {
+		switch obj.Type {
+		case protocol.LinkPost, protocol.TextPost, protocol.Job, protocol.Poll:
+			dbObjects = append(dbObjects, obj)
+		}
+	}
+	sort.Sort(sortFunc(dbObjects))
+	listingSize := len(dbObjects)
+	if listingSize > db.MaxListingSize {
+		listingSize = db.MaxListingSize
+	}
+	var newListing db.Listing
+	newListing.Objects = make([]int64, listingSize)
+	for i, val := range dbObjects[:listingSize] {
+		newListing.Objects[i] = val.ID
+	}
+	if reflect.DeepEqual(listing.Objects, newListing.Objects) {
+		// the listing version only changes with the order of the listing
+		return nil
+	}
+	if err := r.listings.SetListing(listingType, newListing); err != nil {
+		return errors.Wrapf(err, "Error setting lising %d", listingType)
+	}
+	return nil
+}
+
+// Run consume objects.modified and update listings until ctx is done. The modifications
+// buffered when ctx is done are written before Run returns
+func (r *Ranker) Run(ctx context.Context, durableName string) error {
+	objModChannel := make(chan *stan.Msg)
+	aw := time.Second * 30
+	sub, err := r.stan.Subscribe(subjects.ObjectsModified, func(m *stan.Msg) {
+		select {
+		case objModChannel <- m:
+		case <-ctx.Done():
+		}
+	}, stan.SetManualAckMode(), stan.AckWait(aw), stan.DurableName(durableName), stan.StartAt(pb.StartPosition_First), stan.MaxInflight(r.MaxInFlight))
+	if err != nil {
+		return err
+	}
+	defer sub.Close()
+
+	type modMsg struct {
+		msg         *stan.Msg
+		objModified int64
+		received    time.Time
+	}
+	ticker := time.NewTimer(r.Window)
+	defer ticker.Stop()
+	var windowBuffer []modMsg
+	// flush update the listings with the buffered modifications and ack them
+	flush := func() error {
+		start := time.Now()
+		objectsChanged := make([]int64, len(windowBuffer))
+		for i, val := range windowBuffer {
+			objectsChanged[i] = val.objModified
+		}
+		err := r.updateCaches(objectsChanged, db.ListingHot, func(data []db.Object) sort.Interface { return HotSort(data) })
+		if err != nil {
+			return err
+		}
+		monitor.Ranked("hot", start)
+		newStart := time.Now()
+		err = r.updateCaches(objectsChanged, db.ListingNew, func(data []db.Object) sort.Interface { return NewSort(data) })
+		if err != nil {
+			return err
+		}
+		monitor.Ranked("new", newStart)
+		for _, val := range windowBuffer {
+			val.msg.Ack()
+			// the latency of a modification includes the time it waited for the window
+			monitor.MessageProcessed(val.msg.Subject, monitor.ResultOK, val.received)
+		}
+		log.Infof("Sorted ranking for %d objects in %s\n", len(objectsChanged), time.Now().Sub(start).String())
+		windowBuffer = windowBuffer[:0]
+		return nil
+	}
+	for {
+		select {
+		case <-ctx.Done():
+			// stop deliveries before the last window is flushed, so every buffered modification is acked
+			if err := sub.Close(); err != nil {
+				log.Errorf("Error closing subscription %s: %s", durableName, err)
+			}
+			if len(windowBuffer) == 0 {
+				return nil
+			}
+			return flush()
+		case m := <-objModChannel:
+			received := time.Now()
+			var mod protocol.ObjectModified
+			if err := proto.Unmarshal(m.Data, &mod); err != nil {
+				err = errors.Wrap(err, "Malformed object modification")
+				log.Errorf("Moving modification %d to %s: %s", m.Sequence, deadletter.Subject(durableName), err)
+				if err := deadletter.Publish(r.stan, deadletter.FromStan(durableName, m, err)); err != nil {
+					// not acked, so it is redelivered and dead lettered again
+					log.Error(err)
+					continue
+				}
+				m.Ack()
+				monitor.MessageProcessed(m.Subject, monitor.ResultDeadLetter, received)
+				continue
+			}
+			windowBuffer = append(windowBuffer, modMsg{msg: m, objModified: mod.Id, received: received})
+			if len(windowBuffer) == r.MaxInFlight {
+				ticker.Reset(0)
+			}
+		case <-ticker.C:
+			if err := flush(); err != nil {
+				return err
+			}
+			ticker.Reset(r.Window)
+		}
+	}
+}
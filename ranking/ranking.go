@@ -1,135 +1,27 @@
 package main
 
 import (
+	"context"
 	"os"
-	"time"
 
-	"github.com/ngaut/log"
-
-	"strconv"
-
-	"sort"
-
-	"github.com/pkg/errors"
-
-	"github.com/gogo/protobuf/proto"
 	"github.com/kabergstrom/site/db"
-	"github.com/kabergstrom/site/protocol"
-	"github.com/kabergstrom/site/protocol/subjects"
+	"github.com/kabergstrom/site/lifecycle"
+	"github.com/kabergstrom/site/monitor"
+	"github.com/kabergstrom/site/ranking/ranker"
 	"github.com/nats-io/go-nats-streaming"
-	"github.com/nats-io/go-nats-streaming/pb"
-	"github.com/rainycape/memcache"
+	"github.com/ngaut/log"
 )
 
-type rankingCtx struct {
-	stan      stan.Conn
-	mcObj     *memcache.Client
-	mcListing *memcache.Client
-}
-
-type HotSort []db.Object
-
-func (a HotSort) Len() int           { return len(a) }
-func (a HotSort) Swap(i, j int)      { a[i], a[j] = a[j], a[i] }
-func (a HotSort) Less(i, j int) bool { return a[i].Score+a[i].SourceScore > a[j].Score+a[j].SourceScore }
-
-func (r *rankingCtx) updateCaches(objectsChanged []int64, listingType int, sortFunc func(values []db.Object) sort.Interface) error {
-
-	listingItem, err := r.mcListing.Get(strconv.Itoa(listingType))
-	var listing db.Listing
-	if err != nil {
-		if err.Error() != "memcache: cache miss" {
-			return errors.Wrapf(err, "Error getting listing with id %d", listingType)
-		}
-		err = nil
-	} else {
-		err = proto.Unmarshal(listingItem.Value, &listing)
-		if err != nil {
-			return errors.Wrapf(err, "Error unmarshaling listing of type %d", listingType)
-		}
-	}
-	allObjects := make(map[int64]bool, len(listing.Objects)+len(objectsChanged))
-	for _, val := range listing.Objects {
-		allObjects[val] = true
-	}
-	for _, val := range objectsChanged {
-		allObjects[val] = true
-	}
-	dbObjects := make([]db.Object, len(allObjects))
-	i := len(allObjects)
-	for val := range allObjects {
-		i--
-		item, err := r.mcObj.Get(strconv.FormatInt(val, 10))
-		if err != nil {
-			if err.Error() == "memcache: cache miss" {
-				dbObjects = append(dbObjects[:i],
-					dbObjects[i+1:]...)
-				continue
-			}
-			return errors.Wrapf(err, "Error getting object with id %d", val)
-		}
-		obj, err := db.ParseMemCacheObj(item.Value)
-		if err != nil {
-			return errors.Wrapf(err, "Error parsing object with id %d", val)
-		}
-		switch obj.Type {
-		case protocol.LinkPost:
-		case protocol.TextPost:
-		case protocol.Job:
-		case protocol.Poll:
-			break
-		default:
-			dbObjects = append(dbObjects[:i],
-				dbObjects[i+1:]...)
-			continue
-		}
-		dbObjects[i] = obj
-	}
-	sort.Sort(sortFunc(dbObjects))
-	listingSize := len(dbObjects)
-	if listingSize > db.MaxListingSize {
-		listingSize = db.MaxListingSize
-	}
-	var newListing db.Listing
-	newListing.Objects = make([]int64, listingSize)
-	for i, val := range dbObjects[:listingSize] {
-		newListing.Objects[i] = val.ID
-	}
-	bytes, err := proto.Marshal(&newListing)
-	if err != nil {
-		return errors.Wrapf(err, "Error serializing lising %d", listingType)
-	}
-	err = r.mcListing.Set(&memcache.Item{
-		Key:   strconv.Itoa(listingType),
-		Value: bytes,
-	})
-	if err != nil {
-		return errors.Wrapf(err, "Error setting lising %d", listingType)
-	}
-	return nil
-}
-
-func openMemcachedView(url string, viewName string) (*memcache.Client, error) {
-	mc, err := memcache.New(url)
-	if err != nil {
-		return nil, err
-	}
-	if _, err := mc.Get("@@" + viewName); err != nil {
-		return nil, err
-	}
-	return mc, err
-}
-
 func main() {
 	log.SetFlags(log.LstdFlags | log.Lshortfile)
-	memcacheAddr := os.Getenv("MEMCACHE_ADDRESS")
-	mcObj, err := openMemcachedView(memcacheAddr, "object_data")
-	if err != nil {
-		log.Fatalf("Failed to connect to MySQL memcache plugin on %s : %s", memcacheAddr, err)
+	backend := os.Getenv("STORE_BACKEND")
+	storeAddr := os.Getenv("MEMCACHE_ADDRESS")
+	if backend == db.BackendSQL {
+		storeAddr = os.Getenv("MYSQL_DATA_SOURCE_NAME")
 	}
-	mcListing, err := openMemcachedView(memcacheAddr, "listing_data")
+	store, err := db.OpenStore(backend, storeAddr)
 	if err != nil {
-		log.Fatalf("Failed to connect to MySQL memcache plugin on %s : %s", memcacheAddr, err)
+		log.Fatalf("Failed to open %s store: %s", backend, err)
 	}
 
 	clusterID := os.Getenv("NATS_CLUSTER_ID")
@@ -151,52 +43,28 @@ func main() {
 	for _, server := range nc.NatsConn().DiscoveredServers() {
 		log.Infof("Discovered nats server %s", server)
 	}
-	defer nc.Close()
-	objModChannel := make(chan *stan.Msg)
 
-	ranking := rankingCtx{
-		stan:      nc,
-		mcObj:     mcObj,
-		mcListing: mcListing,
+	mon := monitor.NewServer()
+	mon.AddCheck("nats", monitor.NATSConnected(nc.NatsConn()))
+	if p, ok := store.(db.Pinger); ok {
+		mon.AddCheck("store", p.Ping)
 	}
 
-	aw := time.Second * 30
-	maxInFlight := 4096
-	nc.Subscribe(subjects.ObjectsModified, func(m *stan.Msg) { objModChannel <- m }, stan.SetManualAckMode(), stan.AckWait(aw), stan.DurableName("ranking"), stan.StartAt(pb.StartPosition_First), stan.MaxInflight(maxInFlight))
-
-	type modMsg struct {
-		msg         *stan.Msg
-		objModified int64
+	lc := lifecycle.New()
+	lc.Go("Monitoring", func(ctx context.Context) error {
+		return mon.Serve(ctx, monitor.Addr("", "MONITOR_PORT", monitor.RankingPort))
+	})
+	r := ranker.New(nc, store, store)
+	lc.Go("Ranking", func(ctx context.Context) error {
+		return r.Run(ctx, "ranking")
+	})
+	<-lc.Done()
+	lc.Wait(lifecycle.DefaultTimeout)
+	if err := nc.Close(); err != nil {
+		log.Errorf("Error closing nats-streaming connection: %s", err)
 	}
-	ticker := time.NewTimer(time.Second * 5)
-	var windowBuffer []modMsg
-	for {
-		select {
-		case m := <-objModChannel:
-			var mod protocol.ObjectModified
-			if err := proto.Unmarshal(m.Data, &mod); err != nil {
-				log.Fatal(err)
-			}
-			windowBuffer = append(windowBuffer, modMsg{msg: m, objModified: mod.Id})
-			if len(windowBuffer) == maxInFlight {
-				ticker.Reset(0)
-			}
-		case <-ticker.C:
-			start := time.Now()
-			objectsChanged := make([]int64, len(windowBuffer))
-			for i, val := range windowBuffer {
-				objectsChanged[i] = val.objModified
-			}
-			err := ranking.updateCaches(objectsChanged, db.ListingHot, func(data []db.Object) sort.Interface { return HotSort(data) })
-			if err != nil {
-				log.Fatal(err)
-			}
-			for _, val := range windowBuffer {
-				val.msg.Ack()
-			}
-			log.Infof("Sorted ranking for %d objects in %s\n", len(objectsChanged), time.Now().Sub(start).String())
-			windowBuffer = windowBuffer[:0]
-			ticker.Reset(time.Second * 5)
-		}
+	if err := db.Close(store); err != nil {
+		log.Errorf("Error closing store: %s", err)
 	}
+	lc.Exit()
 }
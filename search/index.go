@@ -0,0 +1,216 @@
+// Package search keeps a full-text index of posts and comments in a bleve index on local disk
+package search
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/blevesearch/bleve"
+	"github.com/blevesearch/bleve/analysis/analyzer/keyword"
+	"github.com/blevesearch/bleve/mapping"
+	"github.com/blevesearch/bleve/search/query"
+	"github.com/kabergstrom/site/db"
+	"github.com/kabergstrom/site/protocol"
+	"github.com/pkg/errors"
+)
+
+const (
+	fieldType    = "type"
+	fieldSource  = "source"
+	fieldCreated = "created"
+)
+
+// Sort order of search results
+type Sort int
+
+const (
+	// SortRelevance best matches first
+	SortRelevance Sort = iota
+	// SortDate newest first
+	SortDate
+)
+
+// ParseSort parse a sort name, relevance or date. An empty name is SortRelevance
+func ParseSort(name string) (Sort, error) {
+	switch name {
+	case "", "relevance":
+		return SortRelevance, nil
+	case "date":
+		return SortDate, nil
+	default:
+		return 0, fmt.Errorf("Unknown sort %s", name)
+	}
+}
+
+// document the indexed fields of an object. type and source are the numeric IDs
+type document struct {
+	Title   string    `json:"title"`
+	Text    string    `json:"text"`
+	URL     string    `json:"url"`
+	Author  string    `json:"author"`
+	Type    string    `json:"type"`
+	Source  string    `json:"source"`
+	Created time.Time `json:"created"`
+}
+
+// Index a full-text index of objects keyed by object ID
+type Index struct {
+	index bleve.Index
+}
+
+func indexMapping() mapping.IndexMapping {
+	text := bleve.NewTextFieldMapping()
+	keywordField := bleve.NewTextFieldMapping()
+	keywordField.Analyzer = keyword.Name
+	keywordField.IncludeInAll = false
+	created := bleve.NewDateTimeFieldMapping()
+	created.IncludeInAll = false
+
+	doc := bleve.NewDocumentMapping()
+	doc.AddFieldMappingsAt("title", text)
+	doc.AddFieldMappingsAt("text", text)
+	doc.AddFieldMappingsAt("url", text)
+	doc.AddFieldMappingsAt("author", text)
+	doc.AddFieldMappingsAt(fieldType, keywordField)
+	doc.AddFieldMappingsAt(fieldSource, keywordField)
+	doc.AddFieldMappingsAt(fieldCreated, created)
+
+	m := bleve.NewIndexMapping()
+	m.DefaultMapping = doc
+	return m
+}
+
+// Open open the index at path, creating it if it does not exist
+func Open(path string) (*Index, error) {
+	index, err := bleve.Open(path)
+	if err == bleve.ErrorIndexPathDoesNotExist {
+		index, err = bleve.New(path, indexMapping())
+	}
+	if err != nil {
+		return nil, errors.Wrapf(err, "Error opening search index %s", path)
+	}
+	return &Index{index: index}, nil
+}
+
+// Close close the index
+func (i *Index) Close() error {
+	return i.index.Close()
+}
+
+// Indexed whether objects of type t are indexed. Only the post types the api serves are indexed
+func Indexed(t protocol.ObjectType) bool {
+	switch t {
+	case protocol.LinkPost, protocol.Comment, protocol.TextPost:
+		return true
+	}
+	return false
+}
+
+// indexable whether obj is a post or comment that is shown and belongs in the index
+func indexable(obj db.Object) bool {
+	return Indexed(obj.Type) && !obj.Deleted && !obj.Data.(*db.Post).Dead
+}
+
+func newDocument(obj db.Object, authors map[int64]string) document {
+	post := obj.Data.(*db.Post)
+	return document{
+		Title:   post.Title,
+		Text:    post.Text,
+		URL:     post.Url,
+		Author:  authors[post.Author],
+		Type:    strconv.Itoa(int(obj.Type)),
+		Source:  strconv.Itoa(int(obj.Source)),
+		Created: time.Unix(int64(obj.UnixTime), 0),
+	}
+}
+
+// Update index objects in one batch. Objects that are not posts or comments, or are deleted or
+// dead, are removed from the index. authors maps author object IDs to names
+func (i *Index) Update(objects []db.Object, authors map[int64]string) error {
+	batch := i.index.NewBatch()
+	for _, obj := range objects {
+		id := strconv.FormatInt(obj.ID, 10)
+		if !indexable(obj) {
+			batch.Delete(id)
+			continue
+		}
+		if err := batch.Index(id, newDocument(obj, authors)); err != nil {
+			return errors.Wrapf(err, "Error indexing object %d", obj.ID)
+		}
+	}
+	return i.index.Batch(batch)
+}
+
+// AuthorNames get the names of the authors of objects, keyed by author object ID
+func AuthorNames(store db.ObjectStore, objects []db.Object) (map[int64]string, error) {
+	var ids []int64
+	for _, obj := range objects {
+		if post, ok := obj.Data.(*db.Post); ok && post.Author != 0 {
+			ids = append(ids, post.Author)
+		}
+	}
+	users, err := store.GetObjects(ids)
+	if err != nil {
+		return nil, errors.Wrap(err, "Error getting authors")
+	}
+	names := make(map[int64]string, len(users))
+	for id, obj := range users {
+		if user, ok := obj.Data.(*db.User); ok {
+			names[id] = user.Name
+		}
+	}
+	return names, nil
+}
+
+// Query a search of the index
+type Query struct {
+	// Text matched against the title, text, URL and author
+	Text string
+	// Type only objects of this type. 0 for any type
+	Type protocol.ObjectType
+	// Source only objects from this source. 0 for any source
+	Source protocol.SourceID
+	Sort   Sort
+	From   int
+	Size   int
+}
+
+// Result object IDs matching a Query
+type Result struct {
+	// Total number of matching objects
+	Total uint64
+	IDs   []int64
+}
+
+// Search run q against the index
+func (i *Index) Search(q Query) (Result, error) {
+	conjuncts := []query.Query{bleve.NewMatchQuery(q.Text)}
+	if q.Type != 0 {
+		term := bleve.NewTermQuery(strconv.Itoa(int(q.Type)))
+		term.SetField(fieldType)
+		conjuncts = append(conjuncts, term)
+	}
+	if q.Source != 0 {
+		term := bleve.NewTermQuery(strconv.Itoa(int(q.Source)))
+		term.SetField(fieldSource)
+		conjuncts = append(conjuncts, term)
+	}
+	req := bleve.NewSearchRequestOptions(bleve.NewConjunctionQuery(conjuncts...), q.Size, q.From, false)
+	if q.Sort == SortDate {
+		req.SortBy([]string{"-" + fieldCreated})
+	}
+	res, err := i.index.Search(req)
+	if err != nil {
+		return Result{}, errors.Wrapf(err, "Error searching for %s", q.Text)
+	}
+	result := Result{Total: res.Total, IDs: make([]int64, 0, len(res.Hits))}
+	for _, hit := range res.Hits {
+		id, err := strconv.ParseInt(hit.ID, 10, 64)
+		if err != nil {
+			return Result{}, errors.Wrapf(err, "Invalid object ID %s in search index", hit.ID)
+		}
+		result.IDs = append(result.IDs, id)
+	}
+	return result, nil
+}
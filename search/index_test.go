@@ -0,0 +1,134 @@
+package search
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+
+	"github.com/kabergstrom/site/db"
+	"github.com/kabergstrom/site/protocol"
+)
+
+// openTestIndex create an index in a temporary directory, which is removed by the returned func
+func openTestIndex(t *testing.T) (*Index, func()) {
+	dir, err := ioutil.TempDir("", "search")
+	if err != nil {
+		t.Fatal(err)
+	}
+	index, err := Open(filepath.Join(dir, "index"))
+	if err != nil {
+		os.RemoveAll(dir)
+		t.Fatal(err)
+	}
+	return index, func() {
+		index.Close()
+		os.RemoveAll(dir)
+	}
+}
+
+func search(t *testing.T, index *Index, q Query) []int64 {
+	if q.Size == 0 {
+		q.Size = 10
+	}
+	result, err := index.Search(q)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if int(result.Total) != len(result.IDs) {
+		t.Errorf("Search for %+v found %d objects, returned %v", q, result.Total, result.IDs)
+	}
+	return result.IDs
+}
+
+func sorted(ids []int64) []int64 {
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	return ids
+}
+
+func TestSearch(t *testing.T) {
+	store := db.NewMemoryStore()
+	objects := []db.Object{
+		{ID: 1, Source: protocol.HackerNews, Type: protocol.User, Data: &db.User{Name: "alice"}},
+		{ID: 2, Source: protocol.HackerNews, Type: protocol.LinkPost, UnixTime: 1500000000, Data: &db.Post{Author: 1, Title: "A new compiler release", Url: "https://example.com/release"}},
+		{ID: 3, Source: protocol.HackerNews, Type: protocol.TextPost, UnixTime: 1500000010, Data: &db.Post{Title: "Ask: books about compilers", Text: "Which compiler book should I read?"}},
+		{ID: 4, Source: protocol.Site, Type: protocol.Comment, UnixTime: 1500000020, Data: &db.Post{Parent: 3, Text: "The compiler book with the dragon"}},
+		{ID: 5, Source: protocol.HackerNews, Type: protocol.Job, UnixTime: 1500000030, Data: &db.Post{Title: "Hiring a compiler engineer"}},
+		{ID: 6, Source: protocol.HackerNews, Type: protocol.LinkPost, UnixTime: 1500000040, Deleted: true, Data: &db.Post{Title: "Deleted compiler post"}},
+	}
+	for _, obj := range objects {
+		obj.Compression, obj.Encoding = db.None, db.Protobuf
+		if err := store.InsertObject(obj); err != nil {
+			t.Fatal(err)
+		}
+	}
+	index, remove := openTestIndex(t)
+	defer remove()
+	ix := NewIndexer(nil, store, index)
+	if err := ix.update([]int64{1, 2, 3, 4, 5, 6}); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, c := range []struct {
+		name     string
+		q        Query
+		expected []int64
+	}{
+		{"text", Query{Text: "compiler"}, []int64{2, 3, 4}},
+		{"author", Query{Text: "alice"}, []int64{2}},
+		{"url", Query{Text: "release"}, []int64{2}},
+		{"type", Query{Text: "compiler", Type: protocol.Comment}, []int64{4}},
+		{"source", Query{Text: "compiler", Source: protocol.HackerNews}, []int64{2, 3}},
+		{"type and source", Query{Text: "compiler", Type: protocol.Comment, Source: protocol.HackerNews}, []int64{}},
+	} {
+		if ids := sorted(search(t, index, c.q)); !reflect.DeepEqual(ids, c.expected) {
+			t.Errorf("%s: found %v, expected %v", c.name, ids, c.expected)
+		}
+	}
+	if ids := search(t, index, Query{Text: "compiler", Sort: SortDate}); !reflect.DeepEqual(ids, []int64{4, 3, 2}) {
+		t.Errorf("Sorted by date %v, expected newest first", ids)
+	}
+	if ids := search(t, index, Query{Text: "compiler", Sort: SortDate, From: 1, Size: 1}); !reflect.DeepEqual(ids, []int64{3}) {
+		t.Errorf("Second page %v", ids)
+	}
+
+	// an edit is reindexed and a dead post is removed
+	edited, version, err := store.GetObjectVersion(2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	edited.Data = &db.Post{Author: 1, Title: "A new linker release"}
+	if err := store.UpdateSourceObject(edited, version); err != nil {
+		t.Fatal(err)
+	}
+	dead, version, err := store.GetObjectVersion(4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dead.Data = &db.Post{Parent: 3, Text: "The compiler book with the dragon", Dead: true}
+	if err := store.UpdateSourceObject(dead, version); err != nil {
+		t.Fatal(err)
+	}
+	if err := ix.update([]int64{2, 4}); err != nil {
+		t.Fatal(err)
+	}
+	if ids := sorted(search(t, index, Query{Text: "compiler"})); !reflect.DeepEqual(ids, []int64{3}) {
+		t.Errorf("After update found %v, expected [3]", ids)
+	}
+	if ids := search(t, index, Query{Text: "linker"}); !reflect.DeepEqual(ids, []int64{2}) {
+		t.Errorf("Edited post found as %v", ids)
+	}
+}
+
+func TestParseSort(t *testing.T) {
+	for name, expected := range map[string]Sort{"": SortRelevance, "relevance": SortRelevance, "date": SortDate} {
+		if s, err := ParseSort(name); err != nil || s != expected {
+			t.Errorf("Parsed %q as %d: %v", name, s, err)
+		}
+	}
+	if _, err := ParseSort("score"); err == nil {
+		t.Error("Parsed unknown sort")
+	}
+}
@@ -0,0 +1,143 @@
+package search
+
+import (
+	"context"
+	"time"
+
+	"github.com/gogo/protobuf/proto"
+	"github.com/kabergstrom/site/db"
+	"github.com/kabergstrom/site/protocol"
+	"github.com/kabergstrom/site/protocol/deadletter"
+	"github.com/kabergstrom/site/protocol/subjects"
+	"github.com/nats-io/go-nats-streaming"
+	"github.com/nats-io/go-nats-streaming/pb"
+	"github.com/ngaut/log"
+	"github.com/pkg/errors"
+)
+
+const (
+	// DefaultWindow how long modified objects are buffered before they are indexed
+	DefaultWindow = time.Second
+	// DefaultMaxInFlight max number of unacked modifications, also the max batch size
+	DefaultMaxInFlight = 1024
+
+	// retryBackoff initial wait before a failed batch is indexed again. Doubles with each failure
+	retryBackoff = time.Second
+	// maxRetryBackoff max wait between attempts to index a failed batch
+	maxRetryBackoff = time.Minute
+)
+
+// Indexer keeps an Index up to date with the objects.modified stream
+type Indexer struct {
+	stan    stan.Conn
+	objects db.ObjectStore
+	index   *Index
+
+	// Window how long modified objects are buffered before they are indexed
+	Window time.Duration
+	// MaxInFlight max number of unacked modifications, also the max batch size
+	MaxInFlight int
+}
+
+// NewIndexer create an Indexer reading objects from objects
+func NewIndexer(sc stan.Conn, objects db.ObjectStore, index *Index) *Indexer {
+	return &Indexer{
+		stan:        sc,
+		objects:     objects,
+		index:       index,
+		Window:      DefaultWindow,
+		MaxInFlight: DefaultMaxInFlight,
+	}
+}
+
+func (ix *Indexer) update(objectIDs []int64) error {
+	objects, err := ix.objects.GetObjects(objectIDs)
+	if err != nil {
+		return errors.Wrap(err, "Error getting modified objects")
+	}
+	modified := make([]db.Object, 0, len(objects))
+	for _, obj := range objects {
+		modified = append(modified, obj)
+	}
+	authors, err := AuthorNames(ix.objects, modified)
+	if err != nil {
+		return err
+	}
+	return ix.index.Update(modified, authors)
+}
+
+// Run consume objects.modified and index the modified objects until ctx is done
+func (ix *Indexer) Run(ctx context.Context, durableName string) error {
+	objModChannel := make(chan *stan.Msg)
+	aw := time.Second * 30
+	sub, err := ix.stan.Subscribe(subjects.ObjectsModified, func(m *stan.Msg) {
+		select {
+		case objModChannel <- m:
+		case <-ctx.Done():
+		}
+	}, stan.SetManualAckMode(), stan.AckWait(aw), stan.DurableName(durableName), stan.StartAt(pb.StartPosition_First), stan.MaxInflight(ix.MaxInFlight))
+	if err != nil {
+		return err
+	}
+	defer sub.Close()
+
+	ticker := time.NewTimer(ix.Window)
+	defer ticker.Stop()
+	var msgs []*stan.Msg
+	var objectIDs []int64
+	// buffered sequences of msgs, so a modification redelivered while its batch is retried is kept once
+	buffered := make(map[uint64]bool)
+	var backoff time.Duration
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case m := <-objModChannel:
+			var mod protocol.ObjectModified
+			if err := proto.Unmarshal(m.Data, &mod); err != nil {
+				err = errors.Wrap(err, "Malformed object modification")
+				log.Errorf("Moving modification %d to %s: %s", m.Sequence, deadletter.Subject(durableName), err)
+				if err := deadletter.Publish(ix.stan, deadletter.FromStan(durableName, m, err)); err != nil {
+					log.Error(err)
+					continue
+				}
+				m.Ack()
+				continue
+			}
+			if buffered[m.Sequence] {
+				continue
+			}
+			buffered[m.Sequence] = true
+			msgs = append(msgs, m)
+			objectIDs = append(objectIDs, mod.Id)
+			if len(msgs) >= ix.MaxInFlight && backoff == 0 {
+				ticker.Reset(0)
+			}
+		case <-ticker.C:
+			if len(msgs) > 0 {
+				start := time.Now()
+				if err := ix.update(objectIDs); err != nil {
+					// the batch is kept and indexed again, so a store outage does not stop the api
+					backoff *= 2
+					if backoff == 0 {
+						backoff = retryBackoff
+					} else if backoff > maxRetryBackoff {
+						backoff = maxRetryBackoff
+					}
+					log.Errorf("Error indexing %d objects, retrying in %s: %s", len(objectIDs), backoff, err)
+					ticker.Reset(backoff)
+					continue
+				}
+				backoff = 0
+				for _, m := range msgs {
+					m.Ack()
+				}
+				log.Infof("Indexed %d objects in %s\n", len(objectIDs), time.Now().Sub(start).String())
+				msgs = msgs[:0]
+				objectIDs = objectIDs[:0]
+				buffered = make(map[uint64]bool)
+			}
+			ticker.Reset(ix.Window)
+		}
+	}
+}